@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+
+	"github.com/CovenantSQL/CovenantSQL/api/models"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func init() {
+	rpc.RegisterMethod("bp_getAccount", bpGetAccount, bpGetAccountParams{})
+}
+
+type bpGetAccountParams struct {
+	Address string `json:"address"`
+}
+
+func (params *bpGetAccountParams) Validate() error {
+	return validateAddress("account", params.Address)
+}
+
+func bpGetAccount(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpGetAccountParams)
+	model := models.AccountsModel{}
+	return model.GetAccount(params.Address)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/hex"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	dhrpc "github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/pkg/errors"
+)
+
+var (
+	// requestBP sends a DH-RPC request to the block producers on behalf of the API clients.
+	requestBP = dhrpc.RequestBP
+)
+
+// SetRequestBP sets the DH-RPC caller to the block producers, mostly for test.
+func SetRequestBP(fn func(method string, req interface{}, resp interface{}) error) {
+	requestBP = fn
+}
+
+func validateAddress(name, addr string) error {
+	if _, err := hash.NewHashFromStr(addr); err != nil {
+		return errors.Errorf("invalid %s address %q", name, addr)
+	}
+	return nil
+}
+
+func validateDatabaseID(id string) error {
+	var dbID = proto.DatabaseID(id)
+	if _, err := dbID.AccountAddress(); err != nil {
+		return errors.Errorf("invalid database id %q", id)
+	}
+	return nil
+}
+
+func validateHex(name, s string) error {
+	if _, err := hex.DecodeString(s); err != nil || s == "" {
+		return errors.Errorf("invalid %s %q", name, s)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CovenantSQL/CovenantSQL/api/models"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func init() {
+	rpc.RegisterMethod("bp_getDatabase", bpGetDatabase, bpGetDatabaseParams{})
+	rpc.RegisterMethod("bp_getDatabaseList", bpGetDatabaseList, bpGetDatabaseListParams{})
+}
+
+type bpGetDatabaseParams struct {
+	ID string `json:"id"`
+}
+
+func (params *bpGetDatabaseParams) Validate() error {
+	return validateDatabaseID(params.ID)
+}
+
+func bpGetDatabase(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpGetDatabaseParams)
+	model := models.DatabasesModel{}
+	return model.GetDatabase(params.ID)
+}
+
+type bpGetDatabaseListParams struct {
+	Owner string `json:"owner"`
+	User  string `json:"user"`
+	Page  int    `json:"page"`
+	Size  int    `json:"size"`
+}
+
+func (params *bpGetDatabaseListParams) Validate() error {
+	switch {
+	case params.Owner != "" && params.User != "":
+		return errors.New("either owner or user is required, not both")
+	case params.Owner != "":
+		if err := validateAddress("owner", params.Owner); err != nil {
+			return err
+		}
+	case params.User != "":
+		if err := validateAddress("user", params.User); err != nil {
+			return err
+		}
+	default:
+		return errors.New("either owner or user is required")
+	}
+	if params.Size > 1000 {
+		return errors.New("max size is 1000")
+	}
+	return nil
+}
+
+// BPGetDatabaseListResponse is the response for method bp_getDatabaseList.
+type BPGetDatabaseListResponse struct {
+	Databases  []*models.Database `json:"databases"`
+	Pagination *models.Pagination `json:"pagination"`
+}
+
+func bpGetDatabaseList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpGetDatabaseListParams)
+	model := models.DatabasesModel{}
+	dbs, pagination, err := model.GetDatabaseList(params.Owner, params.User, params.Page, params.Size)
+	if err != nil {
+		return nil, err
+	}
+	result = &BPGetDatabaseListResponse{
+		Databases:  dbs,
+		Pagination: pagination,
+	}
+	return result, nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+// AccountsModel groups operations on Accounts.
+type AccountsModel struct{}
+
+// Account is the confirmed state of an account.
+type Account struct {
+	Address  string            `json:"address"`
+	Balances map[string]uint64 `json:"balances"` // token name -> balance
+	Rating   float64           `json:"rating"`
+	Nonce    uint64            `json:"nonce"` // next nonce
+}
+
+// GetAccount get an account by its address.
+func (m *AccountsModel) GetAccount(addr string) (account *Account, err error) {
+	var (
+		enc []byte
+		dec = &types.Account{}
+	)
+	err = chaindb.Db.QueryRow(`SELECT encoded FROM accounts WHERE address = ?`, addr).Scan(&enc)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = utils.DecodeMsgPack(enc, dec); err != nil {
+		return nil, err
+	}
+	account = &Account{
+		Address:  dec.Address.String(),
+		Balances: make(map[string]uint64),
+		Rating:   float64(dec.Rating) / float64(types.RatingUnit),
+		Nonce:    uint64(dec.NextNonce),
+	}
+	for i := types.TokenType(0); i < types.SupportTokenNumber; i++ {
+		account.Balances[i.String()] = dec.TokenBalance[i]
+	}
+	return account, nil
+}
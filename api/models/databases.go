@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+// DatabasesModel groups operations on Databases.
+type DatabasesModel struct{}
+
+// Database is the confirmed profile of a database.
+type Database struct {
+	ID                string           `json:"id"`
+	Address           string           `json:"address"`
+	Owner             string           `json:"owner"`
+	GasPrice          uint64           `json:"gas_price"`
+	TokenType         string           `json:"token_type"`
+	LastUpdatedHeight uint32           `json:"last_updated_height"`
+	Miners            []*DatabaseMiner `json:"miners"`
+	Users             []*DatabaseUser  `json:"users"`
+}
+
+// DatabaseMiner is a miner of a database.
+type DatabaseMiner struct {
+	Address        string `json:"address"`
+	NodeID         string `json:"node_id"`
+	Deposit        uint64 `json:"deposit"`
+	PendingIncome  uint64 `json:"pending_income"`
+	ReceivedIncome uint64 `json:"received_income"`
+	Status         int32  `json:"status"`
+}
+
+// DatabaseUser is a user of a database.
+type DatabaseUser struct {
+	Address        string `json:"address"`
+	Permission     int32  `json:"permission"`
+	AdvancePayment uint64 `json:"advance_payment"`
+	Arrears        uint64 `json:"arrears"`
+	Deposit        uint64 `json:"deposit"`
+	Status         int32  `json:"status"`
+}
+
+func newDatabase(profile *types.SQLChainProfile) (db *Database) {
+	db = &Database{
+		ID:                string(profile.ID),
+		Address:           profile.Address.String(),
+		Owner:             profile.Owner.String(),
+		GasPrice:          profile.GasPrice,
+		TokenType:         profile.TokenType.String(),
+		LastUpdatedHeight: profile.LastUpdatedHeight,
+	}
+	for _, v := range profile.Miners {
+		db.Miners = append(db.Miners, &DatabaseMiner{
+			Address:        v.Address.String(),
+			NodeID:         string(v.NodeID),
+			Deposit:        v.Deposit,
+			PendingIncome:  v.PendingIncome,
+			ReceivedIncome: v.ReceivedIncome,
+			Status:         int32(v.Status),
+		})
+	}
+	for _, v := range profile.Users {
+		db.Users = append(db.Users, &DatabaseUser{
+			Address:        v.Address.String(),
+			Permission:     int32(v.Permission),
+			AdvancePayment: v.AdvancePayment,
+			Arrears:        v.Arrears,
+			Deposit:        v.Deposit,
+			Status:         int32(v.Status),
+		})
+	}
+	return
+}
+
+// GetDatabase get a database by its id.
+func (m *DatabasesModel) GetDatabase(id string) (db *Database, err error) {
+	var (
+		enc []byte
+		dec = &types.SQLChainProfile{}
+	)
+	err = chaindb.Db.QueryRow(`SELECT encoded FROM shardChain WHERE id = ?`, id).Scan(&enc)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = utils.DecodeMsgPack(enc, dec); err != nil {
+		return nil, err
+	}
+	return newDatabase(dec), nil
+}
+
+// GetDatabaseList get a list of databases owned by owner, or used by user if owner is empty.
+func (m *DatabasesModel) GetDatabaseList(owner, user string, page, size int) (
+	dbs []*Database, pagination *Pagination, err error,
+) {
+	var (
+		querySQL, countSQL string
+		args               []interface{}
+	)
+
+	pagination = NewPagination(page, size)
+
+	// The profiles are encoded, so that they are filtered with the database index
+	if owner != "" {
+		querySQL = `
+		SELECT s.encoded FROM shardChain s
+		INNER JOIN indexed_databases d ON s.id = d.id
+		WHERE d.owner = ?`
+		countSQL = `SELECT COUNT(*) FROM indexed_databases WHERE owner = ?`
+		args = append(args, owner)
+	} else {
+		querySQL = `
+		SELECT s.encoded FROM shardChain s
+		INNER JOIN indexed_database_users u ON s.id = u.database_id
+		WHERE u.user = ?`
+		countSQL = `SELECT COUNT(*) FROM indexed_database_users WHERE user = ?`
+		args = append(args, user)
+	}
+
+	count, err := chaindb.SelectInt(countSQL, args...)
+	if err != nil {
+		return nil, pagination, err
+	}
+	pagination.SetTotal(int(count))
+	if pagination.Offset() > pagination.Total {
+		return dbs, pagination, nil
+	}
+
+	querySQL += " ORDER BY s.id LIMIT ? OFFSET ?"
+	args = append(args, pagination.Limit(), pagination.Offset())
+
+	rows, err := chaindb.Db.Query(querySQL, args...)
+	if err != nil {
+		return nil, pagination, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			enc []byte
+			dec = &types.SQLChainProfile{}
+		)
+		if err = rows.Scan(&enc); err != nil {
+			return nil, pagination, err
+		}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return nil, pagination, err
+		}
+		dbs = append(dbs, newDatabase(dec))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, pagination, err
+	}
+	return dbs, pagination, nil
+}
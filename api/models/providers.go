@@ -0,0 +1,87 @@
+package models
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+// ProvidersModel groups operations on Providers.
+type ProvidersModel struct{}
+
+// Provider is a miner providing service with its resources.
+type Provider struct {
+	Address       string   `json:"address"`
+	NodeID        string   `json:"node_id"`
+	Space         uint64   `json:"space"`
+	Memory        uint64   `json:"memory"`
+	LoadAvgPerCPU float64  `json:"load_avg_per_cpu"`
+	TargetUsers   []string `json:"target_users"`
+	Deposit       uint64   `json:"deposit"`
+	GasPrice      uint64   `json:"gas_price"`
+	TokenType     string   `json:"token_type"`
+	Labels        []string `json:"labels"` // key=value
+}
+
+// GetProviderList get a list of providers ordered by address.
+func (m *ProvidersModel) GetProviderList(page, size int) (
+	providers []*Provider, pagination *Pagination, err error,
+) {
+	var (
+		querySQL = `
+		SELECT
+			encoded
+		FROM
+			provider
+		`
+		countSQL = buildCountSQL(querySQL)
+	)
+
+	pagination = NewPagination(page, size)
+	count, err := chaindb.SelectInt(countSQL)
+	if err != nil {
+		return nil, pagination, err
+	}
+	pagination.SetTotal(int(count))
+	if pagination.Offset() > pagination.Total {
+		return providers, pagination, nil
+	}
+
+	querySQL += " ORDER BY address"
+	querySQL += " LIMIT ? OFFSET ?"
+	rows, err := chaindb.Db.Query(querySQL, pagination.Limit(), pagination.Offset())
+	if err != nil {
+		return nil, pagination, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			enc []byte
+			dec = &types.ProviderProfile{}
+		)
+		if err = rows.Scan(&enc); err != nil {
+			return nil, pagination, err
+		}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return nil, pagination, err
+		}
+		var p = &Provider{
+			Address:       dec.Provider.String(),
+			NodeID:        string(dec.NodeID),
+			Space:         dec.Space,
+			Memory:        dec.Memory,
+			LoadAvgPerCPU: dec.LoadAvgPerCPU,
+			Deposit:       dec.Deposit,
+			GasPrice:      dec.GasPrice,
+			TokenType:     dec.TokenType.String(),
+		}
+		for _, v := range dec.TargetUser {
+			p.TargetUsers = append(p.TargetUsers, v.String())
+		}
+		for _, v := range dec.Labels {
+			p.Labels = append(p.Labels, v.String())
+		}
+		providers = append(providers, p)
+	}
+	return providers, pagination, rows.Err()
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CovenantSQL/CovenantSQL/api/models"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func init() {
+	rpc.RegisterMethod("bp_getProviderList", bpGetProviderList, bpGetProviderListParams{})
+}
+
+type bpGetProviderListParams struct {
+	Page int `json:"page"`
+	Size int `json:"size"`
+}
+
+func (params *bpGetProviderListParams) Validate() error {
+	if params.Size > 1000 {
+		return errors.New("max size is 1000")
+	}
+	return nil
+}
+
+// BPGetProviderListResponse is the response for method bp_getProviderList.
+type BPGetProviderListResponse struct {
+	Providers  []*models.Provider `json:"providers"`
+	Pagination *models.Pagination `json:"pagination"`
+}
+
+func bpGetProviderList(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpGetProviderListParams)
+	model := models.ProvidersModel{}
+	providers, pagination, err := model.GetProviderList(params.Page, params.Size)
+	if err != nil {
+		return nil, err
+	}
+	result = &BPGetProviderListResponse{
+		Providers:  providers,
+		Pagination: pagination,
+	}
+	return result, nil
+}
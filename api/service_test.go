@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,12 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/api"
 	"github.com/CovenantSQL/CovenantSQL/api/models"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
 
 	"github.com/gorilla/websocket"
@@ -60,6 +67,36 @@ var (
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__timestamp" ON "indexed_transactions" ("timestamp" DESC);`,
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__tx_type__timestamp" ON "indexed_transactions" ("tx_type", "timestamp" DESC);`,
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__address__timestamp" ON "indexed_transactions" ("address", "timestamp" DESC);`,
+
+		`CREATE TABLE IF NOT EXISTS "accounts" (
+			"address"	TEXT,
+			"encoded"	BLOB,
+			UNIQUE ("address")
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS "shardChain" (
+			"address"	TEXT,
+			"id"		TEXT,
+			"encoded"	BLOB,
+			UNIQUE ("address", "id")
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS "provider" (
+			"address"	TEXT,
+			"encoded"	BLOB,
+			UNIQUE ("address")
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS "indexed_databases" (
+			"id"		TEXT PRIMARY KEY,
+			"owner"		TEXT
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS "indexed_database_users" (
+			"database_id"	TEXT,
+			"user"			TEXT,
+			PRIMARY KEY ("database_id", "user")
+		);`,
 	}
 
 	blocksMockData = [][]interface{}{
@@ -90,6 +127,51 @@ var (
 		{10, 1, "5MX357EQDlMUxZVPjjXeFQ", "er05e7FvAZOP3gP5_w_RKw", 1546591421791893744, 4, addrB, `{}`},
 		{10, 2, "lXTWT_P7NRxMHukZCEUfng", "er05e7FvAZOP3gP5_w_RKw", 1546591421909181774, 2, addrB, `{}`},
 	}
+
+	stateAddrs  = []proto.AccountAddress{{0x1}, {0x2}, {0x3}, {0x4}}
+	minerNodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111")
+	otherNodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000002222")
+
+	accountsMockData = []*types.Account{
+		{Address: stateAddrs[0], TokenBalance: [types.SupportTokenNumber]uint64{100, 10}, NextNonce: 3},
+		{Address: stateAddrs[1], Rating: types.RatingUnit * 4 / 5},
+	}
+
+	databasesMockData = []*types.SQLChainProfile{
+		{
+			ID:     proto.FromAccountAndNonce(stateAddrs[0], 1),
+			Owner:  stateAddrs[0],
+			Miners: []*types.MinerInfo{{Address: stateAddrs[2], NodeID: minerNodeID, Deposit: 10}},
+			Users: []*types.SQLChainUser{
+				{Address: stateAddrs[0], Permission: types.Admin},
+				{Address: stateAddrs[1], Permission: types.Read},
+			},
+		},
+		{
+			ID:     proto.FromAccountAndNonce(stateAddrs[0], 2),
+			Owner:  stateAddrs[0],
+			Miners: []*types.MinerInfo{{Address: stateAddrs[2], NodeID: minerNodeID, Deposit: 10}},
+			Users:  []*types.SQLChainUser{{Address: stateAddrs[0], Permission: types.Admin}},
+		},
+		{
+			ID:     proto.FromAccountAndNonce(stateAddrs[1], 1),
+			Owner:  stateAddrs[1],
+			Miners: []*types.MinerInfo{{Address: stateAddrs[2], NodeID: minerNodeID, Deposit: 10}},
+			Users:  []*types.SQLChainUser{{Address: stateAddrs[1], Permission: types.Admin}},
+		},
+	}
+
+	providersMockData = []*types.ProviderProfile{
+		{
+			Provider: stateAddrs[2],
+			NodeID:   minerNodeID,
+			Space:    1 << 30,
+			Memory:   1 << 20,
+			Deposit:  10,
+			Labels:   types.Labels{{Key: types.LabelOperator, Value: "acme"}},
+		},
+		{Provider: stateAddrs[3], NodeID: otherNodeID, TargetUser: []proto.AccountAddress{stateAddrs[0]}},
+	}
 )
 
 func mockData(t *testing.T) {
@@ -129,6 +211,51 @@ func mockData(t *testing.T) {
 	); err != nil {
 		t.Errorf("mock data for indexed_transactions failed: %v", err)
 	}
+
+	var insertObject = func(writeSQL string, obj interface{}, keys ...interface{}) error {
+		enc, err := utils.EncodeMsgPack(obj)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(writeSQL, append(keys, enc.Bytes())...)
+		return err
+	}
+	for _, v := range accountsMockData {
+		if err := insertObject(
+			"insert into accounts values (?,?)", v, v.Address.String(),
+		); err != nil {
+			t.Errorf("mock data for accounts failed: %v", err)
+		}
+	}
+	for _, v := range databasesMockData {
+		if v.Address, err = v.ID.AccountAddress(); err != nil {
+			t.Errorf("mock data for shardChain failed: %v", err)
+		}
+		if err := insertObject(
+			"insert into shardChain values (?,?,?)", v, v.Address.String(), string(v.ID),
+		); err != nil {
+			t.Errorf("mock data for shardChain failed: %v", err)
+		}
+		if _, err := db.Exec(
+			"insert into indexed_databases values (?,?)", string(v.ID), v.Owner.String(),
+		); err != nil {
+			t.Errorf("mock data for indexed_databases failed: %v", err)
+		}
+		for _, u := range v.Users {
+			if _, err := db.Exec(
+				"insert into indexed_database_users values (?,?)", string(v.ID), u.Address.String(),
+			); err != nil {
+				t.Errorf("mock data for indexed_database_users failed: %v", err)
+			}
+		}
+	}
+	for _, v := range providersMockData {
+		if err := insertObject(
+			"insert into provider values (?,?)", v, v.Provider.String(),
+		); err != nil {
+			t.Errorf("mock data for provider failed: %v", err)
+		}
+	}
 }
 
 func setupWebsocketClient(addr string) (client *jsonrpc2.Conn, err error) {
@@ -557,4 +684,176 @@ func TestJSONRPCService(t *testing.T) {
 			rpc.Close()
 		})
 	})
+
+	Convey("state API", t, func() {
+		rpc, err := setupWebsocketClient(addr)
+		if err != nil {
+			t.Errorf("failed to connect to wsapi server: %v", err)
+			return
+		}
+
+		Convey("bp_getAccount should fetch account on existed address", func() {
+			var result *models.Account
+			err := rpc.Call(context.Background(), "bp_getAccount",
+				[]interface{}{stateAddrs[0].String()}, &result)
+			So(err, ShouldBeNil)
+			So(result.Address, ShouldEqual, stateAddrs[0].String())
+			So(result.Nonce, ShouldEqual, 3)
+			So(result.Balances[types.Particle.String()], ShouldEqual, 100)
+			So(result.Balances[types.Wave.String()], ShouldEqual, 10)
+
+			result = nil
+			err = rpc.Call(context.Background(), "bp_getAccount",
+				[]interface{}{stateAddrs[1].String()}, &result)
+			So(err, ShouldBeNil)
+			So(result.Rating, ShouldEqual, 0.8)
+
+			result = nil
+			err = rpc.Call(context.Background(), "bp_getAccount",
+				[]interface{}{stateAddrs[3].String()}, &result)
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+
+			err = rpc.Call(context.Background(), "bp_getAccount", []interface{}{"invalid"}, &result)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("bp_getDatabase should fetch database on existed id", func() {
+			var result *models.Database
+			err := rpc.Call(context.Background(), "bp_getDatabase",
+				[]interface{}{string(databasesMockData[0].ID)}, &result)
+			So(err, ShouldBeNil)
+			So(result.ID, ShouldEqual, string(databasesMockData[0].ID))
+			So(result.Owner, ShouldEqual, stateAddrs[0].String())
+			So(result.Miners, ShouldHaveLength, 1)
+			So(result.Miners[0].Address, ShouldEqual, stateAddrs[2].String())
+			So(result.Users, ShouldHaveLength, 2)
+
+			result = nil
+			err = rpc.Call(context.Background(), "bp_getDatabase",
+				[]interface{}{string(proto.FromAccountAndNonce(stateAddrs[3], 1))}, &result)
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+
+			err = rpc.Call(context.Background(), "bp_getDatabase", []interface{}{"invalid"}, &result)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("bp_getDatabaseList should fetch databases by owner or user", func() {
+			var result *api.BPGetDatabaseListResponse
+			err := rpc.Call(context.Background(), "bp_getDatabaseList",
+				[]interface{}{stateAddrs[0].String(), "", 1, 10}, &result)
+			So(err, ShouldBeNil)
+			So(result.Databases, ShouldHaveLength, 2)
+			So(result.Pagination.Total, ShouldEqual, 2)
+			for _, v := range result.Databases {
+				So(v.Owner, ShouldEqual, stateAddrs[0].String())
+			}
+
+			err = rpc.Call(context.Background(), "bp_getDatabaseList",
+				[]interface{}{"", stateAddrs[1].String(), 1, 1}, &result)
+			So(err, ShouldBeNil)
+			So(result.Databases, ShouldHaveLength, 1)
+			So(result.Pagination.Total, ShouldEqual, 2)
+			So(result.Pagination.Pages, ShouldEqual, 2)
+
+			for _, params := range [][]interface{}{
+				{"", "", 1, 10},
+				{stateAddrs[0].String(), stateAddrs[1].String(), 1, 10},
+				{"invalid", "", 1, 10},
+				{stateAddrs[0].String(), "", 1, 1001},
+			} {
+				err = rpc.Call(context.Background(), "bp_getDatabaseList", params, &result)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("bp_getProviderList should fetch providers", func() {
+			var result *api.BPGetProviderListResponse
+			err := rpc.Call(context.Background(), "bp_getProviderList", []interface{}{1, 10}, &result)
+			So(err, ShouldBeNil)
+			So(result.Providers, ShouldHaveLength, 2)
+			So(result.Providers[0].Address, ShouldEqual, stateAddrs[2].String())
+			So(result.Providers[0].Space, ShouldEqual, 1<<30)
+			So(result.Providers[0].Labels, ShouldResemble, []string{"operator=acme"})
+			So(result.Providers[1].TargetUsers, ShouldResemble, []string{stateAddrs[0].String()})
+
+			err = rpc.Call(context.Background(), "bp_getProviderList", []interface{}{1, 1001}, &result)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			rpc.Close()
+		})
+	})
+
+	Convey("chain API", t, func() {
+		rpc, err := setupWebsocketClient(addr)
+		if err != nil {
+			t.Errorf("failed to connect to wsapi server: %v", err)
+			return
+		}
+		var requests []interface{}
+		api.SetRequestBP(func(method string, req interface{}, resp interface{}) error {
+			requests = append(requests, req)
+			switch method {
+			case route.MCCQueryTxState.String():
+				resp.(*types.QueryTxStateResp).State = pi.TransactionStatePacked
+			case route.MCCAddTx.String():
+			default:
+				return errors.New("unexpected method")
+			}
+			return nil
+		})
+
+		Convey("bp_sendTransaction should send signed transaction to block producers", func() {
+			priv, _, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			var tx = types.NewTransfer(&types.TransferHeader{
+				Sender:   stateAddrs[0],
+				Receiver: stateAddrs[1],
+				Amount:   1,
+			})
+			So(tx.Sign(priv), ShouldBeNil)
+			enc, err := utils.EncodeMsgPack(tx)
+			So(err, ShouldBeNil)
+
+			var result *api.BPSendTransactionResponse
+			err = rpc.Call(context.Background(), "bp_sendTransaction",
+				[]interface{}{hex.EncodeToString(enc.Bytes())}, &result)
+			So(err, ShouldBeNil)
+			So(result.Hash, ShouldEqual, tx.Hash().String())
+			So(requests, ShouldHaveLength, 1)
+			So(requests[0].(*types.AddTxReq).Tx.Hash(), ShouldResemble, tx.Hash())
+
+			tx.Amount = 2
+			enc, err = utils.EncodeMsgPack(tx)
+			So(err, ShouldBeNil)
+			for _, params := range [][]interface{}{
+				{hex.EncodeToString(enc.Bytes())},
+				{"invalid"},
+				{""},
+			} {
+				err = rpc.Call(context.Background(), "bp_sendTransaction", params, &result)
+				So(err, ShouldNotBeNil)
+			}
+			So(requests, ShouldHaveLength, 1)
+		})
+
+		Convey("bp_getTransactionState should query transaction state from block producers", func() {
+			var result *api.BPGetTransactionStateResponse
+			var h = databasesMockData[0].Address.String()
+			err := rpc.Call(context.Background(), "bp_getTransactionState", []interface{}{h}, &result)
+			So(err, ShouldBeNil)
+			So(result.Hash, ShouldEqual, h)
+			So(result.State, ShouldEqual, pi.TransactionStatePacked.String())
+
+			err = rpc.Call(context.Background(), "bp_getTransactionState", []interface{}{"invalid"}, &result)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			rpc.Close()
+		})
+	})
 }
@@ -2,10 +2,16 @@ package api
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 
 	"github.com/CovenantSQL/CovenantSQL/api/models"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
@@ -13,6 +19,8 @@ func init() {
 	rpc.RegisterMethod("bp_getTransactionList", bpGetTransactionList, bpGetTransactionListParams{})
 	rpc.RegisterMethod("bp_getTransactionByHash", bpGetTransactionByHash, bpGetTransactionByHashParams{})
 	rpc.RegisterMethod("bp_getTransactionListOfBlock", bpGetTransactionListOfBlock, bpGetTransactionListOfBlockParams{})
+	rpc.RegisterMethod("bp_getTransactionState", bpGetTransactionState, bpGetTransactionStateParams{})
+	rpc.RegisterMethod("bp_sendTransaction", bpSendTransaction, bpSendTransactionParams{})
 }
 
 type bpGetTransactionListParams struct {
@@ -93,3 +101,78 @@ func bpGetTransactionByHash(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 	model := models.TransactionsModel{}
 	return model.GetTransactionByHash(params.Hash)
 }
+
+type bpGetTransactionStateParams struct {
+	Hash string `json:"hash"`
+}
+
+func (params *bpGetTransactionStateParams) Validate() error {
+	if _, err := hash.NewHashFromStr(params.Hash); err != nil {
+		return fmt.Errorf("invalid transaction hash %q", params.Hash)
+	}
+	return nil
+}
+
+// BPGetTransactionStateResponse is the response for method bp_getTransactionState.
+type BPGetTransactionStateResponse struct {
+	Hash  string `json:"hash"`
+	State string `json:"state"`
+}
+
+func bpGetTransactionState(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpGetTransactionStateParams)
+	var (
+		h, _   = hash.NewHashFromStr(params.Hash)
+		txReq  = &types.QueryTxStateReq{Hash: *h}
+		txResp = &types.QueryTxStateResp{}
+	)
+	if err = requestBP(route.MCCQueryTxState.String(), txReq, txResp); err != nil {
+		return nil, err
+	}
+	result = &BPGetTransactionStateResponse{
+		Hash:  params.Hash,
+		State: txResp.State.String(),
+	}
+	return result, nil
+}
+
+type bpSendTransactionParams struct {
+	Raw string `json:"raw"` // hex encoded msgpack of the signed transaction
+}
+
+func (params *bpSendTransactionParams) Validate() error {
+	return validateHex("transaction", params.Raw)
+}
+
+// BPSendTransactionResponse is the response for method bp_sendTransaction.
+type BPSendTransactionResponse struct {
+	Hash string `json:"hash"`
+}
+
+func bpSendTransaction(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (
+	result interface{}, err error,
+) {
+	params := ctx.Value("_params").(*bpSendTransactionParams)
+	var (
+		enc, _ = hex.DecodeString(params.Raw)
+		tx     pi.Transaction
+	)
+	if err = utils.DecodeMsgPack(enc, &tx); err != nil {
+		return nil, fmt.Errorf("decode transaction failed: %v", err)
+	}
+	if tx == nil {
+		return nil, errors.New("empty transaction")
+	}
+	if err = tx.Verify(); err != nil {
+		return nil, fmt.Errorf("verify transaction failed: %v", err)
+	}
+	if err = requestBP(route.MCCAddTx.String(), &types.AddTxReq{TTL: 1, Tx: tx}, &types.AddTxResp{}); err != nil {
+		return nil, err
+	}
+	result = &BPSendTransactionResponse{
+		Hash: tx.Hash().String(),
+	}
+	return result, nil
+}
@@ -92,13 +92,13 @@ func (n *blockNode) ancestorByCount(c uint32) *blockNode {
 
 // lastIrreversible returns the last irreversible block node with the given confirmations
 // from head n. Especially, the block at count 0, also known as the genesis block,
-// is irreversible.
+// is irreversible, and so is the root block of a fast synchronized chain.
 func (n *blockNode) lastIrreversible(confirm uint32) (irr *blockNode) {
 	var count uint32
 	if n.count > confirm {
 		count = n.count - confirm
 	}
-	for irr = n; irr.count > count; irr = irr.parent {
+	for irr = n; irr.count > count && irr.parent != nil; irr = irr.parent {
 	}
 	return
 }
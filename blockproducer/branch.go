@@ -17,6 +17,7 @@ package blockproducer
 
 import (
 	"bytes"
+	"container/heap"
 	"fmt"
 	"sort"
 	"time"
@@ -35,20 +36,24 @@ type branch struct {
 	preview  *metaState
 	packed   map[hash.Hash]pi.Transaction
 	unpacked map[hash.Hash]pi.Transaction
+	// snapshotInterval is the block count interval of state root commitments, 0 to disable.
+	snapshotInterval uint32
 }
 
 func newBranch(
 	baseNode, headNode *blockNode, baseState *metaState, basePool map[hash.Hash]pi.Transaction,
+	snapshotInterval uint32,
 ) (
 	br *branch, err error,
 ) {
 	var (
 		list = headNode.fetchNodeList(baseNode.count)
 		inst = &branch{
-			head:     headNode,
-			preview:  baseState.makeCopy(),
-			packed:   make(map[hash.Hash]pi.Transaction),
-			unpacked: make(map[hash.Hash]pi.Transaction),
+			head:             headNode,
+			preview:          baseState.makeCopy(),
+			packed:           make(map[hash.Hash]pi.Transaction),
+			unpacked:         make(map[hash.Hash]pi.Transaction),
+			snapshotInterval: snapshotInterval,
 		}
 	)
 	// Copy pool
@@ -74,10 +79,14 @@ func newBranch(
 				return
 			}
 			inst.packed[k] = v
-			// Apply to preview
-			if err = inst.preview.apply(v); err != nil {
+			// Apply to preview, the failed transactions charged with fee are also included
+			if err = inst.preview.apply(v, bn.block.Producer(), bn.height); !isIncluded(err) {
 				return
 			}
+			err = nil
+		}
+		if err = inst.verifySnapshotRoot(bn); err != nil {
+			return
 		}
 	}
 	inst.preview.commit()
@@ -113,9 +122,35 @@ func (b *branch) makeArena() *branch {
 		},
 		packed:   p,
 		unpacked: u,
+
+		snapshotInterval: b.snapshotInterval,
 	}
 }
 
+// isSnapshotCount returns whether the block at count c should commit a snapshot root.
+func (b *branch) isSnapshotCount(c uint32) bool {
+	return b.snapshotInterval > 0 && c > 0 && c%b.snapshotInterval == 0
+}
+
+// verifySnapshotRoot checks the snapshot root in the header of block node n against the
+// preview state, which should be the state right after applying the block.
+func (b *branch) verifySnapshotRoot(n *blockNode) (err error) {
+	if b.snapshotInterval == 0 {
+		return
+	}
+	var expected hash.Hash
+	if b.isSnapshotCount(n.count) {
+		if expected, err = b.preview.stateRoot(); err != nil {
+			return
+		}
+	}
+	if !expected.IsEqual(&n.block.SignedHeader.SnapshotRoot) {
+		err = errors.Wrapf(ErrInvalidSnapshotRoot, "block %s at count %d",
+			n.hash.Short(4), n.count)
+	}
+	return
+}
+
 func (b *branch) addTx(tx pi.Transaction) {
 	var k = tx.Hash()
 	if _, ok := b.packed[k]; !ok {
@@ -149,30 +184,95 @@ func (b *branch) applyBlock(n *blockNode) (br *branch, err error) {
 			return
 		}
 		cpy.packed[k] = v
-		// Apply to preview
-		if err = cpy.preview.apply(v); err != nil {
+		// Apply to preview, the failed transactions charged with fee are also included
+		if err = cpy.preview.apply(v, n.block.Producer(), n.height); !isIncluded(err) {
 			return
 		}
+		err = nil
+	}
+	if err = cpy.verifySnapshotRoot(n); err != nil {
+		return
 	}
 	cpy.head = n
 	br = cpy
 	return
 }
 
+// sortUnpackedTxs returns the unpacked transactions in packing order. The transactions of an
+// account, resolved from their signing keys, keep their nonce order, and the account with the highest fee at its next transaction
+// goes first. At most conf.MaxPackedTxsPerAccount transactions are returned for each account.
 func (b *branch) sortUnpackedTxs() (txs []pi.Transaction) {
-	txs = make([]pi.Transaction, 0, len(b.unpacked))
+	var accounts = make(map[proto.AccountAddress][]pi.Transaction)
 	for _, v := range b.unpacked {
-		txs = append(txs, v)
+		var addr = b.preview.accountOf(v.GetAccountAddress())
+		accounts[addr] = append(accounts[addr], v)
+	}
+	var queues = make(txQueues, 0, len(accounts))
+	for _, v := range accounts {
+		var q = v
+		sort.Slice(q, func(i, j int) bool {
+			if ni, nj := q[i].GetAccountNonce(), q[j].GetAccountNonce(); ni != nj {
+				return ni < nj
+			}
+			if fi, fj := pi.GetTransactionFee(q[i]), pi.GetTransactionFee(q[j]); fi != fj {
+				return fi > fj
+			}
+			var hi, hj = q[i].Hash(), q[j].Hash()
+			return bytes.Compare(hi[:], hj[:]) < 0
+		})
+		if len(q) > conf.MaxPackedTxsPerAccount {
+			q = q[:conf.MaxPackedTxsPerAccount]
+		}
+		queues = append(queues, q)
 	}
-	sort.Slice(txs, func(i, j int) bool {
-		if cmp := bytes.Compare(
-			hash.Hash(txs[i].GetAccountAddress()).AsBytes(),
-			hash.Hash(txs[j].GetAccountAddress()).AsBytes(),
-		); cmp != 0 {
-			return cmp < 0
+	txs = make([]pi.Transaction, 0, len(b.unpacked))
+	heap.Init(&queues)
+	for queues.Len() > 0 {
+		var q = queues[0]
+		txs = append(txs, q[0])
+		if len(q) > 1 {
+			queues[0] = q[1:]
+			heap.Fix(&queues, 0)
+		} else {
+			heap.Pop(&queues)
 		}
-		return txs[i].GetAccountNonce() < txs[j].GetAccountNonce()
-	})
+	}
+	return
+}
+
+// pendingTx returns the unpacked transaction of the account resolved from addr at the given nonce.
+func (b *branch) pendingTx(addr proto.AccountAddress, nonce pi.AccountNonce) (tx pi.Transaction) {
+	addr = b.preview.accountOf(addr)
+	for _, v := range b.unpacked {
+		if v.GetAccountNonce() == nonce && b.preview.accountOf(v.GetAccountAddress()) == addr {
+			return v
+		}
+	}
+	return
+}
+
+// txQueues implements heap.Interface for the per-account transaction queues, ordered by the fee
+// of the queue heads.
+type txQueues [][]pi.Transaction
+
+func (q txQueues) Len() int { return len(q) }
+
+func (q txQueues) Less(i, j int) bool {
+	if fi, fj := pi.GetTransactionFee(q[i][0]), pi.GetTransactionFee(q[j][0]); fi != fj {
+		return fi > fj
+	}
+	var ai, aj = q[i][0].GetAccountAddress(), q[j][0].GetAccountAddress()
+	return bytes.Compare(ai[:], aj[:]) < 0
+}
+
+func (q txQueues) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *txQueues) Push(x interface{}) { *q = append(*q, x.([]pi.Transaction)) }
+
+func (q *txQueues) Pop() (x interface{}) {
+	var old = *q
+	x = old[len(old)-1]
+	*q = old[:len(old)-1]
 	return
 }
 
@@ -195,7 +295,7 @@ func (b *branch) produceBlock(
 	out := make([]pi.Transaction, 0, packCount)
 	for _, v := range txs {
 		var k = v.Hash()
-		if ierr = cpy.preview.apply(v); ierr != nil {
+		if ierr = cpy.preview.apply(v, addr, h); !isIncluded(ierr) {
 			continue
 		}
 		delete(cpy.unpacked, k)
@@ -218,6 +318,12 @@ func (b *branch) produceBlock(
 		},
 		Transactions: out,
 	}
+	if cpy.isSnapshotCount(cpy.head.count + 1) {
+		if block.SignedHeader.SnapshotRoot, ierr = cpy.preview.stateRoot(); ierr != nil {
+			err = errors.Wrap(ierr, "failed to compute snapshot root")
+			return
+		}
+	}
 	if ierr = block.PackAndSignBlock(signer); ierr != nil {
 		err = errors.Wrap(ierr, "failed to sign block")
 		return
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBranchSortUnpackedTxs(t *testing.T) {
+	Convey("Given a branch with unpacked transactions from several accounts", t, func() {
+		var (
+			err          error
+			priv1, priv2 *asymmetric.PrivateKey
+			addr1, addr2 proto.AccountAddress
+			b            = &branch{
+				preview:  newMetaState(),
+				unpacked: make(map[hash.Hash]pi.Transaction),
+			}
+			add = func(
+				priv *asymmetric.PrivateKey, sender proto.AccountAddress, nonce, fee uint64,
+			) (
+				t *types.Transfer,
+			) {
+				t = types.NewTransfer(&types.TransferHeader{
+					Sender:              sender,
+					Nonce:               pi.AccountNonce(nonce),
+					TransactionFeeMixin: pi.TransactionFeeMixin{Fee: fee},
+				})
+				So(t.Sign(priv), ShouldBeNil)
+				b.addTx(t)
+				return
+			}
+		)
+		priv1, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		priv2, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr1, err = crypto.PubKeyHash(priv1.PubKey())
+		So(err, ShouldBeNil)
+		addr2, err = crypto.PubKeyHash(priv2.PubKey())
+		So(err, ShouldBeNil)
+
+		var (
+			t11 = add(priv1, addr1, 1, 1)
+			t12 = add(priv1, addr1, 2, 10)
+			t21 = add(priv2, addr2, 1, 5)
+			t22 = add(priv2, addr2, 2, 0)
+		)
+		Convey("The transactions should be sorted by fee in account nonce order", func() {
+			So(b.sortUnpackedTxs(), ShouldResemble, []pi.Transaction{t21, t11, t12, t22})
+		})
+		Convey("The pending transaction should be found by account nonce", func() {
+			So(b.pendingTx(addr1, 2), ShouldEqual, t12)
+			So(b.pendingTx(addr2, 3), ShouldBeNil)
+		})
+		Convey("The transactions of a single account should be limited", func() {
+			for i := 3; i < conf.MaxPackedTxsPerAccount+10; i++ {
+				add(priv1, addr1, uint64(i), 1)
+			}
+			var txs = b.sortUnpackedTxs()
+			So(len(txs), ShouldEqual, conf.MaxPackedTxsPerAccount+2)
+		})
+		Convey("The transactions should be grouped by the account of a rotated key", func() {
+			var (
+				priv3 *asymmetric.PrivateKey
+				key3  proto.AccountAddress
+			)
+			priv3, _, err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			key3, err = crypto.PubKeyHash(priv3.PubKey())
+			So(err, ShouldBeNil)
+			b.preview.dirty.keys[key3] = addr1
+			var t13 = add(priv3, key3, 3, 20)
+			So(b.sortUnpackedTxs(), ShouldResemble, []pi.Transaction{t21, t11, t12, t13, t22})
+			So(b.pendingTx(addr1, 3), ShouldEqual, t13)
+			So(b.pendingTx(key3, 2), ShouldEqual, t12)
+		})
+	})
+}
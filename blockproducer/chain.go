@@ -65,6 +65,8 @@ type Chain struct {
 	period      time.Duration
 	tick        time.Duration
 
+	snapshotInterval uint32
+
 	sync.RWMutex // protects following fields
 	bpInfos      []*blockProducerInfo
 	localBPInfo  *blockProducerInfo
@@ -131,11 +133,32 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		return
 	}
 
+	// Bootstrap from a trusted peer snapshot in fast sync mode
+	if !existed && cfg.FastSync {
+		var (
+			snapshot *types.BPSnapshot
+			headers  []*types.BPSignedHeader
+		)
+		if snapshot, headers, ierr = fetchTrustedSnapshot(ctx, rpc.NewCaller(), cfg); ierr != nil {
+			log.WithError(ierr).Warn("failed to fetch snapshot, fall back to full sync")
+		} else if ierr = installSnapshot(st, snapshot, headers); ierr != nil {
+			err = errors.Wrap(ierr, "failed to install snapshot")
+			return
+		} else {
+			log.WithFields(log.Fields{
+				"count":  snapshot.Count,
+				"height": snapshot.Height,
+				"hash":   snapshot.BlockHash.Short(4),
+			}).Info("bootstrapped from snapshot")
+			existed = true
+		}
+	}
+
 	// Create initial state from genesis block and store
 	if !existed {
 		var init = newMetaState()
 		for _, v := range cfg.Genesis.Transactions {
-			if ierr = init.apply(v); ierr != nil {
+			if ierr = init.apply(v, cfg.Genesis.Producer(), 0); ierr != nil {
 				err = errors.Wrap(ierr, "failed to initialize immutable state")
 				return
 			}
@@ -154,6 +177,10 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		err = errors.Wrap(ierr, "failed to load data from storage")
 		return
 	}
+	if ierr = reindexShardChains(st, immutable); ierr != nil {
+		err = errors.Wrap(ierr, "failed to index database profiles")
+		return
+	}
 	for _, v := range heads {
 		log.WithFields(log.Fields{
 			"irre_hash":  irre.hash.Short(4),
@@ -162,7 +189,9 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 			"head_count": v.count,
 		}).Debug("checking head")
 		if v.hasAncestor(irre) {
-			if br, ierr = newBranch(irre, v, immutable, txPool); ierr != nil {
+			if br, ierr = newBranch(
+				irre, v, immutable, txPool, cfg.SnapshotInterval,
+			); ierr != nil {
 				err = errors.Wrapf(ierr, "failed to rebuild branch with head %s", v.hash.Short(4))
 				return
 			}
@@ -222,6 +251,8 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		period:      cfg.Period,
 		tick:        cfg.Tick,
 
+		snapshotInterval: cfg.SnapshotInterval,
+
 		bpInfos:     bpInfos,
 		localBPInfo: localBPInfo,
 		localNodeID: cfg.NodeID,
@@ -490,6 +521,12 @@ func (c *Chain) processAddTxReq(addTxReq *types.AddTxReq) {
 		return
 	}
 
+	// Add to tx pool
+	if err = c.storeTx(tx); err != nil {
+		le.WithError(err).Warn("failed to add transaction")
+		return
+	}
+
 	// Broadcast to other block producers
 	if ttl > conf.MaxTxBroadcastTTL {
 		ttl = conf.MaxTxBroadcastTTL
@@ -497,11 +534,6 @@ func (c *Chain) processAddTxReq(addTxReq *types.AddTxReq) {
 	if ttl > 0 {
 		c.nonblockingBroadcastTx(ttl-1, tx)
 	}
-
-	// Add to tx pool
-	if err = c.storeTx(tx); err != nil {
-		le.WithError(err).Error("failed to add transaction")
-	}
 }
 
 func (c *Chain) processTxs(ctx context.Context) {
@@ -606,7 +638,11 @@ func (c *Chain) syncCurrentHead(ctx context.Context, requiredReachable uint32) (
 }
 
 func (c *Chain) storeTx(tx pi.Transaction) (err error) {
-	var k = tx.Hash()
+	var (
+		k        = tx.Hash()
+		sps      = []storageProcedure{addTx(tx)}
+		replaced pi.Transaction
+	)
 	c.Lock()
 	defer c.Unlock()
 	if _, ok := c.txPool[k]; ok {
@@ -614,7 +650,24 @@ func (c *Chain) storeTx(tx pi.Transaction) (err error) {
 		return
 	}
 
-	return store(c.storage, []storageProcedure{addTx(tx)}, func() {
+	// Replace the pending transaction with the same account nonce by a higher fee one
+	if replaced = c.headBranch.pendingTx(
+		tx.GetAccountAddress(), tx.GetAccountNonce(),
+	); replaced != nil {
+		if pi.GetTransactionFee(tx) <= pi.GetTransactionFee(replaced) {
+			err = ErrUnderpricedTx
+			return
+		}
+		sps = append(sps, deleteTxs([]pi.Transaction{replaced}))
+	}
+
+	return store(c.storage, sps, func() {
+		if replaced != nil {
+			delete(c.txPool, replaced.Hash())
+			for _, v := range c.branches {
+				v.clearUnpackedTxs([]pi.Transaction{replaced})
+			}
+		}
 		c.txPool[k] = tx
 		for _, v := range c.branches {
 			v.addTx(tx)
@@ -634,6 +687,7 @@ func (c *Chain) replaceAndSwitchToBranch(
 
 		resultTxPool = make(map[hash.Hash]pi.Transaction)
 		expiredTxs   []pi.Transaction
+		snapshots    []storageProcedure
 	)
 
 	// Find new irreversible blocks
@@ -650,17 +704,20 @@ func (c *Chain) replaceAndSwitchToBranch(
 	}
 	for _, b := range newIrres {
 		for _, tx := range b.block.Transactions {
-			if err := c.immutable.apply(tx); err != nil {
+			if err := c.immutable.apply(tx, b.block.Producer(), b.height); !isIncluded(err) {
 				log.WithError(err).Fatal("failed to apply block to immutable database")
 			}
 			delete(resultTxPool, tx.Hash()) // Remove confirmed transaction
 		}
+		if c.snapshotInterval > 0 && b.count%c.snapshotInterval == 0 {
+			snapshots = append(snapshots, c.makeSnapshot(b))
+		}
 	}
 
 	// Check tx expiration
 	for k, v := range resultTxPool {
 		if base, err := c.immutable.nextNonce(
-			v.GetAccountAddress(),
+			c.immutable.accountOf(v.GetAccountAddress()),
 		); err != nil || v.GetAccountNonce() < base {
 			log.WithFields(log.Fields{
 				"hash":    k.Short(4),
@@ -686,6 +743,7 @@ func (c *Chain) replaceAndSwitchToBranch(
 		sps = append(sps, deleteTxs(expiredTxs))
 	}
 	sps = append(sps, updateIrreversible(lastIrre.hash))
+	sps = append(sps, snapshots...)
 
 	// Prepare callback to update cache
 	up = func() {
@@ -812,7 +870,9 @@ func (c *Chain) applyBlock(bl *types.BPBlock) (err error) {
 			bl.SignedHeader.ParentHash, c.lastIrre.count,
 		); ok {
 			head = newBlockNode(height, bl, parent)
-			if br, ierr = newBranch(c.lastIrre, head, c.immutable, c.txPool); ierr != nil {
+			if br, ierr = newBranch(
+				c.lastIrre, head, c.immutable, c.txPool, c.snapshotInterval,
+			); ierr != nil {
 				err = errors.Wrapf(ierr, "failed to fork from %s", parent.hash.Short(4))
 				return
 			}
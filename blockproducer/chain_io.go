@@ -17,12 +17,16 @@
 package blockproducer
 
 import (
+	"database/sql"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
 // This file provides methods set for chain state read/write.
@@ -104,6 +108,54 @@ func (c *Chain) fetchBlockByCount(count uint32) (b *types.BPBlock, height uint32
 	return
 }
 
+// fetchHeaders returns the irreversible block headers in the block count range [from, to], at
+// most maxFetchHeaders ones. The headers below the root block of a fast synchronized chain are
+// loaded from the ones saved with the snapshot.
+func (c *Chain) fetchHeaders(from, to uint32) (hs []*types.BPSignedHeader, err error) {
+	var (
+		irre  = c.lastIrreversibleBlock()
+		nodes []*blockNode
+	)
+	if to > irre.count {
+		to = irre.count
+	}
+	if from > to {
+		return
+	}
+	if to-from >= maxFetchHeaders {
+		to = from + maxFetchHeaders - 1
+	}
+	for n := irre.ancestorByCount(to); n != nil; n = n.parent {
+		nodes = append(nodes, n)
+		if n.count <= from {
+			break
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	if root := nodes[len(nodes)-1]; root.count > from {
+		if hs, err = loadHeaders(c.storage, from, root.count-1); err != nil {
+			return
+		}
+		if len(hs) != int(root.count-from) {
+			err = errors.Wrapf(ErrInvalidHeaderChain, "missing headers below count %d",
+				root.count)
+			return
+		}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		var b = nodes[i].block
+		if b == nil {
+			if b, err = c.loadBlock(nodes[i].hash); err != nil {
+				return
+			}
+		}
+		hs = append(hs, &b.SignedHeader)
+	}
+	return
+}
+
 func (c *Chain) nextNonce(addr proto.AccountAddress) (n pi.AccountNonce, err error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -129,10 +181,14 @@ func (c *Chain) loadSQLChainProfile(databaseID proto.DatabaseID) (profile *types
 	return
 }
 
-func (c *Chain) loadSQLChainProfiles(addr proto.AccountAddress) []*types.SQLChainProfile {
+func (c *Chain) loadSQLChainProfiles(
+	addr proto.AccountAddress) (dbs []*types.SQLChainProfile, accounts []*types.Account,
+) {
 	c.RLock()
 	defer c.RUnlock()
-	return c.immutable.loadROSQLChains(addr)
+	dbs = c.immutable.loadROSQLChains(addr)
+	accounts = c.immutable.loadRORotatedAccounts(dbs)
+	return
 }
 
 func (c *Chain) queryTxState(hash hash.Hash) (state pi.TransactionState, err error) {
@@ -159,8 +215,109 @@ func (c *Chain) queryTxState(hash hash.Hash) (state pi.TransactionState, err err
 	return pi.TransactionStateNotFound, nil
 }
 
+func (c *Chain) queryTxProof(h hash.Hash) (
+	height uint32, header *types.BPSignedHeader, proof *merkle.Proof, err error,
+) {
+	var (
+		blockHash string
+		bh        hash.Hash
+		b         *types.BPBlock
+	)
+	if err = c.storage.Reader().QueryRow(
+		`SELECT "block_height", "block_hash" FROM "indexed_transactions" WHERE "hash" = ?`,
+		h.String(),
+	).Scan(&height, &blockHash); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrTransactionNotFound
+		}
+		err = errors.Wrapf(err, "query tx %s", h.String())
+		return
+	}
+	if err = hash.Decode(&bh, blockHash); err != nil {
+		return
+	}
+	if b, err = c.loadBlock(bh); err != nil {
+		err = errors.Wrapf(err, "load block %s", blockHash)
+		return
+	}
+	if proof, err = b.TxProof(&h); err != nil {
+		return
+	}
+	header = &b.SignedHeader
+	return
+}
+
+// queryInvoices returns the UpdateBilling transactions of the database in the main chain blocks
+// bounded by the heights from and to, to 0 means no upper bound.
+func (c *Chain) queryInvoices(
+	dbID proto.DatabaseID, from, to uint32) (invoices []*types.Invoice, err error,
+) {
+	var (
+		receiver proto.AccountAddress
+		rows     *sql.Rows
+		head     = c.head()
+		blocks   = make(map[hash.Hash]*types.BPBlock)
+	)
+	if receiver, err = dbID.AccountAddress(); err != nil {
+		return
+	}
+	if to == 0 || to > head.height {
+		to = head.height
+	}
+	if rows, err = c.storage.Reader().Query(
+		`SELECT "block_height", "tx_index", "block_hash" FROM "indexed_transactions"
+		WHERE "tx_type" = ? AND "block_height" BETWEEN ? AND ?
+		ORDER BY "block_height", "tx_index"`,
+		uint32(pi.TransactionTypeUpdateBilling), from, to,
+	); err != nil {
+		err = errors.Wrap(err, "query indexed billings")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			height    uint32
+			index     int
+			blockHash string
+			bh        hash.Hash
+		)
+		if err = rows.Scan(&height, &index, &blockHash); err != nil {
+			return
+		}
+		if err = hash.Decode(&bh, blockHash); err != nil {
+			return
+		}
+		var b, ok = blocks[bh]
+		if !ok {
+			// Skip the stale index of the blocks which are not in the current branch
+			if node := head.ancestor(height); node != nil && node.hash.IsEqual(&bh) {
+				if b, err = c.loadBlock(bh); err != nil {
+					err = errors.Wrapf(err, "load block %s", blockHash)
+					return
+				}
+			}
+			blocks[bh] = b
+		}
+		if b == nil || index >= len(b.Transactions) {
+			continue
+		}
+		var ub, isBilling = b.Transactions[index].(*types.UpdateBilling)
+		if !isBilling || ub.Receiver != receiver {
+			continue
+		}
+		invoices = append(invoices, &types.Invoice{
+			Hash:      ub.Hash(),
+			Height:    height,
+			Timestamp: b.Timestamp(),
+			Billing:   ub.UpdateBillingHeader,
+		})
+	}
+	err = rows.Err()
+	return
+}
+
 func (c *Chain) immutableNextNonce(addr proto.AccountAddress) (n pi.AccountNonce, err error) {
 	c.RLock()
 	defer c.RUnlock()
-	return c.immutable.nextNonce(addr)
+	return c.immutable.nextNonce(c.immutable.accountOf(addr))
 }
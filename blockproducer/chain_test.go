@@ -215,6 +215,27 @@ func TestChain(t *testing.T) {
 				err = chain.storeTx(t1)
 				So(err, ShouldEqual, ErrExistedTx)
 			})
+			Convey("The chain should replace pending transaction by a higher fee one", func() {
+				var r1, r2 *types.Transfer
+				r1, err = newTransfer(nonce, priv1, addr1, addr2, 2)
+				So(err, ShouldBeNil)
+				err = chain.storeTx(r1)
+				So(err, ShouldEqual, ErrUnderpricedTx)
+				r2 = types.NewTransfer(&types.TransferHeader{
+					Sender:              addr1,
+					Receiver:            addr2,
+					Nonce:               nonce,
+					TransactionFeeMixin: pi.TransactionFeeMixin{Fee: 1},
+					Amount:              2,
+				})
+				err = r2.Sign(priv1)
+				So(err, ShouldBeNil)
+				err = chain.storeTx(r2)
+				So(err, ShouldBeNil)
+				So(chain.txPool, ShouldNotContainKey, t1.Hash())
+				So(chain.txPool, ShouldContainKey, r2.Hash())
+				So(chain.headBranch.pendingTx(addr1, nonce), ShouldEqual, r2)
+			})
 			err = chain.produceBlock(begin.Add(chain.period).UTC())
 			So(err, ShouldBeNil)
 
@@ -51,6 +51,11 @@ type Config struct {
 
 	Period time.Duration
 	Tick   time.Duration
+
+	// SnapshotInterval is the block count interval of state snapshots, 0 to disable.
+	SnapshotInterval uint32
+	// FastSync makes a new node bootstrap from a peer snapshot instead of replaying all blocks.
+	FastSync bool
 }
 
 // NewConfig creates new config.
@@ -82,4 +82,49 @@ var (
 	ErrNoAvailableBranch = errors.New("no available branch from state storage")
 	// ErrWrongTokenType indicates that token type in transfer is wrong.
 	ErrWrongTokenType = errors.New("wrong token type")
+	// ErrTransactionNotFound indicates that a confirmed transaction is not found in the index.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrInvalidDispute indicates that the dispute evidences cannot prove the accused miner guilty.
+	ErrInvalidDispute = errors.New("invalid dispute")
+	// ErrInvalidLineage indicates that the lineage of a database fork is invalid.
+	ErrInvalidLineage = errors.New("invalid lineage")
+	// ErrDatabaseUserNotFound indicates that the sender is neither a user nor a miner of the
+	// database.
+	ErrDatabaseUserNotFound = errors.New("database user not found")
+	// ErrOutstandingArrears indicates that the database user has outstanding arrears.
+	ErrOutstandingArrears = errors.New("outstanding arrears")
+	// ErrInsufficientDeposit indicates that the deposit of the database miner is insufficient.
+	ErrInsufficientDeposit = errors.New("insufficient deposit")
+	// ErrMinerInArbitration indicates that the database miner is in an arbitration.
+	ErrMinerInArbitration = errors.New("miner is in arbitration")
+	// ErrInvalidOwner indicates that the new owner of a database ownership transfer is invalid.
+	ErrInvalidOwner = errors.New("invalid database owner")
+	// ErrInvalidSnapshotRoot indicates that the snapshot root in the block header does not match
+	// the state root after applying the block.
+	ErrInvalidSnapshotRoot = errors.New("invalid snapshot root")
+	// ErrSnapshotNotFound indicates that the requested state snapshot is not found.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrNoTrustedSnapshot indicates that no snapshot is confirmed by enough peers during a fast
+	// sync.
+	ErrNoTrustedSnapshot = errors.New("no trusted snapshot from peers")
+	// ErrInvalidHeaderChain indicates that the block headers fetched during a fast sync do not
+	// link the genesis block to the snapshot block.
+	ErrInvalidHeaderChain = errors.New("invalid header chain")
+	// ErrUnderpricedTx indicates that the transaction fee is not higher than the pending
+	// transaction with the same account nonce, which it attempts to replace.
+	ErrUnderpricedTx = errors.New("transaction fee too low to replace the pending one")
+	// ErrInvalidAccountKey indicates that the key to bind to an account is invalid.
+	ErrInvalidAccountKey = errors.New("invalid account key")
+	// ErrAccountKeyInUse indicates that the key to bind is already used by another account.
+	ErrAccountKeyInUse = errors.New("account key is already in use")
+	// ErrMinerRatingTooLow indicates that the miner rating is lower than the user requirement.
+	ErrMinerRatingTooLow = errors.New("miner rating too low")
+	// ErrPlacementMismatch indicates that the miner labels do not match the placement constraints.
+	ErrPlacementMismatch = errors.New("miner labels mismatch placement constraints")
+	// ErrPlacementNotSatisfied indicates that the matched miners do not spread across enough
+	// label values required by the placement constraints.
+	ErrPlacementNotSatisfied = errors.New("placement constraints not satisfied")
+	// ErrNoSuchProvider indicates that the miner neither provides service nor serves any
+	// database to drain.
+	ErrNoSuchProvider = errors.New("no such provider")
 )
@@ -58,3 +58,14 @@ func (m *TransactionTypeMixin) GetTimestamp() time.Time {
 func (m *TransactionTypeMixin) SetTimestamp(t time.Time) {
 	m.Timestamp = t
 }
+
+// TransactionFeeMixin provides the fee paid to the block producer in Particle, which is embedded in
+// the signed transaction header.
+type TransactionFeeMixin struct {
+	Fee uint64
+}
+
+// GetFee implements ContainsTransactionFee.GetFee.
+func (m *TransactionFeeMixin) GetFee() uint64 {
+	return m.Fee
+}
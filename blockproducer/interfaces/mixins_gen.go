@@ -6,6 +6,22 @@ import (
 	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
 )
 
+// MarshalHash marshals for hash
+func (z *TransactionFeeMixin) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 1
+	o = append(o, 0x81, 0x81)
+	o = hsp.AppendUint64(o, z.Fee)
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *TransactionFeeMixin) Msgsize() (s int) {
+	s = 1 + 4 + hsp.Uint64Size
+	return
+}
+
 // MarshalHash marshals for hash
 func (z *TransactionTypeMixin) MarshalHash() (o []byte, err error) {
 	var b []byte
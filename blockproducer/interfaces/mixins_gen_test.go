@@ -9,6 +9,43 @@ import (
 	"testing"
 )
 
+func TestMarshalHashTransactionFeeMixin(t *testing.T) {
+	v := TransactionFeeMixin{}
+	binary.Read(rand.Reader, binary.BigEndian, &v)
+	bts1, err := v.MarshalHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts2, err := v.MarshalHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bts1, bts2) {
+		t.Fatal("hash not stable")
+	}
+}
+
+func BenchmarkMarshalHashTransactionFeeMixin(b *testing.B) {
+	v := TransactionFeeMixin{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.MarshalHash()
+	}
+}
+
+func BenchmarkAppendMsgTransactionFeeMixin(b *testing.B) {
+	v := TransactionFeeMixin{}
+	bts := make([]byte, 0, v.Msgsize())
+	bts, _ = v.MarshalHash()
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bts, _ = v.MarshalHash()
+	}
+}
+
 func TestMarshalHashTransactionTypeMixin(t *testing.T) {
 	v := TransactionTypeMixin{}
 	binary.Read(rand.Reader, binary.BigEndian, &v)
@@ -35,3 +35,10 @@ func TestTransactionTypeMixin(t *testing.T) {
 		So(m.GetTimestamp(), ShouldEqual, now)
 	})
 }
+
+func TestTransactionFeeMixin(t *testing.T) {
+	Convey("test transaction fee mixin", t, func() {
+		m := &TransactionFeeMixin{Fee: 10}
+		So(m.GetFee(), ShouldEqual, 10)
+	})
+}
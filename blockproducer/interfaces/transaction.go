@@ -72,6 +72,24 @@ const (
 	TransactionTypeIssueKeys
 	// TransactionTypeUpdateBilling defines SQLChain update billing information.
 	TransactionTypeUpdateBilling
+	// TransactionTypeDispute defines database user disputing a wrong query result.
+	TransactionTypeDispute
+	// TransactionTypeForkDatabase defines database owner forking a database at a block height.
+	TransactionTypeForkDatabase
+	// TransactionTypeDepositToDatabase defines database user topping up its advance payment.
+	TransactionTypeDepositToDatabase
+	// TransactionTypeWithdrawFromDatabase defines database user or miner withdrawing its funds.
+	TransactionTypeWithdrawFromDatabase
+	// TransactionTypeTransferDatabaseOwnership defines database owner transferring the ownership.
+	TransactionTypeTransferDatabaseOwnership
+	// TransactionTypeCreateMultiSigAccount defines multisig account registration transaction type.
+	TransactionTypeCreateMultiSigAccount
+	// TransactionTypeMultiSig defines transaction wrapper signed by a multisig account.
+	TransactionTypeMultiSig
+	// TransactionTypeRotateAccountKey defines account key rotation transaction type.
+	TransactionTypeRotateAccountKey
+	// TransactionTypeWithdrawService defines miner service withdrawal transaction type.
+	TransactionTypeWithdrawService
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -104,6 +122,24 @@ func (t TransactionType) String() string {
 		return "IssueKeys"
 	case TransactionTypeUpdateBilling:
 		return "UpdateBilling"
+	case TransactionTypeDispute:
+		return "Dispute"
+	case TransactionTypeForkDatabase:
+		return "ForkDatabase"
+	case TransactionTypeDepositToDatabase:
+		return "DepositToDatabase"
+	case TransactionTypeWithdrawFromDatabase:
+		return "WithdrawFromDatabase"
+	case TransactionTypeTransferDatabaseOwnership:
+		return "TransferDatabaseOwnership"
+	case TransactionTypeCreateMultiSigAccount:
+		return "CreateMultiSigAccount"
+	case TransactionTypeMultiSig:
+		return "MultiSig"
+	case TransactionTypeRotateAccountKey:
+		return "RotateAccountKey"
+	case TransactionTypeWithdrawService:
+		return "WithdrawService"
 	default:
 		return "Unknown"
 	}
@@ -158,3 +194,20 @@ type Transaction interface {
 	MarshalHash() ([]byte, error)
 	Msgsize() int
 }
+
+// ContainsTransactionFee is the interface implemented by a transaction paying a fee to the block
+// producer.
+type ContainsTransactionFee interface {
+	GetFee() uint64
+}
+
+// GetTransactionFee returns the fee paid by transaction t, or 0 if it pays no fee.
+func GetTransactionFee(t Transaction) uint64 {
+	if w, ok := t.(*TransactionWrapper); ok {
+		t = w.Unwrap()
+	}
+	if f, ok := t.(ContainsTransactionFee); ok {
+		return f.GetFee()
+	}
+	return 0
+}
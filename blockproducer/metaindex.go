@@ -44,6 +44,9 @@ type metaIndex struct {
 	accounts  map[proto.AccountAddress]*types.Account
 	databases map[proto.DatabaseID]*types.SQLChainProfile
 	provider  map[proto.AccountAddress]*types.ProviderProfile
+	// keys maps the addresses of the registered keys to the rotated accounts, which is derived
+	// from the accounts and never persisted. An empty account in the dirty index means unbound.
+	keys map[proto.AccountAddress]proto.AccountAddress
 }
 
 func newMetaIndex() *metaIndex {
@@ -51,6 +54,7 @@ func newMetaIndex() *metaIndex {
 		accounts:  make(map[proto.AccountAddress]*types.Account),
 		databases: make(map[proto.DatabaseID]*types.SQLChainProfile),
 		provider:  make(map[proto.AccountAddress]*types.ProviderProfile),
+		keys:      make(map[proto.AccountAddress]proto.AccountAddress),
 	}
 }
 
@@ -65,5 +69,8 @@ func (i *metaIndex) deepCopy() (cpy *metaIndex) {
 	for k, v := range i.provider {
 		cpy.provider[k] = deepcopy.Copy(v).(*types.ProviderProfile)
 	}
+	for k, v := range i.keys {
+		cpy.keys[k] = v
+	}
 	return
 }
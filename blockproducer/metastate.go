@@ -37,6 +37,10 @@ import (
 
 var (
 	sqlchainPeriod uint64 = 60 * 24 * 30
+	// billingInterval is the expected block height interval between two billings of a database.
+	// It is a chain parameter instead of a local config, so that all block producers rate the
+	// billings alike.
+	billingInterval uint32 = 360
 )
 
 // TODO(leventeliu): lock optimization.
@@ -83,6 +87,34 @@ func (s *metaState) loadAccountObject(k proto.AccountAddress) (o *types.Account,
 	return
 }
 
+// accountOf returns the account which the key address is registered to, or the key address
+// itself if it is not bound to any rotated account.
+func (s *metaState) accountOf(key proto.AccountAddress) (addr proto.AccountAddress) {
+	var ok bool
+	if addr, ok = s.dirty.keys[key]; !ok {
+		addr, ok = s.readonly.keys[key]
+	}
+	if !ok || addr == (proto.AccountAddress{}) {
+		addr = key
+	}
+	return
+}
+
+// signeeAccount returns the account which signee is the currently registered key of.
+func (s *metaState) signeeAccount(signee *asymmetric.PublicKey) (addr proto.AccountAddress, err error) {
+	var key proto.AccountAddress
+	if key, err = crypto.PubKeyHash(signee); err != nil {
+		err = errors.Wrapf(ErrInvalidSender, "invalid signee: %v", err)
+		return
+	}
+	addr = s.accountOf(key)
+	if o, loaded := s.loadAccountObject(addr); loaded && o.PublicKey != nil &&
+		!o.PublicKey.IsEqual(signee) {
+		err = errors.Wrapf(ErrInvalidSender, "key of account %s is rotated", addr)
+	}
+	return
+}
+
 func (s *metaState) loadOrStoreAccountObject(
 	k proto.AccountAddress, v *types.Account) (o *types.Account, loaded bool,
 ) {
@@ -247,6 +279,13 @@ func (s *metaState) commit() {
 			delete(s.readonly.provider, k)
 		}
 	}
+	for k, v := range s.dirty.keys {
+		if v != (proto.AccountAddress{}) {
+			s.readonly.keys[k] = v
+		} else {
+			delete(s.readonly.keys, k)
+		}
+	}
 	// Clean dirty map
 	s.dirty = newMetaIndex()
 	return
@@ -296,16 +335,9 @@ func (s *metaState) decreaseAccountStableBalance(k proto.AccountAddress, amount
 	return s.decreaseAccountToken(k, amount, types.Particle)
 }
 
-func (s *metaState) transferAccountToken(transfer *types.Transfer) (err error) {
-	if transfer.Signee == nil {
-		err = ErrInvalidSender
-		log.WithError(err).Warning("invalid signee in applyTransaction")
-	}
-	realSender, err := crypto.PubKeyHash(transfer.Signee)
-	if err != nil {
-		err = errors.Wrap(err, "applyTx failed")
-		return err
-	}
+func (s *metaState) transferAccountToken(
+	realSender proto.AccountAddress, transfer *types.Transfer) (err error,
+) {
 	if realSender != transfer.Sender {
 		err = errors.Wrapf(ErrInvalidSender,
 			"applyTx failed: real sender %s, sender %s", realSender, transfer.Sender)
@@ -586,7 +618,7 @@ func (s *metaState) applyBilling(tx *types.Billing) (err error) {
 }
 
 func (s *metaState) updateProviderList(tx *types.ProvideService) (err error) {
-	sender, err := crypto.PubKeyHash(tx.Signee)
+	sender, err := s.signeeAccount(tx.Signee)
 	if err != nil {
 		err = errors.Wrap(err, "updateProviderList failed")
 		return
@@ -608,18 +640,261 @@ func (s *metaState) updateProviderList(tx *types.ProvideService) (err error) {
 		Deposit:       minDeposit,
 		GasPrice:      tx.GasPrice,
 		NodeID:        tx.NodeID,
+		Labels:        tx.Labels,
 	}
 	s.dirty.provider[sender] = &pp
 	return
 }
 
-func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error) {
-	log.Infof("create database: %s", tx.Hash())
-	sender, err := crypto.PubKeyHash(tx.Signee)
+// withdrawService removes the sender from the provider list and refunds the provider deposit. If
+// draining, each database served by the sender is also assigned a replacement miner, and the
+// sender is kept as a draining miner of the database until the replicas have migrated. The
+// provider deposit of a draining miner is held until the drain has finished.
+func (s *metaState) withdrawService(tx *types.WithdrawService) (err error) {
+	sender, err := s.signeeAccount(tx.Signee)
 	if err != nil {
-		err = errors.Wrap(err, "matchProviders failed")
+		err = errors.Wrap(err, "withdrawService failed")
+		return
+	}
+	var (
+		po, provided = s.loadProviderObject(sender)
+		dbs          []*types.SQLChainProfile
+	)
+	if tx.Drain {
+		if dbs, err = s.drainSQLChains(sender); err != nil {
+			return
+		}
+	}
+	if !provided && len(dbs) == 0 {
+		err = errors.Wrapf(ErrNoSuchProvider, "miner: %s", sender)
+		return
+	}
+	if provided {
+		var held bool
+		if held, err = s.holdDrainingDeposit(sender, po.Deposit, dbs, ""); err != nil {
+			return
+		}
+		if !held {
+			if err = s.increaseAccountStableBalance(sender, po.Deposit); err != nil {
+				return
+			}
+		}
+		s.deleteProviderObject(sender)
+	}
+	for _, db := range dbs {
+		// The replacement miner is appended to the miner list
+		s.deleteProviderObject(db.Miners[len(db.Miners)-1].Address)
+		s.dirty.databases[db.ID] = db
+	}
+	log.WithFields(log.Fields{
+		"miner":   sender,
+		"drained": len(dbs),
+	}).Info("miner withdrew service")
+	return
+}
+
+// drainSQLChains assigns a replacement miner from the provider list to each database served by
+// the miner, and marks the miner as draining. The updated database profiles are returned without
+// being stored.
+func (s *metaState) drainSQLChains(addr proto.AccountAddress) (dbs []*types.SQLChainProfile, err error) {
+	var picked = map[proto.AccountAddress]struct{}{addr: {}}
+	for _, db := range s.loadSQLChainsOfMiner(addr) {
+		var (
+			draining *types.MinerInfo
+			exclude  []proto.AccountAddress
+		)
+		for _, miner := range db.Miners {
+			if miner.Address == addr {
+				draining = miner
+			}
+			exclude = append(exclude, miner.Address)
+		}
+		if draining.Status == types.Draining {
+			continue
+		}
+		if draining.Status == types.Arbitration {
+			err = errors.Wrapf(ErrMinerInArbitration, "miner: %s, database: %s", addr, db.ID)
+			return
+		}
+		for k := range picked {
+			exclude = append(exclude, k)
+		}
+		// Match the replacement in the same way as the database creation
+		var (
+			req = &types.CreateDatabase{
+				CreateDatabaseHeader: types.CreateDatabaseHeader{
+					Owner:        db.Owner,
+					ResourceMeta: db.Meta,
+					GasPrice:     db.GasPrice,
+					TokenType:    db.TokenType,
+				},
+			}
+			replacement MinerInfos
+		)
+		req.ResourceMeta.TargetMiners = exclude
+		if replacement, err = s.filterNMiners(
+			req, db.Owner, make(map[string]struct{}), 1,
+		); err != nil {
+			err = errors.Wrapf(err, "no replacement of miner %s for database %s", addr, db.ID)
+			return
+		}
+		draining.Status = types.Draining
+		replacement[0].Status = types.Syncing
+		db.Miners = append(db.Miners, replacement[0])
+		picked[replacement[0].Address] = struct{}{}
+		dbs = append(dbs, db)
+	}
+	return
+}
+
+// holdDrainingDeposit adds the deposit to the miner in a database which it is still draining, so
+// that the deposit is released with the drain. The updated profiles in dbs are searched first,
+// and the database skip is excluded from the stored ones.
+func (s *metaState) holdDrainingDeposit(
+	addr proto.AccountAddress, amount uint64, dbs []*types.SQLChainProfile, skip proto.DatabaseID,
+) (held bool, err error) {
+	var updated = make(map[proto.DatabaseID]struct{})
+	for _, db := range dbs {
+		updated[db.ID] = struct{}{}
+		if held, err = holdDeposit(db, addr, amount); held || err != nil {
+			return
+		}
+	}
+	for _, db := range s.loadSQLChainsOfMiner(addr) {
+		if _, ok := updated[db.ID]; ok || db.ID == skip {
+			continue
+		}
+		if held, err = holdDeposit(db, addr, amount); err != nil {
+			return
+		}
+		if held {
+			s.dirty.databases[db.ID] = db
+			return
+		}
+	}
+	return
+}
+
+// holdDeposit adds the deposit to the miner if it is draining the database.
+func holdDeposit(
+	db *types.SQLChainProfile, addr proto.AccountAddress, amount uint64) (held bool, err error,
+) {
+	for _, miner := range db.Miners {
+		if miner.Address == addr && miner.Status == types.Draining {
+			if err = safeAdd(&miner.Deposit, &amount); err != nil {
+				return
+			}
+			held = true
+			return
+		}
+	}
+	return
+}
+
+// loadSQLChainsOfMiner returns copies of the databases served by the miner, sorted by database ID.
+func (s *metaState) loadSQLChainsOfMiner(addr proto.AccountAddress) (dbs []*types.SQLChainProfile) {
+	var ids []proto.DatabaseID
+	for k := range s.readonly.databases {
+		if _, ok := s.dirty.databases[k]; !ok {
+			ids = append(ids, k)
+		}
+	}
+	for k, v := range s.dirty.databases {
+		if v != nil {
+			ids = append(ids, k)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		var db, _ = s.loadSQLChainObject(id)
+		for _, miner := range db.Miners {
+			if miner.Address == addr {
+				dbs = append(dbs, db)
+				break
+			}
+		}
+	}
+	return
+}
+
+// releaseDrainedMiners removes the draining miners from the database profile and releases their
+// deposits. A syncing replacement confirms that it has caught up the database by submitting a
+// billing itself, and the draining miners are released once all the replacements are confirmed
+// and the billing, which is not submitted by a draining miner, reports neither storage proof
+// failure nor unacknowledged responses of the other miners. The deposit of a miner still draining
+// other databases is held by the next one instead.
+func (s *metaState) releaseDrainedMiners(
+	profile *types.SQLChainProfile, tx *types.UpdateBilling, submitter proto.AccountAddress,
+) (err error) {
+	var (
+		faulty            = make(map[proto.AccountAddress]struct{})
+		draining, syncing int
+		byDraining        bool
+	)
+	for _, v := range tx.FailedMiners {
+		faulty[v] = struct{}{}
+	}
+	for _, v := range tx.NoAckMiners {
+		faulty[v] = struct{}{}
+	}
+	for _, miner := range profile.Miners {
+		var _, isFaulty = faulty[miner.Address]
+		switch miner.Status {
+		case types.Draining:
+			draining++
+			byDraining = byDraining || miner.Address == submitter
+		case types.Syncing:
+			if miner.Address == submitter && !isFaulty {
+				miner.Status = types.Normal
+				log.WithFields(log.Fields{
+					"miner":    miner.Address,
+					"database": profile.ID,
+				}).Info("replacement miner confirmed")
+			} else {
+				syncing++
+			}
+		}
+	}
+	if draining == 0 || syncing > 0 || byDraining {
 		return
 	}
+	for _, miner := range profile.Miners {
+		if _, ok := faulty[miner.Address]; ok && miner.Status != types.Draining {
+			return
+		}
+	}
+	var miners = make([]*types.MinerInfo, 0, len(profile.Miners)-draining)
+	for _, miner := range profile.Miners {
+		if miner.Status != types.Draining {
+			miners = append(miners, miner)
+			continue
+		}
+		var held bool
+		if held, err = s.holdDrainingDeposit(
+			miner.Address, miner.Deposit, nil, profile.ID,
+		); err != nil {
+			return
+		}
+		if !held {
+			if err = s.increaseAccountStableBalance(miner.Address, miner.Deposit); err != nil {
+				return
+			}
+		}
+		log.WithFields(log.Fields{
+			"miner":    miner.Address,
+			"database": profile.ID,
+			"deposit":  miner.Deposit,
+			"held":     held,
+		}).Info("drained miner released")
+	}
+	profile.Miners = miners
+	return
+}
+
+func (s *metaState) matchProvidersWithUser(
+	sender proto.AccountAddress, tx *types.CreateDatabase, lineage *types.Lineage) (err error,
+) {
+	log.Infof("create database: %s", tx.Hash())
 	if sender != tx.Owner {
 		err = errors.Wrapf(ErrInvalidSender, "match failed with real sender: %s, sender: %s",
 			sender, tx.Owner)
@@ -645,7 +920,11 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 		return
 	}
 
-	miners := make(MinerInfos, 0, minerCount)
+	var (
+		miners    = make(MinerInfos, 0, minerCount)
+		placement = &tx.ResourceMeta.Placement
+		spread    = make(map[string]struct{})
+	)
 
 	for _, m := range tx.ResourceMeta.TargetMiners {
 		if po, loaded := s.loadProviderObject(m); !loaded {
@@ -656,9 +935,11 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 			err = ErrNoSuchMiner
 			continue
 		} else {
-			miners, err = filterAndAppendMiner(miners, po, tx, sender)
+			miners, err = filterAndAppendMiner(miners, po, tx, sender, s.minerRating(m))
 			if err != nil {
 				log.Warnf("miner filtered %v", err)
+			} else if v, ok := po.Labels.Get(placement.SpreadKey); ok {
+				spread[v] = struct{}{}
 			}
 			// if got enough, break
 			if uint64(len(miners)) == minerCount {
@@ -675,13 +956,18 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 		}
 		var newMiners MinerInfos
 		// create new merged map
-		newMiners, err = s.filterNMiners(tx, sender, int(minerCount)-len(miners))
+		newMiners, err = s.filterNMiners(tx, sender, spread, int(minerCount)-len(miners))
 		if err != nil {
 			return
 		}
 
 		miners = append(miners, newMiners...)
 	}
+	if placement.SpreadKey != "" && len(spread) < int(placement.Spread) {
+		err = errors.Wrapf(ErrPlacementNotSatisfied, "miners spread across %d %s(s), required %d",
+			len(spread), placement.SpreadKey, placement.Spread)
+		return
+	}
 
 	// generate new sqlchain id and address
 	dbID := proto.FromAccountAndNonce(tx.Owner, uint32(tx.Nonce))
@@ -709,7 +995,7 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 		AdvancePayment: tx.AdvancePayment,
 	}
 	// generate genesis block
-	gb, err := s.generateGenesisBlock(dbID, tx.ResourceMeta)
+	gb, err := s.generateGenesisBlock(dbID, tx.ResourceMeta, lineage, tx.GetTimestamp())
 	if err != nil {
 		log.WithFields(log.Fields{
 			"dbID":         dbID,
@@ -738,6 +1024,7 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 		Users:          users,
 		EncodedGenesis: enc.Bytes(),
 		Miners:         miners,
+		Meta:           tx.ResourceMeta,
 	}
 
 	if _, loaded := s.loadSQLChainObject(dbID); loaded {
@@ -753,9 +1040,46 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 	return
 }
 
+// applyForkDatabase creates a new database in the same way as CreateDatabase, except that the
+// genesis block records the lineage, from which the new miners seed the database state.
+func (s *metaState) applyForkDatabase(
+	sender proto.AccountAddress, tx *types.ForkDatabase) (err error,
+) {
+	if !tx.Lineage.IsForked() || tx.Lineage.Height < 0 {
+		err = errors.Wrapf(ErrInvalidLineage, "source: %s, height: %d",
+			tx.Lineage.Source, tx.Lineage.Height)
+		return
+	}
+	so, loaded := s.loadSQLChainObject(tx.Lineage.Source)
+	if !loaded {
+		err = errors.Wrapf(ErrDatabaseNotFound, "fork source: %s", tx.Lineage.Source)
+		return
+	}
+	var isAdmin bool
+	for _, u := range so.Users {
+		if u.Address == sender && u.Permission.CheckAdmin() {
+			isAdmin = true
+			break
+		}
+	}
+	if !isAdmin {
+		log.WithFields(log.Fields{
+			"sender": sender,
+			"source": tx.Lineage.Source,
+		}).WithError(ErrAccountPermissionDeny).Error("unexpected error in applyForkDatabase")
+		return ErrAccountPermissionDeny
+	}
+	return s.matchProvidersWithUser(sender, &types.CreateDatabase{
+		CreateDatabaseHeader:        tx.CreateDatabaseHeader,
+		TransactionTypeMixin:        tx.TransactionTypeMixin,
+		DefaultHashSignVerifierImpl: tx.DefaultHashSignVerifierImpl,
+	}, &tx.Lineage)
+}
+
 func (s *metaState) filterNMiners(
 	tx *types.CreateDatabase,
 	user proto.AccountAddress,
+	spread map[string]struct{},
 	minerCount int) (
 	m MinerInfos, err error,
 ) {
@@ -779,17 +1103,74 @@ func (s *metaState) filterNMiners(
 
 	// suppose 1/4 miners match
 	newMiners := make(MinerInfos, 0, len(allProviderMap)/4)
+	ratings := make(map[proto.AccountAddress]uint64)
 	// filter all miners to slice and sort
 	for _, po := range allProviderMap {
-		newMiners, _ = filterAndAppendMiner(newMiners, po, tx, user)
+		var rating = s.minerRating(po.Provider)
+		ratings[po.Provider] = rating
+		newMiners, _ = filterAndAppendMiner(newMiners, po, tx, user, rating)
 	}
 	if len(newMiners) < minerCount {
 		err = ErrNoEnoughMiner
 		return
 	}
 
-	sort.Slice(newMiners, newMiners.Less)
-	return newMiners[:minerCount], nil
+	// prefer higher rated miners
+	sort.Slice(newMiners, func(i, j int) bool {
+		if ri, rj := ratings[newMiners[i].Address], ratings[newMiners[j].Address]; ri != rj {
+			return ri > rj
+		}
+		return newMiners.Less(i, j)
+	})
+	return pickSpreadMiners(newMiners, allProviderMap, &tx.ResourceMeta.Placement, spread, minerCount), nil
+}
+
+// pickSpreadMiners picks count miners from the sorted candidates. The candidates with a new value
+// of the placement spread label are picked first until the required spread is reached, and the
+// remaining ones are picked in order. The picked label values are added to spread.
+func pickSpreadMiners(
+	candidates MinerInfos,
+	providers map[proto.AccountAddress]*types.ProviderProfile,
+	placement *types.PlacementConstraints,
+	spread map[string]struct{},
+	count int,
+) (picked MinerInfos) {
+	var (
+		selected = make(map[proto.AccountAddress]struct{})
+		n        int
+	)
+	if placement.SpreadKey != "" {
+		for _, m := range candidates {
+			if n >= count || len(spread) >= int(placement.Spread) {
+				break
+			}
+			var v, ok = providers[m.Address].Labels.Get(placement.SpreadKey)
+			if _, seen := spread[v]; ok && !seen {
+				spread[v] = struct{}{}
+				selected[m.Address] = struct{}{}
+				n++
+			}
+		}
+	}
+	picked = make(MinerInfos, 0, count)
+	for _, m := range candidates {
+		if len(picked) >= count {
+			break
+		}
+		if _, ok := selected[m.Address]; !ok {
+			if n >= count {
+				continue
+			}
+			n++
+			if placement.SpreadKey != "" {
+				if v, ok := providers[m.Address].Labels.Get(placement.SpreadKey); ok {
+					spread[v] = struct{}{}
+				}
+			}
+		}
+		picked = append(picked, m)
+	}
+	return
 }
 
 func filterAndAppendMiner(
@@ -797,12 +1178,22 @@ func filterAndAppendMiner(
 	po *types.ProviderProfile,
 	req *types.CreateDatabase,
 	user proto.AccountAddress,
+	rating uint64,
 ) (newMiners []*types.MinerInfo, err error) {
 	newMiners = miners
 	if !isProviderUserMatch(po.TargetUser, user) {
 		err = ErrMinerUserNotMatch
 		return
 	}
+	if rating < req.ResourceMeta.MinRating {
+		err = errors.Wrapf(ErrMinerRatingTooLow, "miner's rating: %d, user's min rating: %d",
+			rating, req.ResourceMeta.MinRating)
+		return
+	}
+	if !req.ResourceMeta.Placement.Match(po.Labels) {
+		err = errors.Wrapf(ErrPlacementMismatch, "miner's labels: %v", po.Labels)
+		return
+	}
 	var match bool
 	if match, err = isProviderReqMatch(po, req); !match {
 		return
@@ -863,20 +1254,15 @@ func isProviderReqMatch(po *types.ProviderProfile, req *types.CreateDatabase) (m
 	return true, nil
 }
 
-func (s *metaState) updatePermission(tx *types.UpdatePermission) (err error) {
+func (s *metaState) updatePermission(
+	sender proto.AccountAddress, tx *types.UpdatePermission) (err error,
+) {
 	log.WithFields(log.Fields{
 		"tx_hash":     tx.Hash(),
-		"sender":      tx.GetAccountAddress(),
+		"sender":      sender,
 		"db_id":       tx.TargetSQLChain,
 		"target_user": tx.TargetUser,
 	}).Debug("in updatePermission")
-	sender, err := crypto.PubKeyHash(tx.Signee)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"tx": tx.Hash(),
-		}).WithError(err).Error("unexpected err")
-		return
-	}
 	so, loaded := s.loadSQLChainObject(tx.TargetSQLChain.DatabaseID())
 	if !loaded {
 		log.WithFields(log.Fields{
@@ -940,8 +1326,7 @@ func (s *metaState) updatePermission(tx *types.UpdatePermission) (err error) {
 	return
 }
 
-func (s *metaState) updateKeys(tx *types.IssueKeys) (err error) {
-	sender := tx.GetAccountAddress()
+func (s *metaState) updateKeys(sender proto.AccountAddress, tx *types.IssueKeys) (err error) {
 	so, loaded := s.loadSQLChainObject(tx.TargetSQLChain.DatabaseID())
 	if !loaded {
 		log.WithFields(log.Fields{
@@ -979,7 +1364,7 @@ func (s *metaState) updateKeys(tx *types.IssueKeys) (err error) {
 	return
 }
 
-func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
+func (s *metaState) updateBilling(tx *types.UpdateBilling, height uint32) (err error) {
 	newProfile, loaded := s.loadSQLChainObject(tx.Receiver.DatabaseID())
 	if !loaded {
 		err = errors.Wrap(ErrDatabaseNotFound, "update billing failed")
@@ -994,9 +1379,12 @@ func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
 	var (
 		costMap   = make(map[proto.AccountAddress]uint64)
 		userMap   = make(map[proto.AccountAddress]map[proto.AccountAddress]uint64)
-		minerAddr = tx.GetAccountAddress()
+		minerAddr proto.AccountAddress
 		isMiner   = false
 	)
+	if minerAddr, err = s.signeeAccount(tx.Signee); err != nil {
+		return
+	}
 	for _, miner := range newProfile.Miners {
 		isMiner = isMiner || (miner.Address == minerAddr)
 		miner.ReceivedIncome += miner.PendingIncome
@@ -1011,6 +1399,30 @@ func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
 		return
 	}
 
+	// Rate the miners with the billing evidences before the profile is updated
+	s.rateBillingMiners(newProfile, tx, minerAddr, height)
+	newProfile.LastUpdatedHeight = height
+
+	// Miners failed in storage proof are put in arbitration until the next passed billing
+	var failed = make(map[proto.AccountAddress]struct{})
+	for _, v := range tx.FailedMiners {
+		failed[v] = struct{}{}
+	}
+	if err = s.releaseDrainedMiners(newProfile, tx, minerAddr); err != nil {
+		return
+	}
+	for _, miner := range newProfile.Miners {
+		if miner.Status == types.Syncing {
+			// not serving yet
+			continue
+		}
+		if _, ok := failed[miner.Address]; ok {
+			miner.Status = types.Arbitration
+		} else if miner.Status == types.Arbitration {
+			miner.Status = types.Normal
+		}
+	}
+
 	for _, userCost := range tx.Users {
 		log.Debugf("update billing user cost: %s, cost: %d", userCost.User, userCost.Cost)
 		costMap[userCost.User] = userCost.Cost
@@ -1021,12 +1433,16 @@ func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
 			userMap[userCost.User][minerIncome.Miner] += minerIncome.Income
 		}
 	}
+	var minDep = minDeposit(newProfile.GasPrice, uint64(len(newProfile.Miners)))
 	for _, user := range newProfile.Users {
 		if user.AdvancePayment >= costMap[user.Address]*newProfile.GasPrice {
 			user.AdvancePayment -= costMap[user.Address] * newProfile.GasPrice
 			for _, miner := range newProfile.Miners {
 				miner.PendingIncome += userMap[user.Address][miner.Address] * newProfile.GasPrice
 			}
+			if user.Status == types.Normal && user.AdvancePayment < minDep {
+				user.Status = types.Reminder
+			}
 		} else {
 			rate := float64(user.AdvancePayment) / float64(costMap[user.Address]*newProfile.GasPrice)
 			user.AdvancePayment = 0
@@ -1062,6 +1478,95 @@ func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
 	return
 }
 
+// applyDispute judges a dispute on a read query result. The accused miner is proved guilty if the
+// responses of a majority of the other miners agree on a same result, which is different from
+// the one returned by the accused miner. A guilty miner is put in arbitration, and its deposit is
+// slashed to compensate the user.
+func (s *metaState) applyDispute(tx *types.Dispute) (err error) {
+	var (
+		sender proto.AccountAddress
+		dbID   = tx.Receiver.DatabaseID()
+		req    = &tx.Response.Request
+	)
+	if sender, err = s.signeeAccount(tx.Signee); err != nil {
+		return
+	}
+	if owner, err := s.signeeAccount(req.Signee); err != nil || owner != sender {
+		return errors.Wrap(ErrInvalidSender, "dispute is not submitted by the request owner")
+	}
+	if req.QueryType != types.ReadQuery {
+		return errors.Wrapf(ErrInvalidDispute, "unexpected query type %s", req.QueryType)
+	}
+	if req.DatabaseID != dbID {
+		return errors.Wrapf(ErrInvalidDispute, "request database %s mismatched", req.DatabaseID)
+	}
+	so, loaded := s.loadSQLChainObject(dbID)
+	if !loaded {
+		return errors.Wrap(ErrDatabaseNotFound, "apply dispute failed")
+	}
+	var isUser bool
+	for _, v := range so.Users {
+		isUser = isUser || v.Address == sender
+	}
+	if !isUser {
+		return errors.Wrap(ErrAccountPermissionDeny, "dispute sender is not a database user")
+	}
+
+	var (
+		miners  = make(map[proto.AccountAddress]*types.MinerInfo)
+		witness = make(map[proto.AccountAddress]struct{})
+		guilty  *types.MinerInfo
+		signer  = func(h *types.SignedResponseHeader) (addr proto.AccountAddress) {
+			addr, _ = s.signeeAccount(h.Signee)
+			return
+		}
+	)
+	for _, v := range so.Miners {
+		miners[v.Address] = v
+	}
+	if guilty = miners[signer(&tx.Response)]; guilty == nil {
+		return errors.Wrapf(ErrNoSuchMiner, "accused miner %s", tx.Response.NodeID)
+	}
+	for i, v := range tx.Witnesses {
+		var addr = signer(v)
+		if addr == guilty.Address || miners[addr] == nil {
+			return errors.Wrapf(ErrInvalidDispute, "unexpected witness %s", v.NodeID)
+		}
+		if _, ok := witness[addr]; ok {
+			return errors.Wrapf(ErrInvalidDispute, "duplicated witness %s", v.NodeID)
+		}
+		witness[addr] = struct{}{}
+		if v.PayloadHash != tx.Witnesses[0].PayloadHash {
+			return errors.Wrapf(ErrInvalidDispute, "witness #%d disagrees with the others", i)
+		}
+	}
+	if len(witness) == 0 || 2*len(witness) <= len(so.Miners)-1 {
+		return errors.Wrapf(ErrInvalidDispute,
+			"insufficient witnesses: %d of %d", len(witness), len(so.Miners)-1)
+	}
+	if tx.Witnesses[0].PayloadHash == tx.Response.PayloadHash {
+		return errors.Wrap(ErrInvalidDispute, "witnesses agree with the accused miner")
+	}
+
+	log.WithFields(log.Fields{
+		"tx_hash": tx.Hash(),
+		"sender":  sender,
+		"db_id":   dbID,
+		"miner":   guilty.Address,
+		"slashed": guilty.Deposit,
+	}).Info("miner is proved guilty in dispute")
+	// Create empty receiver account if not found
+	s.loadOrStoreAccountObject(sender, &types.Account{Address: sender})
+	if err = s.increaseAccountStableBalance(sender, guilty.Deposit); err != nil {
+		return
+	}
+	guilty.Deposit = 0
+	guilty.Status = types.Arbitration
+	s.dirty.databases[dbID] = so
+	s.rateMiner(guilty.Address, scoreGuilty)
+	return
+}
+
 func (s *metaState) loadROSQLChains(addr proto.AccountAddress) (dbs []*types.SQLChainProfile) {
 	for _, db := range s.readonly.databases {
 		for _, miner := range db.Miners {
@@ -1074,18 +1579,35 @@ func (s *metaState) loadROSQLChains(addr proto.AccountAddress) (dbs []*types.SQL
 	return
 }
 
-func (s *metaState) transferSQLChainTokenBalance(transfer *types.Transfer) (err error) {
-	if transfer.Signee == nil {
-		err = ErrInvalidSender
-		log.WithError(err).Warning("invalid signee in applyTransaction")
-	}
-
-	realSender, err := crypto.PubKeyHash(transfer.Signee)
-	if err != nil {
-		err = errors.Wrap(err, "applyTx failed")
-		return
+// loadRORotatedAccounts returns the rotated accounts of the users and miners of dbs.
+func (s *metaState) loadRORotatedAccounts(dbs []*types.SQLChainProfile) (accounts []*types.Account) {
+	var (
+		seen = make(map[proto.AccountAddress]struct{})
+		add  = func(addr proto.AccountAddress) {
+			if _, ok := seen[addr]; ok {
+				return
+			}
+			seen[addr] = struct{}{}
+			if o, ok := s.readonly.accounts[addr]; ok &&
+				(o.PublicKey != nil || len(o.RetiredKeys) > 0) {
+				accounts = append(accounts, deepcopy.Copy(o).(*types.Account))
+			}
+		}
+	)
+	for _, db := range dbs {
+		for _, user := range db.Users {
+			add(user.Address)
+		}
+		for _, miner := range db.Miners {
+			add(miner.Address)
+		}
 	}
+	return
+}
 
+func (s *metaState) transferSQLChainTokenBalance(
+	realSender proto.AccountAddress, transfer *types.Transfer) (err error,
+) {
 	if realSender != transfer.Sender {
 		err = errors.Wrapf(ErrInvalidSender,
 			"applyTx failed: real sender %s, sender %s", realSender, transfer.Sender)
@@ -1189,14 +1711,348 @@ func (s *metaState) transferSQLChainTokenBalance(transfer *types.Transfer) (err
 	return
 }
 
-func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
-	switch t := tx.(type) {
-	case *types.Transfer:
-		err = s.transferSQLChainTokenBalance(t)
-		if err == ErrDatabaseNotFound {
-			err = s.transferAccountToken(t)
+// transferOwnership sets the new owner of the database and moves the owner's admin permission to
+// the new owner.
+func transferOwnership(profile *types.SQLChainProfile, newOwner proto.AccountAddress) {
+	var oldOwner = profile.Owner
+	profile.Owner, profile.PendingOwner = newOwner, proto.AccountAddress{}
+	if oldOwner == newOwner {
+		return
+	}
+	var found bool
+	for _, user := range profile.Users {
+		switch user.Address {
+		case newOwner:
+			user.Permission = types.Admin
+			found = true
+		case oldOwner:
+			user.Permission = types.Void
+		}
+	}
+	if !found {
+		profile.Users = append(profile.Users, &types.SQLChainUser{
+			Address:    newOwner,
+			Permission: types.Admin,
+			Status:     types.UnknownStatus,
+		})
+	}
+}
+
+// applyTransferDatabaseOwnership transfers the ownership of a database. The transfer sent by the
+// current owner is applied at once, unless it requires acceptance, in which case it's kept pending
+// until the new owner accepts it.
+func (s *metaState) applyTransferDatabaseOwnership(
+	sender proto.AccountAddress, tx *types.TransferDatabaseOwnership) (err error,
+) {
+	if tx.NewOwner == (proto.AccountAddress{}) {
+		err = errors.Wrap(ErrInvalidOwner, "empty new owner")
+		return
+	}
+	var (
+		dbID            = tx.TargetSQLChain.DatabaseID()
+		profile, loaded = s.loadSQLChainObject(dbID)
+	)
+	if !loaded {
+		err = errors.Wrapf(ErrDatabaseNotFound, "database: %s", dbID)
+		return
+	}
+	switch {
+	case sender == profile.Owner && tx.RequireAcceptance && tx.NewOwner != sender:
+		profile.PendingOwner = tx.NewOwner
+	case sender == profile.Owner:
+		transferOwnership(profile, tx.NewOwner)
+	case sender == profile.PendingOwner && tx.NewOwner == sender:
+		// accepted by the new owner
+		transferOwnership(profile, sender)
+	default:
+		log.WithFields(log.Fields{
+			"sender": sender,
+			"owner":  profile.Owner,
+			"db_id":  dbID,
+		}).WithError(ErrAccountPermissionDeny).Warning("unexpected error in transferDatabaseOwnership")
+		return ErrAccountPermissionDeny
+	}
+	log.WithFields(log.Fields{
+		"db_id":         dbID,
+		"owner":         profile.Owner,
+		"pending_owner": profile.PendingOwner,
+	}).Info("database ownership transferred")
+	s.dirty.databases[dbID] = profile
+	return
+}
+
+// updateUserStatus updates the status of a database user by its arrears and advance payment: a
+// user with outstanding arrears is in Arrears, and a user whose advance payment is below the
+// minimum deposit is reminded to top up.
+func updateUserStatus(user *types.SQLChainUser, minDep uint64) {
+	switch {
+	case user.Arrears > 0:
+		user.Status = types.Arrears
+	case user.AdvancePayment < minDep:
+		user.Status = types.Reminder
+	default:
+		user.Status = types.Normal
+	}
+}
+
+// loadDatabaseForFund loads the target database of a deposit or withdrawal transaction and checks
+// the token type.
+func (s *metaState) loadDatabaseForFund(
+	target proto.AccountAddress, tokenType types.TokenType) (
+	profile *types.SQLChainProfile, err error,
+) {
+	var loaded bool
+	if profile, loaded = s.loadSQLChainObject(target.DatabaseID()); !loaded {
+		err = errors.Wrapf(ErrDatabaseNotFound, "database: %s", target.DatabaseID())
+		return
+	}
+	if profile.TokenType != tokenType {
+		err = errors.Wrapf(ErrWrongTokenType, "database token type: %s, got: %s",
+			profile.TokenType, tokenType)
+		return
+	}
+	return
+}
+
+// applyDepositToDatabase tops up the advance payment of a database user. The outstanding arrears
+// of the user are paid off to the miners first, and the deposit is filled up to the minimum
+// deposit before the advance payment.
+func (s *metaState) applyDepositToDatabase(
+	sender proto.AccountAddress, tx *types.DepositToDatabase) (err error,
+) {
+	profile, err := s.loadDatabaseForFund(tx.TargetSQLChain, tx.TokenType)
+	if err != nil {
+		return
+	}
+	var user *types.SQLChainUser
+	for _, v := range profile.Users {
+		if v.Address == sender {
+			user = v
+			break
+		}
+	}
+	if user == nil {
+		err = errors.Wrapf(ErrDatabaseUserNotFound, "user: %s, database: %s", sender, profile.ID)
+		return
+	}
+	if tx.Amount < user.Arrears {
+		err = errors.Wrapf(ErrInsufficientTransfer, "arrears: %d, amount: %d",
+			user.Arrears, tx.Amount)
+		return
+	}
+	if err = s.decreaseAccountToken(sender, tx.Amount, tx.TokenType); err != nil {
+		return
+	}
+
+	var (
+		amount = tx.Amount - user.Arrears
+		minDep = minDeposit(profile.GasPrice, uint64(len(profile.Miners)))
+	)
+	// Pay off arrears
+	for _, miner := range profile.Miners {
+		var remained = make([]*types.UserArrears, 0, len(miner.UserArrears))
+		for _, ua := range miner.UserArrears {
+			if ua.User == sender {
+				miner.PendingIncome += ua.Arrears
+			} else {
+				remained = append(remained, ua)
+			}
+		}
+		miner.UserArrears = remained
+	}
+	user.Arrears = 0
+	// Fill up deposit, and the rest goes to advance payment
+	if user.Deposit < minDep {
+		var diff = minDep - user.Deposit
+		if diff > amount {
+			diff = amount
+		}
+		user.Deposit += diff
+		amount -= diff
+	}
+	if err = safeAdd(&user.AdvancePayment, &amount); err != nil {
+		return
+	}
+	updateUserStatus(user, minDep)
+	s.dirty.databases[profile.ID] = profile
+	log.WithFields(log.Fields{
+		"user":            sender,
+		"db_id":           profile.ID,
+		"amount":          tx.Amount,
+		"deposit":         user.Deposit,
+		"advance_payment": user.AdvancePayment,
+		"status":          user.Status,
+	}).Debug("deposit to database")
+	return
+}
+
+// applyWithdrawFromDatabase withdraws the unused advance payment of a database user, or the
+// deposit of a database miner over the minimum provider deposit, to the sender account.
+func (s *metaState) applyWithdrawFromDatabase(
+	sender proto.AccountAddress, tx *types.WithdrawFromDatabase) (err error,
+) {
+	profile, err := s.loadDatabaseForFund(tx.TargetSQLChain, tx.TokenType)
+	if err != nil {
+		return
+	}
+	var (
+		minDep = minDeposit(profile.GasPrice, uint64(len(profile.Miners)))
+		found  bool
+	)
+	for _, user := range profile.Users {
+		if user.Address != sender {
+			continue
+		}
+		if user.Arrears > 0 {
+			err = errors.Wrapf(ErrOutstandingArrears, "arrears: %d", user.Arrears)
+			return
+		}
+		if user.AdvancePayment < tx.Amount {
+			err = errors.Wrapf(ErrInsufficientAdvancePayment, "advance payment: %d, amount: %d",
+				user.AdvancePayment, tx.Amount)
+			return
+		}
+		user.AdvancePayment -= tx.Amount
+		updateUserStatus(user, minDep)
+		found = true
+		break
+	}
+	if !found {
+		for _, miner := range profile.Miners {
+			if miner.Address != sender {
+				continue
+			}
+			if miner.Status == types.Arbitration {
+				err = errors.Wrapf(ErrMinerInArbitration, "miner: %s", sender)
+				return
+			}
+			// The deposit is the collateral of the disputes and penalties, only the excess over
+			// the provider deposit can be withdrawn while the miner is serving the database
+			if minMinerDep := conf.GConf.MinProviderDeposit; miner.Deposit < tx.Amount ||
+				miner.Deposit-tx.Amount < minMinerDep {
+				err = errors.Wrapf(ErrInsufficientDeposit, "deposit: %d, amount: %d, min: %d",
+					miner.Deposit, tx.Amount, minMinerDep)
+				return
+			}
+			miner.Deposit -= tx.Amount
+			found = true
+			break
+		}
+	}
+	if !found {
+		err = errors.Wrapf(ErrDatabaseUserNotFound, "user: %s, database: %s", sender, profile.ID)
+		return
+	}
+	if err = s.increaseAccountToken(sender, tx.Amount, tx.TokenType); err != nil {
+		return
+	}
+	s.dirty.databases[profile.ID] = profile
+	return
+}
+
+func (s *metaState) createMultiSigAccount(tx *types.CreateMultiSigAccount) (err error) {
+	var addr proto.AccountAddress
+	if err = tx.Account.Validate(); err != nil {
+		return
+	}
+	if addr, err = tx.Account.Address(); err != nil {
+		return
+	}
+	// A transfer tx may have created an empty account at the address before registration.
+	var o, loaded = s.loadAccountObject(addr)
+	if !loaded {
+		o = &types.Account{Address: addr}
+	} else if o.MultiSig != nil {
+		err = errors.Wrapf(ErrAccountExists, "multisig account %s", addr)
+		return
+	}
+	o.MultiSig = tx.Account.DeepCopy().(*types.MultiSigAccount)
+	s.dirty.accounts[addr] = o
+	return
+}
+
+// rotateAccountKey binds the new key to the account, the key of the account address is revoked
+// until the account is rotated back to it.
+func (s *metaState) rotateAccountKey(tx *types.RotateAccountKey) (err error) {
+	var sender, newAddr proto.AccountAddress
+	if sender, err = s.signeeAccount(tx.Signee); err != nil {
+		return
+	}
+	if sender != tx.Account {
+		err = errors.Wrapf(ErrInvalidSender,
+			"rotate key failed: real sender %s, account %s", sender, tx.Account)
+		return
+	}
+	var o, loaded = s.loadAccountObject(sender)
+	if !loaded {
+		err = errors.Wrapf(ErrAccountNotFound, "rotate key of account %s", sender)
+		return
+	}
+	if o.MultiSig != nil {
+		err = errors.Wrapf(ErrInvalidSender, "rotate key of multisig account %s", sender)
+		return
+	}
+	if tx.NewKey == nil {
+		err = errors.Wrap(ErrInvalidAccountKey, "missing new key")
+		return
+	}
+	if newAddr, err = crypto.PubKeyHash(tx.NewKey); err != nil {
+		err = errors.Wrapf(ErrInvalidAccountKey, "invalid new key: %v", err)
+		return
+	}
+	var newKey = tx.NewKey
+	if newAddr == sender {
+		// Rotate back to the key of the account address
+		newKey = nil
+	} else if _, ok := s.loadAccountObject(newAddr); ok || s.accountOf(newAddr) != newAddr {
+		err = errors.Wrapf(ErrAccountKeyInUse, "key address %s", newAddr)
+		return
+	}
+	if o.PublicKey != nil {
+		var oldAddr proto.AccountAddress
+		if oldAddr, err = crypto.PubKeyHash(o.PublicKey); err != nil {
+			return
 		}
+		s.dirty.keys[oldAddr] = proto.AccountAddress{}
+		o.RetiredKeys = append(o.RetiredKeys, oldAddr)
+	}
+	if newKey != nil {
+		s.dirty.keys[newAddr] = sender
+	}
+	// Keep the retired keys of the account, excluding the newly registered one
+	var retired = make([]proto.AccountAddress, 0, len(o.RetiredKeys))
+	for _, v := range o.RetiredKeys {
+		if v != newAddr {
+			retired = append(retired, v)
+		}
+	}
+	o.RetiredKeys = retired
+	o.PublicKey = newKey
+	s.dirty.accounts[sender] = o
+	return
+}
+
+func (s *metaState) applyMultiSig(tx *types.MultiSig) (err error) {
+	var (
+		addr      = tx.GetAccountAddress()
+		o, loaded = s.loadAccountObject(addr)
+		inner     = tx.Unwrap()
+	)
+	if !loaded || o.MultiSig == nil {
+		err = errors.Wrapf(ErrAccountNotFound, "multisig account %s", addr)
+		return
+	}
+	if _, ok := inner.(*types.MultiSig); ok {
+		err = errors.Wrap(ErrUnknownTransactionType, "nested multisig transaction")
 		return
+	}
+	return s.applyAuthorizedTransaction(addr, inner)
+}
+
+func (s *metaState) applyTransaction(tx pi.Transaction, height uint32) (err error) {
+	switch t := tx.(type) {
+	case *types.Transfer:
+		err = s.applySignedTransaction(t.Signee, t)
 	case *types.Billing:
 		err = s.applyBilling(t)
 	case *types.BaseAccount:
@@ -1204,23 +2060,87 @@ func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
 	case *types.ProvideService:
 		err = s.updateProviderList(t)
 	case *types.CreateDatabase:
-		err = s.matchProvidersWithUser(t)
+		err = s.applySignedTransaction(t.Signee, t)
+	case *types.ForkDatabase:
+		err = s.applySignedTransaction(t.Signee, t)
+	case *types.DepositToDatabase:
+		err = s.applySignedTransaction(t.Signee, t)
+	case *types.WithdrawFromDatabase:
+		err = s.applySignedTransaction(t.Signee, t)
+	case *types.TransferDatabaseOwnership:
+		err = s.applySignedTransaction(t.Signee, t)
 	case *types.UpdatePermission:
-		err = s.updatePermission(t)
+		err = s.applySignedTransaction(t.Signee, t)
 	case *types.IssueKeys:
-		err = s.updateKeys(t)
+		err = s.applySignedTransaction(t.Signee, t)
 	case *types.UpdateBilling:
-		err = s.updateBilling(t)
+		err = s.updateBilling(t, height)
+	case *types.Dispute:
+		err = s.applyDispute(t)
+	case *types.CreateMultiSigAccount:
+		err = s.createMultiSigAccount(t)
+	case *types.MultiSig:
+		err = s.applyMultiSig(t)
+	case *types.RotateAccountKey:
+		err = s.rotateAccountKey(t)
+	case *types.WithdrawService:
+		err = s.withdrawService(t)
 	case *pi.TransactionWrapper:
 		// call again using unwrapped transaction
-		err = s.applyTransaction(t.Unwrap())
+		err = s.applyTransaction(t.Unwrap(), height)
 	default:
 		err = ErrUnknownTransactionType
 	}
 	return
 }
 
-func (s *metaState) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (genesisBlock *types.Block, err error) {
+// applySignedTransaction applies tx on behalf of the account of its signee.
+func (s *metaState) applySignedTransaction(
+	signee *asymmetric.PublicKey, tx pi.Transaction) (err error,
+) {
+	var sender proto.AccountAddress
+	if sender, err = s.signeeAccount(signee); err != nil {
+		log.WithError(err).Warning("invalid signee in applyTransaction")
+		return
+	}
+	return s.applyAuthorizedTransaction(sender, tx)
+}
+
+// applyAuthorizedTransaction applies tx on behalf of sender, which is either the account of the
+// transaction signee or a multisig account.
+func (s *metaState) applyAuthorizedTransaction(
+	sender proto.AccountAddress, tx pi.Transaction) (err error,
+) {
+	switch t := tx.(type) {
+	case *types.Transfer:
+		err = s.transferSQLChainTokenBalance(sender, t)
+		if err == ErrDatabaseNotFound {
+			err = s.transferAccountToken(sender, t)
+		}
+	case *types.CreateDatabase:
+		err = s.matchProvidersWithUser(sender, t, nil)
+	case *types.ForkDatabase:
+		err = s.applyForkDatabase(sender, t)
+	case *types.DepositToDatabase:
+		err = s.applyDepositToDatabase(sender, t)
+	case *types.WithdrawFromDatabase:
+		err = s.applyWithdrawFromDatabase(sender, t)
+	case *types.TransferDatabaseOwnership:
+		err = s.applyTransferDatabaseOwnership(sender, t)
+	case *types.UpdatePermission:
+		err = s.updatePermission(sender, t)
+	case *types.IssueKeys:
+		err = s.updateKeys(sender, t)
+	default:
+		err = ErrUnknownTransactionType
+	}
+	return
+}
+
+func (s *metaState) generateGenesisBlock(
+	dbID proto.DatabaseID, resourceMeta types.ResourceMeta, lineage *types.Lineage, ts time.Time) (
+	genesisBlock *types.Block, err error,
+) {
 	// TODO(xq262144): following is stub code, real logic should be implemented in the future
 	emptyHash := hash.Hash{}
 
@@ -1240,22 +2160,66 @@ func (s *metaState) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta typ
 				Producer:    nodeID,
 				GenesisHash: emptyHash,
 				ParentHash:  emptyHash,
-				Timestamp:   time.Now().UTC(),
+				Timestamp:   ts.UTC(),
 			},
 		},
 	}
+	if lineage != nil {
+		genesisBlock.SignedHeader.Lineage = *lineage
+	}
 
 	err = genesisBlock.PackAndSignBlock(privKey)
 
 	return
 }
 
-func (s *metaState) apply(t pi.Transaction) (err error) {
+// collectFee credits the transaction fee to the block producer account, which is created if it
+// does not exist.
+func (s *metaState) collectFee(producer proto.AccountAddress, fee uint64) (err error) {
+	var o, loaded = s.loadAccountObject(producer)
+	if !loaded {
+		o = &types.Account{Address: producer}
+	}
+	if err = safeAdd(&o.TokenBalance[types.Particle], &fee); err != nil {
+		return
+	}
+	s.dirty.accounts[producer] = o
+	return
+}
+
+// failedTx is the error of a transaction which failed to apply but is still included in block,
+// for the fee is charged and the nonce is consumed.
+type failedTx struct {
+	cause error
+}
+
+func (e *failedTx) Error() string { return e.cause.Error() }
+
+// Cause returns the apply error of the transaction, for errors.Cause.
+func (e *failedTx) Cause() error { return e.cause }
+
+// isIncluded reports whether the transaction applied with result err is included in block.
+func isIncluded(err error) bool {
+	if err == nil {
+		return true
+	}
+	_, ok := err.(*failedTx)
+	return ok
+}
+
+// apply applies transaction t in a block at height produced by producer, who collects the
+// transaction fee. A transaction paying fee is charged once its nonce matches, even if it fails to
+// apply, so that spamming invalid transactions is never free. Use isIncluded to check whether the
+// transaction is included in block on error.
+func (s *metaState) apply(
+	t pi.Transaction, producer proto.AccountAddress, height uint32) (err error,
+) {
 	log.Infof("get tx: %s", t.GetTransactionType())
 	// NOTE(leventeliu): bypass pool in this method.
 	var (
-		addr  = t.GetAccountAddress()
+		addr  = s.accountOf(t.GetAccountAddress())
 		nonce = t.GetAccountNonce()
+		fee   = pi.GetTransactionFee(t)
 	)
 	// Check account nonce
 	var nextNonce pi.AccountNonce
@@ -1274,14 +2238,40 @@ func (s *metaState) apply(t pi.Transaction) (err error) {
 		}).WithError(err).Debug("nonce not match during transaction apply")
 		return
 	}
-	// Try to apply transaction to metaState
-	if err = s.applyTransaction(t); err != nil {
-		log.WithError(err).Debug("apply transaction failed")
-		return
+	// Charge transaction fee first, so that the transaction can not spend it
+	if fee > 0 {
+		if err = s.decreaseAccountToken(addr, fee, types.Particle); err != nil {
+			err = errors.Wrap(err, "failed to charge transaction fee")
+			return
+		}
+	}
+	// Try to apply transaction to a scratch copy of the dirty index, so that a failed transaction
+	// leaves no partial writes behind
+	var (
+		scratch  = &metaState{dirty: s.dirty.deepCopy(), readonly: s.readonly}
+		applyErr error
+	)
+	if applyErr = scratch.applyTransaction(t, height); applyErr == nil {
+		s.dirty = scratch.dirty
+	} else {
+		log.WithError(applyErr).Debug("apply transaction failed")
+		if fee == 0 {
+			// Nothing is charged, the transaction is simply rejected
+			err = applyErr
+			return
+		}
+	}
+	if fee > 0 {
+		if err = s.collectFee(producer, fee); err != nil {
+			return
+		}
 	}
 	if err = s.increaseNonce(addr); err != nil {
 		return
 	}
+	if applyErr != nil {
+		err = &failedTx{cause: applyErr}
+	}
 	return
 }
 
@@ -1321,6 +2311,48 @@ func (s *metaState) compileChanges(
 	return
 }
 
+// snapshotObjects returns all the state objects in the view of dirty map over read-only map.
+func (s *metaState) snapshotObjects() (
+	accounts []*types.Account, databases []*types.SQLChainProfile, providers []*types.ProviderProfile,
+) {
+	for k, v := range s.readonly.accounts {
+		if _, ok := s.dirty.accounts[k]; !ok {
+			accounts = append(accounts, v)
+		}
+	}
+	for _, v := range s.dirty.accounts {
+		if v != nil {
+			accounts = append(accounts, v)
+		}
+	}
+	for k, v := range s.readonly.databases {
+		if _, ok := s.dirty.databases[k]; !ok {
+			databases = append(databases, v)
+		}
+	}
+	for _, v := range s.dirty.databases {
+		if v != nil {
+			databases = append(databases, v)
+		}
+	}
+	for k, v := range s.readonly.provider {
+		if _, ok := s.dirty.provider[k]; !ok {
+			providers = append(providers, v)
+		}
+	}
+	for _, v := range s.dirty.provider {
+		if v != nil {
+			providers = append(providers, v)
+		}
+	}
+	return
+}
+
+// stateRoot computes the state root of the current view.
+func (s *metaState) stateRoot() (root hash.Hash, err error) {
+	return types.ComputeStateRoot(s.snapshotObjects())
+}
+
 func minDeposit(gasPrice uint64, minerNumber uint64) uint64 {
 	return gasPrice * uint64(conf.GConf.QPS) *
 		conf.GConf.BillingBlockCount * minerNumber
@@ -17,6 +17,7 @@
 package blockproducer
 
 import (
+	"fmt"
 	"math"
 	"os"
 	"sync"
@@ -31,6 +32,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
@@ -361,7 +363,7 @@ func TestMetaState(t *testing.T) {
 							}
 							err = tran1.Sign(privKey1)
 							So(err, ShouldBeNil)
-							err = ms.transferAccountToken(tran1)
+							err = ms.transferAccountToken(addr1, tran1)
 							So(err, ShouldEqual, ErrInsufficientBalance)
 							tran2 := &types.Transfer{
 								TransferHeader: types.TransferHeader{
@@ -374,7 +376,7 @@ func TestMetaState(t *testing.T) {
 							}
 							err = tran2.Sign(privKey1)
 							So(err, ShouldBeNil)
-							err = ms.transferAccountToken(tran2)
+							err = ms.transferAccountToken(addr1, tran2)
 							So(err, ShouldBeNil)
 							ms.commit()
 
@@ -394,7 +396,7 @@ func TestMetaState(t *testing.T) {
 							}
 							err = tran3.Sign(privKey2)
 							So(err, ShouldBeNil)
-							err = ms.transferAccountToken(tran3)
+							err = ms.transferAccountToken(addr2, tran3)
 							So(err, ShouldEqual, ErrBalanceOverflow)
 							tran4 := &types.Transfer{
 								TransferHeader: types.TransferHeader{
@@ -407,7 +409,7 @@ func TestMetaState(t *testing.T) {
 							}
 							err = tran4.Sign(privKey2)
 							So(err, ShouldBeNil)
-							err = ms.transferAccountToken(tran4)
+							err = ms.transferAccountToken(addr2, tran4)
 							So(err, ShouldBeNil)
 							ms.commit()
 						},
@@ -473,20 +475,20 @@ func TestMetaState(t *testing.T) {
 				So(err, ShouldBeNil)
 				err = t2.Sign(privKey1)
 				So(err, ShouldBeNil)
-				err = ms.apply(t0)
+				err = ms.apply(t0, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
-				err = ms.apply(t1)
+				err = ms.apply(t1, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
-				err = ms.apply(t2)
+				err = ms.apply(t2, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 
 				Convey("The metaState should report error if tx fails verification", func() {
 					t1.Nonce = pi.AccountNonce(10)
 					err = t1.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(t1)
+					err = ms.apply(t1, proto.AccountAddress{}, 0)
 					So(err, ShouldEqual, ErrInvalidAccountNonce)
 					t1.Nonce, err = ms.nextNonce(addr1)
 					So(err, ShouldBeNil)
@@ -499,7 +501,7 @@ func TestMetaState(t *testing.T) {
 					So(n, ShouldEqual, 3)
 				})
 				Convey("The metaState should report error on unknown transaction type", func() {
-					err = ms.applyTransaction(nil)
+					err = ms.applyTransaction(nil, 0)
 					So(err, ShouldEqual, ErrUnknownTransactionType)
 				})
 			})
@@ -589,7 +591,7 @@ func TestMetaState(t *testing.T) {
 			txs[7].Sign(privKey2)
 			txs[8].Sign(privKey2)
 			for _, tx := range txs {
-				err = ms.apply(tx)
+				err = ms.apply(tx, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 			}
 			ms.commit()
@@ -602,6 +604,164 @@ func TestMetaState(t *testing.T) {
 				So(bl, ShouldEqual, 118)
 			})
 		})
+		Convey("When the account key is rotated", func() {
+			var (
+				newPriv *asymmetric.PrivateKey
+				rotate  = func(
+					signer *asymmetric.PrivateKey, nonce pi.AccountNonce, key *asymmetric.PublicKey,
+				) (
+					t *types.RotateAccountKey,
+				) {
+					t = types.NewRotateAccountKey(&types.RotateAccountKeyHeader{
+						Account: addr1,
+						NewKey:  key,
+						Nonce:   nonce,
+					})
+					So(t.Sign(signer), ShouldBeNil)
+					return
+				}
+				transfer = func(signer *asymmetric.PrivateKey, nonce pi.AccountNonce) (t *types.Transfer) {
+					t = types.NewTransfer(&types.TransferHeader{
+						Sender:   addr1,
+						Receiver: addr2,
+						Nonce:    nonce,
+						Amount:   1,
+					})
+					So(t.Sign(signer), ShouldBeNil)
+					return
+				}
+			)
+			newPriv, _, err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			err = ms.apply(types.NewBaseAccount(&types.Account{
+				Address:      addr1,
+				TokenBalance: [types.SupportTokenNumber]uint64{100, 100},
+			}), proto.AccountAddress{}, 0)
+			So(err, ShouldBeNil)
+			err = ms.apply(types.NewBaseAccount(&types.Account{
+				Address: addr2,
+			}), proto.AccountAddress{}, 0)
+			So(err, ShouldBeNil)
+			Convey("The key of another account should not be bound", func() {
+				err = ms.apply(rotate(privKey1, 1, privKey2.PubKey()), proto.AccountAddress{}, 0)
+				So(errors.Cause(err), ShouldEqual, ErrAccountKeyInUse)
+			})
+			Convey("The key of the account should not be rotated by others", func() {
+				var tx = rotate(privKey2, 1, newPriv.PubKey())
+				tx.Account = addr1
+				err = ms.apply(tx, proto.AccountAddress{}, 0)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+			})
+			err = ms.apply(rotate(privKey1, 1, newPriv.PubKey()), proto.AccountAddress{}, 0)
+			So(err, ShouldBeNil)
+			ms.commit()
+			Convey("The new key should be registered to the account", func() {
+				var o, loaded = ms.loadAccountObject(addr1)
+				So(loaded, ShouldBeTrue)
+				So(o.PublicKey.IsEqual(newPriv.PubKey()), ShouldBeTrue)
+				err = ms.apply(transfer(privKey1, 2), proto.AccountAddress{}, 0)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+				err = ms.apply(transfer(newPriv, 2), proto.AccountAddress{}, 0)
+				So(err, ShouldBeNil)
+				ms.commit()
+				bl, loaded = ms.loadAccountTokenBalance(addr2, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 1)
+			})
+			Convey("The index should be rebuilt from a copy", func() {
+				var cpy = ms.makeCopy()
+				err = cpy.apply(transfer(newPriv, 2), proto.AccountAddress{}, 0)
+				So(err, ShouldBeNil)
+			})
+			Convey("The account should be rotated back to the key of its address", func() {
+				err = ms.apply(rotate(newPriv, 2, privKey1.PubKey()), proto.AccountAddress{}, 0)
+				So(err, ShouldBeNil)
+				ms.commit()
+				var o, loaded = ms.loadAccountObject(addr1)
+				So(loaded, ShouldBeTrue)
+				So(o.PublicKey, ShouldBeNil)
+				newAddr, err := crypto.PubKeyHash(newPriv.PubKey())
+				So(err, ShouldBeNil)
+				So(o.RetiredKeys, ShouldResemble, []proto.AccountAddress{newAddr})
+				So(ms.loadRORotatedAccounts([]*types.SQLChainProfile{{
+					Users: []*types.SQLChainUser{{Address: addr1}},
+				}}), ShouldHaveLength, 1)
+				err = ms.apply(transfer(newPriv, 3), proto.AccountAddress{}, 0)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+				err = ms.apply(transfer(privKey1, 3), proto.AccountAddress{}, 0)
+				So(err, ShouldBeNil)
+			})
+		})
+		Convey("When transactions with fee are applied", func() {
+			var (
+				t0 = types.NewBaseAccount(&types.Account{
+					Address:      addr1,
+					TokenBalance: [types.SupportTokenNumber]uint64{100, 100},
+				})
+				t1 = types.NewTransfer(&types.TransferHeader{
+					Sender:              addr1,
+					Receiver:            addr2,
+					Nonce:               1,
+					TransactionFeeMixin: pi.TransactionFeeMixin{Fee: 5},
+					Amount:              10,
+				})
+				t2 = types.NewTransfer(&types.TransferHeader{
+					Sender:              addr1,
+					Receiver:            addr2,
+					Nonce:               2,
+					TransactionFeeMixin: pi.TransactionFeeMixin{Fee: 5},
+					Amount:              1000,
+				})
+			)
+			err = t1.Sign(privKey1)
+			So(err, ShouldBeNil)
+			err = t2.Sign(privKey1)
+			So(err, ShouldBeNil)
+			err = ms.apply(t0, addr3, 0)
+			So(err, ShouldBeNil)
+			err = ms.apply(t1, addr3, 0)
+			So(err, ShouldBeNil)
+			ms.commit()
+			Convey("The fee should be charged and credited to the producer", func() {
+				bl, loaded = ms.loadAccountTokenBalance(addr1, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 85)
+				bl, loaded = ms.loadAccountTokenBalance(addr2, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 10)
+				bl, loaded = ms.loadAccountTokenBalance(addr3, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 5)
+			})
+			Convey("The fee should be charged even if the transaction fails", func() {
+				err = ms.apply(t2, addr3, 0)
+				So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
+				So(isIncluded(err), ShouldBeTrue)
+				ms.commit()
+				bl, loaded = ms.loadAccountTokenBalance(addr1, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 80)
+				bl, loaded = ms.loadAccountTokenBalance(addr3, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, 10)
+				// the nonce is consumed, the same transaction can not be charged again
+				err = ms.apply(t2, addr3, 0)
+				So(err, ShouldEqual, ErrInvalidAccountNonce)
+				So(isIncluded(err), ShouldBeFalse)
+			})
+			Convey("The failed transaction without fee should not be included", func() {
+				t3 := types.NewTransfer(&types.TransferHeader{
+					Sender:   addr1,
+					Receiver: addr2,
+					Nonce:    2,
+					Amount:   1000,
+				})
+				So(t3.Sign(privKey1), ShouldBeNil)
+				err = ms.apply(t3, addr3, 0)
+				So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
+				So(isIncluded(err), ShouldBeFalse)
+			})
+		})
 		Convey("When SQLChain are created", func() {
 			conf.GConf, err = conf.LoadConfig("../test/node_standalone/config.yaml")
 			So(err, ShouldBeNil)
@@ -667,7 +827,7 @@ func TestMetaState(t *testing.T) {
 			err = txs[3].Sign(privKey4)
 			So(err, ShouldBeNil)
 			for i := range txs {
-				err = ms.apply(txs[i])
+				err = ms.apply(txs[i], proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 			}
@@ -799,19 +959,19 @@ func TestMetaState(t *testing.T) {
 				err = invalidCd8.Sign(privKey2)
 				So(err, ShouldBeNil)
 
-				err = ms.apply(&invalidPs)
+				err = ms.apply(&invalidPs, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
-				err = ms.apply(&invalidCd1)
+				err = ms.apply(&invalidCd1, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
-				err = ms.apply(&invalidCd2)
+				err = ms.apply(&invalidCd2, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrNoSuchMiner)
-				err = ms.apply(&invalidCd3)
+				err = ms.apply(&invalidCd3, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInsufficientAdvancePayment)
-				err = ms.apply(&invalidCd4)
+				err = ms.apply(&invalidCd4, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInvalidGasPrice)
-				err = ms.apply(&invalidCd5)
+				err = ms.apply(&invalidCd5, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrNoEnoughMiner)
-				err = ms.apply(&invalidCd6)
+				err = ms.apply(&invalidCd6, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInvalidMinerCount)
 				ms.dirty.provider[proto.AccountAddress(hash.HashH([]byte("1")))] = &types.ProviderProfile{
 					TargetUser: nil,
@@ -860,7 +1020,7 @@ func TestMetaState(t *testing.T) {
 					TokenType:     0,
 					NodeID:        "",
 				}
-				err = ms.apply(&invalidCd7)
+				err = ms.apply(&invalidCd7, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrNoEnoughMiner)
 
 				ms.readonly.provider[proto.AccountAddress(hash.HashH([]byte("9")))] = &types.ProviderProfile{
@@ -908,7 +1068,7 @@ func TestMetaState(t *testing.T) {
 					TokenType:     0,
 					NodeID:        "0000001",
 				}
-				err = ms.apply(&invalidCd8)
+				err = ms.apply(&invalidCd8, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				dbID := proto.FromAccountAndNonce(addr2, uint32(invalidCd8.Nonce))
 
@@ -964,17 +1124,17 @@ func TestMetaState(t *testing.T) {
 
 				var b1, b2 uint64
 				b1, loaded = ms.loadAccountTokenBalance(addr2, types.Particle)
-				err = ms.apply(&ps)
+				err = ms.apply(&ps, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 				b2, loaded = ms.loadAccountTokenBalance(addr2, types.Particle)
 				So(loaded, ShouldBeTrue)
 				So(b1-b2, ShouldEqual, conf.GConf.MinProviderDeposit)
-				err = ms.apply(&cd2)
+				err = ms.apply(&cd2, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrMinerUserNotMatch)
 				b1, loaded = ms.loadAccountTokenBalance(addr1, types.Particle)
 				So(loaded, ShouldBeTrue)
-				err = ms.apply(&cd1)
+				err = ms.apply(&cd1, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 				b2, loaded = ms.loadAccountTokenBalance(addr1, types.Particle)
@@ -998,13 +1158,13 @@ func TestMetaState(t *testing.T) {
 				}
 				err = up.Sign(privKey1)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrDatabaseNotFound)
 				up.Permission = 4
 				up.TargetSQLChain = dbAccount
 				err = up.Sign(privKey1)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrInvalidPermission)
 				// test permission update
 				// addr1(admin) update addr3 as admin
@@ -1012,7 +1172,7 @@ func TestMetaState(t *testing.T) {
 				up.Permission = types.Admin
 				err = up.Sign(privKey1)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 				// addr3(admin) update addr4 as read
@@ -1021,7 +1181,7 @@ func TestMetaState(t *testing.T) {
 				up.Permission = types.Read
 				err = up.Sign(privKey3)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 				// addr3(admin) update addr1(admin) as read
@@ -1029,7 +1189,7 @@ func TestMetaState(t *testing.T) {
 				up.Nonce = up.Nonce + 1
 				err = up.Sign(privKey3)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(err, ShouldBeNil)
 				ms.commit()
 				// addr3(admin) update addr3(admin) as read fail
@@ -1038,13 +1198,13 @@ func TestMetaState(t *testing.T) {
 				up.Nonce = up.Nonce + 1
 				err = up.Sign(privKey3)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrNoAdminLeft)
 				// addr1(read) update addr3(admin) fail
 				up.Nonce = cd1.Nonce + 2
 				err = up.Sign(privKey1)
 				So(err, ShouldBeNil)
-				err = ms.apply(&up)
+				err = ms.apply(&up, proto.AccountAddress{}, 0)
 				So(errors.Cause(err), ShouldEqual, ErrAccountPermissionDeny)
 
 				co, loaded = ms.loadSQLChainObject(dbID)
@@ -1062,6 +1222,385 @@ func TestMetaState(t *testing.T) {
 						continue
 					}
 				}
+				Convey("fork database", func() {
+					nonce, err := ms.nextNonce(addr2)
+					So(err, ShouldBeNil)
+					ps.TargetUser = []proto.AccountAddress{addr4}
+					ps.Nonce = nonce
+					err = ps.Sign(privKey2)
+					So(err, ShouldBeNil)
+					err = ms.apply(&ps, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					ms.commit()
+
+					fd := types.NewForkDatabase(&types.ForkDatabaseHeader{
+						CreateDatabaseHeader: types.CreateDatabaseHeader{
+							Owner: addr1,
+							ResourceMeta: types.ResourceMeta{
+								TargetMiners: []proto.AccountAddress{addr2},
+								Node:         1,
+							},
+							GasPrice:       1,
+							AdvancePayment: 3600000,
+							TokenType:      types.Particle,
+						},
+						Lineage: types.Lineage{
+							Source: dbID,
+							Height: 10,
+							Block:  hash.Hash{0x1},
+						},
+					})
+					// addr1 is only a reader of the source database now
+					fd.Nonce, err = ms.nextNonce(addr1)
+					So(err, ShouldBeNil)
+					err = fd.Sign(privKey1)
+					So(err, ShouldBeNil)
+					err = ms.apply(fd, proto.AccountAddress{}, 0)
+					So(errors.Cause(err), ShouldEqual, ErrAccountPermissionDeny)
+
+					// addr3(admin) update addr4 as admin, who is able to fork the database then
+					up.TargetUser = addr4
+					up.Permission = types.Admin
+					up.Nonce, err = ms.nextNonce(addr3)
+					So(err, ShouldBeNil)
+					err = up.Sign(privKey3)
+					So(err, ShouldBeNil)
+					err = ms.apply(&up, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					ms.commit()
+
+					fd.Owner = addr4
+					fd.Nonce, err = ms.nextNonce(addr4)
+					So(err, ShouldBeNil)
+					fd.Lineage.Source = proto.DatabaseID("not_exist")
+					err = fd.Sign(privKey4)
+					So(err, ShouldBeNil)
+					err = ms.apply(fd, proto.AccountAddress{}, 0)
+					So(errors.Cause(err), ShouldEqual, ErrDatabaseNotFound)
+					fd.Lineage.Source = ""
+					err = fd.Sign(privKey4)
+					So(err, ShouldBeNil)
+					err = ms.apply(fd, proto.AccountAddress{}, 0)
+					So(errors.Cause(err), ShouldEqual, ErrInvalidLineage)
+
+					fd.Lineage.Source = dbID
+					err = fd.Sign(privKey4)
+					So(err, ShouldBeNil)
+					err = ms.apply(fd, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					ms.commit()
+
+					forkID := proto.FromAccountAndNonce(fd.Owner, uint32(fd.Nonce))
+					fo, ok := ms.loadSQLChainObject(forkID)
+					So(ok, ShouldBeTrue)
+					So(fo.Owner, ShouldEqual, addr4)
+					So(fo.Miners, ShouldHaveLength, 1)
+					So(fo.Miners[0].Address, ShouldEqual, addr2)
+					var genesis = &types.Block{}
+					err = utils.DecodeMsgPack(fo.EncodedGenesis, genesis)
+					So(err, ShouldBeNil)
+					So(*genesis.Lineage(), ShouldResemble, fd.Lineage)
+				})
+				Convey("deposit to and withdraw from database", func() {
+					var (
+						minDep = minDeposit(co.GasPrice, uint64(len(co.Miners)))
+						apply  = func(tx pi.Transaction, addr proto.AccountAddress,
+							priv *asymmetric.PrivateKey) error {
+							nonce, err := ms.nextNonce(addr)
+							So(err, ShouldBeNil)
+							switch t := tx.(type) {
+							case *types.DepositToDatabase:
+								t.Nonce = nonce
+							case *types.WithdrawFromDatabase:
+								t.Nonce = nonce
+							}
+							So(tx.Sign(priv), ShouldBeNil)
+							if err = ms.apply(tx, proto.AccountAddress{}, 0); err == nil {
+								ms.commit()
+							}
+							return err
+						}
+						deposit = func(amount uint64) *types.DepositToDatabase {
+							return types.NewDepositToDatabase(&types.DepositToDatabaseHeader{
+								TargetSQLChain: dbAccount,
+								Amount:         amount,
+								TokenType:      types.Particle,
+							})
+						}
+						withdraw = func(amount uint64) *types.WithdrawFromDatabase {
+							return types.NewWithdrawFromDatabase(&types.WithdrawFromDatabaseHeader{
+								TargetSQLChain: dbAccount,
+								Amount:         amount,
+								TokenType:      types.Particle,
+							})
+						}
+						user = func(addr proto.AccountAddress) *types.SQLChainUser {
+							profile, ok := ms.loadSQLChainObject(dbID)
+							So(ok, ShouldBeTrue)
+							for _, v := range profile.Users {
+								if v.Address == addr {
+									return v
+								}
+							}
+							return nil
+						}
+					)
+
+					b1, ok := ms.loadAccountTokenBalance(addr4, types.Particle)
+					So(ok, ShouldBeTrue)
+					err = apply(deposit(minDep+1000000), addr4, privKey4)
+					So(err, ShouldBeNil)
+					b2, ok := ms.loadAccountTokenBalance(addr4, types.Particle)
+					So(ok, ShouldBeTrue)
+					So(b1-b2, ShouldEqual, minDep+1000000)
+					So(user(addr4).Deposit, ShouldEqual, minDep)
+					So(user(addr4).AdvancePayment, ShouldEqual, 1000000)
+					So(user(addr4).Status, ShouldEqual, types.Reminder)
+					err = apply(deposit(minDep), addr4, privKey4)
+					So(err, ShouldBeNil)
+					So(user(addr4).AdvancePayment, ShouldEqual, minDep+1000000)
+					So(user(addr4).Status, ShouldEqual, types.Normal)
+
+					// invalid deposits and withdrawals
+					var invalid = deposit(1)
+					invalid.TokenType = types.Wave
+					err = apply(invalid, addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrWrongTokenType)
+					invalid = deposit(1)
+					invalid.TargetSQLChain = addr1
+					err = apply(invalid, addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrDatabaseNotFound)
+					err = apply(deposit(1), addr2, privKey2)
+					So(errors.Cause(err), ShouldEqual, ErrDatabaseUserNotFound)
+					err = apply(withdraw(minDep+1000001), addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientAdvancePayment)
+
+					b1, _ = ms.loadAccountTokenBalance(addr4, types.Particle)
+					err = apply(withdraw(2000000), addr4, privKey4)
+					So(err, ShouldBeNil)
+					b2, _ = ms.loadAccountTokenBalance(addr4, types.Particle)
+					So(b2-b1, ShouldEqual, 2000000)
+					So(user(addr4).AdvancePayment, ShouldEqual, minDep-1000000)
+					So(user(addr4).Status, ShouldEqual, types.Reminder)
+
+					// make addr4 arrears
+					ub := types.NewUpdateBilling(&types.UpdateBillingHeader{
+						Receiver: dbAccount,
+						Users: []*types.UserCost{{
+							User:   addr4,
+							Cost:   minDep,
+							Miners: []*types.MinerIncome{{Miner: addr2, Income: minDep}},
+						}},
+					})
+					ub.Nonce, err = ms.nextNonce(addr2)
+					So(err, ShouldBeNil)
+					So(ub.Sign(privKey2), ShouldBeNil)
+					So(ms.apply(ub, proto.AccountAddress{}, 0), ShouldBeNil)
+					ms.commit()
+					So(user(addr4).Arrears, ShouldEqual, 1000000)
+					So(user(addr4).Status, ShouldEqual, types.Arrears)
+
+					err = apply(withdraw(1), addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrOutstandingArrears)
+					err = apply(deposit(999999), addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientTransfer)
+					err = apply(deposit(1500000), addr4, privKey4)
+					So(err, ShouldBeNil)
+					So(user(addr4).Arrears, ShouldEqual, 0)
+					So(user(addr4).AdvancePayment, ShouldEqual, 500000)
+					So(user(addr4).Status, ShouldEqual, types.Reminder)
+					profile, ok := ms.loadSQLChainObject(dbID)
+					So(ok, ShouldBeTrue)
+					So(profile.Miners[0].UserArrears, ShouldBeEmpty)
+					So(profile.Miners[0].PendingIncome, ShouldEqual, minDep)
+
+					// miner keeps the minimum deposit while serving the database
+					var minerDeposit = profile.Miners[0].Deposit
+					So(minerDeposit, ShouldEqual, conf.GConf.MinProviderDeposit)
+					err = apply(withdraw(minerDeposit+1), addr2, privKey2)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientDeposit)
+					err = apply(withdraw(minerDeposit), addr2, privKey2)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientDeposit)
+					err = apply(withdraw(1), addr2, privKey2)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientDeposit)
+					profile.Miners[0].Deposit += 1000
+					ms.dirty.databases[dbID] = profile
+					ms.commit()
+					b1, _ = ms.loadAccountTokenBalance(addr2, types.Particle)
+					err = apply(withdraw(1001), addr2, privKey2)
+					So(errors.Cause(err), ShouldEqual, ErrInsufficientDeposit)
+					err = apply(withdraw(1000), addr2, privKey2)
+					So(err, ShouldBeNil)
+					b2, _ = ms.loadAccountTokenBalance(addr2, types.Particle)
+					So(b2-b1, ShouldEqual, 1000)
+					profile, ok = ms.loadSQLChainObject(dbID)
+					So(ok, ShouldBeTrue)
+					So(profile.Miners[0].Deposit, ShouldEqual, minerDeposit)
+
+					// a failed deposit with fee only charges the fee
+					for _, v := range profile.Users {
+						if v.Address == addr4 {
+							v.AdvancePayment = math.MaxUint64 - 10
+						}
+					}
+					ms.dirty.databases[dbID] = profile
+					ms.commit()
+					b1, _ = ms.loadAccountTokenBalance(addr4, types.Particle)
+					n1, err := ms.nextNonce(addr4)
+					So(err, ShouldBeNil)
+					var overflow = deposit(1000)
+					overflow.Fee = 7
+					err = apply(overflow, addr4, privKey4)
+					So(errors.Cause(err), ShouldEqual, ErrBalanceOverflow)
+					So(isIncluded(err), ShouldBeTrue)
+					ms.commit()
+					b2, _ = ms.loadAccountTokenBalance(addr4, types.Particle)
+					So(b1-b2, ShouldEqual, 7)
+					n2, err := ms.nextNonce(addr4)
+					So(err, ShouldBeNil)
+					So(n2, ShouldEqual, n1+1)
+					So(user(addr4).AdvancePayment, ShouldEqual, uint64(math.MaxUint64-10))
+				})
+				Convey("transfer database ownership", func() {
+					var (
+						apply = func(newOwner proto.AccountAddress, requireAcceptance bool,
+							addr proto.AccountAddress, priv *asymmetric.PrivateKey) error {
+							tx := types.NewTransferDatabaseOwnership(
+								&types.TransferDatabaseOwnershipHeader{
+									TargetSQLChain:    dbAccount,
+									NewOwner:          newOwner,
+									RequireAcceptance: requireAcceptance,
+								})
+							nonce, err := ms.nextNonce(addr)
+							So(err, ShouldBeNil)
+							tx.Nonce = nonce
+							So(tx.Sign(priv), ShouldBeNil)
+							if err = ms.apply(tx, proto.AccountAddress{}, 0); err == nil {
+								ms.commit()
+							}
+							return err
+						}
+						perm = func(profile *types.SQLChainProfile, addr proto.AccountAddress) (
+							p types.UserPermission) {
+							for _, v := range profile.Users {
+								if v.Address == addr {
+									return v.Permission
+								}
+							}
+							return types.NumberOfUserPermission
+						}
+					)
+					// addr3 is an admin but not the owner
+					err = apply(addr3, false, addr3, privKey3)
+					So(errors.Cause(err), ShouldEqual, ErrAccountPermissionDeny)
+					err = apply(proto.AccountAddress{}, false, addr1, privKey1)
+					So(errors.Cause(err), ShouldEqual, ErrInvalidOwner)
+
+					// transfer to addr2 at once
+					err = apply(addr2, false, addr1, privKey1)
+					So(err, ShouldBeNil)
+					profile, ok := ms.loadSQLChainObject(dbID)
+					So(ok, ShouldBeTrue)
+					So(profile.Owner, ShouldEqual, addr2)
+					So(perm(profile, addr2), ShouldEqual, types.Admin)
+					So(perm(profile, addr1), ShouldEqual, types.Void)
+					So(perm(profile, addr3), ShouldEqual, types.Admin)
+
+					// transfer to addr4 which requires acceptance
+					err = apply(addr4, true, addr2, privKey2)
+					So(err, ShouldBeNil)
+					profile, ok = ms.loadSQLChainObject(dbID)
+					So(ok, ShouldBeTrue)
+					So(profile.Owner, ShouldEqual, addr2)
+					So(profile.PendingOwner, ShouldEqual, addr4)
+					So(perm(profile, addr4), ShouldEqual, types.Read)
+					// only the pending owner can accept it
+					err = apply(addr3, false, addr3, privKey3)
+					So(errors.Cause(err), ShouldEqual, ErrAccountPermissionDeny)
+					err = apply(addr4, false, addr4, privKey4)
+					So(err, ShouldBeNil)
+					profile, ok = ms.loadSQLChainObject(dbID)
+					So(ok, ShouldBeTrue)
+					So(profile.Owner, ShouldEqual, addr4)
+					So(profile.PendingOwner, ShouldEqual, proto.AccountAddress{})
+					So(perm(profile, addr4), ShouldEqual, types.Admin)
+					So(perm(profile, addr2), ShouldEqual, types.Void)
+				})
+				Convey("multisig account", func() {
+					account, err := types.NewMultiSigAccount(2, []*asymmetric.PublicKey{
+						privKey2.PubKey(), privKey3.PubKey(), privKey4.PubKey(),
+					})
+					So(err, ShouldBeNil)
+					msAddr, err := account.Address()
+					So(err, ShouldBeNil)
+					var (
+						create = func() error {
+							tx := types.NewCreateMultiSigAccount(
+								&types.CreateMultiSigAccountHeader{Account: *account})
+							nonce, err := ms.nextNonce(addr1)
+							So(err, ShouldBeNil)
+							tx.Nonce = nonce
+							So(tx.Sign(privKey1), ShouldBeNil)
+							if err = ms.apply(tx, proto.AccountAddress{}, 0); err == nil {
+								ms.commit()
+							}
+							return err
+						}
+						transfer = func(sender proto.AccountAddress) error {
+							nonce, err := ms.nextNonce(msAddr)
+							So(err, ShouldBeNil)
+							tx := types.NewMultiSig(account, types.NewTransfer(&types.TransferHeader{
+								Sender:    sender,
+								Receiver:  addr2,
+								Amount:    1,
+								TokenType: types.Particle,
+								Nonce:     nonce,
+							}))
+							So(tx.Sign(privKey2), ShouldBeNil)
+							So(errors.Cause(tx.Verify()), ShouldEqual, types.ErrMultiSigThreshold)
+							So(tx.Sign(privKey4), ShouldBeNil)
+							So(tx.Verify(), ShouldBeNil)
+							if err = ms.apply(tx, proto.AccountAddress{}, 0); err == nil {
+								ms.commit()
+							}
+							return err
+						}
+					)
+					// not registered yet
+					err = ms.apply(types.NewMultiSig(account, types.NewTransfer(
+						&types.TransferHeader{Sender: msAddr})), proto.AccountAddress{}, 0)
+					So(err, ShouldNotBeNil)
+
+					err = create()
+					So(err, ShouldBeNil)
+					o, loaded := ms.loadAccountObject(msAddr)
+					So(loaded, ShouldBeTrue)
+					So(o.MultiSig, ShouldResemble, account)
+					err = create()
+					So(errors.Cause(err), ShouldEqual, ErrAccountExists)
+
+					tran := types.NewTransfer(&types.TransferHeader{
+						Sender:    addr1,
+						Receiver:  msAddr,
+						Amount:    1,
+						TokenType: types.Particle,
+					})
+					tran.Nonce, err = ms.nextNonce(addr1)
+					So(err, ShouldBeNil)
+					So(tran.Sign(privKey1), ShouldBeNil)
+					err = ms.apply(tran, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					ms.commit()
+
+					// the multisig account can't spend others' tokens
+					err = transfer(addr1)
+					So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+					err = transfer(msAddr)
+					So(err, ShouldBeNil)
+					b, ok := ms.loadAccountTokenBalance(msAddr, types.Particle)
+					So(ok, ShouldBeTrue)
+					So(b, ShouldEqual, 0)
+				})
 				Convey("transfer token", func() {
 					addr1B1, ok := ms.loadAccountTokenBalance(addr1, types.Particle)
 					So(ok, ShouldBeTrue)
@@ -1078,7 +1617,7 @@ func TestMetaState(t *testing.T) {
 					trans1.Nonce = nonce
 					err = trans1.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans1)
+					err = ms.apply(trans1, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 					addr1B2, ok := ms.loadAccountTokenBalance(addr1, types.Particle)
@@ -1109,7 +1648,7 @@ func TestMetaState(t *testing.T) {
 					trans2.Nonce = nonce
 					err = trans2.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans2)
+					err = ms.apply(trans2, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					// ms.commit()
 					profile, ok = ms.loadSQLChainObject(dbID)
@@ -1142,7 +1681,7 @@ func TestMetaState(t *testing.T) {
 					ub.Nonce = nonce
 					err = ub.Sign(privKey2)
 					So(err, ShouldBeNil)
-					err = ms.apply(ub)
+					err = ms.apply(ub, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 					profile, ok = ms.loadSQLChainObject(dbID)
@@ -1166,7 +1705,7 @@ func TestMetaState(t *testing.T) {
 					trans3.Nonce = nonce
 					err = trans3.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans3)
+					err = ms.apply(trans3, proto.AccountAddress{}, 0)
 					So(err, ShouldEqual, ErrInsufficientTransfer)
 					profile, ok = ms.loadSQLChainObject(dbID)
 					So(ok, ShouldBeTrue)
@@ -1189,7 +1728,7 @@ func TestMetaState(t *testing.T) {
 					trans4.Nonce = nonce
 					err = trans4.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans4)
+					err = ms.apply(trans4, proto.AccountAddress{}, 0)
 					ms.commit()
 					profile, ok = ms.loadSQLChainObject(dbID)
 					So(ok, ShouldBeTrue)
@@ -1205,7 +1744,7 @@ func TestMetaState(t *testing.T) {
 					invalidIk1 := &types.IssueKeys{}
 					err = invalidIk1.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(invalidIk1)
+					err = ms.apply(invalidIk1, proto.AccountAddress{}, 0)
 					So(err, ShouldEqual, ErrInvalidAccountNonce)
 					invalidIk2 := &types.IssueKeys{
 						IssueKeysHeader: types.IssueKeysHeader{
@@ -1215,7 +1754,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = invalidIk2.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(invalidIk2)
+					err = ms.apply(invalidIk2, proto.AccountAddress{}, 0)
 					So(err, ShouldEqual, ErrDatabaseNotFound)
 					invalidIk3 := &types.IssueKeys{
 						IssueKeysHeader: types.IssueKeysHeader{
@@ -1225,7 +1764,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = invalidIk3.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(invalidIk3)
+					err = ms.apply(invalidIk3, proto.AccountAddress{}, 0)
 					So(err, ShouldEqual, ErrAccountPermissionDeny)
 					ik1 := &types.IssueKeys{
 						IssueKeysHeader: types.IssueKeysHeader{
@@ -1235,7 +1774,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = ik1.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(ik1)
+					err = ms.apply(ik1, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 					encryptKey := "12345"
@@ -1253,7 +1792,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = ik2.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(ik2)
+					err = ms.apply(ik2, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 
@@ -1273,7 +1812,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = ub1.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(ub1)
+					err = ms.apply(ub1, proto.AccountAddress{}, 0)
 					So(errors.Cause(err), ShouldEqual, ErrDatabaseNotFound)
 					trans1 := types.NewTransfer(&types.TransferHeader{
 						Sender:    addr1,
@@ -1286,7 +1825,7 @@ func TestMetaState(t *testing.T) {
 					trans1.Nonce = nonce
 					err = trans1.Sign(privKey1)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans1)
+					err = ms.apply(trans1, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 					trans2 := types.NewTransfer(&types.TransferHeader{
@@ -1300,7 +1839,7 @@ func TestMetaState(t *testing.T) {
 					trans2.Nonce = nonce
 					err = trans2.Sign(privKey3)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans2)
+					err = ms.apply(trans2, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 					trans3 := types.NewTransfer(&types.TransferHeader{
@@ -1314,7 +1853,7 @@ func TestMetaState(t *testing.T) {
 					trans3.Nonce = nonce
 					err = trans3.Sign(privKey4)
 					So(err, ShouldBeNil)
-					err = ms.apply(trans3)
+					err = ms.apply(trans3, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					ms.commit()
 
@@ -1359,7 +1898,7 @@ func TestMetaState(t *testing.T) {
 					}
 					err = ub2.Sign(privKey2)
 					So(err, ShouldBeNil)
-					err = ms.apply(ub2)
+					err = ms.apply(ub2, proto.AccountAddress{}, 0)
 					ms.commit()
 					sqlchain, loaded := ms.loadSQLChainObject(dbID)
 					So(loaded, ShouldBeTrue)
@@ -1406,15 +1945,431 @@ func TestMetaState(t *testing.T) {
 					}
 					err = ub3.Sign(privKey2)
 					So(err, ShouldBeNil)
-					err = ms.apply(ub3)
+					err = ms.apply(ub3, proto.AccountAddress{}, 0)
 					So(err, ShouldBeNil)
 					sqlchain, loaded = ms.loadSQLChainObject(dbID)
 					So(loaded, ShouldBeTrue)
 					So(len(sqlchain.Miners), ShouldEqual, 1)
 					So(sqlchain.Miners[0].PendingIncome, ShouldEqual, 115)
 					So(sqlchain.Miners[0].ReceivedIncome, ShouldEqual, 115)
+					ub4 := &types.UpdateBilling{
+						UpdateBillingHeader: types.UpdateBillingHeader{
+							Receiver:     dbAccount,
+							FailedMiners: []proto.AccountAddress{sqlchain.Miners[0].Address},
+							Nonce:        4,
+						},
+					}
+					err = ub4.Sign(privKey2)
+					So(err, ShouldBeNil)
+					err = ms.apply(ub4, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					sqlchain, loaded = ms.loadSQLChainObject(dbID)
+					So(loaded, ShouldBeTrue)
+					So(sqlchain.Miners[0].Status, ShouldEqual, types.Arbitration)
+					ub5 := &types.UpdateBilling{
+						UpdateBillingHeader: types.UpdateBillingHeader{
+							Receiver: dbAccount,
+							Nonce:    5,
+						},
+					}
+					err = ub5.Sign(privKey2)
+					So(err, ShouldBeNil)
+					err = ms.apply(ub5, proto.AccountAddress{}, 0)
+					So(err, ShouldBeNil)
+					sqlchain, loaded = ms.loadSQLChainObject(dbID)
+					So(loaded, ShouldBeTrue)
+					So(sqlchain.Miners[0].Status, ShouldEqual, types.Normal)
 				})
 			})
 		})
 	})
 }
+
+func TestMetaStateDispute(t *testing.T) {
+	Convey("Given a metaState with a database served by 3 miners", t, func() {
+		var (
+			err      error
+			ms       = newMetaState()
+			dbID     proto.DatabaseID
+			userKey  *asymmetric.PrivateKey
+			userAddr proto.AccountAddress
+			keys     [3]*asymmetric.PrivateKey
+			profile  = &types.SQLChainProfile{}
+			nonce    pi.AccountNonce
+		)
+		userKey, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		userAddr, err = crypto.PubKeyHash(userKey.PubKey())
+		So(err, ShouldBeNil)
+		dbID = proto.FromAccountAndNonce(userAddr, 1)
+		profile.ID = dbID
+		for i := range keys {
+			keys[i], _, err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			addr, err := crypto.PubKeyHash(keys[i].PubKey())
+			So(err, ShouldBeNil)
+			profile.Miners = append(profile.Miners, &types.MinerInfo{
+				Address: addr,
+				NodeID:  proto.NodeID(addr.String()),
+				Deposit: 100,
+				Status:  types.Normal,
+			})
+		}
+		profile.Users = []*types.SQLChainUser{{Address: userAddr, Permission: types.Read}}
+		ms.loadOrStoreAccountObject(userAddr, &types.Account{Address: userAddr})
+		ms.loadOrStoreSQLChainObject(dbID, profile)
+		ms.commit()
+		dbAccount, err := dbID.AccountAddress()
+		So(err, ShouldBeNil)
+
+		var (
+			req = types.SignedRequestHeader{RequestHeader: types.RequestHeader{
+				QueryType:  types.ReadQuery,
+				NodeID:     proto.NodeID(userAddr.String()),
+				DatabaseID: dbID,
+			}}
+			respondAt = func(i int, offset uint64, payload string) (resp *types.SignedResponseHeader) {
+				resp = &types.SignedResponseHeader{ResponseHeader: types.ResponseHeader{
+					Request:     req,
+					NodeID:      profile.Miners[i].NodeID,
+					LogOffset:   offset,
+					PayloadHash: hash.THashH([]byte(payload)),
+				}}
+				So(resp.Sign(keys[i]), ShouldBeNil)
+				return
+			}
+			respond = func(i int, payload string) *types.SignedResponseHeader {
+				return respondAt(i, 1, payload)
+			}
+			dispute = func(resp *types.SignedResponseHeader, witnesses ...*types.SignedResponseHeader) error {
+				var tx = types.NewDispute(&types.DisputeHeader{
+					Receiver:  dbAccount,
+					Response:  *resp,
+					Witnesses: witnesses,
+					Nonce:     nonce,
+				})
+				So(tx.Sign(userKey), ShouldBeNil)
+				if err := tx.Verify(); err != nil {
+					return err
+				}
+				return ms.apply(tx, proto.AccountAddress{}, 0)
+			}
+		)
+		So(req.Sign(userKey), ShouldBeNil)
+
+		Convey("The dispute should be rejected without enough witnesses", func() {
+			err = dispute(respond(0, "wrong"), respond(1, "right"))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDispute)
+			err = dispute(respond(0, "wrong"), respond(1, "right"), respond(1, "right"))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDispute)
+			err = dispute(respond(0, "wrong"), respond(0, "right"), respond(1, "right"))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDispute)
+		})
+		Convey("The dispute should be rejected if the witnesses disagree", func() {
+			err = dispute(respond(0, "wrong"), respond(1, "right"), respond(2, "other"))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDispute)
+			err = dispute(respond(0, "right"), respond(1, "right"), respond(2, "right"))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidDispute)
+		})
+		Convey("The dispute should be rejected if the witnesses are replayed after a write", func() {
+			// The honest miner answered at offset 1, and the user collects the responses of the
+			// same read from the other miners after a write of its own
+			err = dispute(respondAt(0, 1, "before"), respondAt(1, 2, "after"), respondAt(2, 2, "after"))
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidDispute)
+			err = dispute(respondAt(0, 1, "before"), respondAt(1, 1, "after"), respondAt(2, 2, "after"))
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidDispute)
+			co, loaded := ms.loadSQLChainObject(dbID)
+			So(loaded, ShouldBeTrue)
+			So(co.Miners[0].Deposit, ShouldEqual, 100)
+			So(co.Miners[0].Status, ShouldEqual, types.Normal)
+		})
+		Convey("The dispute should be rejected if it is not submitted by the request owner", func() {
+			var tx = types.NewDispute(&types.DisputeHeader{
+				Receiver:  dbAccount,
+				Response:  *respond(0, "wrong"),
+				Witnesses: []*types.SignedResponseHeader{respond(1, "right"), respond(2, "right")},
+			})
+			So(tx.Sign(keys[1]), ShouldBeNil)
+			err = ms.applyTransaction(tx, 0)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+		})
+		Convey("The guilty miner should be slashed", func() {
+			err = dispute(respond(0, "wrong"), respond(1, "right"), respond(2, "right"))
+			So(err, ShouldBeNil)
+			ms.commit()
+			co, loaded := ms.loadSQLChainObject(dbID)
+			So(loaded, ShouldBeTrue)
+			So(co.Miners[0].Deposit, ShouldEqual, 0)
+			So(co.Miners[0].Status, ShouldEqual, types.Arbitration)
+			So(co.Miners[1].Deposit, ShouldEqual, 100)
+			So(co.Miners[1].Status, ShouldEqual, types.Normal)
+			balance, loaded := ms.loadAccountTokenBalance(userAddr, types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 100)
+		})
+	})
+}
+
+func TestMetaStatePlacement(t *testing.T) {
+	Convey("Given a metaState with labeled providers", t, func() {
+		var (
+			ms        = newMetaState()
+			user      = proto.AccountAddress{0x10}
+			operators = []string{"a", "a", "a", "b", "c"}
+			miners    = make([]proto.AccountAddress, len(operators))
+		)
+		for i, v := range operators {
+			miners[i] = proto.AccountAddress{byte(i + 1)}
+			ms.dirty.provider[miners[i]] = &types.ProviderProfile{
+				Provider: miners[i],
+				NodeID:   proto.NodeID(miners[i].String()),
+				Labels: types.Labels{
+					{Key: types.LabelOperator, Value: v},
+					{Key: types.LabelDatacenter, Value: fmt.Sprintf("dc%d", i%2)},
+				},
+			}
+		}
+		// rate the miners in order
+		for i, v := range miners {
+			for j := 0; j < len(miners)-i; j++ {
+				ms.rateMiner(v, types.RatingUnit)
+			}
+		}
+		var req = types.NewCreateDatabase(&types.CreateDatabaseHeader{
+			ResourceMeta: types.ResourceMeta{Node: 3},
+		})
+		Convey("The higher rated miners should be picked without constraints", func() {
+			selected, err := ms.filterNMiners(req, user, nil, 3)
+			So(err, ShouldBeNil)
+			So(selected, ShouldHaveLength, 3)
+			for i, v := range selected {
+				So(v.Address, ShouldEqual, miners[i])
+			}
+		})
+		Convey("The miners with avoided or missing labels should be filtered", func() {
+			req.ResourceMeta.Placement.AvoidLabels = types.Labels{
+				{Key: types.LabelDatacenter, Value: "dc0"},
+			}
+			_, err := ms.filterNMiners(req, user, nil, 3)
+			So(err, ShouldEqual, ErrNoEnoughMiner)
+			selected, err := ms.filterNMiners(req, user, nil, 2)
+			So(err, ShouldBeNil)
+			So(selected[0].Address, ShouldEqual, miners[1])
+			So(selected[1].Address, ShouldEqual, miners[3])
+
+			req.ResourceMeta.Placement.AvoidLabels = nil
+			req.ResourceMeta.Placement.MatchLabels = types.Labels{
+				{Key: types.LabelOperator, Value: "a"},
+			}
+			selected, err = ms.filterNMiners(req, user, nil, 3)
+			So(err, ShouldBeNil)
+			for i, v := range selected {
+				So(v.Address, ShouldEqual, miners[i])
+			}
+			req.ResourceMeta.Placement.MatchLabels = types.Labels{
+				{Key: types.LabelHardwareClass, Value: "ssd"},
+			}
+			_, err = ms.filterNMiners(req, user, nil, 1)
+			So(err, ShouldEqual, ErrNoEnoughMiner)
+		})
+		Convey("The miners should spread across distinct operators", func() {
+			req.ResourceMeta.Placement.SpreadKey = types.LabelOperator
+			req.ResourceMeta.Placement.Spread = 3
+			var spread = make(map[string]struct{})
+			selected, err := ms.filterNMiners(req, user, spread, 3)
+			So(err, ShouldBeNil)
+			So(spread, ShouldHaveLength, 3)
+			So(selected[0].Address, ShouldEqual, miners[0])
+			So(selected[1].Address, ShouldEqual, miners[3])
+			So(selected[2].Address, ShouldEqual, miners[4])
+
+			req.ResourceMeta.Placement.Spread = 2
+			spread = make(map[string]struct{})
+			selected, err = ms.filterNMiners(req, user, spread, 3)
+			So(err, ShouldBeNil)
+			So(spread, ShouldHaveLength, 2)
+			So(selected[0].Address, ShouldEqual, miners[0])
+			So(selected[1].Address, ShouldEqual, miners[1])
+			So(selected[2].Address, ShouldEqual, miners[3])
+
+			req.ResourceMeta.Placement.Spread = 4
+			spread = make(map[string]struct{})
+			_, err = ms.filterNMiners(req, user, spread, 3)
+			So(err, ShouldBeNil)
+			So(len(spread), ShouldBeLessThan, 4)
+		})
+	})
+}
+
+func TestMetaStateWithdrawService(t *testing.T) {
+	Convey("Given a metaState with a database and some providers", t, func() {
+		var (
+			ms      = newMetaState()
+			keys    = make([]*asymmetric.PrivateKey, 5)
+			addrs   = make([]proto.AccountAddress, len(keys))
+			owner   = proto.AccountAddress{0x10}
+			dbID    = proto.FromAccountAndNonce(owner, 1)
+			profile = &types.SQLChainProfile{ID: dbID, Owner: owner, GasPrice: 1}
+			err     error
+		)
+		for i := range keys {
+			keys[i], _, err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			addrs[i], err = crypto.PubKeyHash(keys[i].PubKey())
+			So(err, ShouldBeNil)
+			ms.loadOrStoreAccountObject(addrs[i], &types.Account{Address: addrs[i]})
+		}
+		// miners 0 and 1 serve the database, miners 2, 3 and 4 provide service
+		for i := 0; i < 2; i++ {
+			profile.Miners = append(profile.Miners, &types.MinerInfo{
+				Address: addrs[i],
+				NodeID:  proto.NodeID(addrs[i].String()),
+				Deposit: 100,
+				Status:  types.Normal,
+			})
+		}
+		for i := 2; i < len(addrs); i++ {
+			ms.loadOrStoreProviderObject(addrs[i], &types.ProviderProfile{
+				Provider: addrs[i],
+				NodeID:   proto.NodeID(addrs[i].String()),
+				Deposit:  10,
+				GasPrice: 1,
+			})
+		}
+		ms.loadOrStoreSQLChainObject(dbID, profile)
+		ms.commit()
+		var withdraw = func(i int, drain bool) error {
+			var tx = types.NewWithdrawService(&types.WithdrawServiceHeader{Drain: drain})
+			So(tx.Sign(keys[i]), ShouldBeNil)
+			return ms.applyTransaction(tx, 0)
+		}
+
+		Convey("The provider should be removed and refunded on withdrawal", func() {
+			So(withdraw(4, false), ShouldBeNil)
+			ms.commit()
+			_, loaded := ms.loadProviderObject(addrs[4])
+			So(loaded, ShouldBeFalse)
+			balance, loaded := ms.loadAccountTokenBalance(addrs[4], types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 10)
+			err = withdraw(4, false)
+			So(errors.Cause(err), ShouldEqual, ErrNoSuchProvider)
+			err = withdraw(0, false)
+			So(errors.Cause(err), ShouldEqual, ErrNoSuchProvider)
+		})
+		Convey("The miner in arbitration should not drain", func() {
+			co, _ := ms.loadSQLChainObject(dbID)
+			co.Miners[0].Status = types.Arbitration
+			ms.dirty.databases[dbID] = co
+			ms.commit()
+			err = withdraw(0, true)
+			So(errors.Cause(err), ShouldEqual, ErrMinerInArbitration)
+		})
+		Convey("The miner should drain without any replacement", func() {
+			for i := 2; i < len(addrs); i++ {
+				ms.deleteProviderObject(addrs[i])
+			}
+			ms.commit()
+			err = withdraw(0, true)
+			So(errors.Cause(err), ShouldEqual, ErrNoEnoughMiner)
+		})
+		Convey("The draining miner should be replaced and released after migration", func() {
+			So(withdraw(0, true), ShouldBeNil)
+			ms.commit()
+			co, loaded := ms.loadSQLChainObject(dbID)
+			So(loaded, ShouldBeTrue)
+			So(co.Miners, ShouldHaveLength, 3)
+			So(co.Miners[0].Status, ShouldEqual, types.Draining)
+			var replacement = co.Miners[2].Address
+			So(replacement, ShouldNotEqual, addrs[1])
+			_, loaded = ms.loadProviderObject(replacement)
+			So(loaded, ShouldBeFalse)
+
+			// drain again without effect
+			err = withdraw(0, true)
+			So(errors.Cause(err), ShouldEqual, ErrNoSuchProvider)
+
+			So(co.Miners[2].Status, ShouldEqual, types.Syncing)
+
+			// The draining miner cannot release itself, neither can the others before the
+			// replacement confirms that it has caught up
+			var billing = types.NewUpdateBilling(&types.UpdateBillingHeader{})
+			So(ms.releaseDrainedMiners(co, billing, addrs[0]), ShouldBeNil)
+			So(co.Miners, ShouldHaveLength, 3)
+			So(ms.releaseDrainedMiners(co, billing, addrs[1]), ShouldBeNil)
+			So(co.Miners, ShouldHaveLength, 3)
+			So(co.Miners[2].Status, ShouldEqual, types.Syncing)
+
+			// The replacement reported with no-acks is not confirmed
+			billing.NoAckMiners = []proto.AccountAddress{replacement}
+			So(ms.releaseDrainedMiners(co, billing, replacement), ShouldBeNil)
+			So(co.Miners, ShouldHaveLength, 3)
+			So(co.Miners[2].Status, ShouldEqual, types.Syncing)
+
+			billing.NoAckMiners = []proto.AccountAddress{addrs[0]}
+			So(ms.releaseDrainedMiners(co, billing, replacement), ShouldBeNil)
+			So(co.Miners, ShouldHaveLength, 2)
+			So(co.Miners[1].Status, ShouldEqual, types.Normal)
+			So(co.Miners[0].Address, ShouldEqual, addrs[1])
+			So(co.Miners[1].Address, ShouldEqual, replacement)
+			ms.commit()
+			balance, loaded := ms.loadAccountTokenBalance(addrs[0], types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(balance, ShouldEqual, 100)
+		})
+		Convey("The deposits should be held until the miner has finished all the drains", func() {
+			var (
+				dbID2    = proto.FromAccountAndNonce(owner, 2)
+				profile2 = &types.SQLChainProfile{ID: dbID2, Owner: owner, GasPrice: 1}
+				release  = func(id proto.DatabaseID) {
+					co, loaded := ms.loadSQLChainObject(id)
+					So(loaded, ShouldBeTrue)
+					var replacement = co.Miners[len(co.Miners)-1].Address
+					var billing = types.NewUpdateBilling(&types.UpdateBillingHeader{})
+					So(ms.releaseDrainedMiners(co, billing, replacement), ShouldBeNil)
+					for _, miner := range co.Miners {
+						So(miner.Address, ShouldNotEqual, addrs[0])
+					}
+					ms.dirty.databases[id] = co
+					ms.commit()
+				}
+				balance = func() uint64 {
+					balance, loaded := ms.loadAccountTokenBalance(addrs[0], types.Particle)
+					So(loaded, ShouldBeTrue)
+					return balance
+				}
+			)
+			profile2.Miners = []*types.MinerInfo{{
+				Address: addrs[0],
+				NodeID:  proto.NodeID(addrs[0].String()),
+				Deposit: 200,
+				Status:  types.Normal,
+			}}
+			ms.loadOrStoreSQLChainObject(dbID2, profile2)
+			ms.loadOrStoreProviderObject(addrs[0], &types.ProviderProfile{
+				Provider: addrs[0],
+				NodeID:   proto.NodeID(addrs[0].String()),
+				Deposit:  10,
+				GasPrice: 1,
+			})
+			ms.commit()
+
+			So(withdraw(0, true), ShouldBeNil)
+			ms.commit()
+			_, loaded := ms.loadProviderObject(addrs[0])
+			So(loaded, ShouldBeFalse)
+			So(balance(), ShouldEqual, 0)
+			co, _ := ms.loadSQLChainObject(dbID)
+			So(co.Miners[0].Deposit, ShouldEqual, 110)
+
+			release(dbID)
+			So(balance(), ShouldEqual, 0)
+			co, _ = ms.loadSQLChainObject(dbID2)
+			So(co.Miners[0].Status, ShouldEqual, types.Draining)
+			So(co.Miners[0].Deposit, ShouldEqual, 310)
+
+			release(dbID2)
+			So(balance(), ShouldEqual, 310)
+		})
+	})
+}
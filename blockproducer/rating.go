@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+)
+
+// Miner rating is a fixed-point moving average in [0, types.RatingUnit] of the scores of the
+// on-chain evidences of the miner behaviours. Integer arithmetic keeps the rating identical on all
+// block producers. A zero rating means no evidence yet, as the average never drops below 1 from a
+// positive initial rating.
+const (
+	// initialMinerRating is the rating of the miners without any evidence.
+	initialMinerRating = types.RatingUnit / 2
+	// ratingWeight is the weight in percent of the latest evidence in the moving average.
+	ratingWeight = 10
+	// lateBillingFactor is the multiple of the expected billing interval after which the billing
+	// of a database is considered late.
+	lateBillingFactor = 2
+)
+
+// Scores of the miner behaviour evidences.
+const (
+	// scoreBilling is the score of a miner submitting the billing of its database in time.
+	scoreBilling = types.RatingUnit
+	// scoreLateBilling is the score of a miner submitting a late billing.
+	scoreLateBilling = types.RatingUnit / 2
+	// scoreServing is the score of a miner earning income in a billing period.
+	scoreServing = types.RatingUnit
+	// scoreAbsent is the score of an idle miner of a database which served queries in a billing
+	// period.
+	scoreAbsent = types.RatingUnit / 5
+	// scoreNoAck is the score of a miner with unacknowledged responses in a billing period.
+	scoreNoAck = types.RatingUnit / 2
+	// scoreProofFailure is the score of a miner failed in storage proof.
+	scoreProofFailure = 0
+	// scoreGuilty is the score of a miner proved guilty in a dispute.
+	scoreGuilty = 0
+)
+
+// minerRating returns the rating of the miner account.
+func (s *metaState) minerRating(addr proto.AccountAddress) (rating uint64) {
+	if o, loaded := s.loadAccountObject(addr); loaded {
+		rating = o.Rating
+	}
+	if rating == 0 {
+		rating = initialMinerRating
+	}
+	return
+}
+
+// rateMiner updates the rating of the miner account with the score of a new evidence.
+func (s *metaState) rateMiner(addr proto.AccountAddress, score uint64) {
+	var o, loaded = s.loadAccountObject(addr)
+	if !loaded {
+		o = &types.Account{Address: addr}
+	}
+	var rating = o.Rating
+	if rating == 0 {
+		rating = initialMinerRating
+	}
+	if rating = ((100-ratingWeight)*rating + ratingWeight*score) / 100; rating == 0 {
+		rating = 1
+	}
+	o.Rating = rating
+	s.dirty.accounts[addr] = o
+}
+
+// rateBillingMiners rates the miners of the database profile from the billing submitted by
+// submitter at the block height. The submitter is rated for each of its billings, while the
+// evidences of the other miners are only counted from the first billing of a billing period, as
+// all the miners of the database submit the billings of a same period.
+func (s *metaState) rateBillingMiners(
+	profile *types.SQLChainProfile, tx *types.UpdateBilling, submitter proto.AccountAddress,
+	height uint32,
+) {
+	// Billing participation and regularity of the submitter
+	var score = scoreBilling
+	if profile.LastUpdatedHeight > 0 &&
+		height > profile.LastUpdatedHeight+lateBillingFactor*billingInterval {
+		score = scoreLateBilling
+	}
+	s.rateMiner(submitter, score)
+
+	// Billings within half an interval after the last rated one belong to the same period
+	if profile.LastRatedHeight > 0 && height < profile.LastRatedHeight+billingInterval/2 {
+		return
+	}
+	profile.LastRatedHeight = height
+
+	// Uptime of the miners serving queries, storage proofs and no-ack reports
+	var (
+		earned  = make(map[proto.AccountAddress]struct{})
+		failed  = make(map[proto.AccountAddress]struct{})
+		noAcked = make(map[proto.AccountAddress]struct{})
+	)
+	for _, v := range tx.Users {
+		for _, m := range v.Miners {
+			if m.Income > 0 {
+				earned[m.Miner] = struct{}{}
+			}
+		}
+	}
+	for _, v := range tx.FailedMiners {
+		failed[v] = struct{}{}
+	}
+	for _, v := range tx.NoAckMiners {
+		noAcked[v] = struct{}{}
+	}
+	for _, miner := range profile.Miners {
+		var addr = miner.Address
+		if _, ok := failed[addr]; ok {
+			s.rateMiner(addr, scoreProofFailure)
+			continue
+		}
+		if _, ok := noAcked[addr]; ok {
+			s.rateMiner(addr, scoreNoAck)
+		}
+		if _, ok := earned[addr]; ok {
+			s.rateMiner(addr, scoreServing)
+		} else if len(earned) > 0 {
+			s.rateMiner(addr, scoreAbsent)
+		}
+	}
+}
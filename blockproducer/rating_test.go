@@ -0,0 +1,135 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMinerRating(t *testing.T) {
+	Convey("Given a metaState and a database with some miners", t, func() {
+		var (
+			ms      = newMetaState()
+			miners  = []proto.AccountAddress{{0x1}, {0x2}, {0x3}, {0x4}}
+			user    = proto.AccountAddress{0x10}
+			profile = &types.SQLChainProfile{}
+		)
+		for _, v := range miners {
+			profile.Miners = append(profile.Miners, &types.MinerInfo{Address: v})
+		}
+		Convey("The miner without evidence should have the initial rating", func() {
+			So(ms.minerRating(miners[0]), ShouldEqual, initialMinerRating)
+		})
+		Convey("The miners should be rated by the billing evidences", func() {
+			var tx = types.NewUpdateBilling(&types.UpdateBillingHeader{
+				Users: []*types.UserCost{
+					{
+						User: user,
+						Miners: []*types.MinerIncome{
+							{Miner: miners[0], Income: 1},
+							{Miner: miners[1], Income: 1},
+						},
+					},
+				},
+				FailedMiners: []proto.AccountAddress{miners[2]},
+				NoAckMiners:  []proto.AccountAddress{miners[1]},
+			})
+			ms.rateBillingMiners(profile, tx, miners[0], 10)
+			ms.commit()
+			var ratings = make([]uint64, len(miners))
+			for i, v := range miners {
+				ratings[i] = ms.minerRating(v)
+			}
+			So(ratings[0], ShouldBeGreaterThan, initialMinerRating)
+			So(ratings[0], ShouldBeGreaterThan, ratings[1])
+			So(ratings[1], ShouldBeGreaterThan, ratings[3])
+			So(ratings[3], ShouldBeLessThan, initialMinerRating)
+			So(ratings[2], ShouldBeLessThan, ratings[3])
+			for _, v := range ratings {
+				So(v, ShouldBeBetween, 0, types.RatingUnit)
+			}
+
+			Convey("The higher rated providers should be preferred", func() {
+				for _, v := range miners {
+					ms.dirty.provider[v] = &types.ProviderProfile{
+						Provider: v,
+						NodeID:   proto.NodeID(v.String()),
+					}
+				}
+				var req = types.NewCreateDatabase(&types.CreateDatabaseHeader{
+					ResourceMeta: types.ResourceMeta{Node: 2},
+				})
+				selected, err := ms.filterNMiners(req, user, nil, 2)
+				So(err, ShouldBeNil)
+				So(selected[0].Address, ShouldEqual, miners[0])
+				So(selected[1].Address, ShouldEqual, miners[1])
+
+				req.ResourceMeta.MinRating = ratings[0]
+				_, err = ms.filterNMiners(req, user, nil, 2)
+				So(err, ShouldEqual, ErrNoEnoughMiner)
+				selected, err = ms.filterNMiners(req, user, nil, 1)
+				So(err, ShouldBeNil)
+				So(selected[0].Address, ShouldEqual, miners[0])
+			})
+		})
+		Convey("The miners should be rated once per billing period", func() {
+			var tx = types.NewUpdateBilling(&types.UpdateBillingHeader{
+				FailedMiners: []proto.AccountAddress{miners[2]},
+			})
+			ms.rateBillingMiners(profile, tx, miners[0], 10)
+			ms.commit()
+			var failed = ms.minerRating(miners[2])
+			So(failed, ShouldBeLessThan, initialMinerRating)
+			So(profile.LastRatedHeight, ShouldEqual, 10)
+
+			// the billing of the same period from another miner only rates its submitter
+			ms.rateBillingMiners(profile, tx, miners[1], 12)
+			ms.commit()
+			So(ms.minerRating(miners[1]), ShouldBeGreaterThan, initialMinerRating)
+			So(ms.minerRating(miners[2]), ShouldEqual, failed)
+			So(profile.LastRatedHeight, ShouldEqual, 10)
+
+			ms.rateBillingMiners(profile, tx, miners[1], 10+billingInterval)
+			ms.commit()
+			So(ms.minerRating(miners[2]), ShouldBeLessThan, failed)
+			So(profile.LastRatedHeight, ShouldEqual, 10+billingInterval)
+		})
+		Convey("The late billing should be rated lower", func() {
+			var tx = types.NewUpdateBilling(&types.UpdateBillingHeader{})
+			profile.LastUpdatedHeight = 10
+			ms.rateBillingMiners(profile, tx, miners[0], 10+billingInterval)
+			ms.rateBillingMiners(profile, tx, miners[1], 11+lateBillingFactor*billingInterval)
+			ms.commit()
+			So(ms.minerRating(miners[0]), ShouldBeGreaterThan, ms.minerRating(miners[1]))
+			So(ms.minerRating(miners[1]), ShouldEqual, initialMinerRating)
+		})
+		Convey("The guilty or failed miner rating should decrease continuously", func() {
+			var last = ms.minerRating(miners[0])
+			for i := 0; i < 10; i++ {
+				ms.rateMiner(miners[0], scoreGuilty)
+				var rating = ms.minerRating(miners[0])
+				So(rating, ShouldBeLessThan, last)
+				So(rating, ShouldBeGreaterThan, 0)
+				last = rating
+			}
+		})
+	})
+}
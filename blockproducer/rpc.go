@@ -66,7 +66,7 @@ func (s *ChainRPCService) FetchLastIrreversibleBlock(
 	resp.Block = b
 	resp.Count = c
 	resp.Height = h
-	resp.SQLChains = s.chain.loadSQLChainProfiles(req.Address)
+	resp.SQLChains, resp.Accounts = s.chain.loadSQLChainProfiles(req.Address)
 	return nil
 }
 
@@ -82,6 +82,25 @@ func (s *ChainRPCService) FetchBlockByCount(req *types.FetchBlockByCountReq, res
 	return err
 }
 
+// FetchSnapshot is the RPC method to fetch a signed state snapshot from the target server.
+func (s *ChainRPCService) FetchSnapshot(
+	req *types.FetchSnapshotReq, resp *types.FetchSnapshotResp) (err error,
+) {
+	if resp.Snapshot, err = s.chain.loadSnapshot(req.Count); err == ErrSnapshotNotFound {
+		err = nil
+	}
+	return
+}
+
+// FetchHeaders is the RPC method to fetch the irreversible block headers in the block count range
+// [From, To] from the target server.
+func (s *ChainRPCService) FetchHeaders(
+	req *types.FetchHeadersReq, resp *types.FetchHeadersResp) (err error,
+) {
+	resp.Headers, err = s.chain.fetchHeaders(req.From, req.To)
+	return
+}
+
 // FetchTxBilling is the RPC method to fetch a known billing tx from the target server.
 func (s *ChainRPCService) FetchTxBilling(req *types.FetchTxBillingReq, resp *types.FetchTxBillingResp) error {
 	return nil
@@ -138,6 +157,30 @@ func (s *ChainRPCService) QueryTxState(
 	return
 }
 
+// QueryTxProof is the RPC method to query the merkle inclusion proof of a confirmed transaction.
+func (s *ChainRPCService) QueryTxProof(
+	req *types.QueryTxProofReq, resp *types.QueryTxProofResp) (err error,
+) {
+	resp.Hash = req.Hash
+	resp.Height, resp.Header, resp.Proof, err = s.chain.queryTxProof(req.Hash)
+	return
+}
+
+// QueryInvoices is the RPC method to query the confirmed billings of a database.
+func (s *ChainRPCService) QueryInvoices(
+	req *types.QueryInvoicesReq, resp *types.QueryInvoicesResp) (err error,
+) {
+	if resp.Invoices, err = s.chain.queryInvoices(
+		req.DatabaseID, req.FromHeight, req.ToHeight,
+	); err != nil {
+		return
+	}
+	if p, ok := s.chain.loadSQLChainProfile(req.DatabaseID); ok {
+		resp.GasPrice = p.GasPrice
+	}
+	return
+}
+
 // Sub is the RPC method to subscribe some event.
 func (s *ChainRPCService) Sub(req *types.SubReq, resp *types.SubResp) (err error) {
 	return s.chain.chainBus.Subscribe(req.Topic, func(request interface{}, response interface{}) {
@@ -0,0 +1,357 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	"github.com/pkg/errors"
+)
+
+// This file provides the state snapshot and fast sync procedures of the main chain.
+
+// maxFetchHeaders is the maximum number of block headers returned by a single FetchHeaders call.
+const maxFetchHeaders = 1000
+
+// newSnapshot creates a signed snapshot of state s, which should be the state right after
+// applying the block of node n.
+func newSnapshot(
+	n *blockNode, s *metaState, signer *asymmetric.PrivateKey) (out *types.BPSnapshot, err error,
+) {
+	var snapshot = &types.BPSnapshot{
+		BPSnapshotHeader: types.BPSnapshotHeader{
+			Count:     n.count,
+			Height:    n.height,
+			BlockHash: n.hash,
+		},
+		Block: n.block,
+	}
+	snapshot.Accounts, snapshot.Databases, snapshot.Providers = s.snapshotObjects()
+	if err = snapshot.Sign(signer); err != nil {
+		return
+	}
+	if !snapshot.StateRoot.IsEqual(&n.block.SignedHeader.SnapshotRoot) {
+		err = errors.Wrapf(ErrInvalidSnapshotRoot, "block %s at count %d",
+			n.hash.Short(4), n.count)
+		return
+	}
+	out = snapshot
+	return
+}
+
+// installSnapshot stores the state and block of a verified snapshot as the irreversible base
+// of a new chain storage, along with the verified headers since the genesis block, so that the
+// new chain can serve them to other fast synchronizing peers.
+func installSnapshot(
+	st xi.Storage, s *types.BPSnapshot, hs []*types.BPSignedHeader) (err error,
+) {
+	var sps []storageProcedure
+	for _, v := range s.Accounts {
+		sps = append(sps, updateAccount(v))
+	}
+	for _, v := range s.Databases {
+		sps = append(sps, updateShardChain(v))
+	}
+	for _, v := range s.Providers {
+		sps = append(sps, updateProvider(v))
+	}
+	sps = append(sps, addBlock(s.Height, s.Block))
+	sps = append(sps, buildBlockIndex(s.Height, s.Block))
+	sps = append(sps, updateIrreversible(s.BlockHash))
+	sps = append(sps, addSnapshot(s))
+	sps = append(sps, addHeaders(1, hs))
+	return store(st, sps, nil)
+}
+
+// fetchTrustedSnapshot fetches the latest snapshots from the peers of the config, and returns
+// the newest verified one whose block is confirmed by the majority of the peers, along with the
+// block headers which commit its state root since the genesis block.
+func fetchTrustedSnapshot(
+	ctx context.Context, caller *rpc.Caller, cfg *Config,
+) (
+	out *types.BPSnapshot, hs []*types.BPSignedHeader, err error,
+) {
+	var (
+		remotes    []proto.NodeID
+		candidates []*types.BPSnapshot
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+	)
+	for _, v := range cfg.Peers.Servers {
+		if !v.IsEqual(&cfg.NodeID) {
+			remotes = append(remotes, v)
+		}
+	}
+	for _, v := range remotes {
+		wg.Add(1)
+		go func(remote proto.NodeID) {
+			defer wg.Done()
+			var (
+				cld, ccl = context.WithTimeout(ctx, cfg.Period)
+				req      = &types.FetchSnapshotReq{}
+				resp     = &types.FetchSnapshotResp{}
+				le       = log.WithField("remote", remote)
+				ierr     error
+			)
+			defer ccl()
+			if ierr = caller.CallNodeWithContext(
+				cld, remote, route.MCCFetchSnapshot.String(), req, resp,
+			); ierr != nil {
+				le.WithError(ierr).Warn("failed to fetch snapshot")
+				return
+			}
+			if resp.Snapshot == nil {
+				return
+			}
+			if ierr = resp.Snapshot.Verify(); ierr != nil {
+				le.WithError(ierr).Warn("failed to verify snapshot")
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			candidates = append(candidates, resp.Snapshot)
+		}(v)
+	}
+	wg.Wait()
+
+	// Try from the newest snapshot
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Count > candidates[j].Count
+	})
+	for _, v := range candidates {
+		var confirms = countBlockConfirms(ctx, caller, cfg, remotes, v)
+		log.WithFields(log.Fields{
+			"count":    v.Count,
+			"hash":     v.BlockHash.Short(4),
+			"confirms": confirms,
+			"peers":    len(remotes),
+		}).Info("checking snapshot")
+		if 2*confirms <= len(remotes) {
+			continue
+		}
+		if hs = fetchVerifiedHeaders(ctx, caller, cfg, remotes, v); hs != nil {
+			out = v
+			return
+		}
+	}
+	err = ErrNoTrustedSnapshot
+	return
+}
+
+// fetchVerifiedHeaders fetches the block headers from count 1 to the snapshot block from the
+// remote peers in turn, and returns the first header chain which passes verifyHeaders.
+func fetchVerifiedHeaders(
+	ctx context.Context, caller *rpc.Caller, cfg *Config, remotes []proto.NodeID,
+	s *types.BPSnapshot,
+) (
+	hs []*types.BPSignedHeader,
+) {
+	for _, v := range remotes {
+		var (
+			fetched []*types.BPSignedHeader
+			le      = log.WithFields(log.Fields{
+				"remote": v,
+				"count":  s.Count,
+			})
+			err error
+		)
+		for from := uint32(1); from <= s.Count; {
+			var (
+				cld, ccl = context.WithTimeout(ctx, cfg.Period)
+				req      = &types.FetchHeadersReq{From: from, To: s.Count}
+				resp     = &types.FetchHeadersResp{}
+			)
+			err = caller.CallNodeWithContext(
+				cld, v, route.MCCFetchHeaders.String(), req, resp)
+			ccl()
+			if err == nil && len(resp.Headers) == 0 {
+				err = errors.Wrapf(ErrInvalidHeaderChain, "no header from count %d", from)
+			}
+			if err != nil {
+				break
+			}
+			fetched = append(fetched, resp.Headers...)
+			from += uint32(len(resp.Headers))
+		}
+		if err == nil {
+			err = verifyHeaders(cfg.Genesis, knownProducers(cfg), fetched, s)
+		}
+		if err != nil {
+			le.WithError(err).Warn("failed to fetch verified headers")
+			continue
+		}
+		return fetched
+	}
+	return
+}
+
+// knownProducers returns the account addresses of the configured block producers, i.e., the
+// producer of the genesis block and the peer servers of which the public keys are known.
+func knownProducers(cfg *Config) (producers map[proto.AccountAddress]struct{}) {
+	producers = map[proto.AccountAddress]struct{}{
+		cfg.Genesis.Producer(): {},
+	}
+	for _, v := range cfg.Peers.Servers {
+		var (
+			pub  *asymmetric.PublicKey
+			addr proto.AccountAddress
+			err  error
+		)
+		if pub, err = kms.GetPublicKey(v); err == nil {
+			addr, err = crypto.PubKeyHash(pub)
+		}
+		if err != nil {
+			log.WithField("node", v).WithError(err).Warn("failed to resolve block producer")
+			continue
+		}
+		producers[addr] = struct{}{}
+	}
+	return
+}
+
+// verifyHeaders checks that the headers form a chain of blocks signed by the known producers from
+// the genesis block to the snapshot block, and that the last one commits the snapshot state root.
+func verifyHeaders(
+	genesis *types.BPBlock, producers map[proto.AccountAddress]struct{},
+	hs []*types.BPSignedHeader, s *types.BPSnapshot,
+) (
+	err error,
+) {
+	if uint32(len(hs)) != s.Count {
+		return errors.Wrapf(ErrInvalidHeaderChain, "got %d headers for block count %d",
+			len(hs), s.Count)
+	}
+	var parent = genesis.BlockHash()
+	for i, v := range hs {
+		var (
+			count = i + 1
+			enc   []byte
+			addr  proto.AccountAddress
+		)
+		if enc, err = v.BPHeader.MarshalHash(); err != nil {
+			return
+		}
+		if h := hash.THashH(enc); !h.IsEqual(&v.BlockHash) {
+			return errors.Wrapf(ErrInvalidHeaderChain, "invalid block hash at count %d", count)
+		}
+		if !v.ParentHash.IsEqual(parent) {
+			return errors.Wrapf(ErrInvalidHeaderChain, "broken parent link at count %d", count)
+		}
+		if v.Signee == nil || v.Signature == nil {
+			return errors.Wrapf(ErrInvalidHeaderChain, "unsigned header at count %d", count)
+		}
+		if err = v.Verify(); err != nil {
+			return errors.Wrapf(err, "invalid signature at count %d", count)
+		}
+		if addr, err = crypto.PubKeyHash(v.Signee); err != nil {
+			return
+		}
+		if addr != v.Producer {
+			return errors.Wrapf(ErrInvalidHeaderChain, "header at count %d not signed by producer",
+				count)
+		}
+		if _, ok := producers[addr]; !ok {
+			return errors.Wrapf(ErrInvalidHeaderChain, "unknown producer %s at count %d",
+				addr, count)
+		}
+		parent = &v.BlockHash
+	}
+	if !parent.IsEqual(&s.BlockHash) {
+		return errors.Wrap(ErrInvalidHeaderChain, "header chain not end at the snapshot block")
+	}
+	if last := hs[len(hs)-1]; !last.SnapshotRoot.IsEqual(&s.StateRoot) {
+		return errors.Wrap(ErrInvalidSnapshotRoot, "snapshot root not committed in header chain")
+	}
+	return
+}
+
+// countBlockConfirms returns the number of remote peers having the snapshot block at the same
+// block count.
+func countBlockConfirms(
+	ctx context.Context, caller *rpc.Caller, cfg *Config, remotes []proto.NodeID,
+	s *types.BPSnapshot,
+) (
+	confirms int,
+) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, v := range remotes {
+		wg.Add(1)
+		go func(remote proto.NodeID) {
+			defer wg.Done()
+			var (
+				cld, ccl = context.WithTimeout(ctx, cfg.Period)
+				req      = &types.FetchBlockByCountReq{Count: s.Count}
+				resp     = &types.FetchBlockResp{}
+			)
+			defer ccl()
+			if err := caller.CallNodeWithContext(
+				cld, remote, route.MCCFetchBlockByCount.String(), req, resp,
+			); err != nil || resp.Block == nil || !resp.Block.BlockHash().IsEqual(&s.BlockHash) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			confirms++
+		}(v)
+	}
+	wg.Wait()
+	return
+}
+
+// makeSnapshot returns the storage procedure to save the snapshot of the immutable state at the
+// new irreversible block node n. It fails silently, since a snapshot only helps other peers to
+// bootstrap.
+func (c *Chain) makeSnapshot(n *blockNode) storageProcedure {
+	var (
+		priv     *asymmetric.PrivateKey
+		snapshot *types.BPSnapshot
+		err      error
+		le       = log.WithFields(log.Fields{
+			"count": n.count,
+			"hash":  n.hash.Short(4),
+		})
+	)
+	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+		le.WithError(err).Error("failed to load private key for snapshot")
+		return errPass(nil)
+	}
+	if snapshot, err = newSnapshot(n, c.immutable, priv); err != nil {
+		le.WithError(err).Error("failed to create snapshot")
+		return errPass(nil)
+	}
+	le.Debug("created snapshot")
+	return addSnapshot(snapshot)
+}
+
+func (c *Chain) loadSnapshot(count uint32) (s *types.BPSnapshot, err error) {
+	return loadSnapshot(c.storage, count)
+}
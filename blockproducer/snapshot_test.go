@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChainSnapshot(t *testing.T) {
+	Convey("Given a new block producer chain with snapshot enabled", t, func() {
+		var (
+			err     error
+			config  *Config
+			genesis *types.BPBlock
+			begin   time.Time
+			nonce   = mine.Uint256{}
+			leader  = (&proto.RawNodeID{
+				Hash: mine.HashBlock(testingPublicKey.Serialize(), nonce),
+			}).ToNodeID()
+			chain *Chain
+
+			addr1, addr2 proto.AccountAddress
+		)
+
+		// the leader key is known to resolve the block producer address
+		err = kms.SetPublicKey(leader, nonce, testingPublicKey)
+		So(err, ShouldBeNil)
+		addr1, err = crypto.PubKeyHash(testingPublicKey)
+		So(err, ShouldBeNil)
+		_, pub2, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr2, err = crypto.PubKeyHash(pub2)
+		So(err, ShouldBeNil)
+
+		genesis = &types.BPBlock{
+			SignedHeader: types.BPSignedHeader{
+				BPHeader: types.BPHeader{
+					Timestamp: time.Now().Add(-10 * time.Second),
+				},
+			},
+			Transactions: []pi.Transaction{
+				types.NewBaseAccount(&types.Account{
+					Address:      addr1,
+					TokenBalance: [5]uint64{1000, 1000, 1000, 1000, 1000},
+				}),
+			},
+		}
+		err = genesis.PackAndSignBlock(testingPrivateKey)
+		So(err, ShouldBeNil)
+		begin = genesis.Timestamp()
+
+		config = &Config{
+			Genesis:  genesis,
+			DataFile: path.Join(testingDataDir, t.Name()),
+			Peers: &proto.Peers{
+				PeersHeader: proto.PeersHeader{
+					Leader:  leader,
+					Servers: []proto.NodeID{leader},
+				},
+			},
+			NodeID: leader,
+			Period: time.Duration(1 * time.Second),
+			Tick:   time.Duration(300 * time.Millisecond),
+
+			SnapshotInterval: 2,
+		}
+		chain, err = NewChain(config)
+		So(err, ShouldBeNil)
+		chain.confirms = 1
+
+		Reset(func() {
+			err = chain.Stop()
+			So(err, ShouldBeNil)
+			err = os.Remove(config.DataFile)
+			So(err, ShouldBeNil)
+		})
+
+		// Produce blocks #1-#3 with transfers, the block at count 2 becomes irreversible at last
+		for i := 1; i <= 3; i++ {
+			var tx pi.Transaction
+			tx, err = newTransfer(pi.AccountNonce(i), testingPrivateKey, addr1, addr2, 1)
+			So(err, ShouldBeNil)
+			err = chain.storeTx(tx)
+			So(err, ShouldBeNil)
+			err = chain.produceBlock(begin.Add(time.Duration(i) * chain.period).UTC())
+			So(err, ShouldBeNil)
+		}
+		So(chain.head().count, ShouldEqual, 3)
+		So(chain.lastIrreversibleBlock().count, ShouldEqual, 2)
+
+		Convey("The blocks at the snapshot interval should commit the state root", func() {
+			var b1, b2 *types.BPBlock
+			b1, _, err = chain.fetchBlockByCount(1)
+			So(err, ShouldBeNil)
+			So(b1.SignedHeader.SnapshotRoot, ShouldResemble, hash.Hash{})
+			b2, _, err = chain.fetchBlockByCount(2)
+			So(err, ShouldBeNil)
+			So(b2.SignedHeader.SnapshotRoot, ShouldNotResemble, hash.Hash{})
+
+			Convey("The chain should reject a block with an invalid snapshot root", func() {
+				var (
+					arena = chain.headBranch.makeArena()
+					bl    *types.BPBlock
+				)
+				arena.snapshotInterval = 0
+				_, bl, err = arena.produceBlock(
+					4, begin.Add(4*chain.period).UTC(), chain.address, testingPrivateKey)
+				So(err, ShouldBeNil)
+				So(bl.SignedHeader.SnapshotRoot, ShouldResemble, hash.Hash{})
+				err = chain.pushBlock(bl)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSnapshotRoot)
+				// the blocks replayed on rebuilding a branch should be verified too
+				_, err = newBranch(chain.head(), newBlockNode(4, bl, chain.head()),
+					chain.headBranch.preview, nil, config.SnapshotInterval)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSnapshotRoot)
+			})
+		})
+
+		Convey("The irreversible snapshot should be saved and verifiable", func() {
+			var snapshot *types.BPSnapshot
+			_, err = chain.loadSnapshot(1)
+			So(err, ShouldEqual, ErrSnapshotNotFound)
+			snapshot, err = chain.loadSnapshot(0)
+			So(err, ShouldBeNil)
+			So(snapshot.Count, ShouldEqual, 2)
+			So(snapshot.Height, ShouldEqual, 2)
+			So(snapshot.Accounts, ShouldHaveLength, 2)
+			err = snapshot.Verify()
+			So(err, ShouldBeNil)
+
+			var resp = &types.FetchSnapshotResp{}
+			err = (&ChainRPCService{chain: chain}).FetchSnapshot(
+				&types.FetchSnapshotReq{Count: 2}, resp)
+			So(err, ShouldBeNil)
+			So(resp.Snapshot.BlockHash, ShouldResemble, snapshot.BlockHash)
+			resp = &types.FetchSnapshotResp{}
+			err = (&ChainRPCService{chain: chain}).FetchSnapshot(
+				&types.FetchSnapshotReq{Count: 4}, resp)
+			So(err, ShouldBeNil)
+			So(resp.Snapshot, ShouldBeNil)
+
+			var headers []*types.BPSignedHeader
+			hresp := &types.FetchHeadersResp{}
+			err = (&ChainRPCService{chain: chain}).FetchHeaders(
+				&types.FetchHeadersReq{From: 1, To: 3}, hresp)
+			So(err, ShouldBeNil)
+			headers = hresp.Headers
+			So(headers, ShouldHaveLength, 2)
+			var producers = knownProducers(config)
+			So(producers, ShouldContainKey, chain.address)
+			err = verifyHeaders(genesis, producers, headers, snapshot)
+			So(err, ShouldBeNil)
+
+			Convey("The header chain should commit the snapshot block and root", func() {
+				err = verifyHeaders(genesis, producers, headers[:1], snapshot)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidHeaderChain)
+				err = verifyHeaders(
+					genesis, producers, []*types.BPSignedHeader{headers[1], headers[1]}, snapshot)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidHeaderChain)
+
+				var forged = *headers[1]
+				forged.SnapshotRoot[0]++
+				err = verifyHeaders(
+					genesis, producers, []*types.BPSignedHeader{headers[0], &forged}, snapshot)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidHeaderChain)
+
+				// a header chain signed by an unknown key is rejected
+				var (
+					priv     *asymmetric.PrivateKey
+					pub      *asymmetric.PublicKey
+					outsider proto.AccountAddress
+					enc      []byte
+					parent   = genesis.BlockHash()
+					hs       = make([]*types.BPSignedHeader, len(headers))
+				)
+				priv, pub, err = asymmetric.GenSecp256k1KeyPair()
+				So(err, ShouldBeNil)
+				outsider, err = crypto.PubKeyHash(pub)
+				So(err, ShouldBeNil)
+				for i, v := range headers {
+					var h = *v
+					h.ParentHash = *parent
+					h.Producer = outsider
+					enc, err = h.BPHeader.MarshalHash()
+					So(err, ShouldBeNil)
+					h.BlockHash = hash.THashH(enc)
+					h.Signee = pub
+					h.Signature, err = priv.Sign(h.BlockHash[:])
+					So(err, ShouldBeNil)
+					hs[i] = &h
+					parent = &h.BlockHash
+				}
+				var fake = *snapshot
+				fake.BlockHash = *parent
+				err = verifyHeaders(
+					genesis, map[proto.AccountAddress]struct{}{outsider: {}}, hs, &fake)
+				So(err, ShouldBeNil)
+				err = verifyHeaders(genesis, producers, hs, &fake)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidHeaderChain)
+
+				var other = *snapshot
+				other.StateRoot[0]++
+				err = verifyHeaders(genesis, producers, headers, &other)
+				So(errors.Cause(err), ShouldEqual, ErrInvalidSnapshotRoot)
+			})
+
+			Convey("A new chain bootstrapped from the snapshot should sync the rest blocks", func() {
+				var (
+					fcfg  = *config
+					st    = chain.storage
+					fast  *Chain
+					b3    *types.BPBlock
+					bal   uint64
+					ok    bool
+					ierr  error
+					fpath = path.Join(testingDataDir, fmt.Sprintf("%s-fast", t.Name()))
+				)
+				fcfg.DataFile = fpath
+				defer os.Remove(fpath)
+				st, err = openStorage(fmt.Sprintf("file:%s", fpath))
+				So(err, ShouldBeNil)
+				err = installSnapshot(st, snapshot, headers)
+				So(err, ShouldBeNil)
+				st.Close()
+
+				fast, err = NewChain(&fcfg)
+				So(err, ShouldBeNil)
+				defer func() {
+					ierr = fast.Stop()
+					So(ierr, ShouldBeNil)
+				}()
+				fast.confirms = 1
+				So(fast.head().count, ShouldEqual, 2)
+				So(fast.lastIrreversibleBlock().count, ShouldEqual, 2)
+				bal, ok = fast.loadAccountTokenBalance(addr2, types.Particle)
+				So(ok, ShouldBeTrue)
+				So(bal, ShouldEqual, 2)
+
+				b3, _, err = chain.fetchBlockByCount(3)
+				So(err, ShouldBeNil)
+				err = fast.pushBlock(b3)
+				So(err, ShouldBeNil)
+				So(fast.head().count, ShouldEqual, 3)
+				So(fast.head().hash, ShouldResemble, chain.head().hash)
+
+				// The fast synchronized chain should serve the headers since the genesis block
+				var fastHeaders []*types.BPSignedHeader
+				fastHeaders, err = fast.fetchHeaders(1, 3)
+				So(err, ShouldBeNil)
+				err = verifyHeaders(genesis, producers, fastHeaders, snapshot)
+				So(err, ShouldBeNil)
+
+				// Reload the fast synchronized chain from storage
+				ierr = fast.Stop()
+				So(ierr, ShouldBeNil)
+				fast, err = NewChain(&fcfg)
+				So(err, ShouldBeNil)
+				So(fast.head().count, ShouldEqual, 3)
+				So(fast.lastIrreversibleBlock().count, ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
@@ -56,6 +57,22 @@ var (
 			UNIQUE ("id")
 		);`,
 
+		`CREATE TABLE IF NOT EXISTS "snapshots" (
+			"count"		INT,
+			"height"	INT,
+			"hash"		TEXT,
+			"root"		TEXT,
+			"encoded"	BLOB,
+			UNIQUE ("count")
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS "headers" (
+			"count"		INT,
+			"hash"		TEXT,
+			"encoded"	BLOB,
+			UNIQUE ("count")
+		);`,
+
 		// Meta state tables
 		`CREATE TABLE IF NOT EXISTS "accounts" (
 			"address"	TEXT,
@@ -107,6 +124,21 @@ var (
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__timestamp" ON "indexed_transactions" ("timestamp" DESC);`,
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__tx_type__timestamp" ON "indexed_transactions" ("tx_type", "timestamp" DESC);`,
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_transactions__address__timestamp" ON "indexed_transactions" ("address", "timestamp" DESC);`,
+
+		`CREATE TABLE IF NOT EXISTS "indexed_databases" (
+			"id"		TEXT PRIMARY KEY,
+			"owner"		TEXT
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS "idx__indexed_databases__owner" ON "indexed_databases" ("owner", "id");`,
+
+		`CREATE TABLE IF NOT EXISTS "indexed_database_users" (
+			"database_id"	TEXT,
+			"user"			TEXT,
+			PRIMARY KEY ("database_id", "user")
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS "idx__indexed_database_users__user" ON "indexed_database_users" ("user", "database_id");`,
 	}
 )
 
@@ -248,6 +280,53 @@ func updateIrreversible(h hash.Hash) storageProcedure {
 	}
 }
 
+func addSnapshot(s *types.BPSnapshot) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(s); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "snapshots" ("count", "height", "hash", "root", "encoded")
+	VALUES (?, ?, ?, ?, ?)`,
+			s.Count,
+			s.Height,
+			s.BlockHash.String(),
+			s.StateRoot.String(),
+			enc.Bytes())
+		return
+	}
+}
+
+// addHeaders saves the verified block headers starting from block count from, which are the
+// ancestors of the root block of a fast synchronized chain.
+func addHeaders(from uint32, hs []*types.BPSignedHeader) storageProcedure {
+	var encs = make([][]byte, len(hs))
+	for i, v := range hs {
+		var enc, err = utils.EncodeMsgPack(v)
+		if err != nil {
+			return errPass(err)
+		}
+		encs[i] = enc.Bytes()
+	}
+	return func(tx *sql.Tx) (err error) {
+		var stmt *sql.Stmt
+		if stmt, err = tx.Prepare(`INSERT OR REPLACE INTO "headers" ("count", "hash", "encoded")
+	VALUES (?, ?, ?)`); err != nil {
+			return
+		}
+		defer stmt.Close()
+		for i, v := range hs {
+			if _, err = stmt.Exec(from+uint32(i), v.BlockHash.String(), encs[i]); err != nil {
+				return
+			}
+		}
+		return
+	}
+}
+
 func deleteTxs(txs []pi.Transaction) storageProcedure {
 	var hs = make([]hash.Hash, len(txs))
 	for i, v := range txs {
@@ -316,13 +395,66 @@ func updateShardChain(profile *types.SQLChainProfile) storageProcedure {
 			"profile_token_type":    profile.TokenType,
 			"profile_miners_number": len(profile.Miners),
 		}).Debug("updating profile")
-		_, err = tx.Exec(`INSERT OR REPLACE INTO "shardChain" ("address", "id", "encoded")
+		if _, err = tx.Exec(`INSERT OR REPLACE INTO "shardChain" ("address", "id", "encoded")
 	VALUES (?, ?, ?)`,
 			profile.Address.String(),
 			string(profile.ID),
-			enc.Bytes())
+			enc.Bytes()); err != nil {
+			return
+		}
+		return indexShardChain(profile)(tx)
+	}
+}
+
+// indexShardChain updates the owner and user index of the database profile, which is used to
+// list the databases of an account.
+func indexShardChain(profile *types.SQLChainProfile) storageProcedure {
+	return func(tx *sql.Tx) (err error) {
+		if _, err = tx.Exec(`INSERT OR REPLACE INTO "indexed_databases" ("id", "owner")
+	VALUES (?, ?)`,
+			string(profile.ID),
+			profile.Owner.String()); err != nil {
+			return
+		}
+		if _, err = tx.Exec(`DELETE FROM "indexed_database_users" WHERE "database_id"=?`,
+			string(profile.ID)); err != nil {
+			return
+		}
+		for _, v := range profile.Users {
+			if _, err = tx.Exec(`INSERT OR REPLACE INTO "indexed_database_users"
+	("database_id", "user") VALUES (?, ?)`,
+				string(profile.ID),
+				v.Address.String()); err != nil {
+				return
+			}
+		}
+		return
+	}
+}
+
+// reindexShardChains rebuilds the database index if it is not in sync with the profiles, e.g.,
+// the profiles are stored before the index is introduced.
+func reindexShardChains(st xi.Storage, view *metaState) (err error) {
+	var count int
+	if err = st.Reader().QueryRow(
+		`SELECT COUNT(*) FROM "indexed_databases"`,
+	).Scan(&count); err != nil {
+		return
+	}
+	if count == len(view.readonly.databases) {
+		return
+	}
+	var sps = []storageProcedure{func(tx *sql.Tx) (err error) {
+		if _, err = tx.Exec(`DELETE FROM "indexed_databases"`); err != nil {
+			return
+		}
+		_, err = tx.Exec(`DELETE FROM "indexed_database_users"`)
 		return
+	}}
+	for _, v := range view.readonly.databases {
+		sps = append(sps, indexShardChain(v))
 	}
+	return store(st, sps, nil)
 }
 
 func deleteShardChain(id proto.DatabaseID) storageProcedure {
@@ -330,7 +462,13 @@ func deleteShardChain(id proto.DatabaseID) storageProcedure {
 		log.WithFields(log.Fields{
 			"profile_database_id": id,
 		}).Debug("deleting profile")
-		_, err = tx.Exec(`DELETE FROM "shardChain" WHERE "id"=?`, id)
+		if _, err = tx.Exec(`DELETE FROM "shardChain" WHERE "id"=?`, id); err != nil {
+			return
+		}
+		if _, err = tx.Exec(`DELETE FROM "indexed_databases" WHERE "id"=?`, id); err != nil {
+			return
+		}
+		_, err = tx.Exec(`DELETE FROM "indexed_database_users" WHERE "database_id"=?`, id)
 		return
 	}
 }
@@ -380,6 +518,86 @@ func loadIrreHash(st xi.Storage) (irre hash.Hash, err error) {
 	return
 }
 
+// loadSnapshot loads the snapshot at block count c, or the latest one if c is 0.
+func loadSnapshot(st xi.Storage, c uint32) (s *types.BPSnapshot, err error) {
+	var (
+		enc []byte
+		row *sql.Row
+		dec = &types.BPSnapshot{}
+	)
+	if c == 0 {
+		row = st.Reader().QueryRow(
+			`SELECT "encoded" FROM "snapshots" ORDER BY "count" DESC LIMIT 1`)
+	} else {
+		row = st.Reader().QueryRow(`SELECT "encoded" FROM "snapshots" WHERE "count"=?`, c)
+	}
+	if err = row.Scan(&enc); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrSnapshotNotFound
+		}
+		return
+	}
+	if err = utils.DecodeMsgPack(enc, dec); err != nil {
+		return
+	}
+	s = dec
+	return
+}
+
+// loadHeaders loads the saved block headers in the block count range [from, to].
+func loadHeaders(st xi.Storage, from, to uint32) (hs []*types.BPSignedHeader, err error) {
+	var (
+		rows *sql.Rows
+		enc  []byte
+	)
+	if rows, err = st.Reader().Query(
+		`SELECT "encoded" FROM "headers" WHERE "count">=? AND "count"<=? ORDER BY "count"`,
+		from, to,
+	); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&enc); err != nil {
+			return
+		}
+		var dec = &types.BPSignedHeader{}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return
+		}
+		hs = append(hs, dec)
+	}
+	err = rows.Err()
+	return
+}
+
+// loadSnapshotCounts loads the block counts of the snapshot blocks indexed by block hash.
+func loadSnapshotCounts(st xi.Storage) (counts map[hash.Hash]uint32, err error) {
+	var (
+		rows *sql.Rows
+		c    uint32
+		hex  string
+		h    hash.Hash
+	)
+	if rows, err = st.Reader().Query(`SELECT "count", "hash" FROM "snapshots"`); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	counts = make(map[hash.Hash]uint32)
+	for rows.Next() {
+		if err = rows.Scan(&c, &hex); err != nil {
+			return
+		}
+		if err = hash.Decode(&h, hex); err != nil {
+			return
+		}
+		counts[h] = c
+	}
+	return
+}
+
 func loadTxPool(st xi.Storage) (txPool map[hash.Hash]pi.Transaction, err error) {
 	var (
 		th   hash.Hash
@@ -423,6 +641,7 @@ func loadBlocks(
 
 		index      = make(map[hash.Hash]*blockNode)
 		headsIndex = make(map[hash.Hash]*blockNode)
+		bases      map[hash.Hash]uint32
 
 		// Scan buffer
 		id           uint32
@@ -435,6 +654,11 @@ func loadBlocks(
 		bn, pn *blockNode
 	)
 
+	// Load snapshot block counts, any of them may be the root block of a fast synchronized chain
+	if bases, err = loadSnapshotCounts(st); err != nil {
+		return
+	}
+
 	// Load blocks
 	if rows, err = st.Reader().Query(
 		`SELECT "rowid", "height", "hash", "parent", "encoded" FROM "blocks" ORDER BY "rowid"`,
@@ -481,6 +705,20 @@ func loadBlocks(
 			}).Debug("set genesis block")
 			continue
 		}
+		// Add root block of a fast synchronized chain
+		if c, isBase := bases[bh]; isBase && len(index) == 0 {
+			bn = newBlockNode(height, dec, nil)
+			bn.count = c
+			index[bh] = bn
+			headsIndex[bh] = bn
+			log.WithFields(log.Fields{
+				"rowid":  id,
+				"height": height,
+				"count":  c,
+				"hash":   bh.Short(4),
+			}).Debug("set snapshot root block")
+			continue
+		}
 		// Add normal block
 		if pn, ok = index[ph]; !ok {
 			err = errors.Wrapf(ErrParentNotFound, "parent %s not found", ph.Short(4))
@@ -531,6 +769,13 @@ func loadAndCacheAccounts(st xi.Storage, view *metaState) (err error) {
 			return
 		}
 		view.readonly.accounts[proto.AccountAddress(addr)] = dec
+		if dec.PublicKey != nil {
+			var key proto.AccountAddress
+			if key, err = crypto.PubKeyHash(dec.PublicKey); err != nil {
+				return
+			}
+			view.readonly.keys[key] = dec.Address
+		}
 	}
 
 	return
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatabaseIndex(t *testing.T) {
+	Convey("Given a storage with database profiles", t, func() {
+		var (
+			fpath = path.Join(testingDataDir, t.Name())
+			owner = proto.AccountAddress{0x1}
+			user  = proto.AccountAddress{0x2}
+			p1    = &types.SQLChainProfile{
+				ID:    "db1",
+				Owner: owner,
+				Users: []*types.SQLChainUser{{Address: owner}, {Address: user}},
+			}
+			p2 = &types.SQLChainProfile{
+				ID:    "db2",
+				Owner: user,
+				Users: []*types.SQLChainUser{{Address: user}},
+			}
+			st  xi.Storage
+			err error
+		)
+		st, err = openStorage(fmt.Sprintf("file:%s", fpath))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			st.Close()
+			os.Remove(fpath)
+		})
+		err = store(st, []storageProcedure{updateShardChain(p1), updateShardChain(p2)}, nil)
+		So(err, ShouldBeNil)
+
+		var queryIDs = func(q string, args ...interface{}) (ids []string) {
+			var rows *sql.Rows
+			rows, err = st.Reader().Query(q, args...)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			for rows.Next() {
+				var id string
+				So(rows.Scan(&id), ShouldBeNil)
+				ids = append(ids, id)
+			}
+			return
+		}
+		var (
+			byOwner = `SELECT "id" FROM "indexed_databases" WHERE "owner"=? ORDER BY "id"`
+			byUser  = `SELECT "database_id" FROM "indexed_database_users" WHERE "user"=?
+	ORDER BY "database_id"`
+		)
+		So(queryIDs(byOwner, owner.String()), ShouldResemble, []string{"db1"})
+		So(queryIDs(byUser, user.String()), ShouldResemble, []string{"db1", "db2"})
+
+		Convey("The index should follow the profile updates", func() {
+			p1.Users = p1.Users[:1]
+			err = store(st, []storageProcedure{updateShardChain(p1), deleteShardChain("db2")}, nil)
+			So(err, ShouldBeNil)
+			So(queryIDs(byOwner, user.String()), ShouldBeEmpty)
+			So(queryIDs(byUser, user.String()), ShouldBeEmpty)
+			So(queryIDs(byUser, owner.String()), ShouldResemble, []string{"db1"})
+		})
+		Convey("The index should be rebuilt if it is out of sync", func() {
+			_, err = st.Writer().Exec(`DELETE FROM "indexed_databases"`)
+			So(err, ShouldBeNil)
+			var view = newMetaState()
+			err = loadAndCacheShardChainProfiles(st, view)
+			So(err, ShouldBeNil)
+			err = reindexShardChains(st, view)
+			So(err, ShouldBeNil)
+			So(queryIDs(byOwner, owner.String()), ShouldResemble, []string{"db1"})
+			So(queryIDs(byUser, user.String()), ShouldResemble, []string{"db1", "db2"})
+		})
+	})
+}
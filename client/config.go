@@ -20,11 +20,19 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
 )
 
 const (
 	paramUseLeader   = "use_leader"
 	paramUseFollower = "use_follower"
+	paramConsistency = "consistency"
+
+	// DefaultMaxStaleness defines the default max staleness of bounded staleness read.
+	DefaultMaxStaleness = 5 * time.Second
 )
 
 // Config is a configuration parsed from a DSN string.
@@ -40,6 +48,15 @@ type Config struct {
 
 	// UseFollower use follower nodes to do queries
 	UseFollower bool
+
+	// Consistency defines the consistency level of read queries, options are:
+	//   any: read local state of the node directly (default)
+	//   strong: wait for the node to catch up with the leader commits before read
+	//   bounded_staleness=5s: read state no staler than the specified duration
+	Consistency types.ReadConsistency
+
+	// MaxStaleness defines the max staleness of bounded staleness read
+	MaxStaleness time.Duration
 }
 
 // NewConfig creates a new config with default value.
@@ -64,6 +81,12 @@ func (cfg *Config) FormatDSN() string {
 			newQuery.Add(paramUseLeader, strconv.FormatBool(cfg.UseLeader))
 		}
 	}
+	switch cfg.Consistency {
+	case types.ReadConsistencyStrong:
+		newQuery.Add(paramConsistency, cfg.Consistency.String())
+	case types.ReadConsistencyBoundedStaleness:
+		newQuery.Add(paramConsistency, cfg.Consistency.String()+"="+cfg.MaxStaleness.String())
+	}
 	u.RawQuery = newQuery.Encode()
 
 	return u.String()
@@ -91,5 +114,47 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 		cfg.UseLeader = true
 	}
 
+	// option: consistency
+	if cfg.Consistency, cfg.MaxStaleness, err = parseConsistency(q.Get(paramConsistency)); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+func parseConsistency(s string) (c types.ReadConsistency, maxStaleness time.Duration, err error) {
+	var (
+		parts = strings.SplitN(s, "=", 2)
+		level = parts[0]
+	)
+
+	switch level {
+	case "", types.ReadConsistencyAny.String():
+		c = types.ReadConsistencyAny
+	case types.ReadConsistencyStrong.String():
+		c = types.ReadConsistencyStrong
+	case types.ReadConsistencyBoundedStaleness.String():
+		c = types.ReadConsistencyBoundedStaleness
+		maxStaleness = DefaultMaxStaleness
+		if len(parts) > 1 {
+			if maxStaleness, err = time.ParseDuration(parts[1]); err != nil {
+				err = errors.Wrapf(err, "invalid max staleness: %s", parts[1])
+				return
+			}
+			if maxStaleness < 0 {
+				err = errors.Errorf("negative max staleness: %s", parts[1])
+				return
+			}
+		}
+		return
+	default:
+		err = errors.Errorf("invalid consistency: %s", s)
+		return
+	}
+
+	if len(parts) > 1 {
+		err = errors.Errorf("unexpected option for %s consistency: %s", level, parts[1])
+	}
+
+	return
+}
@@ -18,7 +18,9 @@ package client
 
 import (
 	"testing"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/types"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -90,5 +92,44 @@ func TestConfig(t *testing.T) {
 			UseLeader:   true,
 			UseFollower: true,
 		})
+		testFormatAndParse(&Config{
+			UseLeader:   false,
+			UseFollower: true,
+			Consistency: types.ReadConsistencyStrong,
+		})
+		testFormatAndParse(&Config{
+			UseLeader:    true,
+			UseFollower:  true,
+			Consistency:  types.ReadConsistencyBoundedStaleness,
+			MaxStaleness: 3 * time.Second,
+		})
+	})
+
+	Convey("test dsn with consistency options", t, func() {
+		cfg, err := ParseDSN("covenantsql://db?use_follower=true&consistency=bounded_staleness=5s")
+		So(err, ShouldBeNil)
+		So(cfg.Consistency, ShouldEqual, types.ReadConsistencyBoundedStaleness)
+		So(cfg.MaxStaleness, ShouldEqual, 5*time.Second)
+
+		cfg, err = ParseDSN("covenantsql://db?consistency=bounded_staleness")
+		So(err, ShouldBeNil)
+		So(cfg.MaxStaleness, ShouldEqual, DefaultMaxStaleness)
+
+		cfg, err = ParseDSN("covenantsql://db?consistency=strong")
+		So(err, ShouldBeNil)
+		So(cfg.Consistency, ShouldEqual, types.ReadConsistencyStrong)
+
+		cfg, err = ParseDSN("covenantsql://db?consistency=any")
+		So(err, ShouldBeNil)
+		So(cfg.Consistency, ShouldEqual, types.ReadConsistencyAny)
+
+		_, err = ParseDSN("covenantsql://db?consistency=eventual")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?consistency=strong=1s")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?consistency=bounded_staleness=abc")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("covenantsql://db?consistency=bounded_staleness=-1s")
+		So(err, ShouldNotBeNil)
 	})
 }
@@ -45,6 +45,9 @@ type conn struct {
 	inTransaction bool
 	closed        int32
 
+	consistency  types.ReadConsistency
+	maxStaleness time.Duration
+
 	leader   *pconn
 	follower *pconn
 }
@@ -70,10 +73,12 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	c = &conn{
-		dbID:        proto.DatabaseID(cfg.DatabaseID),
-		localNodeID: localNodeID,
-		privKey:     privKey,
-		queries:     make([]types.Query, 0),
+		dbID:         proto.DatabaseID(cfg.DatabaseID),
+		localNodeID:  localNodeID,
+		privKey:      privKey,
+		queries:      make([]types.Query, 0),
+		consistency:  cfg.Consistency,
+		maxStaleness: cfg.MaxStaleness,
 	}
 
 	// get peers from BP
@@ -390,6 +395,10 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 			Queries: queries,
 		},
 	}
+	if queryType == types.ReadQuery {
+		req.Header.Consistency = c.consistency
+		req.Header.MaxStaleness = int64(c.maxStaleness / time.Millisecond)
+	}
 
 	if err = req.Sign(c.privKey); err != nil {
 		return
@@ -36,6 +36,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -209,6 +210,106 @@ func Create(meta ResourceMeta) (dsn string, err error) {
 	return
 }
 
+// Fork forks the source database at the block height into a new database, which is seeded with the
+// source database state at that block. The block hash is fetched from the source database leader
+// and recorded as the lineage of the new database. Only the source database admin is allowed to
+// fork.
+func Fork(sourceDSN string, height int32, meta ResourceMeta) (dsn string, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		srcCfg     *Config
+		source     proto.DatabaseID
+		privateKey *asymmetric.PrivateKey
+		clientAddr proto.AccountAddress
+		peers      *proto.Peers
+		nonce      interfaces.AccountNonce
+		fetchReq   *sqlchain.MuxFetchBlockReq
+		fetchResp  = new(sqlchain.MuxFetchBlockResp)
+		req        = new(types.AddTxReq)
+		resp       = new(types.AddTxResp)
+	)
+	if srcCfg, err = ParseDSN(sourceDSN); err != nil {
+		return
+	}
+	source = proto.DatabaseID(srcCfg.DatabaseID)
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		err = errors.Wrap(err, "get local private key failed")
+		return
+	}
+	if clientAddr, err = crypto.PubKeyHash(privateKey.PubKey()); err != nil {
+		err = errors.Wrap(err, "get local account address failed")
+		return
+	}
+
+	// fetch the lineage block from the source database
+	if peers, err = cacheGetPeers(source, privateKey); err != nil {
+		return
+	}
+	fetchReq = &sqlchain.MuxFetchBlockReq{
+		DatabaseID:    source,
+		FetchBlockReq: sqlchain.FetchBlockReq{Height: height},
+	}
+	if err = rpc.NewCaller().CallNode(
+		peers.Leader, route.SQLCFetchBlock.String(), fetchReq, fetchResp,
+	); err != nil {
+		err = errors.Wrapf(err, "failed to call %s", route.SQLCFetchBlock)
+		return
+	}
+	if fetchResp.Block == nil {
+		err = errors.Errorf("no block at height %d of database %s", height, source)
+		return
+	}
+
+	if nonce, err = getNonce(clientAddr); err != nil {
+		err = errors.Wrap(err, "allocate fork database transaction nonce failed")
+		return
+	}
+
+	if meta.GasPrice == 0 {
+		meta.GasPrice = DefaultGasPrice
+	}
+	if meta.AdvancePayment == 0 {
+		meta.AdvancePayment = DefaultAdvancePayment
+	}
+
+	req.TTL = 1
+	req.Tx = types.NewForkDatabase(&types.ForkDatabaseHeader{
+		CreateDatabaseHeader: types.CreateDatabaseHeader{
+			Owner:          clientAddr,
+			ResourceMeta:   meta.ResourceMeta,
+			GasPrice:       meta.GasPrice,
+			AdvancePayment: meta.AdvancePayment,
+			TokenType:      types.Particle,
+			Nonce:          nonce,
+		},
+		Lineage: types.Lineage{
+			Source: source,
+			Height: height,
+			Block:  *fetchResp.Block.BlockHash(),
+		},
+	})
+
+	if err = req.Tx.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign request failed")
+		return
+	}
+
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		err = errors.Wrap(err, "call fork database transaction failed")
+		return
+	}
+
+	cfg := NewConfig()
+	cfg.DatabaseID = string(proto.FromAccountAndNonce(clientAddr, uint32(nonce)))
+	dsn = cfg.FormatDSN()
+
+	return
+}
+
 // WaitDBCreation waits for database creation complete
 func WaitDBCreation(ctx context.Context, dsn string) (err error) {
 	dsnCfg, err := ParseDSN(dsn)
@@ -385,6 +486,353 @@ func TransferToken(targetUser proto.AccountAddress, amount uint64, tokenType typ
 	return
 }
 
+// Dispute accuses the miner responding resp of returning a wrong result for the read query req.
+// The same request is sent to the other miners of the database as witnesses, and the dispute
+// transaction is sent to chain with their responses executed against the same state.
+func Dispute(req *types.Request, resp *types.SignedResponseHeader) (txHash hash.Hash, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		pubKey    *asymmetric.PublicKey
+		privKey   *asymmetric.PrivateKey
+		addr      proto.AccountAddress
+		dbAccount proto.AccountAddress
+		nonce     interfaces.AccountNonce
+		peers     *proto.Peers
+		witnesses []*types.SignedResponseHeader
+	)
+	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+	if dbAccount, err = req.Header.DatabaseID.AccountAddress(); err != nil {
+		return
+	}
+	if peers, err = cacheGetPeers(req.Header.DatabaseID, privKey); err != nil {
+		return
+	}
+
+	for _, s := range peers.Servers {
+		if s == resp.NodeID {
+			continue
+		}
+		var witness types.Response
+		if err := rpc.NewCaller().CallNode(s, route.DBSQuery.String(), req, &witness); err != nil {
+			log.WithField("witness", s).WithError(err).Warning("query witness failed")
+			continue
+		}
+		if err := witness.Verify(); err != nil {
+			log.WithField("witness", s).WithError(err).Warning("verify witness failed")
+			continue
+		}
+		if witness.Header.LogOffset != resp.LogOffset {
+			log.WithFields(log.Fields{
+				"witness":  s,
+				"offset":   witness.Header.LogOffset,
+				"expected": resp.LogOffset,
+			}).Warning("witness is executed against another state")
+			continue
+		}
+		witnesses = append(witnesses, &witness.Header)
+	}
+
+	nonce, err = getNonce(addr)
+	if err != nil {
+		return
+	}
+
+	d := types.NewDispute(&types.DisputeHeader{
+		Receiver:  dbAccount,
+		Response:  *resp,
+		Witnesses: witnesses,
+		Nonce:     nonce,
+	})
+	err = d.Sign(privKey)
+	if err != nil {
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	addTxReq := new(types.AddTxReq)
+	addTxResp := new(types.AddTxResp)
+	addTxReq.Tx = d
+	err = requestBP(route.MCCAddTx, addTxReq, addTxResp)
+	if err != nil {
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = d.Hash()
+	return
+}
+
+// DepositToDatabase tops up the advance payment of current account in the database. The
+// outstanding arrears are paid off first.
+func DepositToDatabase(dsn string, amount uint64) (txHash hash.Hash, err error) {
+	return sendDatabaseTx(dsn, func(
+		target proto.AccountAddress, nonce interfaces.AccountNonce) interfaces.Transaction {
+		return types.NewDepositToDatabase(&types.DepositToDatabaseHeader{
+			TargetSQLChain: target,
+			Amount:         amount,
+			TokenType:      types.Particle,
+			Nonce:          nonce,
+		})
+	})
+}
+
+// WithdrawFromDatabase withdraws the unused advance payment of current account from the database,
+// or the deposit if current account is a miner of the database.
+func WithdrawFromDatabase(dsn string, amount uint64) (txHash hash.Hash, err error) {
+	return sendDatabaseTx(dsn, func(
+		target proto.AccountAddress, nonce interfaces.AccountNonce) interfaces.Transaction {
+		return types.NewWithdrawFromDatabase(&types.WithdrawFromDatabaseHeader{
+			TargetSQLChain: target,
+			Amount:         amount,
+			TokenType:      types.Particle,
+			Nonce:          nonce,
+		})
+	})
+}
+
+// TransferDatabaseOwnership transfers the ownership of the database from current account to the
+// new owner. If requireAcceptance is set, the transfer is kept pending until the new owner accepts
+// it by AcceptDatabaseOwnership.
+func TransferDatabaseOwnership(
+	dsn string, newOwner proto.AccountAddress, requireAcceptance bool) (txHash hash.Hash, err error,
+) {
+	return sendDatabaseTx(dsn, func(
+		target proto.AccountAddress, nonce interfaces.AccountNonce) interfaces.Transaction {
+		return types.NewTransferDatabaseOwnership(&types.TransferDatabaseOwnershipHeader{
+			TargetSQLChain:    target,
+			NewOwner:          newOwner,
+			RequireAcceptance: requireAcceptance,
+			Nonce:             nonce,
+		})
+	})
+}
+
+// AcceptDatabaseOwnership accepts the pending ownership transfer of the database to current
+// account.
+func AcceptDatabaseOwnership(dsn string) (txHash hash.Hash, err error) {
+	var (
+		pubKey *asymmetric.PublicKey
+		addr   proto.AccountAddress
+	)
+	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+	return TransferDatabaseOwnership(dsn, addr, false)
+}
+
+// CreateMultiSigAccount registers a M-of-N multisig account requiring threshold signatures of
+// the keys, and returns the address of the new account.
+func CreateMultiSigAccount(threshold uint32, keys []*asymmetric.PublicKey) (
+	txHash hash.Hash, addr proto.AccountAddress, err error,
+) {
+	var account *types.MultiSigAccount
+	if account, err = types.NewMultiSigAccount(threshold, keys); err != nil {
+		return
+	}
+	if addr, err = account.Address(); err != nil {
+		return
+	}
+	txHash, err = sendTx(func(nonce interfaces.AccountNonce) interfaces.Transaction {
+		return types.NewCreateMultiSigAccount(&types.CreateMultiSigAccountHeader{
+			Account: *account,
+			Nonce:   nonce,
+		})
+	})
+	return
+}
+
+// NewMultiSigTransaction returns an unsigned transaction of the multisig account, the wrapped
+// transaction is built by newTx with the account address and its next nonce. The partial
+// signatures can be collected offline by SignMultiSig or cql-utils, and merged by
+// types.MultiSig.Merge before the transaction is sent by SendMultiSig.
+func NewMultiSigTransaction(account *types.MultiSigAccount, newTx func(
+	sender proto.AccountAddress, nonce interfaces.AccountNonce) interfaces.Transaction) (
+	tx *types.MultiSig, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		addr  proto.AccountAddress
+		nonce interfaces.AccountNonce
+	)
+	if addr, err = account.Address(); err != nil {
+		return
+	}
+	if nonce, err = getNonce(addr); err != nil {
+		return
+	}
+	tx = types.NewMultiSig(account, newTx(addr, nonce))
+	return
+}
+
+// SignMultiSig adds the partial signature of current account to the multisig transaction.
+func SignMultiSig(tx *types.MultiSig) (err error) {
+	var privKey *asymmetric.PrivateKey
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	return tx.Sign(privKey)
+}
+
+// SendMultiSig sends the multisig transaction to chain once it has collected enough signatures.
+func SendMultiSig(tx *types.MultiSig) (txHash hash.Hash, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if err = tx.Verify(); err != nil {
+		return
+	}
+	addTxReq := new(types.AddTxReq)
+	addTxResp := new(types.AddTxResp)
+	addTxReq.Tx = tx
+	if err = requestBP(route.MCCAddTx, addTxReq, addTxResp); err != nil {
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = tx.Hash()
+	return
+}
+
+func sendDatabaseTx(dsn string, newTx func(
+	target proto.AccountAddress, nonce interfaces.AccountNonce) interfaces.Transaction) (
+	txHash hash.Hash, err error,
+) {
+	var (
+		cfg    *Config
+		dbID   proto.DatabaseID
+		target proto.AccountAddress
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID = proto.DatabaseID(cfg.DatabaseID)
+	if target, err = dbID.AccountAddress(); err != nil {
+		return
+	}
+	return sendTx(func(nonce interfaces.AccountNonce) interfaces.Transaction {
+		return newTx(target, nonce)
+	})
+}
+
+func sendTx(newTx func(nonce interfaces.AccountNonce) interfaces.Transaction) (
+	txHash hash.Hash, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		privKey *asymmetric.PrivateKey
+		addr    proto.AccountAddress
+		nonce   interfaces.AccountNonce
+	)
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(privKey.PubKey()); err != nil {
+		return
+	}
+	if nonce, err = getNonce(addr); err != nil {
+		return
+	}
+
+	var tx = newTx(nonce)
+	if err = tx.Sign(privKey); err != nil {
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	addTxReq := new(types.AddTxReq)
+	addTxResp := new(types.AddTxResp)
+	addTxReq.Tx = tx
+	if err = requestBP(route.MCCAddTx, addTxReq, addTxResp); err != nil {
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = tx.Hash()
+	return
+}
+
+// BillingPreview returns the pending charges of the database in the current billing window, which
+// is computed by the leader miner of the database. Only the database admin is allowed to preview.
+func BillingPreview(dsn string) (resp *types.BillingPreviewResp, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		cfg     *Config
+		privKey *asymmetric.PrivateKey
+		peers   *proto.Peers
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if peers, err = cacheGetPeers(proto.DatabaseID(cfg.DatabaseID), privKey); err != nil {
+		return
+	}
+
+	req := &types.BillingPreviewReq{DatabaseID: proto.DatabaseID(cfg.DatabaseID)}
+	resp = &types.BillingPreviewResp{}
+	if err = rpc.NewCaller().CallNode(
+		peers.Leader, route.DBSBillingPreview.String(), req, resp,
+	); err != nil {
+		err = errors.Wrapf(err, "failed to call %s", route.DBSBillingPreview)
+		resp = nil
+	}
+	return
+}
+
+// QueryInvoices returns the confirmed billings of the database in the main chain blocks bounded
+// by the heights from and to, to 0 means no upper bound.
+func QueryInvoices(dsn string, from, to uint32) (resp *types.QueryInvoicesResp, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+
+	req := &types.QueryInvoicesReq{
+		DatabaseID: proto.DatabaseID(cfg.DatabaseID),
+		FromHeight: from,
+		ToHeight:   to,
+	}
+	resp = &types.QueryInvoicesResp{}
+	if err = requestBP(route.MCCQueryInvoices, req, resp); err != nil {
+		err = errors.Wrapf(err, "failed to call %s", route.MCCQueryInvoices)
+		resp = nil
+	}
+	return
+}
+
 // WaitTxConfirmation waits for the transaction with target hash txHash to be confirmed. It also
 // returns if any error occurs or a final state is returned from BP.
 func WaitTxConfirmation(
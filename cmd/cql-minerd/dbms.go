@@ -27,6 +27,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
@@ -50,6 +51,22 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 		MaxReqTimeGap: conf.GConf.Miner.MaxReqTimeGap,
 	}
 
+	if walInfo := conf.GConf.Miner.KayakWal; walInfo != nil && walInfo.UseFileWal {
+		cfg.FileWal = &kl.FileWalConfig{
+			SegmentSize:  walInfo.SegmentSize,
+			SyncInterval: walInfo.SyncInterval,
+		}
+		cfg.WalRetention = walInfo.Retention
+		if cfg.FileWal.SyncPolicy, err = kl.ParseSyncPolicy(walInfo.SyncPolicy); err != nil {
+			return
+		}
+	}
+
+	if archiveInfo := conf.GConf.Miner.BlockArchive; archiveInfo != nil {
+		cfg.BlockArchiveTTL = archiveInfo.TTL
+		cfg.DropSettledArchives = archiveInfo.DropSettled
+	}
+
 	if dbms, err = worker.NewDBMS(cfg); err != nil {
 		err = errors.Wrap(err, "create new DBMS failed")
 		return
@@ -79,6 +79,10 @@ var (
 	metricGraphite string
 	traceFile      string
 
+	// service
+	withdraw bool
+	drain    bool
+
 	// other
 	noLogo      bool
 	showVersion bool
@@ -106,6 +110,10 @@ func init() {
 
 	flag.StringVar(&traceFile, "trace-file", "", "Trace profile")
 	flag.StringVar(&logLevel, "log-level", "", "Service log level")
+	flag.BoolVar(&withdraw, "withdraw-service", false,
+		"Withdraw from the provider list instead of providing service")
+	flag.BoolVar(&drain, "drain", false,
+		"Hand off the served databases to replacement miners on service withdrawal")
 
 	flag.Usage = func() {
 		_, _ = fmt.Fprintf(os.Stderr, "\n%s\n\n", desc)
@@ -201,6 +209,12 @@ func main() {
 
 	// start period provide service transaction generator
 	go func() {
+		if withdraw {
+			// stop receiving new databases, the served ones are kept until released
+			sendWithdrawService(drain)
+			return
+		}
+
 		// start prometheus collector
 		reg := metric.StartMetricCollector()
 
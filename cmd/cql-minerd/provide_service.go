@@ -155,6 +155,16 @@ func sendProvideService(reg *prometheus.Registry) {
 	if conf.GConf.Miner != nil && len(conf.GConf.Miner.TargetUsers) > 0 {
 		tx.ProvideServiceHeader.TargetUser = conf.GConf.Miner.TargetUsers
 	}
+	if conf.GConf.Miner != nil {
+		for _, v := range conf.GConf.Miner.Labels {
+			var label types.Label
+			if label, err = types.ParseLabel(v); err != nil {
+				log.WithError(err).Error("parse miner label failed")
+				return
+			}
+			tx.ProvideServiceHeader.Labels = append(tx.ProvideServiceHeader.Labels, label)
+		}
+	}
 
 	tx.Nonce = nonceResp.Nonce
 
@@ -172,3 +182,59 @@ func sendProvideService(reg *prometheus.Registry) {
 		return
 	}
 }
+
+func sendWithdrawService(drain bool) {
+	var (
+		privateKey *asymmetric.PrivateKey
+		minerAddr  proto.AccountAddress
+		err        error
+	)
+
+	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+		log.WithError(err).Error("get local private key failed")
+		return
+	}
+
+	if minerAddr, err = crypto.PubKeyHash(privateKey.PubKey()); err != nil {
+		log.WithError(err).Error("get miner account address failed")
+		return
+	}
+
+	var (
+		nonceReq  = new(types.NextAccountNonceReq)
+		nonceResp = new(types.NextAccountNonceResp)
+		req       = new(types.AddTxReq)
+		resp      = new(types.AddTxResp)
+	)
+
+	nonceReq.Addr = minerAddr
+
+	if err = rpc.RequestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
+		// allocate nonce failed
+		log.WithError(err).Error("allocate nonce for transaction failed")
+		return
+	}
+
+	tx := types.NewWithdrawService(
+		&types.WithdrawServiceHeader{
+			Drain: drain,
+			Nonce: nonceResp.Nonce,
+		},
+	)
+
+	if err = tx.Sign(privateKey); err != nil {
+		log.WithError(err).Error("sign withdraw service transaction failed")
+		return
+	}
+
+	req.TTL = 1
+	req.Tx = tx
+
+	if err = rpc.RequestBP(route.MCCAddTx.String(), req, resp); err != nil {
+		// add transaction failed
+		log.WithError(err).Error("send withdraw service transaction failed")
+		return
+	}
+
+	log.WithField("drain", drain).Info("sent withdraw service transaction")
+}
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -156,6 +157,63 @@ func (a *explorerAPI) GetResponse(rw http.ResponseWriter, r *http.Request) {
 	sendResponse(200, true, "", a.formatResponseHeader(resp), rw)
 }
 
+func (a *explorerAPI) GetMerkleProof(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	h, err := a.getHash(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	var bucket []byte
+	switch vars["type"] {
+	case "ack":
+		bucket = ackBucket
+	case "request":
+		bucket = requestBucket
+	case "response":
+		bucket = responseBucket
+	default:
+		sendResponse(400, false, "invalid proof type", nil, rw)
+		return
+	}
+
+	height, b, leaf, proof, err := a.service.getMerkleProof(dbID, bucket, h)
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(200, true, "", a.formatMerkleProof(height, b, &leaf, proof), rw)
+}
+
+func (a *explorerAPI) GetPendingLogs(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	logs := a.service.getPendingLogs(dbID)
+	res := make([]map[string]interface{}, 0, len(logs))
+	for _, q := range logs {
+		res = append(res, a.formatQueryAsTx(q))
+	}
+
+	sendResponse(200, true, "", map[string]interface{}{
+		"logs": res,
+	}, rw)
+}
+
 func (a *explorerAPI) GetBlock(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
@@ -605,6 +663,13 @@ func (a *explorerAPI) formatResponseHeader(resp *types.SignedResponseHeader) map
 	}
 }
 
+func (a *explorerAPI) formatQueryAsTx(q *types.QueryAsTx) map[string]interface{} {
+	return map[string]interface{}{
+		"request":  a.formatRequest(q.Request)["request"],
+		"response": a.formatResponseHeader(q.Response)["response"],
+	}
+}
+
 func (a *explorerAPI) formatAck(ack *types.SignedAckHeader) map[string]interface{} {
 	return map[string]interface{}{
 		"ack": map[string]interface{}{
@@ -630,6 +695,30 @@ func (a *explorerAPI) formatAck(ack *types.SignedAckHeader) map[string]interface
 	}
 }
 
+func (a *explorerAPI) formatMerkleProof(
+	height int32, b *types.Block, leaf *hash.Hash, proof *merkle.Proof) map[string]interface{} {
+	siblings := make([]string, 0, len(proof.Siblings))
+	for _, v := range proof.Siblings {
+		siblings = append(siblings, v.String())
+	}
+
+	return map[string]interface{}{
+		"proof": map[string]interface{}{
+			"block": map[string]interface{}{
+				"height":      height,
+				"hash":        b.BlockHash().String(),
+				"merkle_root": b.SignedHeader.MerkleRoot.String(),
+				"state_root":  b.StateRoot().String(),
+				"producer":    b.Producer(),
+				"timestamp":   a.formatTime(b.Timestamp()),
+			},
+			"leaf":     leaf.String(),
+			"index":    proof.Index,
+			"siblings": siblings,
+		},
+	}
+}
+
 func (a *explorerAPI) formatTime(t time.Time) float64 {
 	return float64(t.UnixNano()) / 1e6
 }
@@ -677,6 +766,8 @@ func startAPI(service *Service, listenAddr string) (server *http.Server, err err
 	v3Router.HandleFunc("/count/{db}/{count:[0-9]+}", api.GetBlockByCountV3).Methods("GET")
 	v3Router.HandleFunc("/height/{db}/{height:[0-9]+}", api.GetBlockByHeightV3).Methods("GET")
 	v3Router.HandleFunc("/head/{db}", api.GetHighestBlockV3).Methods("GET")
+	v3Router.HandleFunc("/proof/{type:ack|request|response}/{db}/{hash}", api.GetMerkleProof).Methods("GET")
+	v3Router.HandleFunc("/pending/{db}", api.GetPendingLogs).Methods("GET")
 
 	server = &http.Server{
 		Addr:         listenAddr,
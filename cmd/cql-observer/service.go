@@ -27,6 +27,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
@@ -41,6 +42,8 @@ import (
 
 const (
 	dbFileName = "observer.db"
+	// maxPendingLogs is the maximum number of pending write logs kept for each database.
+	maxPendingLogs = 10000
 )
 
 // Bucket stores transaction/block information as follows
@@ -103,6 +106,10 @@ type Service struct {
 	db      *bolt.DB
 	caller  *rpc.Caller
 	stopped int32
+
+	// pendingLogs keeps the advised write logs which are not included in any block yet.
+	pendingLock sync.Mutex
+	pendingLogs map[proto.DatabaseID][]*types.QueryAsTx
 }
 
 // NewService creates new observer service and load previous subscription from the meta database.
@@ -151,6 +158,7 @@ func NewService() (service *Service, err error) {
 		subscription: make(map[proto.DatabaseID]int32),
 		db:           db,
 		caller:       rpc.NewCaller(),
+		pendingLogs:  make(map[proto.DatabaseID][]*types.QueryAsTx),
 	}
 
 	// load previous subscriptions
@@ -241,6 +249,76 @@ func (s *Service) AdviseNewBlock(req *sqlchain.MuxAdviseNewBlockReq, resp *sqlch
 	return s.addBlock(req.DatabaseID, req.Count, req.Block)
 }
 
+// AdviseBinLog handles write logs advised by the remote database chain service between blocks.
+func (s *Service) AdviseBinLog(req *sqlchain.MuxAdviseBinLogReq, resp *sqlchain.MuxAdviseBinLogResp) (err error) {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		// stopped
+		return ErrStopped
+	}
+
+	log.WithFields(log.Fields{
+		"node":  req.GetNodeID().String(),
+		"count": len(req.Logs),
+	}).Debug("received binlog")
+
+	s.addPendingLogs(req.DatabaseID, req.Logs)
+	return
+}
+
+func (s *Service) addPendingLogs(dbID proto.DatabaseID, logs []*types.QueryAsTx) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	pending := s.pendingLogs[dbID]
+	for _, q := range logs {
+		if q.Request == nil || q.Response == nil {
+			continue
+		}
+		if err := q.Response.Verify(); err != nil {
+			log.WithField("db", dbID).WithError(err).Warning("received invalid binlog")
+			continue
+		}
+		// skip logs already received
+		if l := len(pending); l > 0 && q.Response.LogOffset <= pending[l-1].Response.LogOffset {
+			continue
+		}
+		pending = append(pending, q)
+	}
+	if len(pending) > maxPendingLogs {
+		pending = pending[len(pending)-maxPendingLogs:]
+	}
+	s.pendingLogs[dbID] = pending
+}
+
+func (s *Service) prunePendingLogs(dbID proto.DatabaseID, b *types.Block) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	pending := s.pendingLogs[dbID]
+	if len(pending) == 0 {
+		return
+	}
+	included := make(map[hash.Hash]struct{}, len(b.QueryTxs))
+	for _, q := range b.QueryTxs {
+		included[q.Response.Hash()] = struct{}{}
+	}
+	remains := pending[:0]
+	for _, q := range pending {
+		if _, ok := included[q.Response.Hash()]; !ok {
+			remains = append(remains, q)
+		}
+	}
+	s.pendingLogs[dbID] = remains
+}
+
+func (s *Service) getPendingLogs(dbID proto.DatabaseID) (logs []*types.QueryAsTx) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	logs = make([]*types.QueryAsTx, len(s.pendingLogs[dbID]))
+	copy(logs, s.pendingLogs[dbID])
+	return
+}
+
 func (s *Service) start() (err error) {
 	if atomic.LoadInt32(&s.stopped) == 1 {
 		// stopped
@@ -425,6 +503,8 @@ func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *types.Block) (
 		}
 	}
 
+	s.prunePendingLogs(dbID, b)
+
 	return
 }
 
@@ -691,6 +771,65 @@ func (s *Service) getResponseHeader(dbID proto.DatabaseID, h *hash.Hash) (respon
 	return
 }
 
+// lookupIndex returns the block height and the object offset in block of the indexed object.
+func (s *Service) lookupIndex(
+	bucketName []byte, dbID proto.DatabaseID, h *hash.Hash) (height, offset int32, err error,
+) {
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(bucketName).Bucket([]byte(dbID))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		data := bucket.Get(h.AsBytes())
+		if data == nil {
+			return ErrNotFound
+		}
+
+		// get block height and object offset in block
+		if len(data) != 8 {
+			// invalid data payload
+			return ErrInconsistentData
+		}
+
+		height = bytesToInt32(data[:4])
+		offset = bytesToInt32(data[4:])
+		return
+	})
+	return
+}
+
+// getMerkleProof returns the block including the ack, request or response and the merkle inclusion
+// proof of it. A request is included in block by its response, so the leaf of a request is the
+// hash of its response.
+func (s *Service) getMerkleProof(dbID proto.DatabaseID, bucketName []byte, h *hash.Hash) (
+	height int32, b *types.Block, leaf hash.Hash, proof *merkle.Proof, err error,
+) {
+	var offset int32
+	if height, offset, err = s.lookupIndex(bucketName, dbID, h); err != nil {
+		return
+	}
+	if _, b, err = s.getBlockByHeight(dbID, height); err != nil {
+		return
+	}
+
+	switch string(bucketName) {
+	case string(requestBucket):
+		if offset < 0 || int32(len(b.QueryTxs)) <= offset {
+			err = ErrInconsistentData
+			return
+		}
+		leaf = b.QueryTxs[int(offset)].Response.Hash()
+	default:
+		leaf = *h
+	}
+
+	if proof, err = b.MerkleProof(&leaf); err != nil {
+		err = ErrInconsistentData
+	}
+	return
+}
+
 func (s *Service) getHighestBlock(dbID proto.DatabaseID) (height int32, b *types.Block, err error) {
 	err = s.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(blockBucket).Bucket([]byte(dbID))
@@ -43,7 +43,7 @@ const name = "cql-utils"
 func init() {
 	log.SetLevel(log.InfoLevel)
 
-	flag.StringVar(&tool, "tool", "", "Tool type, miner, keytool, rpc, nonce, confgen, addrgen, adapterconfgen")
+	flag.StringVar(&tool, "tool", "", "Tool type, miner, keytool, rpc, nonce, confgen, addrgen, adapterconfgen, walmigrate, wal, block, multisig")
 	flag.StringVar(&publicKeyHex, "public", "", "Public key hex string to mine node id/nonce")
 	flag.StringVar(&privateKeyFile, "private", "~/.cql/private.key", "Private key file to generate/show")
 	flag.StringVar(&configFile, "config", "~/.cql/config.yaml", "Config file to use")
@@ -100,6 +100,14 @@ func main() {
 			os.Exit(1)
 		}
 		runAddrgen()
+	case "walmigrate":
+		runWalMigrate()
+	case "wal":
+		runWalInspect()
+	case "block":
+		runBlockInspect()
+	case "multisig":
+		runMultiSig()
 	default:
 		flag.Usage()
 		os.Exit(1)
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	multiSigAction    string
+	multiSigFile      string
+	multiSigMerge     string
+	multiSigKeys      string
+	multiSigThreshold uint
+	multiSigReceiver  string
+	multiSigAmount    uint64
+)
+
+func init() {
+	flag.StringVar(&multiSigAction, "multisig-action", "show",
+		"Multisig action: create, transfer, sign, merge, show or send")
+	flag.StringVar(&multiSigFile, "multisig-file", "", "Multisig transaction file to operate on")
+	flag.StringVar(&multiSigMerge, "multisig-merge", "",
+		"Comma separated multisig transaction files to merge signatures from")
+	flag.StringVar(&multiSigKeys, "multisig-keys", "", "Comma separated public key hex strings of the multisig account")
+	flag.UintVar(&multiSigThreshold, "multisig-threshold", 0, "Number of signatures required by the multisig account")
+	flag.StringVar(&multiSigReceiver, "multisig-to", "", "Receiver account address of the multisig transfer")
+	flag.Uint64Var(&multiSigAmount, "multisig-amount", 0, "Particle amount of the multisig transfer")
+}
+
+func runMultiSig() {
+	switch multiSigAction {
+	case "create":
+		account := parseMultiSigAccount()
+		initMultiSigClient()
+		txHash, addr, err := client.CreateMultiSigAccount(account.Threshold, account.Keys)
+		if err != nil {
+			log.WithError(err).Fatal("create multisig account failed")
+		}
+		fmt.Printf("multisig account: %s\ntx hash: %s\n", addr, txHash)
+	case "transfer":
+		if multiSigReceiver == "" || multiSigAmount == 0 {
+			log.Fatal("multisig-to and multisig-amount are required for transfer")
+		}
+		h, err := hash.NewHashFromStr(multiSigReceiver)
+		if err != nil {
+			log.WithError(err).Fatal("invalid receiver address")
+		}
+		account := parseMultiSigAccount()
+		initMultiSigClient()
+		tx, err := client.NewMultiSigTransaction(account, func(
+			sender proto.AccountAddress, nonce pi.AccountNonce) pi.Transaction {
+			return types.NewTransfer(&types.TransferHeader{
+				Sender:    sender,
+				Receiver:  proto.AccountAddress(*h),
+				Amount:    multiSigAmount,
+				TokenType: types.Particle,
+				Nonce:     nonce,
+			})
+		})
+		if err != nil {
+			log.WithError(err).Fatal("build multisig transaction failed")
+		}
+		writeMultiSigFile(tx)
+	case "sign":
+		tx := readMultiSigFile(multiSigFile)
+		masterKey, err := readMasterKey()
+		if err != nil {
+			log.WithError(err).Fatal("read master key failed")
+		}
+		privateKey, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
+		if err != nil {
+			log.WithError(err).Fatal("load private key file failed")
+		}
+		if err = tx.Sign(privateKey); err != nil {
+			log.WithError(err).Fatal("sign multisig transaction failed")
+		}
+		writeMultiSigFile(tx)
+	case "merge":
+		tx := readMultiSigFile(multiSigFile)
+		for _, v := range strings.Split(multiSigMerge, ",") {
+			if err := tx.Merge(readMultiSigFile(strings.TrimSpace(v))); err != nil {
+				log.WithError(err).Fatalf("merge signatures from %s failed", v)
+			}
+		}
+		writeMultiSigFile(tx)
+	case "show":
+		showMultiSig(readMultiSigFile(multiSigFile))
+	case "send":
+		tx := readMultiSigFile(multiSigFile)
+		initMultiSigClient()
+		txHash, err := client.SendMultiSig(tx)
+		if err != nil {
+			log.WithError(err).Fatal("send multisig transaction failed")
+		}
+		fmt.Printf("tx hash: %s\n", txHash)
+	default:
+		log.Fatalf("unknown multisig action: %s", multiSigAction)
+	}
+}
+
+func initMultiSigClient() {
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	if err = client.Init(configFile, []byte(masterKey)); err != nil {
+		log.WithError(err).Fatal("init client failed")
+	}
+}
+
+func parseMultiSigAccount() (account *types.MultiSigAccount) {
+	var keys []*asymmetric.PublicKey
+	for _, v := range strings.Split(multiSigKeys, ",") {
+		b, err := hex.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			log.WithError(err).Fatal("error converting hex")
+		}
+		key, err := asymmetric.ParsePubKey(b)
+		if err != nil {
+			log.WithError(err).Fatal("error converting public key")
+		}
+		keys = append(keys, key)
+	}
+	account, err := types.NewMultiSigAccount(uint32(multiSigThreshold), keys)
+	if err != nil {
+		log.WithError(err).Fatal("invalid multisig account")
+	}
+	return
+}
+
+func readMultiSigFile(path string) (tx *types.MultiSig) {
+	if path == "" {
+		log.Fatal("multisig-file is required")
+	}
+	enc, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.WithError(err).Fatal("read multisig transaction file failed")
+	}
+	tx = &types.MultiSig{}
+	if err = utils.DecodeMsgPack(enc, tx); err != nil {
+		log.WithError(err).Fatal("decode multisig transaction failed")
+	}
+	return
+}
+
+func writeMultiSigFile(tx *types.MultiSig) {
+	if multiSigFile == "" {
+		log.Fatal("multisig-file is required")
+	}
+	enc, err := utils.EncodeMsgPack(tx)
+	if err != nil {
+		log.WithError(err).Fatal("encode multisig transaction failed")
+	}
+	if err = ioutil.WriteFile(multiSigFile, enc.Bytes(), 0600); err != nil {
+		log.WithError(err).Fatal("write multisig transaction file failed")
+	}
+	fmt.Printf("multisig transaction saved to %s, signatures: %d/%d\n",
+		multiSigFile, len(tx.Signees), tx.Account.Threshold)
+}
+
+func showMultiSig(tx *types.MultiSig) {
+	fmt.Printf("account: %s\n", tx.GetAccountAddress())
+	fmt.Printf("threshold: %d of %d\n", tx.Account.Threshold, len(tx.Account.Keys))
+	if inner := tx.Unwrap(); inner != nil {
+		fmt.Printf("transaction: %s, nonce: %d\n", inner.GetTransactionType(), inner.GetAccountNonce())
+	}
+	fmt.Printf("hash: %s\n", tx.Hash())
+	for _, v := range tx.Signees {
+		addr, _ := crypto.PubKeyHash(v)
+		fmt.Printf("signed by: %s\n", addr)
+	}
+	if err := tx.Verify(); err != nil {
+		fmt.Printf("verify: %v\n", err)
+	} else {
+		fmt.Println("verify: ok")
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/worker"
+)
+
+var (
+	inspectPath    string
+	inspectAction  string
+	inspectDecode  bool
+	inspectFrom    int64
+	inspectLogType string
+)
+
+func init() {
+	flag.StringVar(&inspectPath, "inspect-path", "",
+		"Kayak leveldb wal path for wal tool, sqlchain file prefix (e.g. chain.db) for block tool")
+	flag.StringVar(&inspectAction, "inspect-action", "verify", "Inspect action: list, verify or truncate")
+	flag.BoolVar(&inspectDecode, "inspect-decode", false, "Decode wal payloads or block contents on list")
+	flag.Int64Var(&inspectFrom, "inspect-truncate-from", -1,
+		"Truncate from this index/height, default to the first corrupted one")
+	flag.StringVar(&inspectLogType, "inspect-log-type", "", "Only list logs of this type, e.g. LogPrepare")
+}
+
+func runWalInspect() {
+	if inspectPath == "" {
+		log.Fatal("inspect-path is required for wal tool")
+		return
+	}
+
+	p, err := kl.NewLevelDBWal(inspectPath)
+	if err != nil {
+		log.WithError(err).Fatal("open wal failed")
+		return
+	}
+	defer p.Close()
+
+	var printLog kl.WalkFunc
+	if inspectAction == "list" {
+		printLog = func(index uint64, l *kt.Log, lerr error) error {
+			if lerr != nil {
+				fmt.Printf("%d\tCORRUPTED\t%v\n", index, lerr)
+				return nil
+			}
+			if inspectLogType != "" && l.Type.String() != inspectLogType {
+				return nil
+			}
+			fmt.Printf("%d\t%s\t%s\t%d\n", index, l.Type, l.Producer, len(l.Data))
+			if inspectDecode {
+				printLogPayload(l)
+			}
+			return nil
+		}
+	}
+
+	report, err := kl.Inspect(p, printLog)
+	if err != nil {
+		log.WithError(err).Fatal("inspect wal failed")
+		return
+	}
+
+	switch inspectAction {
+	case "list", "verify":
+		fmt.Printf("logs: %d, index: [%d, %d]\n", report.Count, report.FirstIndex, report.LastIndex)
+		for t, c := range report.TypeCount {
+			fmt.Printf("  %s: %d\n", t, c)
+		}
+		fmt.Printf("missing indexes: %v\n", report.Missing)
+		fmt.Printf("pending prepares: %v\n", report.PendingPrepares)
+		fmt.Printf("orphan commits/rollbacks: %v\n", report.Orphans)
+		fmt.Printf("corrupted logs: %v\n", report.Corrupted)
+	case "truncate":
+		var from uint64
+		if inspectFrom >= 0 {
+			from = uint64(inspectFrom)
+		} else if len(report.Corrupted) > 0 {
+			from = report.Corrupted[0]
+		} else {
+			fmt.Println("no corrupted log found, nothing to truncate")
+			return
+		}
+		removed, err := p.TruncateFrom(from)
+		if err != nil {
+			log.WithError(err).Fatal("truncate wal failed")
+			return
+		}
+		fmt.Printf("removed %d logs from index %d\n", removed, from)
+	default:
+		log.Fatalf("unknown inspect action: %s", inspectAction)
+	}
+}
+
+func printLogPayload(l *kt.Log) {
+	switch l.Type {
+	case kt.LogPrepare:
+		// decode with the kayak handler payload format of worker database
+		req, err := (&worker.Database{}).DecodePayload(l.Data)
+		if err != nil {
+			fmt.Printf("\tdecode payload failed: %v\n", err)
+			return
+		}
+		printJSON(req)
+	case kt.LogCommit, kt.LogRollback:
+		if len(l.Data) >= 8 {
+			fmt.Printf("\tprepare index: %d", binary.BigEndian.Uint64(l.Data))
+		}
+		if len(l.Data) >= 16 {
+			fmt.Printf(", last commit: %d", binary.BigEndian.Uint64(l.Data[8:]))
+		}
+		fmt.Println()
+	}
+}
+
+func runBlockInspect() {
+	if inspectPath == "" {
+		log.Fatal("inspect-path is required for block tool")
+		return
+	}
+
+	var printBlock func(*sqlchain.BlockRecord) error
+	if inspectAction == "list" {
+		printBlock = func(rec *sqlchain.BlockRecord) error {
+			if rec.Err != nil {
+				fmt.Printf("%d\t%s\tCORRUPTED\t%v\n", rec.Height, rec.Hash, rec.Err)
+				return nil
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\tqueries: %d, acks: %d, failed: %d\n",
+				rec.Height, rec.Hash, rec.Block.Producer(), rec.Block.Timestamp(),
+				len(rec.Block.QueryTxs), len(rec.Block.Acks), len(rec.Block.FailedReqs))
+			if inspectDecode {
+				printJSON(rec.Block)
+			}
+			return nil
+		}
+	}
+
+	report, err := sqlchain.InspectBlockStore(inspectPath, printBlock)
+	if err != nil {
+		log.WithError(err).Fatal("inspect block storage failed")
+		return
+	}
+
+	switch inspectAction {
+	case "list", "verify":
+		fmt.Printf("blocks: %d, head: %s at height %d\n", report.Count, report.HeadHash, report.HeadHeight)
+		fmt.Printf("archived blocks: %d\n", report.Archived)
+		fmt.Printf("unlinked blocks: %v\n", report.Unlinked)
+		fmt.Printf("corrupted blocks: %v\n", report.Corrupted)
+	case "truncate":
+		var from int32
+		if inspectFrom >= 0 {
+			from = int32(inspectFrom)
+		} else if len(report.Corrupted) > 0 {
+			from = report.Corrupted[0]
+		} else {
+			fmt.Println("no corrupted block found, nothing to truncate")
+			return
+		}
+		removed, err := sqlchain.TruncateBlockStore(inspectPath, from)
+		if err != nil {
+			log.WithError(err).Fatal("truncate block storage failed")
+			return
+		}
+		fmt.Printf("removed %d blocks from height %d\n", removed, from)
+	default:
+		log.Fatalf("unknown inspect action: %s", inspectAction)
+	}
+}
+
+func printJSON(v interface{}) {
+	out, err := json.MarshalIndent(v, "\t", "  ")
+	if err != nil {
+		fmt.Printf("\tencode json failed: %v\n", err)
+		return
+	}
+	fmt.Printf("\t%s\n", out)
+}
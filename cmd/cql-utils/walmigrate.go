@@ -0,0 +1,64 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	walSrc         string
+	walDst         string
+	walSegmentSize int64
+	walSyncPolicy  string
+)
+
+func init() {
+	flag.StringVar(&walSrc, "wal-src", "", "Source leveldb wal path to migrate")
+	flag.StringVar(&walDst, "wal-dst", "", "Target file wal directory to migrate to")
+	flag.Int64Var(&walSegmentSize, "wal-segment-size", kl.DefaultSegmentSize, "Max segment file size of target file wal")
+	flag.StringVar(&walSyncPolicy, "wal-sync", "always", "Sync policy of target file wal: always, interval or none")
+}
+
+func runWalMigrate() {
+	if walSrc == "" || walDst == "" {
+		log.Fatal("wal-src and wal-dst are required for walmigrate tool")
+		return
+	}
+
+	cfg := &kl.FileWalConfig{
+		SegmentSize: walSegmentSize,
+	}
+
+	var err error
+	if cfg.SyncPolicy, err = kl.ParseSyncPolicy(walSyncPolicy); err != nil {
+		log.WithError(err).Fatal("invalid sync policy")
+		return
+	}
+
+	count, err := kl.MigrateLevelDBWal(walSrc, walDst, cfg)
+	if err != nil {
+		log.WithError(err).Fatal("migrate wal failed")
+		return
+	}
+
+	fmt.Printf("migrated %d logs from %s to %s\n", count, walSrc, walDst)
+}
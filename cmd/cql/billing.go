@@ -0,0 +1,137 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/types"
+)
+
+// billingRow is a charge of a single user, which is the unit for cost attribution.
+type billingRow struct {
+	Invoice   string    `json:"invoice,omitempty"` // billing tx hash, empty for pending charges
+	Height    int64     `json:"height"`            // main chain height, or sqlchain end height if pending
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user"`
+	Gas       uint64    `json:"gas"`
+	GasPrice  uint64    `json:"gas_price"`
+	Amount    uint64    `json:"amount"`
+}
+
+var billingCSVHeader = []string{
+	"invoice", "height", "timestamp", "user", "gas", "gas_price", "amount",
+}
+
+func (r *billingRow) csvRecord() []string {
+	var ts string
+	if !r.Timestamp.IsZero() {
+		ts = r.Timestamp.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		r.Invoice,
+		strconv.FormatInt(r.Height, 10),
+		ts,
+		r.User,
+		strconv.FormatUint(r.Gas, 10),
+		strconv.FormatUint(r.GasPrice, 10),
+		strconv.FormatUint(r.Amount, 10),
+	}
+}
+
+// toDSN accepts both the database dsn and the database id without covenantsql:// scheme.
+func toDSN(db string) string {
+	if _, err := client.ParseDSN(db); err != nil {
+		cfg := client.NewConfig()
+		cfg.DatabaseID = db
+		return cfg.FormatDSN()
+	}
+	return db
+}
+
+func appendBillingRows(
+	rows []*billingRow, invoice string, height int64, ts time.Time,
+	billing *types.UpdateBillingHeader, gasPrice uint64,
+) []*billingRow {
+	for _, v := range billing.Users {
+		rows = append(rows, &billingRow{
+			Invoice:   invoice,
+			Height:    height,
+			Timestamp: ts,
+			User:      v.User.String(),
+			Gas:       v.Cost,
+			GasPrice:  gasPrice,
+			Amount:    v.Cost * gasPrice,
+		})
+	}
+	return rows
+}
+
+func writeBillingRows(w io.Writer, format string, rows []*billingRow) (err error) {
+	switch format {
+	case "json":
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "csv":
+		var cw = csv.NewWriter(w)
+		if err = cw.Write(billingCSVHeader); err != nil {
+			return
+		}
+		for _, v := range rows {
+			if err = cw.Write(v.csvRecord()); err != nil {
+				return
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown billing format %#v, should be csv or json", format)
+	}
+}
+
+func previewBilling(w io.Writer, dsn string, format string) (err error) {
+	var resp *types.BillingPreviewResp
+	if resp, err = client.BillingPreview(dsn); err != nil {
+		return
+	}
+	var rows = make([]*billingRow, 0)
+	if resp.Billing != nil {
+		rows = appendBillingRows(
+			rows, "", int64(resp.EndHeight), time.Time{}, resp.Billing, resp.GasPrice)
+	}
+	return writeBillingRows(w, format, rows)
+}
+
+func exportInvoices(w io.Writer, dsn string, from, to uint32, format string) (err error) {
+	var resp *types.QueryInvoicesResp
+	if resp, err = client.QueryInvoices(dsn, from, to); err != nil {
+		return
+	}
+	var rows = make([]*billingRow, 0)
+	for _, v := range resp.Invoices {
+		rows = appendBillingRows(
+			rows, v.Hash.String(), int64(v.Height), v.Timestamp, &v.Billing, resp.GasPrice)
+	}
+	return writeBillingRows(w, format, rows)
+}
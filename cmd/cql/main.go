@@ -67,13 +67,28 @@ var (
 
 	// DML variables
 	createDB                string // as a instance meta json string or simply a node count
+	forkDB                  string // source database id to fork
+	forkHeight              int    // source database block height to fork at
+	forkMeta                string // as a instance meta json string or simply a node count
 	dropDB                  string // database id to drop
 	updatePermission        string // update user's permission on specific sqlchain
 	transferToken           string // transfer token to target account
+	depositDB               string // database id to top up the advance payment
+	withdrawDB              string // database id to withdraw the advance payment or deposit from
+	fundAmount              uint64 // amount to deposit or withdraw
+	transferOwnership       string // transfer database ownership to target account
+	acceptOwnership         string // database id to accept the pending ownership transfer
 	getBalance              bool   // get balance of current account
 	getBalanceWithTokenName string // get specific token's balance of current account
 	waitTxConfirmation      bool   // wait for transaction confirmation before exiting
 
+	// Billing variables
+	billingPreview string // database id to preview the pending charges
+	invoices       string // database id to export the confirmed billings
+	invoiceFrom    uint   // main chain height to export invoices from
+	invoiceTo      uint   // main chain height to export invoices to, 0 means no bound
+	billingFormat  string // billing export format: csv or json
+
 	waitTxConfirmationMaxDuration time.Duration
 )
 
@@ -83,6 +98,13 @@ type userPermission struct {
 	Perm        string               `json:"perm"`
 }
 
+type tranOwner struct {
+	TargetChain proto.AccountAddress `json:"chain"`
+	NewOwner    proto.AccountAddress `json:"owner"`
+	// Accept requires the new owner to accept the transfer by -accept-owner
+	Accept bool `json:"accept"`
+}
+
 type tranToken struct {
 	TargetUser proto.AccountAddress `json:"addr"`
 	Amount     string               `json:"amount"`
@@ -224,12 +246,27 @@ func init() {
 
 	// DML flags
 	flag.StringVar(&createDB, "create", "", "Create database, argument can be instance requirement json or simply a node count requirement")
+	flag.StringVar(&forkDB, "fork", "", "Fork database at specific block height into a new database, argument should be the source database id")
+	flag.IntVar(&forkHeight, "fork-height", 0, "Block height of the source database to fork at")
+	flag.StringVar(&forkMeta, "fork-meta", "1", "Instance requirement of the forked database, in the same form as -create")
 	flag.StringVar(&dropDB, "drop", "", "Drop database, argument should be a database id (without covenantsql:// scheme is acceptable)")
 	flag.StringVar(&updatePermission, "update-perm", "", "Update user's permission on specific sqlchain")
 	flag.StringVar(&transferToken, "transfer", "", "Transfer token to target account")
+	flag.StringVar(&depositDB, "deposit", "", "Top up the advance payment in specific database, the outstanding arrears are paid off first")
+	flag.StringVar(&withdrawDB, "withdraw", "", "Withdraw the unused advance payment, or the deposit for a miner, from specific database")
+	flag.Uint64Var(&fundAmount, "amount", 0, "Amount of Particle to deposit or withdraw")
+	flag.StringVar(&transferOwnership, "transfer-owner", "", "Transfer database ownership to target account")
+	flag.StringVar(&acceptOwnership, "accept-owner", "", "Accept the pending ownership transfer of specific database")
 	flag.BoolVar(&getBalance, "get-balance", false, "Get balance of current account")
 	flag.StringVar(&getBalanceWithTokenName, "token-balance", "", "Get specific token's balance of current account, e.g. Particle, Wave, and etc.")
 	flag.BoolVar(&waitTxConfirmation, "wait-tx-confirm", false, "Wait for transaction confirmation")
+
+	// Billing flags
+	flag.StringVar(&billingPreview, "billing-preview", "", "Preview the pending charges per user of specific database, only allowed for database admin")
+	flag.StringVar(&invoices, "invoices", "", "Export the confirmed billings per user of specific database")
+	flag.UintVar(&invoiceFrom, "invoice-from", 0, "Export invoices from the main chain height")
+	flag.UintVar(&invoiceTo, "invoice-to", 0, "Export invoices to the main chain height, 0 means the current head")
+	flag.StringVar(&billingFormat, "billing-format", "csv", "Billing export format: csv or json")
 }
 
 func main() {
@@ -299,6 +336,23 @@ func main() {
 		return
 	}
 
+	if billingPreview != "" {
+		if err = previewBilling(os.Stdout, toDSN(billingPreview), billingFormat); err != nil {
+			log.WithField("db", billingPreview).WithError(err).Error("preview billing failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if invoices != "" {
+		if err = exportInvoices(os.Stdout, toDSN(invoices),
+			uint32(invoiceFrom), uint32(invoiceTo), billingFormat); err != nil {
+			log.WithField("db", invoices).WithError(err).Error("export invoices failed")
+			os.Exit(-1)
+		}
+		return
+	}
+
 	if dropDB != "" {
 		// drop database
 		if _, err := client.ParseDSN(dropDB); err != nil {
@@ -322,25 +376,48 @@ func main() {
 	if createDB != "" {
 		// create database
 		// parse instance requirement
-		var meta client.ResourceMeta
+		meta, err := parseResourceMeta(createDB)
+		if err != nil {
+			log.WithField("db", createDB).Error("create database failed: invalid instance description")
+			os.Exit(-1)
+			return
+		}
 
-		if err := json.Unmarshal([]byte(createDB), &meta); err != nil {
-			// not a instance json, try if it is a number describing node count
-			nodeCnt, err := strconv.ParseUint(createDB, 10, 16)
+		dsn, err := client.Create(meta)
+		if err != nil {
+			log.WithError(err).Error("create database failed")
+			os.Exit(-1)
+			return
+		}
+
+		if waitTxConfirmation {
+			var ctx, cancel = context.WithTimeout(context.Background(), waitTxConfirmationMaxDuration)
+			defer cancel()
+			err = client.WaitDBCreation(ctx, dsn)
 			if err != nil {
-				// still failing
-				log.WithField("db", createDB).Error("create database failed: invalid instance description")
+				log.WithError(err).Error("create database failed durating creation")
 				os.Exit(-1)
 				return
 			}
+		}
+
+		log.Infof("the newly created database is: %#v", dsn)
+		fmt.Println(dsn)
+		return
+	}
 
-			meta = client.ResourceMeta{}
-			meta.Node = uint16(nodeCnt)
+	if forkDB != "" {
+		// fork database
+		meta, err := parseResourceMeta(forkMeta)
+		if err != nil {
+			log.WithField("db", forkDB).Error("fork database failed: invalid instance description")
+			os.Exit(-1)
+			return
 		}
 
-		dsn, err := client.Create(meta)
+		dsn, err := client.Fork(toDSN(forkDB), int32(forkHeight), meta)
 		if err != nil {
-			log.WithError(err).Error("create database failed")
+			log.WithField("db", forkDB).WithError(err).Error("fork database failed")
 			os.Exit(-1)
 			return
 		}
@@ -350,14 +427,14 @@ func main() {
 			defer cancel()
 			err = client.WaitDBCreation(ctx, dsn)
 			if err != nil {
-				log.WithError(err).Error("create database failed durating creation")
+				log.WithError(err).Error("fork database failed durating creation")
 				os.Exit(-1)
 				return
 			}
 		}
 
-		log.Infof("the newly created database is: %#v", dsn)
-		fmt.Printf(dsn)
+		log.Infof("the newly forked database is: %#v", dsn)
+		fmt.Println(dsn)
 		return
 	}
 
@@ -447,6 +524,60 @@ func main() {
 		return
 	}
 
+	if transferOwnership != "" || acceptOwnership != "" {
+		var txHash hash.Hash
+		if transferOwnership != "" {
+			var tran tranOwner
+			if err = json.Unmarshal([]byte(transferOwnership), &tran); err != nil {
+				log.WithError(err).Error("transfer ownership failed: invalid transfer description")
+				os.Exit(-1)
+				return
+			}
+			var dsn = toDSN(string(tran.TargetChain.DatabaseID()))
+			txHash, err = client.TransferDatabaseOwnership(dsn, tran.NewOwner, tran.Accept)
+		} else {
+			txHash, err = client.AcceptDatabaseOwnership(toDSN(acceptOwnership))
+		}
+		if err != nil {
+			log.WithError(err).Error("transfer ownership failed")
+			os.Exit(-1)
+			return
+		}
+
+		if waitTxConfirmation {
+			wait(txHash)
+		}
+
+		log.Info("succeed in sending transaction to CovenantSQL")
+		return
+	}
+
+	if depositDB != "" || withdrawDB != "" {
+		var (
+			txHash hash.Hash
+			db     = depositDB
+			op     = "deposit to database"
+		)
+		if depositDB != "" {
+			txHash, err = client.DepositToDatabase(toDSN(depositDB), fundAmount)
+		} else {
+			db, op = withdrawDB, "withdraw from database"
+			txHash, err = client.WithdrawFromDatabase(toDSN(withdrawDB), fundAmount)
+		}
+		if err != nil {
+			log.WithField("db", db).WithError(err).Errorf("%s failed", op)
+			os.Exit(-1)
+			return
+		}
+
+		if waitTxConfirmation {
+			wait(txHash)
+		}
+
+		log.Info("succeed in sending transaction to CovenantSQL")
+		return
+	}
+
 	var (
 		curUser   *user.User
 		available = drivers.Available()
@@ -490,6 +621,20 @@ func main() {
 	}
 }
 
+// parseResourceMeta parses the instance requirement json or simply a node count requirement.
+func parseResourceMeta(desc string) (meta client.ResourceMeta, err error) {
+	if err = json.Unmarshal([]byte(desc), &meta); err != nil {
+		// not a instance json, try if it is a number describing node count
+		var nodeCnt uint64
+		if nodeCnt, err = strconv.ParseUint(desc, 10, 16); err != nil {
+			return
+		}
+		meta = client.ResourceMeta{}
+		meta.Node = uint16(nodeCnt)
+	}
+	return
+}
+
 func wait(txHash hash.Hash) {
 	var ctx, cancel = context.WithTimeout(context.Background(), waitTxConfirmationMaxDuration)
 	defer cancel()
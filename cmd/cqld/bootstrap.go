@@ -163,6 +163,8 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		conf.GConf.BPTick,
 	)
 	chainConfig.Mode = mode
+	chainConfig.SnapshotInterval = conf.GConf.BP.SnapshotInterval
+	chainConfig.FastSync = conf.GConf.BP.FastSync
 	chain, err := bp.NewChain(chainConfig)
 	if err != nil {
 		log.WithError(err).Error("init chain failed")
@@ -82,6 +82,10 @@ type BPInfo struct {
 	ChainFileName string `yaml:"ChainFileName"`
 	// BPGenesis is the genesis block filed
 	BPGenesis BPGenesisInfo `yaml:"BPGenesisInfo,omitempty"`
+	// SnapshotInterval is the block count interval of main chain state snapshots, 0 to disable
+	SnapshotInterval uint32 `yaml:"SnapshotInterval,omitempty"`
+	// FastSync makes a new node bootstrap from a peer snapshot instead of replaying all blocks
+	FastSync bool `yaml:"FastSync,omitempty"`
 }
 
 // MinerDatabaseFixture config.
@@ -94,6 +98,25 @@ type MinerDatabaseFixture struct {
 	AutoGenerateGenesisBlock bool             `yaml:"AutoGenerateGenesisBlock,omitempty"`
 }
 
+// KayakWalInfo defines the kayak wal config of miner databases.
+type KayakWalInfo struct {
+	// UseFileWal replaces the leveldb wal with the segmented file wal.
+	UseFileWal   bool          `yaml:"UseFileWal,omitempty"`
+	SegmentSize  int64         `yaml:"SegmentSize,omitempty"`
+	SyncPolicy   string        `yaml:"SyncPolicy,omitempty"` // always, interval or none
+	SyncInterval time.Duration `yaml:"SyncInterval,omitempty"`
+	// Retention sets the count of latest logs kept on wal truncation, 0 to keep all logs.
+	Retention uint64 `yaml:"Retention,omitempty"`
+}
+
+// BlockArchiveInfo defines the sqlchain block archive config of miner databases.
+type BlockArchiveInfo struct {
+	// TTL sets the block periods after which blocks are archived, 0 to disable archiving.
+	TTL int32 `yaml:"TTL,omitempty"`
+	// DropSettled removes the archived blocks once their billing is confirmed.
+	DropSettled bool `yaml:"DropSettled,omitempty"`
+}
+
 // MinerInfo for miner config.
 type MinerInfo struct {
 	// node basic config.
@@ -101,6 +124,9 @@ type MinerInfo struct {
 	MaxReqTimeGap          time.Duration          `yaml:"MaxReqTimeGap,omitempty"`
 	ProvideServiceInterval time.Duration          `yaml:"ProvideServiceInterval,omitempty"`
 	TargetUsers            []proto.AccountAddress `yaml:"TargetUsers,omitempty"`
+	Labels                 []string               `yaml:"Labels,omitempty"` // key=value, e.g. operator=acme
+	KayakWal               *KayakWalInfo          `yaml:"KayakWal,omitempty"`
+	BlockArchive           *BlockArchiveInfo      `yaml:"BlockArchive,omitempty"`
 
 	// when test mode, fixture database config is used.
 	IsTestMode   bool                    `yaml:"IsTestMode,omitempty"`
@@ -148,6 +174,12 @@ type Config struct {
 	SQLChainTick       time.Duration `yaml:"SQLChainTick"`
 	SQLChainTTL        int32         `yaml:"SQLChainTTL"`
 	MinProviderDeposit uint64        `yaml:"MinProviderDeposit"`
+	// SQLChainBinLogInterval sets the interval of write logs advising between sqlchain blocks,
+	// 0 to disable.
+	SQLChainBinLogInterval time.Duration `yaml:"SQLChainBinLogInterval,omitempty"`
+	// SQLChainNoAckLimit sets the maximum unacknowledged responses of a client in a billing
+	// period, after which the client queries are rejected by the miner, 0 to disable.
+	SQLChainNoAckLimit int32 `yaml:"SQLChainNoAckLimit,omitempty"`
 }
 
 // GConf is the global config pointer.
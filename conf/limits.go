@@ -24,4 +24,6 @@ const (
 	MaxPendingTxsPerAccount = 1000
 	// MaxTransactionsPerBlock defines the limit of transactions per block.
 	MaxTransactionsPerBlock = 10000
+	// MaxPackedTxsPerAccount defines the limit of transactions of one account packed in a block.
+	MaxPackedTxsPerAccount = 100
 )
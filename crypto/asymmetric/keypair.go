@@ -102,6 +102,12 @@ func (k *PublicKey) IsEqual(public *PublicKey) bool {
 	return (*ec.PublicKey)(k).IsEqual((*ec.PublicKey)(public))
 }
 
+// DeepCopy implements the deepcopy.Interface, a public key is immutable and is shared by the
+// copies.
+func (k *PublicKey) DeepCopy() interface{} {
+	return k
+}
+
 // Serialize is a function that converts a public key
 // to uncompressed byte array
 //
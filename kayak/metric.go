@@ -0,0 +1,175 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"sync"
+	"time"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricNamespace = "covenantsql"
+	metricSubsystem = "kayak"
+
+	// leader apply phases
+	phaseLeaderPrepare    = "leader_prepare"
+	phaseFollowerPrepare  = "follower_prepare"
+	phaseLeaderRollback   = "leader_rollback"
+	phaseFollowerRollback = "follower_rollback"
+	phaseCommitEnqueue    = "commit_enqueue"
+	phaseCommitDequeue    = "commit_dequeue"
+	phaseLeaderCommit     = "leader_commit"
+	phaseFollowerCommit   = "follower_commit"
+	phaseDBCommit         = "db_commit"
+	phaseTotal            = "total"
+)
+
+var (
+	applyPhases = []string{
+		phaseLeaderPrepare, phaseFollowerPrepare, phaseLeaderRollback, phaseFollowerRollback,
+		phaseCommitEnqueue, phaseCommitDequeue, phaseLeaderCommit, phaseFollowerCommit,
+		phaseDBCommit, phaseTotal,
+	}
+
+	applyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricNamespace,
+		Subsystem: metricSubsystem,
+		Name:      "apply_duration_seconds",
+		Help:      "Duration of kayak leader apply phases.",
+		// 100us to about 3.3s
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"db", "phase"})
+
+	followerLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, metricSubsystem, "follower_lag"),
+		"Leader next log index minus the last commit index acknowledged by follower.",
+		[]string{"db", "follower"}, nil,
+	)
+	pendingPreparesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, metricSubsystem, "pending_prepares"),
+		"Prepare logs waiting for commit or rollback.",
+		[]string{"db"}, nil,
+	)
+	walSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, metricSubsystem, "wal_size_bytes"),
+		"Storage size of kayak wal.",
+		[]string{"db"}, nil,
+	)
+
+	// runtimes defines the started runtimes to collect gauges from, instance id -> *Runtime.
+	runtimes sync.Map
+)
+
+func init() {
+	// registered once for all runtimes, metrics of each runtime are labeled by database
+	metric.RegisterServiceCollector(applyDuration, &runtimeCollector{})
+}
+
+// runtimeCollector collects gauges of the started runtimes on scraping.
+type runtimeCollector struct{}
+
+// Describe implements prometheus.Collector.Describe.
+func (c *runtimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- followerLagDesc
+	ch <- pendingPreparesDesc
+	ch <- walSizeDesc
+}
+
+// Collect implements prometheus.Collector.Collect.
+func (c *runtimeCollector) Collect(ch chan<- prometheus.Metric) {
+	runtimes.Range(func(_, v interface{}) bool {
+		v.(*Runtime).collectMetrics(ch)
+		return true
+	})
+}
+
+func (r *Runtime) registerMetrics() {
+	runtimes.Store(r.instanceID, r)
+}
+
+func (r *Runtime) unregisterMetrics() {
+	if v, ok := runtimes.Load(r.instanceID); ok && v.(*Runtime) == r {
+		runtimes.Delete(r.instanceID)
+	}
+	for _, phase := range applyPhases {
+		applyDuration.DeleteLabelValues(r.instanceID, phase)
+	}
+}
+
+func (r *Runtime) collectMetrics(ch chan<- prometheus.Metric) {
+	r.pendingPreparesLock.RLock()
+	pendingPrepares := len(r.pendingPrepares)
+	r.pendingPreparesLock.RUnlock()
+	ch <- prometheus.MustNewConstMetric(
+		pendingPreparesDesc, prometheus.GaugeValue, float64(pendingPrepares), r.instanceID)
+
+	if sizer, ok := r.wal.(kt.WalSizer); ok {
+		if size, err := sizer.Size(); err != nil {
+			log.WithField("db", r.instanceID).WithError(err).Debug("get kayak wal size failed")
+		} else {
+			ch <- prometheus.MustNewConstMetric(
+				walSizeDesc, prometheus.GaugeValue, float64(size), r.instanceID)
+		}
+	}
+
+	r.peersLock.RLock()
+	isLeader := r.role == proto.Leader
+	r.peersLock.RUnlock()
+	if !isLeader {
+		return
+	}
+
+	r.nextIndexLock.Lock()
+	nextIndex := r.nextIndex
+	r.nextIndexLock.Unlock()
+
+	r.followerCommits.Range(func(k, v interface{}) bool {
+		var lag float64
+		if commitIndex := v.(uint64); nextIndex > commitIndex {
+			lag = float64(nextIndex - commitIndex)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			followerLagDesc, prometheus.GaugeValue, lag, r.instanceID, string(k.(proto.NodeID)))
+		return true
+	})
+}
+
+// trackFollowerCommit records the commit index acknowledged by follower for lag calculation.
+func (r *Runtime) trackFollowerCommit(node proto.NodeID, req interface{}, err error) {
+	if err != nil {
+		return
+	}
+	rpcReq, ok := req.(*kt.RPCRequest)
+	if !ok || rpcReq.Log == nil || rpcReq.Log.Type != kt.LogCommit {
+		return
+	}
+	// commits may be acknowledged out of order
+	if v, ok := r.followerCommits.Load(node); ok && v.(uint64) >= rpcReq.Log.Index {
+		return
+	}
+	r.followerCommits.Store(node, rpcReq.Log.Index)
+}
+
+func observeApplyPhase(db string, phase string, d time.Duration) {
+	applyDuration.WithLabelValues(db, phase).Observe(d.Seconds())
+}
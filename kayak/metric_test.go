@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type echoHandler struct{}
+
+func (h *echoHandler) EncodePayload(req interface{}) (data []byte, err error) {
+	return req.([]byte), nil
+}
+
+func (h *echoHandler) DecodePayload(data []byte) (req interface{}, err error) {
+	return data, nil
+}
+
+func (h *echoHandler) Check(req interface{}) error {
+	return nil
+}
+
+func (h *echoHandler) Commit(req interface{}) (result interface{}, err error) {
+	return req, nil
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	Convey("kayak runtime metrics", t, func() {
+		walDir, err := ioutil.TempDir("", "kayak_metric")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(walDir)
+
+		w, err := kl.NewLevelDBWal(walDir)
+		So(err, ShouldBeNil)
+		defer w.Close()
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		newRuntime := func(w kt.Wal, db string) (rt *Runtime, err error) {
+			return NewRuntime(&kt.RuntimeConfig{
+				Handler:          &echoHandler{},
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              w,
+				NodeID:           node1,
+				InstanceID:       db,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+			})
+		}
+		rt, err := newRuntime(w, "metric_db")
+		So(err, ShouldBeNil)
+		So(rt.Start(), ShouldBeNil)
+
+		// another runtime in the same process
+		w2 := kl.NewMemWal()
+		defer w2.Close()
+		rt2, err := newRuntime(w2, "metric_db2")
+		So(err, ShouldBeNil)
+		So(rt2.Start(), ShouldBeNil)
+		defer rt2.Shutdown()
+		_, _, err = rt2.Apply(context.Background(), []byte("happy"))
+		So(err, ShouldBeNil)
+
+		for i := 0; i != 5; i++ {
+			_, _, err = rt.Apply(context.Background(), []byte("happy"))
+			So(err, ShouldBeNil)
+		}
+
+		// follower acknowledged the first commit log
+		rt.trackFollowerCommit(node2, &kt.RPCRequest{
+			Log: &kt.Log{LogHeader: kt.LogHeader{Index: 1, Type: kt.LogCommit}},
+		}, nil)
+		rt.trackFollowerCommit(node2, &kt.RPCRequest{
+			Log: &kt.Log{LogHeader: kt.LogHeader{Index: 0, Type: kt.LogCommit}},
+		}, nil)
+
+		// kayak metrics are exposed by the node metric registry
+		reg := metric.StartMetricCollector()
+		So(reg, ShouldNotBeNil)
+
+		gather := func() map[string]*dto.MetricFamily {
+			mfs, err := reg.Gather()
+			So(err, ShouldBeNil)
+			m := make(map[string]*dto.MetricFamily)
+			for _, mf := range mfs {
+				m[mf.GetName()] = mf
+			}
+			return m
+		}
+
+		// metric of database db, and of apply phase if phase is not empty
+		find := func(mf *dto.MetricFamily, db string, phase string) (found *dto.Metric) {
+			for _, m := range mf.GetMetric() {
+				var dbMatched, phaseMatched = false, phase == ""
+				for _, l := range m.GetLabel() {
+					switch l.GetName() {
+					case "db":
+						dbMatched = l.GetValue() == db
+					case "phase":
+						phaseMatched = phaseMatched || l.GetValue() == phase
+					}
+				}
+				if dbMatched && phaseMatched {
+					found = m
+				}
+			}
+			return
+		}
+
+		mfs := gather()
+		So(mfs, ShouldContainKey, "covenantsql_kayak_apply_duration_seconds")
+		So(mfs, ShouldContainKey, "covenantsql_kayak_wal_size_bytes")
+		So(mfs, ShouldContainKey, "covenantsql_kayak_pending_prepares")
+		So(find(mfs["covenantsql_kayak_pending_prepares"], "metric_db", ""), ShouldNotBeNil)
+		So(find(mfs["covenantsql_kayak_pending_prepares"], "metric_db", "").GetGauge().GetValue(),
+			ShouldEqual, 0)
+		So(mfs, ShouldContainKey, "covenantsql_kayak_follower_lag")
+		// 10 logs written, next index is 10
+		So(find(mfs["covenantsql_kayak_follower_lag"], "metric_db", "").GetGauge().GetValue(),
+			ShouldEqual, 9)
+
+		applyDurations := mfs["covenantsql_kayak_apply_duration_seconds"]
+		So(find(applyDurations, "metric_db", phaseTotal).GetHistogram().GetSampleCount(), ShouldEqual, 5)
+		So(find(applyDurations, "metric_db2", phaseTotal).GetHistogram().GetSampleCount(), ShouldEqual, 1)
+
+		So(rt.Shutdown(), ShouldBeNil)
+		mfs = gather()
+		So(find(mfs["covenantsql_kayak_apply_duration_seconds"], "metric_db", phaseTotal), ShouldBeNil)
+		So(find(mfs["covenantsql_kayak_pending_prepares"], "metric_db", ""), ShouldBeNil)
+		So(find(mfs["covenantsql_kayak_pending_prepares"], "metric_db2", ""), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+// LastCommit returns the last commit log index of current node.
+func (r *Runtime) LastCommit() uint64 {
+	return atomic.LoadUint64(&r.lastCommit)
+}
+
+// LeaderReadIndex returns the last commit log index as read index, only available on leader.
+func (r *Runtime) LeaderReadIndex() (index uint64, err error) {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	if r.role != proto.Leader {
+		err = kt.ErrNotLeader
+		return
+	}
+
+	index = atomic.LoadUint64(&r.lastCommit)
+	return
+}
+
+// ReadIndex waits until the local state contains all the commits of leader at read time.
+// A read index fetched from leader within maxStaleness is reused, zero maxStaleness always
+// asks the leader for a fresh one.
+func (r *Runtime) ReadIndex(ctx context.Context, maxStaleness time.Duration) (index uint64, err error) {
+	r.peersLock.RLock()
+	var (
+		isLeader = r.role == proto.Leader
+		leader   = r.peers.Leader
+	)
+	r.peersLock.RUnlock()
+
+	if isLeader {
+		// leader marks last commit after the underlying handler commit finished
+		index = atomic.LoadUint64(&r.lastCommit)
+		return
+	}
+
+	if index, err = r.fetchReadIndex(leader, maxStaleness); err != nil {
+		return
+	}
+
+	err = r.waitCommit(ctx, index)
+	return
+}
+
+func (r *Runtime) fetchReadIndex(leader proto.NodeID, maxStaleness time.Duration) (index uint64, err error) {
+	if r.readIndexMethod == "" {
+		err = kt.ErrReadIndexNotSupported
+		return
+	}
+
+	if maxStaleness > 0 {
+		r.readIndexLock.Lock()
+		cachedIndex, cachedTime := r.readIndex, r.readIndexTime
+		r.readIndexLock.Unlock()
+
+		if !cachedTime.IsZero() && time.Since(cachedTime) <= maxStaleness {
+			index = cachedIndex
+			return
+		}
+	}
+
+	var (
+		// leader index is at least as new as the request send time
+		tmStart = time.Now()
+		req     = &kt.ReadIndexRequest{Instance: r.instanceID}
+		resp    = &kt.ReadIndexResponse{}
+	)
+
+	if err = r.getCaller(leader).Call(r.readIndexMethod, req, resp); err != nil {
+		err = errors.Wrapf(err, "fetch read index from leader %v failed", leader)
+		return
+	}
+
+	index = resp.Index
+
+	r.readIndexLock.Lock()
+	defer r.readIndexLock.Unlock()
+	if tmStart.After(r.readIndexTime) {
+		r.readIndex, r.readIndexTime = index, tmStart
+	}
+
+	return
+}
+
+func (r *Runtime) waitCommit(ctx context.Context, index uint64) (err error) {
+	for {
+		// fetch notify channel before checking to avoid missing commits in between
+		r.commitNotifyLock.Lock()
+		notifyCh := r.commitNotifyCh
+		r.commitNotifyLock.Unlock()
+
+		if atomic.LoadUint64(&r.lastCommit) >= index {
+			return
+		}
+
+		select {
+		case <-notifyCh:
+		case <-ctx.Done():
+			err = errors.Wrapf(ctx.Err(), "wait for commit index %v", index)
+			return
+		case <-r.stopCh:
+			err = errors.Wrapf(kt.ErrStopped, "wait for commit index %v", index)
+			return
+		}
+	}
+}
+
+func (r *Runtime) notifyCommit() {
+	r.commitNotifyLock.Lock()
+	defer r.commitNotifyLock.Unlock()
+
+	close(r.commitNotifyCh)
+	r.commitNotifyCh = make(chan struct{})
+}
@@ -48,6 +48,9 @@ type Runtime struct {
 	nextIndex     uint64
 	// lastCommit, last commit log index
 	lastCommit uint64
+	// commitNotifyCh is closed and renewed on every commit to wake up read index waiters.
+	commitNotifyCh   chan struct{}
+	commitNotifyLock sync.Mutex
 	// pendingPrepares, prepares needs to be committed/rollback
 	pendingPrepares     map[uint64]bool
 	pendingPreparesLock sync.RWMutex
@@ -84,8 +87,16 @@ type Runtime struct {
 	serviceName string
 	// rpc method for coordination requests.
 	rpcMethod string
+	// rpc method for read index requests.
+	readIndexMethod string
+	// readIndex caches the latest read index fetched from leader for bounded staleness reads.
+	readIndex     uint64
+	readIndexTime time.Time
+	readIndexLock sync.Mutex
 	// tracks the outgoing rpc requests.
 	rpcTrackCh chan *rpcTracker
+	// followerCommits tracks the commit index acknowledged by followers, used by lag metrics.
+	followerCommits sync.Map // map[proto.NodeID]uint64
 
 	//// Parameters
 	// prepare threshold defines the minimum node count requirement for prepare operation.
@@ -96,6 +107,10 @@ type Runtime struct {
 	prepareTimeout time.Duration
 	// commit timeout defines the max allowed time for commit operation.
 	commitTimeout time.Duration
+	// wal retention defines the count of latest logs retained on wal truncation, 0 to keep all.
+	walRetention uint64
+	// wal checkpoint is the index which the wal is truncated to, only accessed by commit cycle.
+	walCheckpoint uint64
 	// channel for awaiting commits.
 	commitCh chan *commitReq
 
@@ -175,6 +190,7 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 	rt = &Runtime{
 		// indexes
 		pendingPrepares: make(map[uint64]bool, commitWindow*2),
+		commitNotifyCh:  make(chan struct{}),
 
 		// handler and logs
 		sh:         cfg.Handler,
@@ -199,12 +215,17 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		prepareTimeout:   cfg.PrepareTimeout,
 		commitThreshold:  cfg.CommitThreshold,
 		commitTimeout:    cfg.CommitTimeout,
+		walRetention:     cfg.WalRetention,
 		commitCh:         make(chan *commitReq, commitWindow),
 
 		// stop coordinator
 		stopCh: make(chan struct{}),
 	}
 
+	if cfg.ReadIndexMethodName != "" {
+		rt.readIndexMethod = fmt.Sprintf("%v.%v", cfg.ServiceName, cfg.ReadIndexMethodName)
+	}
+
 	// read from pool to rebuild uncommitted log map
 	if err = rt.readLogs(); err != nil {
 		return
@@ -221,6 +242,8 @@ func (r *Runtime) Start() (err error) {
 
 	// start commit cycle
 	r.goFunc(r.commitCycle)
+	// export runtime metrics
+	r.registerMetrics()
 	// start rpc tracker collector
 	// TODO():
 
@@ -233,6 +256,8 @@ func (r *Runtime) Shutdown() (err error) {
 		return
 	}
 
+	r.unregisterMetrics()
+
 	select {
 	case <-r.stopCh:
 	default:
@@ -257,36 +282,57 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 			"r": logIndex,
 		}
 		if !tmLeaderPrepare.Before(tmStart) {
-			fields["lp"] = tmLeaderPrepare.Sub(tmStart).Nanoseconds()
+			d := tmLeaderPrepare.Sub(tmStart)
+			fields["lp"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseLeaderPrepare, d)
 		}
 		if !tmFollowerPrepare.Before(tmLeaderPrepare) {
-			fields["fp"] = tmFollowerPrepare.Sub(tmLeaderPrepare).Nanoseconds()
+			d := tmFollowerPrepare.Sub(tmLeaderPrepare)
+			fields["fp"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseFollowerPrepare, d)
 		}
 		if !tmLeaderRollback.Before(tmFollowerPrepare) {
-			fields["lr"] = tmLeaderRollback.Sub(tmFollowerPrepare).Nanoseconds()
+			d := tmLeaderRollback.Sub(tmFollowerPrepare)
+			fields["lr"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseLeaderRollback, d)
 		}
 		if !tmRollback.Before(tmLeaderRollback) {
-			fields["fr"] = tmRollback.Sub(tmLeaderRollback).Nanoseconds()
+			d := tmRollback.Sub(tmLeaderRollback)
+			fields["fr"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseFollowerRollback, d)
 		}
 		if !tmCommitEnqueue.Before(tmFollowerPrepare) {
-			fields["eq"] = tmCommitEnqueue.Sub(tmFollowerPrepare).Nanoseconds()
+			d := tmCommitEnqueue.Sub(tmFollowerPrepare)
+			fields["eq"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseCommitEnqueue, d)
 		}
 		if !tmCommitDequeue.Before(tmCommitEnqueue) {
-			fields["dq"] = tmCommitDequeue.Sub(tmCommitEnqueue).Nanoseconds()
+			d := tmCommitDequeue.Sub(tmCommitEnqueue)
+			fields["dq"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseCommitDequeue, d)
 		}
 		if !tmLeaderCommit.Before(tmCommitDequeue) {
-			fields["lc"] = tmLeaderCommit.Sub(tmCommitDequeue).Nanoseconds()
+			d := tmLeaderCommit.Sub(tmCommitDequeue)
+			fields["lc"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseLeaderCommit, d)
 		}
 		if !tmCommit.Before(tmLeaderCommit) {
-			fields["fc"] = tmCommit.Sub(tmLeaderCommit).Nanoseconds()
+			d := tmCommit.Sub(tmLeaderCommit)
+			fields["fc"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseFollowerCommit, d)
 		}
 		if dbCost > 0 {
 			fields["dc"] = dbCost.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseDBCommit, dbCost)
 		}
 		if !tmCommit.Before(tmStart) {
-			fields["t"] = tmCommit.Sub(tmStart).Nanoseconds()
+			d := tmCommit.Sub(tmStart)
+			fields["t"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseTotal, d)
 		} else if !tmRollback.Before(tmStart) {
-			fields["t"] = tmRollback.Sub(tmStart).Nanoseconds()
+			d := tmRollback.Sub(tmStart)
+			fields["t"] = d.Nanoseconds()
+			observeApplyPhase(r.instanceID, phaseTotal, d)
 		}
 		log.WithFields(fields).WithError(err).Debug("kayak leader apply")
 	}()
@@ -551,7 +597,7 @@ func (r *Runtime) followerRollback(l *kt.Log) (err error) {
 		err = errors.Wrap(err, "write follower rollback log failed")
 	}
 
-	r.markPrepareFinished(l.Index)
+	r.markPrepareFinished(prepareLog.Index)
 
 	return
 }
@@ -608,7 +654,7 @@ func (r *Runtime) followerCommit(l *kt.Log) (err error) {
 	}
 	tmCommitDequeue = time.Now()
 
-	r.markPrepareFinished(l.Index)
+	r.markPrepareFinished(prepareLog.Index)
 	tmMark = time.Now()
 
 	return
@@ -754,10 +800,13 @@ func (r *Runtime) leaderDoCommit(req *commitReq) (dbCost time.Duration, tracker
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, l.Index)
+	r.notifyCommit()
 
 	// send commit
 	tracker = r.rpc(l, r.minCommitFollowers)
 
+	r.truncateWal()
+
 	// TODO(): text log for rpc errors
 
 	// TODO(): mark uncommitted nodes and remove from peers
@@ -793,15 +842,76 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, req.log.Index)
+	r.notifyCommit()
 
 	req.result <- &commitResult{err: err, dbCost: time.Since(tmStart)}
 
+	r.truncateWal()
+
 	return
 }
 
+// truncateWal removes the resolved logs from wal except the latest walRetention ones. The wal is
+// truncated once every walRetention commits. On leader, the logs not acknowledged by any of the
+// followers are also kept, so that the lagging followers can still be caught up from leader wal.
+func (r *Runtime) truncateWal() {
+	truncater, ok := r.wal.(kt.WalTruncater)
+	if !ok || r.walRetention == 0 {
+		return
+	}
+
+	lastCommit := atomic.LoadUint64(&r.lastCommit)
+	if lastCommit < r.walCheckpoint+2*r.walRetention {
+		return
+	}
+
+	// logs below checkpoint must be all committed or rolled back
+	checkpoint := lastCommit - r.walRetention
+	r.pendingPreparesLock.RLock()
+	for i := range r.pendingPrepares {
+		if i < checkpoint {
+			checkpoint = i
+		}
+	}
+	r.pendingPreparesLock.RUnlock()
+	if r.role == proto.Leader {
+		for _, v := range r.followers {
+			var commit uint64
+			if c, ok := r.followerCommits.Load(v); ok {
+				commit = c.(uint64)
+			}
+			if commit < checkpoint {
+				checkpoint = commit
+			}
+		}
+	}
+	if checkpoint <= r.walCheckpoint {
+		return
+	}
+
+	if err := truncater.Truncate(checkpoint); err != nil {
+		log.WithFields(log.Fields{
+			"instance":   r.instanceID,
+			"checkpoint": checkpoint,
+		}).WithError(err).Warning("truncate kayak wal failed")
+		return
+	}
+	r.walCheckpoint = checkpoint
+}
+
 func (r *Runtime) getPrepareLog(l *kt.Log) (lastCommitIndex uint64, pl *kt.Log, err error) {
 	var prepareIndex uint64
 
+	if lastCommitIndex, prepareIndex, err = r.decodeCommitData(l); err != nil {
+		return
+	}
+
+	pl, err = r.wal.Get(prepareIndex)
+
+	return
+}
+
+func (r *Runtime) decodeCommitData(l *kt.Log) (lastCommitIndex uint64, prepareIndex uint64, err error) {
 	// decode prepare index
 	if prepareIndex, err = r.bytesToUint64(l.Data); err != nil {
 		err = errors.Wrap(err, "log does not contain valid prepare index")
@@ -813,11 +923,16 @@ func (r *Runtime) getPrepareLog(l *kt.Log) (lastCommitIndex uint64, pl *kt.Log,
 		lastCommitIndex, _ = r.bytesToUint64(l.Data[8:])
 	}
 
-	pl, err = r.wal.Get(prepareIndex)
-
 	return
 }
 
+// isTruncatedPrepare reports whether the prepare log resolved by commit/rollback log l is below
+// the wal checkpoint, which is already truncated from wal.
+func (r *Runtime) isTruncatedPrepare(l *kt.Log, checkpoint uint64) bool {
+	_, prepareIndex, err := r.decodeCommitData(l)
+	return err == nil && prepareIndex < checkpoint
+}
+
 func (r *Runtime) newLog(logType kt.LogType, data []byte) (l *kt.Log, err error) {
 	// allocate index
 	r.nextIndexLock.Lock()
@@ -843,7 +958,10 @@ func (r *Runtime) newLog(logType kt.LogType, data []byte) (l *kt.Log, err error)
 
 func (r *Runtime) readLogs() (err error) {
 	// load logs, only called during init
-	var l *kt.Log
+	var (
+		l          *kt.Log
+		checkpoint uint64
+	)
 
 	for {
 		if l, err = r.wal.Read(); err != nil && err != io.EOF {
@@ -854,7 +972,27 @@ func (r *Runtime) readLogs() (err error) {
 			break
 		}
 
+		if l.Type != kt.LogCheckpoint && l.Index < checkpoint {
+			// logs below checkpoint are already resolved
+			r.updateNextIndex(l)
+			continue
+		}
+
 		switch l.Type {
+		case kt.LogCheckpoint:
+			// virtual checkpoint log from truncated wal, contains last commit index before checkpoint
+			var lastCommit uint64
+			if lastCommit, err = r.bytesToUint64(l.Data); err != nil {
+				err = errors.Wrap(err, "checkpoint log does not contain valid commit index")
+				return
+			}
+			checkpoint = l.Index
+			r.lastCommit = lastCommit
+			for i := range r.pendingPrepares {
+				if i < checkpoint {
+					delete(r.pendingPrepares, i)
+				}
+			}
 		case kt.LogPrepare:
 			// record in pending prepares
 			r.pendingPrepares[l.Index] = true
@@ -862,6 +1000,19 @@ func (r *Runtime) readLogs() (err error) {
 			// record last commit
 			var lastCommit uint64
 			var prepareLog *kt.Log
+			if r.isTruncatedPrepare(l, checkpoint) {
+				// prepare log is truncated and resolved by this commit
+				if lastCommit, _, err = r.decodeCommitData(l); err != nil {
+					return
+				}
+				if lastCommit != r.lastCommit {
+					err = errors.Wrapf(kt.ErrInvalidLog,
+						"last commit record in wal mismatched (expected: %v, actual: %v)", r.lastCommit, lastCommit)
+					return
+				}
+				r.lastCommit = l.Index
+				break
+			}
 			if lastCommit, prepareLog, err = r.getPrepareLog(l); err != nil {
 				err = errors.Wrap(err, "previous prepare does not exists, node need full recovery")
 				return
@@ -880,6 +1031,10 @@ func (r *Runtime) readLogs() (err error) {
 			delete(r.pendingPrepares, prepareLog.Index)
 		case kt.LogRollback:
 			var prepareLog *kt.Log
+			if r.isTruncatedPrepare(l, checkpoint) {
+				// prepare log is truncated and resolved by this rollback
+				break
+			}
 			if _, prepareLog, err = r.getPrepareLog(l); err != nil {
 				err = errors.Wrap(err, "previous prepare does not exists, node need full recovery")
 				return
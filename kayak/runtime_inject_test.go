@@ -16,9 +16,18 @@
 
 package kayak
 
-import "github.com/CovenantSQL/CovenantSQL/proto"
+import (
+	"context"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
 
 // SetCaller injects caller for test purpose.
 func (r *Runtime) SetCaller(id proto.NodeID, c Caller) {
 	r.callerMap.Store(id, c)
 }
+
+// WaitCommit exposes commit waiting for test purpose.
+func (r *Runtime) WaitCommit(ctx context.Context, index uint64) error {
+	return r.waitCommit(ctx, index)
+}
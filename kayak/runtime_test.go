@@ -22,10 +22,12 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -167,6 +169,11 @@ func (s *fakeService) Call(req *kt.RPCRequest, resp *interface{}) (err error) {
 	return s.rt.FollowerApply(req.Log)
 }
 
+func (s *fakeService) ReadIndex(req *kt.ReadIndexRequest, resp *kt.ReadIndexResponse) (err error) {
+	resp.Index, err = s.rt.LeaderReadIndex()
+	return
+}
+
 func (s *fakeService) serveConn(c net.Conn) {
 	s.s.ServeCodec(utils.GetMsgPackServerCodec(c))
 }
@@ -193,6 +200,16 @@ func (c *fakeCaller) Call(method string, req interface{}, resp interface{}) (err
 	return client.Call(method, req, resp)
 }
 
+// laggingCaller accepts the prepare logs but never acknowledges any commit log.
+type laggingCaller struct{}
+
+func (c *laggingCaller) Call(method string, req interface{}, resp interface{}) error {
+	if r, ok := req.(*kt.RPCRequest); ok && r.Log != nil && r.Log.Type == kt.LogCommit {
+		return errors.New("lagging")
+	}
+	return nil
+}
+
 func TestRuntime(t *testing.T) {
 	Convey("runtime test", t, func(c C) {
 		lvl := log.GetLevel()
@@ -232,16 +249,17 @@ func TestRuntime(t *testing.T) {
 		wal1 := kl.NewMemWal()
 		defer wal1.Close()
 		cfg1 := &kt.RuntimeConfig{
-			Handler:          db1,
-			PrepareThreshold: 1.0,
-			CommitThreshold:  1.0,
-			PrepareTimeout:   time.Second,
-			CommitTimeout:    10 * time.Second,
-			Peers:            peers,
-			Wal:              wal1,
-			NodeID:           node1,
-			ServiceName:      "Test",
-			MethodName:       "Call",
+			Handler:             db1,
+			PrepareThreshold:    1.0,
+			CommitThreshold:     1.0,
+			PrepareTimeout:      time.Second,
+			CommitTimeout:       10 * time.Second,
+			Peers:               peers,
+			Wal:                 wal1,
+			NodeID:              node1,
+			ServiceName:         "Test",
+			MethodName:          "Call",
+			ReadIndexMethodName: "ReadIndex",
 		}
 		rt1, err := kayak.NewRuntime(cfg1)
 		So(err, ShouldBeNil)
@@ -249,16 +267,17 @@ func TestRuntime(t *testing.T) {
 		wal2 := kl.NewMemWal()
 		defer wal2.Close()
 		cfg2 := &kt.RuntimeConfig{
-			Handler:          db2,
-			PrepareThreshold: 1.0,
-			CommitThreshold:  1.0,
-			PrepareTimeout:   time.Second,
-			CommitTimeout:    10 * time.Second,
-			Peers:            peers,
-			Wal:              wal2,
-			NodeID:           node2,
-			ServiceName:      "Test",
-			MethodName:       "Call",
+			Handler:             db2,
+			PrepareThreshold:    1.0,
+			CommitThreshold:     1.0,
+			PrepareTimeout:      time.Second,
+			CommitTimeout:       10 * time.Second,
+			Peers:               peers,
+			Wal:                 wal2,
+			NodeID:              node2,
+			ServiceName:         "Test",
+			MethodName:          "Call",
+			ReadIndexMethodName: "ReadIndex",
 		}
 		rt2, err := kayak.NewRuntime(cfg2)
 		So(err, ShouldBeNil)
@@ -376,6 +395,35 @@ func TestRuntime(t *testing.T) {
 		So(d2, ShouldHaveLength, 1)
 		So(d2[0], ShouldHaveLength, 1)
 		So(fmt.Sprint(d2[0][0]), ShouldResemble, fmt.Sprint(total))
+
+		// read index
+		var index uint64
+		index, err = rt1.ReadIndex(context.Background(), 0)
+		So(err, ShouldBeNil)
+		So(index, ShouldEqual, rt1.LastCommit())
+		index, err = rt2.ReadIndex(context.Background(), 0)
+		So(err, ShouldBeNil)
+		So(index, ShouldEqual, rt1.LastCommit())
+		So(rt2.LastCommit(), ShouldBeGreaterThanOrEqualTo, index)
+		_, err = rt2.LeaderReadIndex()
+		So(err, ShouldEqual, kt.ErrNotLeader)
+
+		// bounded staleness reuses the cached read index
+		_, _, err = rt1.Apply(context.Background(), q)
+		So(err, ShouldBeNil)
+		var staleIndex uint64
+		staleIndex, err = rt2.ReadIndex(context.Background(), time.Minute)
+		So(err, ShouldBeNil)
+		So(staleIndex, ShouldEqual, index)
+		index, err = rt2.ReadIndex(context.Background(), 0)
+		So(err, ShouldBeNil)
+		So(index, ShouldEqual, rt1.LastCommit())
+		So(index, ShouldBeGreaterThan, staleIndex)
+
+		// wait for a future commit
+		timeoutCtx, timeoutCtxFunc := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer timeoutCtxFunc()
+		So(rt2.WaitCommit(timeoutCtx, rt2.LastCommit()+100), ShouldNotBeNil)
 	})
 	Convey("trivial cases", t, func() {
 		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
@@ -497,6 +545,244 @@ func TestRuntime(t *testing.T) {
 		So(rt.Shutdown(), ShouldBeNil)
 		So(func() { rt.Shutdown() }, ShouldNotPanic)
 	})
+	Convey("test wal truncation", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		dir, err := ioutil.TempDir("", "kayak_truncate")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader: node1,
+				Servers: []proto.NodeID{
+					node1,
+					node2,
+				},
+			},
+		}
+
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		walCfg := &kl.FileWalConfig{SegmentSize: 256, SyncPolicy: kl.SyncInterval}
+		newRuntime := func(node proto.NodeID, idx int) (
+			rt *kayak.Runtime, w *kl.FileWal, db *sqliteStorage, err error) {
+			if db, err = newSQLiteStorage(filepath.Join(dir, fmt.Sprintf("db%d", idx))); err != nil {
+				return
+			}
+			if w, err = kl.NewFileWal(filepath.Join(dir, fmt.Sprintf("wal%d", idx)), walCfg); err != nil {
+				return
+			}
+			rt, err = kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:             db,
+				PrepareThreshold:    1.0,
+				CommitThreshold:     1.0,
+				PrepareTimeout:      time.Second,
+				CommitTimeout:       10 * time.Second,
+				Peers:               peers,
+				Wal:                 w,
+				WalRetention:        10,
+				NodeID:              node,
+				ServiceName:         "Test",
+				MethodName:          "Call",
+				ReadIndexMethodName: "ReadIndex",
+			})
+			return
+		}
+
+		rt1, wal1, db1, err := newRuntime(node1, 1)
+		So(err, ShouldBeNil)
+		defer db1.Close()
+		rt2, wal2, db2, err := newRuntime(node2, 2)
+		So(err, ShouldBeNil)
+		defer db2.Close()
+
+		m := newFakeMux()
+		m.register(node1, newFakeService(rt1))
+		m.register(node2, newFakeService(rt2))
+		rt1.SetCaller(node2, newFakeCaller(m, node2))
+		rt2.SetCaller(node1, newFakeCaller(m, node1))
+		So(rt1.Start(), ShouldBeNil)
+		So(rt2.Start(), ShouldBeNil)
+
+		_, _, err = rt1.Apply(context.Background(), &queryStructure{
+			Queries: []storage.Query{
+				{Pattern: "CREATE TABLE IF NOT EXISTS test (t1 text)"},
+			},
+		})
+		So(err, ShouldBeNil)
+		for i := 0; i != 50; i++ {
+			_, _, err = rt1.Apply(context.Background(), &queryStructure{
+				Queries: []storage.Query{
+					{
+						Pattern: "INSERT INTO test (t1) VALUES(?)",
+						Args:    []sql.NamedArg{sql.Named("", RandStringRunes(10))},
+					},
+				},
+			})
+			So(err, ShouldBeNil)
+		}
+
+		// wait for the follower to apply the last commit
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		So(rt2.WaitCommit(ctx, rt1.LastCommit()), ShouldBeNil)
+
+		// resolved logs are removed from both leader and follower, the latest ones are kept
+		for _, w := range []*kl.FileWal{wal1, wal2} {
+			_, err = w.Get(0)
+			So(err, ShouldEqual, kl.ErrNotExists)
+			_, err = w.Get(rt1.LastCommit())
+			So(err, ShouldBeNil)
+		}
+
+		So(rt1.Shutdown(), ShouldBeNil)
+		So(rt2.Shutdown(), ShouldBeNil)
+		wal1.Close()
+		wal2.Close()
+
+		// runtime recovers from the truncated wal
+		w, err := kl.NewFileWal(filepath.Join(dir, "wal1"), walCfg)
+		So(err, ShouldBeNil)
+		defer w.Close()
+		singlePeers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1},
+			},
+		}
+		err = singlePeers.Sign(privKey)
+		So(err, ShouldBeNil)
+		rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+			Handler:          db1,
+			PrepareThreshold: 1.0,
+			CommitThreshold:  1.0,
+			PrepareTimeout:   time.Second,
+			CommitTimeout:    10 * time.Second,
+			Peers:            singlePeers,
+			Wal:              w,
+			WalRetention:     10,
+			NodeID:           node1,
+			ServiceName:      "Test",
+			MethodName:       "Call",
+		})
+		So(err, ShouldBeNil)
+		So(rt.Start(), ShouldBeNil)
+		defer rt.Shutdown()
+		lastCommit := rt.LastCommit()
+		So(lastCommit, ShouldBeGreaterThan, 0)
+		_, _, err = rt.Apply(context.Background(), &queryStructure{
+			Queries: []storage.Query{
+				{Pattern: "INSERT INTO test (t1) VALUES('recovered')"},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(rt.LastCommit(), ShouldBeGreaterThan, lastCommit)
+	})
+
+	Convey("test wal truncation with a lagging follower", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		dir, err := ioutil.TempDir("", "kayak_truncate_lag")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		node3 := proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2, node3},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		walCfg := &kl.FileWalConfig{SegmentSize: 256, SyncPolicy: kl.SyncInterval}
+		newRuntime := func(node proto.NodeID, idx int) (
+			rt *kayak.Runtime, w *kl.FileWal, db *sqliteStorage, err error) {
+			if db, err = newSQLiteStorage(filepath.Join(dir, fmt.Sprintf("db%d", idx))); err != nil {
+				return
+			}
+			if w, err = kl.NewFileWal(filepath.Join(dir, fmt.Sprintf("wal%d", idx)), walCfg); err != nil {
+				return
+			}
+			rt, err = kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:          db,
+				PrepareThreshold: 1.0,
+				CommitThreshold:  0.5,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              w,
+				WalRetention:     10,
+				NodeID:           node,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+			})
+			return
+		}
+
+		rt1, wal1, db1, err := newRuntime(node1, 1)
+		So(err, ShouldBeNil)
+		defer db1.Close()
+		defer wal1.Close()
+		rt2, wal2, db2, err := newRuntime(node2, 2)
+		So(err, ShouldBeNil)
+		defer db2.Close()
+		defer wal2.Close()
+
+		// node3 never acknowledges any commit
+		m := newFakeMux()
+		m.register(node1, newFakeService(rt1))
+		m.register(node2, newFakeService(rt2))
+		rt1.SetCaller(node2, newFakeCaller(m, node2))
+		rt1.SetCaller(node3, &laggingCaller{})
+		rt2.SetCaller(node1, newFakeCaller(m, node1))
+		So(rt1.Start(), ShouldBeNil)
+		defer rt1.Shutdown()
+		So(rt2.Start(), ShouldBeNil)
+		defer rt2.Shutdown()
+
+		_, _, err = rt1.Apply(context.Background(), &queryStructure{
+			Queries: []storage.Query{
+				{Pattern: "CREATE TABLE IF NOT EXISTS test (t1 text)"},
+			},
+		})
+		So(err, ShouldBeNil)
+		for i := 0; i != 50; i++ {
+			_, _, err = rt1.Apply(context.Background(), &queryStructure{
+				Queries: []storage.Query{
+					{
+						Pattern: "INSERT INTO test (t1) VALUES(?)",
+						Args:    []sql.NamedArg{sql.Named("", RandStringRunes(10))},
+					},
+				},
+			})
+			So(err, ShouldBeNil)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		So(rt2.WaitCommit(ctx, rt1.LastCommit()), ShouldBeNil)
+
+		// leader keeps the logs for the lagging follower, while the follower truncates its wal
+		_, err = wal1.Get(0)
+		So(err, ShouldBeNil)
+		_, err = wal2.Get(0)
+		So(err, ShouldEqual, kl.ErrNotExists)
+	})
 }
 
 func BenchmarkRuntime(b *testing.B) {
@@ -541,16 +827,17 @@ func BenchmarkRuntime(b *testing.B) {
 		wal1 := kl.NewMemWal()
 		defer wal1.Close()
 		cfg1 := &kt.RuntimeConfig{
-			Handler:          db1,
-			PrepareThreshold: 1.0,
-			CommitThreshold:  1.0,
-			PrepareTimeout:   time.Second,
-			CommitTimeout:    10 * time.Second,
-			Peers:            peers,
-			Wal:              wal1,
-			NodeID:           node1,
-			ServiceName:      "Test",
-			MethodName:       "Call",
+			Handler:             db1,
+			PrepareThreshold:    1.0,
+			CommitThreshold:     1.0,
+			PrepareTimeout:      time.Second,
+			CommitTimeout:       10 * time.Second,
+			Peers:               peers,
+			Wal:                 wal1,
+			NodeID:              node1,
+			ServiceName:         "Test",
+			MethodName:          "Call",
+			ReadIndexMethodName: "ReadIndex",
 		}
 		rt1, err := kayak.NewRuntime(cfg1)
 		So(err, ShouldBeNil)
@@ -558,16 +845,17 @@ func BenchmarkRuntime(b *testing.B) {
 		wal2 := kl.NewMemWal()
 		defer wal2.Close()
 		cfg2 := &kt.RuntimeConfig{
-			Handler:          db2,
-			PrepareThreshold: 1.0,
-			CommitThreshold:  1.0,
-			PrepareTimeout:   time.Second,
-			CommitTimeout:    10 * time.Second,
-			Peers:            peers,
-			Wal:              wal2,
-			NodeID:           node2,
-			ServiceName:      "Test",
-			MethodName:       "Call",
+			Handler:             db2,
+			PrepareThreshold:    1.0,
+			CommitThreshold:     1.0,
+			PrepareTimeout:      time.Second,
+			CommitTimeout:       10 * time.Second,
+			Peers:               peers,
+			Wal:                 wal2,
+			NodeID:              node2,
+			ServiceName:         "Test",
+			MethodName:          "Call",
+			ReadIndexMethodName: "ReadIndex",
 		}
 		rt2, err := kayak.NewRuntime(cfg2)
 		So(err, ShouldBeNil)
@@ -668,3 +956,90 @@ func BenchmarkRuntime(b *testing.B) {
 		b.StartTimer()
 	})
 }
+
+func TestFollowerResolvePrepare(t *testing.T) {
+	Convey("test follower resolving prepare logs", t, func() {
+		lvl := log.GetLevel()
+		log.SetLevel(log.FatalLevel)
+		defer log.SetLevel(lvl)
+
+		db, err := newSQLiteStorage("test_follower_resolve.db")
+		So(err, ShouldBeNil)
+		defer func() {
+			db.Close()
+			os.Remove("test_follower_resolve.db")
+		}()
+
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		err = peers.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+			Handler:          db,
+			PrepareThreshold: 1.0,
+			CommitThreshold:  1.0,
+			PrepareTimeout:   time.Second,
+			CommitTimeout:    10 * time.Second,
+			Peers:            peers,
+			Wal:              kl.NewMemWal(),
+			NodeID:           node2,
+			ServiceName:      "Test",
+			MethodName:       "Call",
+		})
+		So(err, ShouldBeNil)
+		So(rt.Start(), ShouldBeNil)
+		defer rt.Shutdown()
+
+		payload, err := db.EncodePayload(&queryStructure{
+			Queries: []storage.Query{
+				{Pattern: "CREATE TABLE IF NOT EXISTS test (t1 text)"},
+			},
+		})
+		So(err, ShouldBeNil)
+		indexBytes := func(indexes ...uint64) (b []byte) {
+			for _, i := range indexes {
+				var buf [8]byte
+				binary.BigEndian.PutUint64(buf[:], i)
+				b = append(b, buf[:]...)
+			}
+			return
+		}
+		newLog := func(index uint64, typ kt.LogType, data []byte) *kt.Log {
+			return &kt.Log{
+				LogHeader: kt.LogHeader{
+					Index:      index,
+					Type:       typ,
+					Producer:   node1,
+					DataLength: uint64(len(data)),
+				},
+				Data: data,
+			}
+		}
+
+		// rolled back prepare could not be resolved again
+		So(rt.FollowerApply(newLog(0, kt.LogPrepare, payload)), ShouldBeNil)
+		So(rt.FollowerApply(newLog(1, kt.LogRollback, indexBytes(0))), ShouldBeNil)
+		err = rt.FollowerApply(newLog(2, kt.LogRollback, indexBytes(0)))
+		So(errors.Cause(err), ShouldEqual, kt.ErrInvalidLog)
+		err = rt.FollowerApply(newLog(2, kt.LogCommit, indexBytes(0, 0)))
+		So(errors.Cause(err), ShouldEqual, kt.ErrInvalidLog)
+
+		// committed prepare could not be resolved again
+		So(rt.FollowerApply(newLog(3, kt.LogPrepare, payload)), ShouldBeNil)
+		So(rt.FollowerApply(newLog(4, kt.LogCommit, indexBytes(3, 0))), ShouldBeNil)
+		So(rt.LastCommit(), ShouldEqual, 4)
+		err = rt.FollowerApply(newLog(5, kt.LogRollback, indexBytes(3)))
+		So(errors.Cause(err), ShouldEqual, kt.ErrInvalidLog)
+		err = rt.FollowerApply(newLog(5, kt.LogCommit, indexBytes(3, 4)))
+		So(errors.Cause(err), ShouldEqual, kt.ErrInvalidLog)
+	})
+}
@@ -38,6 +38,9 @@ type RuntimeConfig struct {
 	Peers *proto.Peers
 	// wal for kayak.
 	Wal Wal
+	// count of latest logs retained on wal truncation, wal is never truncated if 0 or the wal does
+	// not implement WalTruncater.
+	WalRetention uint64
 	// current node id.
 	NodeID proto.NodeID
 	// current instance id.
@@ -46,4 +49,6 @@ type RuntimeConfig struct {
 	ServiceName string
 	// mux service method.
 	MethodName string
+	// mux service read index method, read index is not supported if not set.
+	ReadIndexMethodName string
 }
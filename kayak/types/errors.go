@@ -33,4 +33,8 @@ var (
 	ErrNotInPeer = errors.New("node not in peer")
 	// ErrInvalidConfig represents invalid kayak runtime config.
 	ErrInvalidConfig = errors.New("invalid runtime config")
+	// ErrStopped represents kayak runtime is stopped.
+	ErrStopped = errors.New("runtime stopped")
+	// ErrReadIndexNotSupported represents read index method is not configured.
+	ErrReadIndexNotSupported = errors.New("read index not supported")
 )
@@ -24,3 +24,15 @@ type RPCRequest struct {
 	Instance string
 	Log      *Log
 }
+
+// ReadIndexRequest defines the read index request entity sent to leader.
+type ReadIndexRequest struct {
+	proto.Envelope
+	Instance string
+}
+
+// ReadIndexResponse defines the read index response entity, Index is the last commit index of leader.
+type ReadIndexResponse struct {
+	proto.Envelope
+	Index uint64
+}
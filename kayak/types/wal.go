@@ -25,3 +25,15 @@ type Wal interface {
 	// random access
 	Get(index uint64) (*Log, error)
 }
+
+// WalTruncater defines the optional wal interface to remove the resolved logs.
+type WalTruncater interface {
+	// remove logs below checkpoint index, which are all committed or rolled back
+	Truncate(checkpoint uint64) error
+}
+
+// WalSizer defines the optional wal interface to report the storage size.
+type WalSizer interface {
+	// storage size in bytes
+	Size() (int64, error)
+}
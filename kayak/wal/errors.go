@@ -27,4 +27,8 @@ var (
 	ErrAlreadyExists = errors.New("log already exists")
 	// ErrNotExists represents the log does not exists.
 	ErrNotExists = errors.New("log not exists")
+	// ErrCorruptedLog represents the log record failed the checksum or could not be decoded.
+	ErrCorruptedLog = errors.New("corrupted log")
+	// ErrInvalidConfig represents the wal config is invalid.
+	ErrInvalidConfig = errors.New("invalid wal config")
 )
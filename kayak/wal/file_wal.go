@@ -0,0 +1,729 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSegmentSize defines the default max size of a wal segment file.
+	DefaultSegmentSize = 64 << 20
+	// DefaultSyncInterval defines the default fsync interval for SyncInterval policy.
+	DefaultSyncInterval = time.Second
+
+	segmentFileSuffix  = ".wal"
+	checkpointFileName = "checkpoint"
+	// record header: crc32 of body + body length.
+	recordHeaderSize = 8
+	// max allowed record body length, used to detect corrupted length field.
+	maxRecordSize = 1 << 30
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy defines the fsync policy of file wal.
+type SyncPolicy int
+
+const (
+	// SyncEveryWrite syncs the segment file after every log write.
+	SyncEveryWrite SyncPolicy = iota
+	// SyncInterval syncs the segment file periodically.
+	SyncInterval
+	// SyncNone leaves the flush to the operating system.
+	SyncNone
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncEveryWrite:
+		return "always"
+	case SyncInterval:
+		return "interval"
+	case SyncNone:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSyncPolicy parses the sync policy from its string form.
+func ParseSyncPolicy(s string) (p SyncPolicy, err error) {
+	switch strings.ToLower(s) {
+	case "", "always":
+		p = SyncEveryWrite
+	case "interval":
+		p = SyncInterval
+	case "none":
+		p = SyncNone
+	default:
+		err = errors.Wrapf(ErrInvalidConfig, "unknown sync policy: %s", s)
+	}
+	return
+}
+
+// FileWalConfig defines the config of file wal.
+type FileWalConfig struct {
+	// max size of a single segment file, new segment is created on overflow.
+	SegmentSize int64
+	// fsync policy for log writes.
+	SyncPolicy SyncPolicy
+	// fsync interval, only used by SyncInterval policy.
+	SyncInterval time.Duration
+}
+
+type fileWalSegment struct {
+	seq      uint64
+	file     *os.File
+	size     int64
+	count    int
+	maxIndex uint64
+}
+
+type fileWalPosition struct {
+	seq     uint64
+	offset  int64
+	length  uint32
+	logType kt.LogType
+}
+
+// FileWal defines an append-only wal using segmented files as storage.
+type FileWal struct {
+	sync.RWMutex
+	dir       string
+	cfg       FileWalConfig
+	segments  []*fileWalSegment
+	index     map[uint64]*fileWalPosition
+	readQueue []uint64
+	readPos   int
+	// checkpoint defines the index below which logs could be deleted,
+	// checkpointCommit is the last commit index before the checkpoint.
+	checkpoint       uint64
+	checkpointCommit uint64
+	closed           uint32
+	read             uint32
+	dirty            uint32
+	stopCh           chan struct{}
+	wg               sync.WaitGroup
+}
+
+// NewFileWal returns new file wal instance stored in dir.
+func NewFileWal(dir string, cfg *FileWalConfig) (p *FileWal, err error) {
+	if dir == "" {
+		err = errors.Wrap(ErrInvalidConfig, "empty wal directory")
+		return
+	}
+
+	p = &FileWal{
+		dir:    dir,
+		index:  make(map[uint64]*fileWalPosition),
+		stopCh: make(chan struct{}),
+	}
+
+	if cfg != nil {
+		p.cfg = *cfg
+	}
+	if p.cfg.SegmentSize <= 0 {
+		p.cfg.SegmentSize = DefaultSegmentSize
+	}
+	if p.cfg.SyncInterval <= 0 {
+		p.cfg.SyncInterval = DefaultSyncInterval
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = errors.Wrap(err, "create wal directory failed")
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			p.closeFiles()
+		}
+	}()
+
+	if err = p.loadCheckpoint(); err != nil {
+		return
+	}
+
+	if err = p.loadSegments(); err != nil {
+		return
+	}
+
+	if p.cfg.SyncPolicy == SyncInterval {
+		p.wg.Add(1)
+		go p.syncCycle()
+	}
+
+	return
+}
+
+// Write implements Wal.Write.
+func (p *FileWal) Write(l *kt.Log) (err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	// mark wal as already read
+	atomic.CompareAndSwapUint32(&p.read, 0, 1)
+
+	if l == nil {
+		err = ErrInvalidLog
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if _, exists := p.index[l.Index]; exists {
+		err = ErrAlreadyExists
+		return
+	}
+
+	l.DataLength = uint64(len(l.Data))
+
+	var record []byte
+	if record, err = p.encodeRecord(l); err != nil {
+		return
+	}
+
+	seg := p.segments[len(p.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(record)) > p.cfg.SegmentSize {
+		if seg, err = p.rotate(); err != nil {
+			return
+		}
+	}
+
+	if _, err = seg.file.WriteAt(record, seg.size); err != nil {
+		err = errors.Wrap(err, "write log record failed")
+		return
+	}
+
+	p.index[l.Index] = &fileWalPosition{
+		seq:     seg.seq,
+		offset:  seg.size,
+		length:  uint32(len(record) - recordHeaderSize),
+		logType: l.Type,
+	}
+	seg.size += int64(len(record))
+	seg.count++
+	if seg.count == 1 || l.Index > seg.maxIndex {
+		seg.maxIndex = l.Index
+	}
+
+	switch p.cfg.SyncPolicy {
+	case SyncEveryWrite:
+		if err = seg.file.Sync(); err != nil {
+			err = errors.Wrap(err, "sync wal segment failed")
+		}
+	case SyncInterval:
+		atomic.StoreUint32(&p.dirty, 1)
+	}
+
+	return
+}
+
+// Read implements Wal.Read.
+func (p *FileWal) Read() (l *kt.Log, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	if atomic.LoadUint32(&p.read) == 1 {
+		err = io.EOF
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.readQueue == nil {
+		p.readQueue = make([]uint64, 0, len(p.index))
+		for i := range p.index {
+			p.readQueue = append(p.readQueue, i)
+		}
+		sort.Slice(p.readQueue, func(i, j int) bool { return p.readQueue[i] < p.readQueue[j] })
+		p.readPos = 0
+
+		if p.checkpoint > 0 {
+			// virtual checkpoint log to notify the reader of the truncated logs
+			l = p.checkpointLog()
+			return
+		}
+	}
+
+	if p.readPos < len(p.readQueue) {
+		l, err = p.get(p.readQueue[p.readPos])
+		p.readPos++
+		return
+	}
+
+	p.readQueue = nil
+	err = io.EOF
+
+	// log read complete, could not read again
+	atomic.StoreUint32(&p.read, 1)
+
+	return
+}
+
+// Get implements Wal.Get.
+func (p *FileWal) Get(i uint64) (l *kt.Log, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.get(i)
+}
+
+// Size implements types.WalSizer.Size, returns total size of the segment files.
+func (p *FileWal) Size() (size int64, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	for _, seg := range p.segments {
+		size += seg.size
+	}
+
+	return
+}
+
+// Truncate deletes segments which only contains logs below the checkpoint index.
+// Logs below checkpoint must be all committed or rolled back, the last commit before checkpoint
+// will be provided as a virtual LogCheckpoint log on next wal load.
+func (p *FileWal) Truncate(checkpoint uint64) (err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if checkpoint <= p.checkpoint {
+		return
+	}
+
+	lastCommit := p.checkpointCommit
+	for i, pos := range p.index {
+		if i < checkpoint && pos.logType == kt.LogCommit && i > lastCommit {
+			lastCommit = i
+		}
+	}
+
+	// persist checkpoint before removing any segment
+	if err = p.saveCheckpoint(checkpoint, lastCommit); err != nil {
+		return
+	}
+	p.checkpoint, p.checkpointCommit = checkpoint, lastCommit
+
+	// never remove the segment being written
+	var (
+		last     = len(p.segments) - 1
+		retained = make([]*fileWalSegment, 0, len(p.segments))
+	)
+	for i, seg := range p.segments {
+		if i == last || (seg.count > 0 && seg.maxIndex >= checkpoint) {
+			retained = append(retained, seg)
+			continue
+		}
+		for idx, pos := range p.index {
+			if pos.seq == seg.seq {
+				delete(p.index, idx)
+			}
+		}
+		_ = seg.file.Close()
+		if err = os.Remove(p.segmentPath(seg.seq)); err != nil {
+			err = errors.Wrap(err, "remove wal segment failed")
+			return
+		}
+		log.WithFields(log.Fields{
+			"dir":        p.dir,
+			"segment":    seg.seq,
+			"checkpoint": checkpoint,
+		}).Debug("removed wal segment below checkpoint")
+	}
+	p.segments = retained
+
+	return
+}
+
+// Close implements Wal.Close.
+func (p *FileWal) Close() {
+	if !atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
+		return
+	}
+
+	close(p.stopCh)
+	p.wg.Wait()
+
+	p.Lock()
+	defer p.Unlock()
+
+	if n := len(p.segments); n > 0 && p.cfg.SyncPolicy != SyncNone {
+		_ = p.segments[n-1].file.Sync()
+	}
+	p.closeFiles()
+}
+
+func (p *FileWal) get(i uint64) (l *kt.Log, err error) {
+	pos, exists := p.index[i]
+	if !exists {
+		err = ErrNotExists
+		return
+	}
+
+	var seg *fileWalSegment
+	for _, s := range p.segments {
+		if s.seq == pos.seq {
+			seg = s
+			break
+		}
+	}
+	if seg == nil {
+		err = ErrNotExists
+		return
+	}
+
+	buf := make([]byte, recordHeaderSize+int(pos.length))
+	if _, err = seg.file.ReadAt(buf, pos.offset); err != nil {
+		err = errors.Wrap(err, "read log record failed")
+		return
+	}
+
+	var body []byte
+	if body, err = p.checkRecord(buf); err != nil {
+		return
+	}
+
+	return p.decodeBody(body)
+}
+
+func (p *FileWal) checkpointLog() *kt.Log {
+	return &kt.Log{
+		LogHeader: kt.LogHeader{
+			Index:      p.checkpoint,
+			Type:       kt.LogCheckpoint,
+			DataLength: 8,
+		},
+		Data: p.uint64ToBytes(p.checkpointCommit),
+	}
+}
+
+func (p *FileWal) encodeRecord(l *kt.Log) (record []byte, err error) {
+	var enc *bytes.Buffer
+	if enc, err = utils.EncodeMsgPack(l.LogHeader); err != nil {
+		err = errors.Wrap(err, "encode log header failed")
+		return
+	}
+
+	bodyLen := 4 + enc.Len() + len(l.Data)
+	record = make([]byte, recordHeaderSize+bodyLen)
+	body := record[recordHeaderSize:]
+	binary.BigEndian.PutUint32(body, uint32(enc.Len()))
+	copy(body[4:], enc.Bytes())
+	copy(body[4+enc.Len():], l.Data)
+
+	binary.BigEndian.PutUint32(record, crc32.Checksum(body, crcTable))
+	binary.BigEndian.PutUint32(record[4:], uint32(bodyLen))
+
+	return
+}
+
+func (p *FileWal) checkRecord(record []byte) (body []byte, err error) {
+	if len(record) < recordHeaderSize {
+		err = ErrCorruptedLog
+		return
+	}
+	body = record[recordHeaderSize:]
+	if uint32(len(body)) != binary.BigEndian.Uint32(record[4:]) ||
+		crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(record) {
+		err = ErrCorruptedLog
+	}
+	return
+}
+
+func (p *FileWal) decodeBody(body []byte) (l *kt.Log, err error) {
+	if len(body) < 4 {
+		err = ErrCorruptedLog
+		return
+	}
+	headerLen := int(binary.BigEndian.Uint32(body))
+	if 4+headerLen > len(body) {
+		err = ErrCorruptedLog
+		return
+	}
+
+	l = new(kt.Log)
+	if err = utils.DecodeMsgPack(body[4:4+headerLen], &l.LogHeader); err != nil {
+		err = errors.Wrap(err, "decode log header failed")
+		return
+	}
+	l.Data = append([]byte(nil), body[4+headerLen:]...)
+
+	return
+}
+
+func (p *FileWal) loadSegments() (err error) {
+	var infos []os.FileInfo
+	if infos, err = ioutil.ReadDir(p.dir); err != nil {
+		err = errors.Wrap(err, "read wal directory failed")
+		return
+	}
+
+	var seqs []uint64
+	for _, info := range infos {
+		var seq uint64
+		if info.IsDir() || !strings.HasSuffix(info.Name(), segmentFileSuffix) {
+			continue
+		}
+		if _, err = fmt.Sscanf(info.Name(), "%020d"+segmentFileSuffix, &seq); err != nil {
+			err = nil
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for i, seq := range seqs {
+		if err = p.loadSegment(seq, i == len(seqs)-1); err != nil {
+			return
+		}
+	}
+
+	if len(p.segments) == 0 {
+		_, err = p.newSegment(1)
+	}
+
+	return
+}
+
+func (p *FileWal) loadSegment(seq uint64, isLast bool) (err error) {
+	var (
+		seg = &fileWalSegment{seq: seq}
+		r   *bufio.Reader
+	)
+
+	if seg.file, err = os.OpenFile(p.segmentPath(seq), os.O_RDWR, 0644); err != nil {
+		err = errors.Wrap(err, "open wal segment failed")
+		return
+	}
+	p.segments = append(p.segments, seg)
+
+	r = bufio.NewReader(seg.file)
+
+	for {
+		var (
+			header = make([]byte, recordHeaderSize)
+			n      int
+			body   []byte
+			l      *kt.Log
+		)
+
+		if n, err = io.ReadFull(r, header); err == io.EOF {
+			err = nil
+			return
+		} else if err == nil {
+			bodyLen := binary.BigEndian.Uint32(header[4:])
+			if bodyLen > maxRecordSize {
+				err = ErrCorruptedLog
+			} else {
+				record := make([]byte, recordHeaderSize+int(bodyLen))
+				copy(record, header)
+				if _, err = io.ReadFull(r, record[recordHeaderSize:]); err == nil {
+					if body, err = p.checkRecord(record); err == nil {
+						l, err = p.decodeBody(body)
+					}
+				}
+			}
+		}
+
+		if err != nil {
+			if !isLast {
+				err = errors.Wrapf(ErrCorruptedLog, "segment %d at offset %d: %v", seq, seg.size, err)
+				return
+			}
+
+			// torn write in the tail segment, discard the incomplete records
+			log.WithFields(log.Fields{
+				"dir":     p.dir,
+				"segment": seq,
+				"offset":  seg.size,
+				"read":    n,
+			}).WithError(err).Warning("truncate corrupted wal tail")
+
+			if err = seg.file.Truncate(seg.size); err != nil {
+				err = errors.Wrap(err, "truncate corrupted wal tail failed")
+			}
+			return
+		}
+
+		p.index[l.Index] = &fileWalPosition{
+			seq:     seq,
+			offset:  seg.size,
+			length:  uint32(len(body)),
+			logType: l.Type,
+		}
+		seg.size += int64(recordHeaderSize + len(body))
+		seg.count++
+		if seg.count == 1 || l.Index > seg.maxIndex {
+			seg.maxIndex = l.Index
+		}
+	}
+}
+
+func (p *FileWal) newSegment(seq uint64) (seg *fileWalSegment, err error) {
+	seg = &fileWalSegment{seq: seq}
+	if seg.file, err = os.OpenFile(p.segmentPath(seq), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+		err = errors.Wrap(err, "create wal segment failed")
+		return
+	}
+	p.segments = append(p.segments, seg)
+	return
+}
+
+func (p *FileWal) rotate() (seg *fileWalSegment, err error) {
+	last := p.segments[len(p.segments)-1]
+	if p.cfg.SyncPolicy != SyncNone {
+		if err = last.file.Sync(); err != nil {
+			err = errors.Wrap(err, "sync wal segment failed")
+			return
+		}
+	}
+	return p.newSegment(last.seq + 1)
+}
+
+func (p *FileWal) loadCheckpoint() (err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filepath.Join(p.dir, checkpointFileName)); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		err = errors.Wrap(err, "read wal checkpoint failed")
+		return
+	}
+	if len(data) != 20 || crc32.Checksum(data[4:], crcTable) != binary.BigEndian.Uint32(data) {
+		err = errors.Wrap(ErrCorruptedLog, "invalid wal checkpoint")
+		return
+	}
+	p.checkpoint = binary.BigEndian.Uint64(data[4:])
+	p.checkpointCommit = binary.BigEndian.Uint64(data[12:])
+	return
+}
+
+func (p *FileWal) saveCheckpoint(checkpoint, lastCommit uint64) (err error) {
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint64(data[4:], checkpoint)
+	binary.BigEndian.PutUint64(data[12:], lastCommit)
+	binary.BigEndian.PutUint32(data, crc32.Checksum(data[4:], crcTable))
+
+	var (
+		target = filepath.Join(p.dir, checkpointFileName)
+		tmp    = target + ".tmp"
+		f      *os.File
+	)
+	if f, err = os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		err = errors.Wrap(err, "create wal checkpoint failed")
+		return
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	if err != nil {
+		err = errors.Wrap(err, "write wal checkpoint failed")
+		return
+	}
+	if err = os.Rename(tmp, target); err != nil {
+		err = errors.Wrap(err, "save wal checkpoint failed")
+	}
+	return
+}
+
+func (p *FileWal) syncCycle() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		if !atomic.CompareAndSwapUint32(&p.dirty, 1, 0) {
+			continue
+		}
+
+		p.RLock()
+		if n := len(p.segments); n > 0 {
+			if err := p.segments[n-1].file.Sync(); err != nil {
+				log.WithField("dir", p.dir).WithError(err).Error("sync wal segment failed")
+			}
+		}
+		p.RUnlock()
+	}
+}
+
+func (p *FileWal) closeFiles() {
+	for _, seg := range p.segments {
+		if seg.file != nil {
+			_ = seg.file.Close()
+		}
+	}
+	p.segments = nil
+}
+
+func (p *FileWal) segmentPath(seq uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%020d%s", seq, segmentFileSuffix))
+}
+
+func (p *FileWal) uint64ToBytes(o uint64) (res []byte) {
+	res = make([]byte, 8)
+	binary.BigEndian.PutUint64(res, o)
+	return
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileWal_Write(t *testing.T) {
+	Convey("file wal write/get/close", t, func() {
+		walDir, err := ioutil.TempDir("", "file_wal")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(walDir)
+
+		var p *FileWal
+		p, err = NewFileWal(walDir, nil)
+		So(err, ShouldBeNil)
+
+		err = p.Write(nil)
+		So(err, ShouldNotBeNil)
+
+		l1 := &kt.Log{
+			LogHeader: kt.LogHeader{
+				Index:    0,
+				Type:     kt.LogPrepare,
+				Producer: proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000"),
+			},
+			Data: []byte("happy1"),
+		}
+
+		err = p.Write(l1)
+		So(err, ShouldBeNil)
+		err = p.Write(l1)
+		So(err, ShouldEqual, ErrAlreadyExists)
+
+		var l *kt.Log
+		l, err = p.Get(l1.Index)
+		So(err, ShouldBeNil)
+		So(l, ShouldResemble, l1)
+
+		_, err = p.Get(10000)
+		So(err, ShouldEqual, ErrNotExists)
+
+		// not consecutive writes
+		for _, i := range []uint64{1, 3, 2} {
+			err = p.Write(&kt.Log{
+				LogHeader: kt.LogHeader{
+					Index: i,
+					Type:  kt.LogPrepare,
+				},
+				Data: []byte("happy"),
+			})
+			So(err, ShouldBeNil)
+		}
+
+		_, err = p.Read()
+		So(err, ShouldEqual, io.EOF)
+
+		p.Close()
+		So(p.Close, ShouldNotPanic)
+
+		_, err = p.Read()
+		So(err, ShouldEqual, ErrWalClosed)
+		err = p.Write(l1)
+		So(err, ShouldEqual, ErrWalClosed)
+		_, err = p.Get(l1.Index)
+		So(err, ShouldEqual, ErrWalClosed)
+
+		// load again, read in index order
+		p, err = NewFileWal(walDir, nil)
+		So(err, ShouldBeNil)
+
+		for i := 0; i != 4; i++ {
+			l, err = p.Read()
+			So(err, ShouldBeNil)
+			So(l.Index, ShouldEqual, i)
+		}
+
+		_, err = p.Read()
+		So(err, ShouldEqual, io.EOF)
+
+		p.Close()
+	})
+	Convey("open failed test", t, func() {
+		_, err := NewFileWal("", nil)
+		So(err, ShouldNotBeNil)
+		_, err = ParseSyncPolicy("sometimes")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFileWal_Segments(t *testing.T) {
+	Convey("file wal rotation, truncation and recovery", t, func() {
+		walDir, err := ioutil.TempDir("", "file_wal")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(walDir)
+
+		cfg := &FileWalConfig{
+			SegmentSize: 256,
+			SyncPolicy:  SyncInterval,
+		}
+
+		var p *FileWal
+		p, err = NewFileWal(walDir, cfg)
+		So(err, ShouldBeNil)
+
+		// prepare/commit pairs
+		for i := uint64(0); i != 40; i += 2 {
+			err = p.Write(&kt.Log{
+				LogHeader: kt.LogHeader{Index: i, Type: kt.LogPrepare},
+				Data:      []byte("prepare data"),
+			})
+			So(err, ShouldBeNil)
+			err = p.Write(&kt.Log{
+				LogHeader: kt.LogHeader{Index: i + 1, Type: kt.LogCommit},
+				Data:      p.uint64ToBytes(i),
+			})
+			So(err, ShouldBeNil)
+		}
+
+		segments, _ := filepath.Glob(filepath.Join(walDir, "*"+segmentFileSuffix))
+		So(len(segments), ShouldBeGreaterThan, 1)
+
+		err = p.Truncate(20)
+		So(err, ShouldBeNil)
+
+		remains, _ := filepath.Glob(filepath.Join(walDir, "*"+segmentFileSuffix))
+		So(len(remains), ShouldBeLessThan, len(segments))
+
+		_, err = p.Get(0)
+		So(err, ShouldEqual, ErrNotExists)
+		_, err = p.Get(39)
+		So(err, ShouldBeNil)
+
+		p.Close()
+
+		// append garbage to the tail segment to simulate torn write
+		f, err := os.OpenFile(remains[len(remains)-1], os.O_WRONLY|os.O_APPEND, 0644)
+		So(err, ShouldBeNil)
+		_, err = f.Write([]byte{0x01, 0x02, 0x03})
+		So(err, ShouldBeNil)
+		f.Close()
+
+		p, err = NewFileWal(walDir, cfg)
+		So(err, ShouldBeNil)
+		defer p.Close()
+
+		var l *kt.Log
+		l, err = p.Read()
+		So(err, ShouldBeNil)
+		So(l.Type, ShouldEqual, kt.LogCheckpoint)
+		So(l.Index, ShouldEqual, 20)
+		So(l.Data, ShouldResemble, p.uint64ToBytes(19))
+
+		var last uint64
+		for {
+			if l, err = p.Read(); err != nil {
+				break
+			}
+			So(l.Index, ShouldBeGreaterThanOrEqualTo, last)
+			last = l.Index
+		}
+		So(err, ShouldEqual, io.EOF)
+		So(last, ShouldEqual, 39)
+
+		// write after recovery
+		err = p.Write(&kt.Log{
+			LogHeader: kt.LogHeader{Index: 40, Type: kt.LogNoop},
+		})
+		So(err, ShouldBeNil)
+		l, err = p.Get(40)
+		So(err, ShouldBeNil)
+		So(l.Type, ShouldEqual, kt.LogNoop)
+	})
+}
+
+func TestMigrateLevelDBWal(t *testing.T) {
+	Convey("migrate leveldb wal to file wal", t, func() {
+		baseDir, err := ioutil.TempDir("", "wal_migrate")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(baseDir)
+
+		var (
+			srcPath = filepath.Join(baseDir, "kayak.ldb")
+			dstDir  = filepath.Join(baseDir, "kayak.wal")
+			src     *LevelDBWal
+		)
+
+		src, err = NewLevelDBWal(srcPath)
+		So(err, ShouldBeNil)
+		for i := uint64(0); i != 10; i++ {
+			err = src.Write(&kt.Log{
+				LogHeader: kt.LogHeader{Index: i, Type: kt.LogPrepare},
+				Data:      []byte("happy"),
+			})
+			So(err, ShouldBeNil)
+		}
+		src.Close()
+
+		var count uint64
+		count, err = MigrateLevelDBWal(srcPath, dstDir, nil)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 10)
+
+		// migrate to non-empty wal
+		_, err = MigrateLevelDBWal(srcPath, dstDir, nil)
+		So(err, ShouldNotBeNil)
+		_, err = MigrateLevelDBWal(filepath.Join(baseDir, "not_exists"), dstDir, nil)
+		So(err, ShouldNotBeNil)
+
+		var dst *FileWal
+		dst, err = NewFileWal(dstDir, nil)
+		So(err, ShouldBeNil)
+		defer dst.Close()
+
+		var l *kt.Log
+		l, err = dst.Get(9)
+		So(err, ShouldBeNil)
+		So(l.Data, ShouldResemble, []byte("happy"))
+	})
+}
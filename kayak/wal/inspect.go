@@ -0,0 +1,169 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync/atomic"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// WalkFunc defines the callback of wal walking, err is the load error of the log at index.
+type WalkFunc func(index uint64, l *kt.Log, err error) error
+
+// InspectReport defines the verification result of a wal.
+type InspectReport struct {
+	Count      uint64
+	FirstIndex uint64
+	LastIndex  uint64
+	TypeCount  map[kt.LogType]uint64
+	// Missing defines the indexes absent between first and last index.
+	Missing []uint64
+	// PendingPrepares defines the prepare logs without commit/rollback.
+	PendingPrepares []uint64
+	// Orphans defines the commit/rollback logs referencing a non-existent or resolved prepare.
+	Orphans []uint64
+	// Corrupted defines the indexes of logs could not be loaded.
+	Corrupted []uint64
+}
+
+// Walk iterates all logs in index order, corrupted logs are provided with load error.
+func (p *LevelDBWal) Walk(fn WalkFunc) (err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	it := p.db.NewIterator(util.BytesPrefix(logHeaderKeyPrefix), nil)
+	defer it.Release()
+
+	for it.Next() {
+		var (
+			key   = it.Key()
+			index uint64
+			l     *kt.Log
+			lerr  error
+		)
+		if len(key) != len(logHeaderKeyPrefix)+8 {
+			continue
+		}
+		index = binary.BigEndian.Uint64(key[len(logHeaderKeyPrefix):])
+		if l, lerr = p.load(it.Value()); lerr == nil && l.Index != index {
+			lerr = errors.Wrapf(ErrCorruptedLog, "log index %d mismatch with key index %d", l.Index, index)
+		}
+		if err = fn(index, l, lerr); err != nil {
+			return
+		}
+	}
+
+	return it.Error()
+}
+
+// TruncateFrom removes all logs with index greater than or equal to the given index.
+func (p *LevelDBWal) TruncateFrom(index uint64) (removed uint64, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	batch := new(leveldb.Batch)
+	for _, prefix := range [][]byte{logHeaderKeyPrefix, logDataKeyPrefix} {
+		it := p.db.NewIterator(&util.Range{
+			Start: append(append([]byte(nil), prefix...), p.uint64ToBytes(index)...),
+			Limit: util.BytesPrefix(prefix).Limit,
+		}, nil)
+		for it.Next() {
+			batch.Delete(append([]byte(nil), it.Key()...))
+			if string(prefix) == string(logHeaderKeyPrefix) {
+				removed++
+			}
+		}
+		it.Release()
+		if err = it.Error(); err != nil {
+			err = errors.Wrap(err, "iterate logs failed")
+			return
+		}
+	}
+
+	if err = p.db.Write(batch, nil); err != nil {
+		err = errors.Wrap(err, "remove logs failed")
+	}
+
+	return
+}
+
+// Inspect walks the wal and verifies index continuity and prepare resolution.
+func Inspect(p *LevelDBWal, fn WalkFunc) (report *InspectReport, err error) {
+	report = &InspectReport{
+		TypeCount: make(map[kt.LogType]uint64),
+	}
+
+	var (
+		pending = make(map[uint64]bool)
+		last    uint64
+	)
+
+	err = p.Walk(func(index uint64, l *kt.Log, lerr error) (err error) {
+		if report.Count == 0 {
+			report.FirstIndex = index
+		} else {
+			for i := last + 1; i < index; i++ {
+				report.Missing = append(report.Missing, i)
+			}
+		}
+		report.Count++
+		report.LastIndex = index
+		last = index
+
+		if lerr != nil {
+			report.Corrupted = append(report.Corrupted, index)
+		} else {
+			report.TypeCount[l.Type]++
+
+			switch l.Type {
+			case kt.LogPrepare:
+				pending[index] = true
+			case kt.LogCommit, kt.LogRollback:
+				if len(l.Data) < 8 || !pending[binary.BigEndian.Uint64(l.Data)] {
+					report.Orphans = append(report.Orphans, index)
+				} else {
+					delete(pending, binary.BigEndian.Uint64(l.Data))
+				}
+			}
+		}
+
+		if fn != nil {
+			err = fn(index, l, lerr)
+		}
+
+		return
+	})
+
+	for i := range pending {
+		report.PendingPrepares = append(report.PendingPrepares, i)
+	}
+	sort.Slice(report.PendingPrepares, func(i, j int) bool {
+		return report.PendingPrepares[i] < report.PendingPrepares[j]
+	})
+
+	return
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspect(t *testing.T) {
+	Convey("inspect and truncate leveldb wal", t, func() {
+		dbFile, err := ioutil.TempDir("", "wal_inspect")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dbFile)
+
+		var p *LevelDBWal
+		p, err = NewLevelDBWal(dbFile)
+		So(err, ShouldBeNil)
+		defer p.Close()
+
+		// prepare 0, commit 0, prepare 2, rollback 5 (orphan), prepare 7 (missing 6)
+		logs := []*kt.Log{
+			{LogHeader: kt.LogHeader{Index: 0, Type: kt.LogPrepare}, Data: []byte("happy")},
+			{LogHeader: kt.LogHeader{Index: 1, Type: kt.LogCommit}, Data: p.uint64ToBytes(0)},
+			{LogHeader: kt.LogHeader{Index: 2, Type: kt.LogPrepare}, Data: []byte("happy")},
+			{LogHeader: kt.LogHeader{Index: 3, Type: kt.LogPrepare}, Data: []byte("happy")},
+			{LogHeader: kt.LogHeader{Index: 4, Type: kt.LogCommit}, Data: p.uint64ToBytes(3)},
+			{LogHeader: kt.LogHeader{Index: 5, Type: kt.LogRollback}, Data: p.uint64ToBytes(3)},
+			{LogHeader: kt.LogHeader{Index: 7, Type: kt.LogPrepare}, Data: []byte("happy")},
+		}
+		for _, l := range logs {
+			err = p.Write(l)
+			So(err, ShouldBeNil)
+		}
+
+		var (
+			report *InspectReport
+			walked []uint64
+		)
+		report, err = Inspect(p, func(index uint64, l *kt.Log, lerr error) error {
+			So(lerr, ShouldBeNil)
+			walked = append(walked, index)
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(walked, ShouldResemble, []uint64{0, 1, 2, 3, 4, 5, 7})
+		So(report.Count, ShouldEqual, 7)
+		So(report.FirstIndex, ShouldEqual, 0)
+		So(report.LastIndex, ShouldEqual, 7)
+		So(report.TypeCount[kt.LogPrepare], ShouldEqual, 4)
+		So(report.Missing, ShouldResemble, []uint64{6})
+		So(report.PendingPrepares, ShouldResemble, []uint64{2, 7})
+		So(report.Orphans, ShouldResemble, []uint64{5})
+		So(report.Corrupted, ShouldBeEmpty)
+
+		var removed uint64
+		removed, err = p.TruncateFrom(5)
+		So(err, ShouldBeNil)
+		So(removed, ShouldEqual, 2)
+
+		report, err = Inspect(p, nil)
+		So(err, ShouldBeNil)
+		So(report.Count, ShouldEqual, 5)
+		So(report.LastIndex, ShouldEqual, 4)
+		So(report.Missing, ShouldBeEmpty)
+		So(report.Orphans, ShouldBeEmpty)
+		So(report.PendingPrepares, ShouldResemble, []uint64{2})
+
+		p.Close()
+		_, err = Inspect(p, nil)
+		So(err, ShouldEqual, ErrWalClosed)
+		_, err = p.TruncateFrom(0)
+		So(err, ShouldEqual, ErrWalClosed)
+	})
+}
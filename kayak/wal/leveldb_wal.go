@@ -190,6 +190,26 @@ func (p *LevelDBWal) Close() {
 	}
 }
 
+// Size implements types.WalSizer.Size, returns approximate size of logs flushed to disk.
+func (p *LevelDBWal) Size() (size int64, err error) {
+	if atomic.LoadUint32(&p.closed) == 1 {
+		err = ErrWalClosed
+		return
+	}
+
+	var sizes leveldb.Sizes
+	if sizes, err = p.db.SizeOf([]util.Range{
+		*util.BytesPrefix(logHeaderKeyPrefix),
+		*util.BytesPrefix(logDataKeyPrefix),
+	}); err != nil {
+		err = errors.Wrap(err, "get wal size failed")
+		return
+	}
+
+	size = sizes.Sum()
+	return
+}
+
 func (p *LevelDBWal) load(logHeader []byte) (l *kt.Log, err error) {
 	l = new(kt.Log)
 
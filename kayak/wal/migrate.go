@@ -0,0 +1,75 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"io"
+	"os"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/pkg/errors"
+)
+
+// CopyWal reads all logs from src and writes them to dst.
+func CopyWal(src, dst kt.Wal) (count uint64, err error) {
+	var l *kt.Log
+
+	for {
+		if l, err = src.Read(); err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			err = errors.Wrap(err, "read source wal failed")
+			return
+		}
+
+		if err = dst.Write(l); err != nil {
+			err = errors.Wrapf(err, "write log %d to target wal failed", l.Index)
+			return
+		}
+
+		count++
+	}
+}
+
+// MigrateLevelDBWal converts the leveldb wal in srcPath to a file wal in dstDir.
+// The target directory must not contain any wal segments.
+func MigrateLevelDBWal(srcPath string, dstDir string, cfg *FileWalConfig) (count uint64, err error) {
+	if _, err = os.Stat(srcPath); err != nil {
+		err = errors.Wrap(err, "stat leveldb wal failed")
+		return
+	}
+
+	var src *LevelDBWal
+	if src, err = NewLevelDBWal(srcPath); err != nil {
+		return
+	}
+	defer src.Close()
+
+	var dst *FileWal
+	if dst, err = NewFileWal(dstDir, cfg); err != nil {
+		return
+	}
+	defer dst.Close()
+
+	if len(dst.index) > 0 || dst.checkpoint > 0 {
+		err = errors.Wrapf(ErrAlreadyExists, "file wal in %s is not empty", dstDir)
+		return
+	}
+
+	return CopyWal(src, dst)
+}
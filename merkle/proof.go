@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package merkle
+
+import (
+	"errors"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+)
+
+var (
+	// ErrIndexOutOfRange indicates that the leaf index is out of the merkle tree range.
+	ErrIndexOutOfRange = errors.New("leaf index out of range")
+)
+
+// Proof is the merkle inclusion proof of a leaf, which contains the sibling hashes on the path
+// from the leaf to the root.
+type Proof struct {
+	// Index is the leaf index, its bits indicate the side of the path node at each level.
+	Index    uint64
+	Siblings []hash.Hash
+}
+
+// GetProof returns the inclusion proof of the leaf at index.
+func (merkle *Merkle) GetProof(index uint64) (proof *Proof, err error) {
+	var (
+		width = (uint64(len(merkle.tree)) + 1) / 2
+		start uint64
+		i     = index
+	)
+	if index >= width || merkle.tree[index] == nil {
+		err = ErrIndexOutOfRange
+		return
+	}
+	proof = &Proof{Index: index}
+	for ; width > 1; width /= 2 {
+		var sibling = merkle.tree[start+(i^1)]
+		if sibling == nil {
+			// only left node, which is merged with itself
+			sibling = merkle.tree[start+i]
+		}
+		proof.Siblings = append(proof.Siblings, *sibling)
+		start += width
+		i /= 2
+	}
+	return
+}
+
+// ComputeRoot computes the merkle root from the leaf and the proof.
+func (p *Proof) ComputeRoot(leaf *hash.Hash) *hash.Hash {
+	var (
+		node = leaf
+		i    = p.Index
+	)
+	for j := range p.Siblings {
+		if i%2 == 0 {
+			node = MergeTwoHash(node, &p.Siblings[j])
+		} else {
+			node = MergeTwoHash(&p.Siblings[j], node)
+		}
+		i /= 2
+	}
+	return node
+}
+
+// VerifyProof verifies that the leaf is included in the merkle tree of root.
+func VerifyProof(leaf *hash.Hash, root *hash.Hash, proof *Proof) bool {
+	if proof == nil || proof.Index>>uint(len(proof.Siblings)) != 0 {
+		return false
+	}
+	return proof.ComputeRoot(leaf).IsEqual(root)
+}
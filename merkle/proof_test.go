@@ -0,0 +1,54 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package merkle
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProof(t *testing.T) {
+	Convey("Proofs of every leaf should be verified against the root", t, func() {
+		for n := 1; n <= 9; n++ {
+			var items = make([]*hash.Hash, n)
+			for i := range items {
+				items[i] = &hash.Hash{}
+				rand.Read(items[i][:])
+			}
+			var (
+				tree = NewMerkle(items)
+				root = tree.GetRoot()
+			)
+			for i := range items {
+				proof, err := tree.GetProof(uint64(i))
+				So(err, ShouldBeNil)
+				So(VerifyProof(items[i], root, proof), ShouldBeTrue)
+				// wrong leaf
+				So(VerifyProof(items[(i+1)%n], root, proof), ShouldEqual, n == 1)
+				// index out of the tree
+				proof.Index |= 1 << uint(len(proof.Siblings))
+				So(VerifyProof(items[i], root, proof), ShouldBeFalse)
+			}
+			_, err := tree.GetProof(uint64(n))
+			So(err, ShouldEqual, ErrIndexOutOfRange)
+		}
+		So(VerifyProof(&hash.Hash{}, &hash.Hash{}, nil), ShouldBeFalse)
+	})
+}
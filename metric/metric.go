@@ -18,16 +18,31 @@ package metric
 
 import (
 	"sort"
+	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/version"
 )
 
+var (
+	// serviceCollectors are the collectors of node services, e.g. kayak runtimes.
+	serviceCollectors     []prometheus.Collector
+	serviceCollectorsLock sync.Mutex
+)
+
 func init() {
 	prometheus.MustRegister(version.NewCollector("CovenantSQL"))
 }
 
+// RegisterServiceCollector adds collectors of node services to the registries returned by
+// StartMetricCollector, it should be called once per collector during package initialization.
+func RegisterServiceCollector(cs ...prometheus.Collector) {
+	serviceCollectorsLock.Lock()
+	defer serviceCollectorsLock.Unlock()
+	serviceCollectors = append(serviceCollectors, cs...)
+}
+
 // StartMetricCollector starts collector registered in NewNodeCollector()
 func StartMetricCollector() (registry *prometheus.Registry) {
 	nc, err := NewNodeCollector()
@@ -43,6 +58,15 @@ func StartMetricCollector() (registry *prometheus.Registry) {
 		return nil
 	}
 
+	serviceCollectorsLock.Lock()
+	defer serviceCollectorsLock.Unlock()
+	for _, c := range serviceCollectors {
+		if err = registry.Register(c); err != nil {
+			log.WithError(err).Error("couldn't register service collector")
+			return nil
+		}
+	}
+
 	log.Info("enabled collectors:")
 	var collectors []string
 	for n := range nc.Collectors {
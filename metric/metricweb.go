@@ -23,6 +23,8 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
 	mw "github.com/zserge/metric"
 
 	"github.com/CovenantSQL/CovenantSQL/utils"
@@ -53,7 +55,27 @@ func collect(cc *CollectClient) (err error) {
 	return
 }
 
-// InitMetricWeb initializes the /debug/metrics web
+// gathererHandler serves the metrics of gatherer in prometheus exposition format.
+func gathererHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contentType := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(contentType))
+		enc := expfmt.NewEncoder(w, contentType)
+		for _, mf := range mfs {
+			if err = enc.Encode(mf); err != nil {
+				log.WithError(err).Debug("encode metric family failed")
+				return
+			}
+		}
+	})
+}
+
+// InitMetricWeb initializes the /debug/metrics web and the /metrics prometheus endpoint
 func InitMetricWeb(metricWeb string) (err error) {
 	// Some Go internal metrics
 	expvar.Publish("go:numgoroutine", mw.NewGauge("1m1s", "5m5s", "1h1m"))
@@ -86,6 +108,8 @@ func InitMetricWeb(metricWeb string) (err error) {
 		}
 	}()
 	http.Handle("/debug/metrics", mw.Handler(mw.Exposed))
+	// node metrics and service metrics, e.g. kayak runtime metrics
+	http.Handle("/metrics", gathererHandler(cc.Registry))
 	go func() {
 		_ = http.ListenAndServe(metricWeb, nil)
 	}()
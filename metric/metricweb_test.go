@@ -2,6 +2,7 @@ package metric
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"testing"
 	"time"
@@ -27,5 +28,12 @@ func TestInitMetricWeb(t *testing.T) {
 		So(string(buf), ShouldContainSubstring, "cpu_count")
 		So(string(buf), ShouldContainSubstring, "fs_avail")
 		So(string(buf), ShouldContainSubstring, "go:alloc")
+
+		resp, err = http.Get("http://" + addr + "/metrics")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldContainSubstring, "node_cpu_count")
 	})
 }
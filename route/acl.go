@@ -81,6 +81,10 @@ const (
 	DBSSubscribeTransactions
 	// DBSCancelSubscription is used by dbms to handle observer subscription cancellation request
 	DBSCancelSubscription
+	// DBSQueryDivergence is used by database owner to query state divergence events
+	DBSQueryDivergence
+	// DBSBillingPreview is used by database owner to preview the pending charges of the database
+	DBSBillingPreview
 	// DBCCall is used by Miner for data consistency
 	DBCCall
 	// SQLCAdviseNewBlock is used by sqlchain to advise new block between adjacent node
@@ -91,12 +95,18 @@ const (
 	SQLCAdviseAckedQuery
 	// SQLCFetchBlock is used by sqlchain to fetch block from adjacent nodes
 	SQLCFetchBlock
+	// SQLCFetchSnapshot is used by sqlchain to fetch state snapshot from adjacent nodes
+	SQLCFetchSnapshot
+	// SQLCFetchMerkleProof is used by sqlchain to fetch the merkle inclusion proof in a block
+	SQLCFetchMerkleProof
 	// SQLCSignBilling is used by sqlchain to response billing signature for periodic billing request
 	SQLCSignBilling
 	// SQLCLaunchBilling is used by blockproducer to trigger the billing process in sqlchain
 	SQLCLaunchBilling
 	// OBSAdviseNewBlock is used by sqlchain to push new block to observers
 	OBSAdviseNewBlock
+	// OBSAdviseBinLog is used by sqlchain to push committed write logs to observers
+	OBSAdviseBinLog
 	// MCCAdviseNewBlock is used by block producer to push block to adjacent nodes
 	MCCAdviseNewBlock
 	// MCCAdviseTxBilling is used by block producer to push billing transaction to adjacent nodes
@@ -110,6 +120,10 @@ const (
 	// MCCFetchLastIrreversibleBlock is used by nodes to fetch last irreversible block from
 	// block producer
 	MCCFetchLastIrreversibleBlock
+	// MCCFetchSnapshot is used by nodes to fetch signed state snapshot from block producer
+	MCCFetchSnapshot
+	// MCCFetchHeaders is used by nodes to fetch irreversible block headers from block producer
+	MCCFetchHeaders
 	// MCCFetchTxBilling is used by nodes to fetch billing transaction from block producer
 	MCCFetchTxBilling
 	// MCCNextAccountNonce is used by block producer main chain to allocate next nonce for transactions
@@ -122,6 +136,10 @@ const (
 	MCCQueryAccountTokenBalance
 	// MCCQueryTxState is used by client to query transaction state.
 	MCCQueryTxState
+	// MCCQueryTxProof is used by client to query the merkle inclusion proof of transaction.
+	MCCQueryTxProof
+	// MCCQueryInvoices is used by client to query the confirmed billings of a database.
+	MCCQueryInvoices
 	// DHTRPCName defines the block producer dh-rpc service name
 	DHTRPCName = "DHT"
 	// BlockProducerRPCName defines main chain rpc name
@@ -157,6 +175,10 @@ func (s RemoteFunc) String() string {
 		return "DBS.SubscribeTransactions"
 	case DBSCancelSubscription:
 		return "DBS.CancelSubscription"
+	case DBSQueryDivergence:
+		return "DBS.QueryDivergence"
+	case DBSBillingPreview:
+		return "DBS.BillingPreview"
 	case DBCCall:
 		return "DBC.Call"
 	case SQLCAdviseNewBlock:
@@ -167,12 +189,18 @@ func (s RemoteFunc) String() string {
 		return "SQLC.AdviseAckedQuery"
 	case SQLCFetchBlock:
 		return "SQLC.FetchBlock"
+	case SQLCFetchSnapshot:
+		return "SQLC.FetchSnapshot"
+	case SQLCFetchMerkleProof:
+		return "SQLC.FetchMerkleProof"
 	case SQLCSignBilling:
 		return "SQLC.SignBilling"
 	case SQLCLaunchBilling:
 		return "SQLC.LaunchBilling"
 	case OBSAdviseNewBlock:
 		return "OBS.AdviseNewBlock"
+	case OBSAdviseBinLog:
+		return "OBS.AdviseBinLog"
 	case MCCAdviseNewBlock:
 		return "MCC.AdviseNewBlock"
 	case MCCAdviseTxBilling:
@@ -185,6 +213,10 @@ func (s RemoteFunc) String() string {
 		return "MCC.FetchBlockByCount"
 	case MCCFetchLastIrreversibleBlock:
 		return "MCC.FetchLastIrreversibleBlock"
+	case MCCFetchSnapshot:
+		return "MCC.FetchSnapshot"
+	case MCCFetchHeaders:
+		return "MCC.FetchHeaders"
 	case MCCFetchTxBilling:
 		return "MCC.FetchTxBilling"
 	case MCCNextAccountNonce:
@@ -197,6 +229,10 @@ func (s RemoteFunc) String() string {
 		return "MCC.QueryAccountTokenBalance"
 	case MCCQueryTxState:
 		return "MCC.QueryTxState"
+	case MCCQueryTxProof:
+		return "MCC.QueryTxProof"
+	case MCCQueryInvoices:
+		return "MCC.QueryInvoices"
 	}
 	return "Unknown"
 }
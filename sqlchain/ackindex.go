@@ -114,11 +114,12 @@ func (i *multiAckIndex) acks() (ret []*types.SignedAckHeader) {
 	return
 }
 
-func (i *multiAckIndex) expire() {
+// expire records the expired queries and returns the responses without acknowledgement.
+func (i *multiAckIndex) expire() (unacked []*types.SignedResponseHeader) {
 	i.RLock()
 	defer i.RUnlock()
-	// TODO(leventeliu): need further processing.
 	for _, v := range i.respIndex {
+		unacked = append(unacked, v)
 		log.WithFields(log.Fields{
 			"request_hash":  v.Request.Hash(),
 			"request_time":  v.Request.Timestamp,
@@ -143,6 +144,7 @@ func (i *multiAckIndex) expire() {
 			"ack_time":      v.Timestamp,
 		}).Warn("query expires without block producing")
 	}
+	return
 }
 
 type ackIndex struct {
@@ -177,7 +179,9 @@ func (i *ackIndex) load(h int32) (mi *multiAckIndex, err error) {
 	return
 }
 
-func (i *ackIndex) advance(h int32) {
+// advance moves the index barrier to height h, and returns the expired responses without
+// acknowledgement.
+func (i *ackIndex) advance(h int32) (unacked []*types.SignedResponseHeader) {
 	var dl []*multiAckIndex
 	i.Lock()
 	for x := i.barrier; x < h; x++ {
@@ -190,11 +194,12 @@ func (i *ackIndex) advance(h int32) {
 	i.Unlock()
 	// Record expired and not acknowledged queries
 	for _, v := range dl {
-		v.expire()
+		unacked = append(unacked, v.expire()...)
 		atomic.AddInt32(&responseCount, int32(-len(v.respIndex)))
 		atomic.AddInt32(&ackCount, int32(-len(v.ackIndex)))
 	}
 	atomic.AddInt32(&multiIndexCount, int32(-len(dl)))
+	return
 }
 
 func (i *ackIndex) addResponse(h int32, resp *types.SignedResponseHeader) (err error) {
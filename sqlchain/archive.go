@@ -0,0 +1,484 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+/*
+Block archiving moves old blocks out of the block storage:
+
+	1. Blocks older than BlockArchiveTTL periods are packed into archive segment files in the
+	   "${ChainFilePrefix}-archive" directory, archiveSegmentBlocks blocks per segment. Each block
+	   is compressed separately, so that it can be read back without unpacking the whole segment.
+	2. The archived blocks are removed from the block storage, and an archive entry keyed by the
+	   block height and hash is kept instead, which locates the block in the segment and also
+	   keeps the block index rebuildable while loading the chain.
+	3. With DropSettledArchives enabled, the segments are removed once the billing of all their
+	   blocks has been confirmed by the main chain. The archive entries of the dropped blocks are
+	   kept with an empty segment name, and FetchBlock returns ErrBlockArchived for them. The
+	   tracked billing transactions and the settled height are saved with the chain metadata, so
+	   that the settlement continues after restarting.
+*/
+
+const archiveSegmentSuffix = ".seg"
+
+// archiveSegmentBlocks is the number of blocks packed into an archive segment.
+var archiveSegmentBlocks = 64
+
+// archiveEntry defines the location of an archived block in the archive segments.
+type archiveEntry struct {
+	// Segment is the segment file name, or empty if the segment is dropped.
+	Segment    string
+	Offset     uint32
+	Length     uint32
+	ParentHash hash.Hash
+	// NextID is the next log offset calculated from the block, used to restore state sequence.
+	NextID uint64
+}
+
+// billingTx defines a billing transaction sent to the main chain.
+type billingTx struct {
+	Hash   hash.Hash
+	Height int32
+}
+
+// settlement defines the billing settlement progress saved with the chain metadata.
+type settlement struct {
+	// SettledHeight is the highest block height of which the billing is confirmed.
+	SettledHeight int32
+	// BillingTxs are the billing transactions sent to the main chain and not settled yet.
+	BillingTxs []*billingTx
+}
+
+func archiveDir(chainFilePrefix string) string {
+	return chainFilePrefix + "-archive"
+}
+
+func writeSegment(name string, data []byte) (err error) {
+	var f *os.File
+	if f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+func readSegment(name string, offset, length uint32) (data []byte, err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer f.Close()
+	data = make([]byte, length)
+	_, err = f.ReadAt(data, int64(offset))
+	return
+}
+
+// archiveBlocks packs the blocks older than the archive TTL into archive segments.
+func (c *Chain) archiveBlocks() (archived int, err error) {
+	var limit = c.rt.getHead().Height - c.rt.archiveTTL
+	if limit <= 0 {
+		return
+	}
+	if err = os.MkdirAll(c.rt.archiveDir, 0700); err != nil {
+		err = errors.Wrap(err, "create archive directory")
+		return
+	}
+	for {
+		var n int
+		if n, err = c.archiveSegment(limit); err != nil || n == 0 {
+			return
+		}
+		archived += n
+	}
+}
+
+// archiveSegment packs the next archiveSegmentBlocks blocks with height not greater than limit
+// into a new segment, or nothing if there are not enough blocks.
+func (c *Chain) archiveSegment(limit int32) (archived int, err error) {
+	var (
+		it = c.bdb.NewIterator(&util.Range{
+			// Genesis block is always kept in the block storage
+			Start: utils.ConcatAll(metaBlockIndex[:], heightToKey(1)),
+			Limit: utils.ConcatAll(metaBlockIndex[:], heightToKey(limit+1)),
+		}, nil)
+		buf     = new(bytes.Buffer)
+		keys    [][]byte
+		entries []*archiveEntry
+	)
+	defer it.Release()
+	for len(keys) < archiveSegmentBlocks && it.Next() {
+		var (
+			k, v  = it.Key(), it.Value()
+			block = &types.Block{}
+			comp  = snappy.Encode(nil, v)
+		)
+		if err = utils.DecodeMsgPack(v, block); err != nil {
+			err = errors.Wrapf(err, "decode block at height %d", keyWithSymbolToHeight(k))
+			return
+		}
+		var entry = &archiveEntry{
+			Offset:     uint32(buf.Len()),
+			Length:     uint32(len(comp)),
+			ParentHash: *block.ParentHash(),
+		}
+		entry.NextID, _ = block.CalcNextID()
+		buf.Write(comp)
+		keys = append(keys, append([]byte(nil), k...))
+		entries = append(entries, entry)
+	}
+	if err = it.Error(); err != nil {
+		err = errors.Wrap(err, "iterate blocks")
+		return
+	}
+	if len(keys) < archiveSegmentBlocks {
+		return
+	}
+
+	var name = fmt.Sprintf("%010d-%010d%s",
+		keyWithSymbolToHeight(keys[0]), keyWithSymbolToHeight(keys[len(keys)-1]),
+		archiveSegmentSuffix)
+	if err = writeSegment(filepath.Join(c.rt.archiveDir, name), buf.Bytes()); err != nil {
+		err = errors.Wrapf(err, "write archive segment %s", name)
+		return
+	}
+	var batch = new(leveldb.Batch)
+	for i, k := range keys {
+		var enc *bytes.Buffer
+		entries[i].Segment = name
+		if enc, err = utils.EncodeMsgPack(entries[i]); err != nil {
+			return
+		}
+		batch.Put(utils.ConcatAll(metaArchiveIndex[:], k[len(metaBlockIndex):]), enc.Bytes())
+		batch.Delete(k)
+	}
+	if err = c.bdb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		err = errors.Wrapf(err, "index archive segment %s", name)
+		return
+	}
+	archived = len(keys)
+	log.WithFields(log.Fields{
+		"segment": name,
+		"count":   archived,
+		"db":      c.databaseID,
+	}).Info("archived blocks")
+	return
+}
+
+// fetchArchivedBlock reads the block of the node from the archive segments, it returns nil if
+// the block is not archived, or ErrBlockArchived if the segment is dropped.
+func (c *Chain) fetchArchivedBlock(n *blockNode) (b *types.Block, err error) {
+	c.archiveLock.RLock()
+	defer c.archiveLock.RUnlock()
+	var (
+		k     = utils.ConcatAll(metaArchiveIndex[:], n.indexKey())
+		v     []byte
+		entry = &archiveEntry{}
+	)
+	if v, err = c.bdb.Get(k, nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if err = utils.DecodeMsgPack(v, entry); err != nil {
+		err = errors.Wrapf(err, "decode archive entry at height %d", n.height)
+		return
+	}
+	if entry.Segment == "" {
+		err = errors.Wrapf(ErrBlockArchived, "fetch block at height %d", n.height)
+		return
+	}
+	if v, err = readSegment(
+		filepath.Join(c.rt.archiveDir, entry.Segment), entry.Offset, entry.Length,
+	); err != nil {
+		err = errors.Wrapf(err, "read archive segment %s", entry.Segment)
+		return
+	}
+	if v, err = snappy.Decode(nil, v); err != nil {
+		err = errors.Wrapf(err, "decompress block at height %d", n.height)
+		return
+	}
+	b = &types.Block{}
+	statBlock(b)
+	if err = utils.DecodeMsgPack(v, b); err != nil {
+		err = errors.Wrapf(err, "decode block at height %d", n.height)
+		b = nil
+	}
+	return
+}
+
+// loadArchivedNodes rebuilds the block index of the archived blocks, which must be called after
+// the genesis block is indexed.
+func (c *Chain) loadArchivedNodes() (last *blockNode, id uint64, err error) {
+	var it = c.bdb.NewIterator(util.BytesPrefix(metaArchiveIndex[:]), nil)
+	defer it.Release()
+	for it.Next() {
+		var (
+			k     = it.Key()
+			entry = &archiveEntry{}
+		)
+		if len(k) < len(metaArchiveIndex)+4+hash.HashSize {
+			continue
+		}
+		if err = utils.DecodeMsgPack(it.Value(), entry); err != nil {
+			err = errors.Wrapf(err, "decode archive entry at height %d", keyWithSymbolToHeight(k))
+			return
+		}
+		var parent = c.bi.lookupNode(&entry.ParentHash)
+		if parent == nil {
+			err = errors.Wrapf(ErrParentNotFound,
+				"load archived block at height %d", keyWithSymbolToHeight(k))
+			return
+		}
+		var node = &blockNode{
+			parent: parent,
+			height: keyWithSymbolToHeight(k),
+			count:  parent.count + 1,
+		}
+		copy(node.hash[:], k[len(metaArchiveIndex)+4:])
+		c.bi.addBlock(node)
+		last = node
+		if entry.NextID > id {
+			id = entry.NextID
+		}
+	}
+	err = it.Error()
+	return
+}
+
+// loadSettlement restores the billing settlement progress from the chain metadata.
+func (c *Chain) loadSettlement() (err error) {
+	var (
+		enc []byte
+		s   = &settlement{}
+	)
+	if enc, err = c.bdb.Get(metaSettlement[:], nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if err = utils.DecodeMsgPack(enc, s); err != nil {
+		err = errors.Wrap(err, "decode settlement")
+		return
+	}
+	c.settlementLock.Lock()
+	defer c.settlementLock.Unlock()
+	c.settledHeight, c.billingTxs = s.SettledHeight, s.BillingTxs
+	return
+}
+
+// saveSettlement saves the billing settlement progress with the chain metadata, the caller must
+// hold the settlement lock.
+func (c *Chain) saveSettlement() (err error) {
+	var enc *bytes.Buffer
+	if enc, err = utils.EncodeMsgPack(&settlement{
+		SettledHeight: c.settledHeight,
+		BillingTxs:    c.billingTxs,
+	}); err != nil {
+		return
+	}
+	if err = c.bdb.Put(metaSettlement[:], enc.Bytes(), nil); err != nil {
+		err = errors.Wrap(err, "save settlement")
+	}
+	return
+}
+
+// trackBilling keeps track of the billing transaction for the blocks up to height.
+func (c *Chain) trackBilling(h hash.Hash, height int32) {
+	c.settlementLock.Lock()
+	defer c.settlementLock.Unlock()
+	c.billingTxs = append(c.billingTxs, &billingTx{Hash: h, Height: height})
+	if err := c.saveSettlement(); err != nil {
+		log.WithField("db", c.databaseID).WithError(err).Warning("save settlement failed")
+	}
+}
+
+// settleBilling queries the states of the tracked billing transactions from the main chain and
+// updates the settled height.
+func (c *Chain) settleBilling() {
+	c.settlementLock.Lock()
+	defer c.settlementLock.Unlock()
+	if len(c.billingTxs) == 0 {
+		return
+	}
+	var pending = c.billingTxs[:0]
+	for _, v := range c.billingTxs {
+		var (
+			req  = &types.QueryTxStateReq{Hash: v.Hash}
+			resp = &types.QueryTxStateResp{}
+		)
+		if err := rpc.RequestBP(route.MCCQueryTxState.String(), req, resp); err != nil {
+			log.WithField("db", c.databaseID).WithError(err).Warning("query billing state failed")
+			pending = append(pending, v)
+			continue
+		}
+		switch resp.State {
+		case pi.TransactionStateConfirmed:
+			if v.Height > c.settledHeight {
+				c.settledHeight = v.Height
+			}
+		case pi.TransactionStatePending, pi.TransactionStatePacked:
+			pending = append(pending, v)
+		default:
+			log.WithFields(log.Fields{
+				"tx":    v.Hash.String(),
+				"state": resp.State.String(),
+				"db":    c.databaseID,
+			}).Warning("billing transaction is not settled")
+		}
+	}
+	c.billingTxs = pending
+	if err := c.saveSettlement(); err != nil {
+		log.WithField("db", c.databaseID).WithError(err).Warning("save settlement failed")
+	}
+}
+
+// dropSettledArchives removes the archive segments of which all blocks have settled billing.
+func (c *Chain) dropSettledArchives() (dropped []string, err error) {
+	c.settlementLock.Lock()
+	var settled = c.settledHeight
+	c.settlementLock.Unlock()
+
+	var (
+		it       = c.bdb.NewIterator(util.BytesPrefix(metaArchiveIndex[:]), nil)
+		segments = make(map[string][][]byte)
+		unsettle = make(map[string]bool)
+		order    []string
+	)
+	for it.Next() {
+		var (
+			k     = it.Key()
+			entry = &archiveEntry{}
+		)
+		if err = utils.DecodeMsgPack(it.Value(), entry); err != nil {
+			it.Release()
+			err = errors.Wrapf(err, "decode archive entry at height %d", keyWithSymbolToHeight(k))
+			return
+		}
+		if entry.Segment == "" {
+			continue
+		}
+		if _, ok := segments[entry.Segment]; !ok {
+			order = append(order, entry.Segment)
+		}
+		segments[entry.Segment] = append(segments[entry.Segment], append([]byte(nil), k...))
+		if keyWithSymbolToHeight(k) > settled {
+			unsettle[entry.Segment] = true
+		}
+	}
+	it.Release()
+	if err = it.Error(); err != nil {
+		err = errors.Wrap(err, "iterate archive entries")
+		return
+	}
+
+	c.archiveLock.Lock()
+	defer c.archiveLock.Unlock()
+	for _, name := range order {
+		if unsettle[name] {
+			continue
+		}
+		var batch = new(leveldb.Batch)
+		for _, k := range segments[name] {
+			var (
+				v     []byte
+				enc   *bytes.Buffer
+				entry = &archiveEntry{}
+			)
+			if v, err = c.bdb.Get(k, nil); err != nil {
+				return
+			}
+			if err = utils.DecodeMsgPack(v, entry); err != nil {
+				return
+			}
+			entry.Segment, entry.Offset, entry.Length = "", 0, 0
+			if enc, err = utils.EncodeMsgPack(entry); err != nil {
+				return
+			}
+			batch.Put(k, enc.Bytes())
+		}
+		if err = c.bdb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+			err = errors.Wrapf(err, "drop archive segment %s", name)
+			return
+		}
+		if err = os.Remove(filepath.Join(c.rt.archiveDir, name)); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapf(err, "remove archive segment %s", name)
+			return
+		}
+		err = nil
+		dropped = append(dropped, name)
+	}
+	if len(dropped) > 0 {
+		log.WithFields(log.Fields{
+			"segments": dropped,
+			"settled":  settled,
+			"db":       c.databaseID,
+		}).Info("dropped settled archive segments")
+	}
+	return
+}
+
+func (c *Chain) archiveCycle(ctx context.Context) {
+	var ticker = time.NewTicker(c.rt.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := c.archiveBlocks(); err != nil {
+				log.WithField("db", c.databaseID).WithError(err).Error("archive blocks failed")
+			}
+			if c.rt.dropSettledArchives {
+				c.settleBilling()
+				if _, err := c.dropSettledArchives(); err != nil {
+					log.WithField("db", c.databaseID).WithError(err).Error(
+						"drop settled archives failed")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestArchiveBlocks(t *testing.T) {
+	Convey("Given a chain with some old blocks", t, func() {
+		var (
+			prefix = path.Join(testDataDir, t.Name())
+			blocks []*types.Block
+			nodes  []*blockNode
+			parent hash.Hash
+			err    error
+		)
+		archiveSegmentBlocks = 4
+		defer func() { archiveSegmentBlocks = 64 }()
+
+		bdb, err := leveldb.OpenFile(prefix+"-block-state.ldb", &leveldbConf)
+		So(err, ShouldBeNil)
+		var c = &Chain{bdb: bdb, bi: newBlockIndex(), rt: &runtime{
+			archiveTTL: 2,
+			archiveDir: archiveDir(prefix),
+		}}
+		for h := int32(0); h <= 12; h++ {
+			var b *types.Block
+			b, err = createRandomBlock(parent, h == 0)
+			So(err, ShouldBeNil)
+			enc, err := utils.EncodeMsgPack(b)
+			So(err, ShouldBeNil)
+			var node = newBlockNode(h, b, func() *blockNode {
+				if h > 0 {
+					return nodes[h-1]
+				}
+				return nil
+			}())
+			err = bdb.Put(utils.ConcatAll(metaBlockIndex[:], node.indexKey()), enc.Bytes(), nil)
+			So(err, ShouldBeNil)
+			c.bi.addBlock(node)
+			blocks, nodes, parent = append(blocks, b), append(nodes, node), *b.BlockHash()
+		}
+		var st = &state{node: nodes[12], Head: nodes[12].hash, Height: 12}
+		c.rt.setHead(st)
+		enc, err := utils.EncodeMsgPack(st)
+		So(err, ShouldBeNil)
+		err = bdb.Put(metaState[:], enc.Bytes(), nil)
+		So(err, ShouldBeNil)
+
+		Convey("The blocks should be archived in full segments", func() {
+			archived, err := c.archiveBlocks()
+			So(err, ShouldBeNil)
+			So(archived, ShouldEqual, 8)
+			files, err := ioutil.ReadDir(c.rt.archiveDir)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 2)
+			So(files[0].Name(), ShouldEqual, "0000000001-0000000004"+archiveSegmentSuffix)
+			// no more full segments
+			archived, err = c.archiveBlocks()
+			So(err, ShouldBeNil)
+			So(archived, ShouldEqual, 0)
+
+			for _, h := range []int32{0, 3, 8, 9, 12} {
+				b, err := c.FetchBlock(h)
+				So(err, ShouldBeNil)
+				So(b, ShouldNotBeNil)
+				So(b.BlockHash(), ShouldResemble, blocks[h].BlockHash())
+			}
+
+			Convey("The block index should be rebuilt from the archive entries", func() {
+				var cc = &Chain{bdb: bdb, bi: newBlockIndex(), rt: c.rt}
+				cc.bi.addBlock(&blockNode{hash: nodes[0].hash})
+				last, _, err := cc.loadArchivedNodes()
+				So(err, ShouldBeNil)
+				So(last, ShouldNotBeNil)
+				So(last.hash, ShouldResemble, nodes[8].hash)
+				So(last.height, ShouldEqual, 8)
+				So(last.count, ShouldEqual, 8)
+				So(last.parent.hash, ShouldResemble, nodes[7].hash)
+			})
+			Convey("The settled segments should be dropped", func() {
+				c.settledHeight = 6
+				dropped, err := c.dropSettledArchives()
+				So(err, ShouldBeNil)
+				So(dropped, ShouldResemble, []string{"0000000001-0000000004" + archiveSegmentSuffix})
+				b, err := c.FetchBlock(3)
+				So(errors.Cause(err), ShouldEqual, ErrBlockArchived)
+				So(b, ShouldBeNil)
+				b, err = c.FetchBlock(6)
+				So(err, ShouldBeNil)
+				So(b, ShouldNotBeNil)
+				dropped, err = c.dropSettledArchives()
+				So(err, ShouldBeNil)
+				So(dropped, ShouldBeEmpty)
+			})
+			Convey("The settlement should be restored from the chain metadata", func() {
+				c.trackBilling(hash.Hash{0x1}, 4)
+				c.trackBilling(hash.Hash{0x2}, 8)
+				c.settlementLock.Lock()
+				c.settledHeight = 4
+				c.billingTxs = c.billingTxs[1:]
+				err = c.saveSettlement()
+				c.settlementLock.Unlock()
+				So(err, ShouldBeNil)
+
+				var cc = &Chain{bdb: bdb, bi: newBlockIndex(), rt: c.rt}
+				err = cc.loadSettlement()
+				So(err, ShouldBeNil)
+				So(cc.settledHeight, ShouldEqual, 4)
+				So(cc.billingTxs, ShouldResemble, []*billingTx{{Hash: hash.Hash{0x2}, Height: 8}})
+			})
+			Convey("The archived blocks should be linked in inspection", func() {
+				err = bdb.Close()
+				So(err, ShouldBeNil)
+				report, err := InspectBlockStore(prefix, nil)
+				So(err, ShouldBeNil)
+				So(report.Count, ShouldEqual, 5)
+				So(report.Archived, ShouldEqual, 8)
+				So(report.Unlinked, ShouldBeEmpty)
+				So(report.Corrupted, ShouldBeEmpty)
+			})
+		})
+
+		Reset(func() {
+			bdb.Close()
+			os.RemoveAll(prefix + "-block-state.ldb")
+			os.RemoveAll(archiveDir(prefix))
+		})
+	})
+}
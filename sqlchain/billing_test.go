@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBillingPreview(t *testing.T) {
+	Convey("Given a chain with a query transaction in each block", t, func() {
+		cli, err := newRandomNode()
+		So(err, ShouldBeNil)
+		miner, err := newRandomNode()
+		So(err, ShouldBeNil)
+		userAddr, err := crypto.PubKeyHash(cli.PublicKey)
+		So(err, ShouldBeNil)
+		minerAddr, err := crypto.PubKeyHash(miner.PublicKey)
+		So(err, ShouldBeNil)
+
+		var (
+			c = &Chain{
+				databaseID:   testDatabaseID,
+				updatePeriod: 3,
+				rt:           &runtime{peers: &proto.Peers{}},
+			}
+			nodes  []*blockNode
+			parent hash.Hash
+		)
+		for h := int32(0); h <= 5; h++ {
+			b, err := createRandomBlock(parent, false)
+			So(err, ShouldBeNil)
+			if h > 0 {
+				resp, err := createRandomQueryResponse(cli, miner)
+				So(err, ShouldBeNil)
+				b.QueryTxs = []*types.QueryAsTx{{
+					Request:  &types.Request{Header: resp.Request},
+					Response: resp,
+				}}
+			}
+			var node = newBlockNode(h, b, func() *blockNode {
+				if h > 0 {
+					return nodes[h-1]
+				}
+				return nil
+			}())
+			nodes, parent = append(nodes, node), *b.BlockHash()
+		}
+
+		Convey("The pending blocks after the last billing should be previewed", func() {
+			c.rt.setHead(&state{node: nodes[5], Head: nodes[5].hash, Height: 5})
+			header, start, end, err := c.BillingPreview()
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 4)
+			So(end, ShouldEqual, 5)
+			So(header, ShouldNotBeNil)
+			So(header.Users, ShouldHaveLength, 1)
+			So(header.Users[0].User, ShouldEqual, userAddr)
+			So(header.Users[0].Cost, ShouldEqual, 2)
+			So(header.Users[0].Miners, ShouldHaveLength, 1)
+			So(header.Users[0].Miners[0].Miner, ShouldEqual, minerAddr)
+			So(header.Users[0].Miners[0].Income, ShouldEqual, 2)
+
+			receiver, err := testDatabaseID.AccountAddress()
+			So(err, ShouldBeNil)
+			So(header.Receiver, ShouldEqual, receiver)
+		})
+		Convey("Nothing should be previewed right after a billing", func() {
+			c.rt.setHead(&state{node: nodes[3], Head: nodes[3].hash, Height: 3})
+			header, _, _, err := c.BillingPreview()
+			So(err, ShouldBeNil)
+			So(header, ShouldBeNil)
+
+			ub, err := c.billing(nodes[3])
+			So(err, ShouldBeNil)
+			So(ub.Users, ShouldHaveLength, 1)
+			So(ub.Users[0].Cost, ShouldEqual, 3)
+		})
+		Convey("The queries signed before a key rotation should still be billed", func() {
+			// The user account is rotated to a new key, of which the original key is still
+			// resolved for billing, and any other key is unresolvable
+			c.resolveAccount = func(signee *asymmetric.PublicKey) (proto.AccountAddress, error) {
+				if signee.IsEqual(cli.PublicKey) {
+					return userAddr, nil
+				}
+				if signee.IsEqual(miner.PublicKey) {
+					return minerAddr, nil
+				}
+				return proto.AccountAddress{}, errors.New("unresolvable key")
+			}
+			ub, err := c.billing(nodes[3])
+			So(err, ShouldBeNil)
+			So(ub.Users, ShouldHaveLength, 1)
+			So(ub.Users[0].User, ShouldEqual, userAddr)
+			So(ub.Users[0].Cost, ShouldEqual, 3)
+
+			// The queries of an unresolvable signee are skipped instead of failing the billing
+			other, err := newRandomNode()
+			So(err, ShouldBeNil)
+			resp, err := createRandomQueryResponse(other, miner)
+			So(err, ShouldBeNil)
+			nodes[2].block.QueryTxs = append(nodes[2].block.QueryTxs, &types.QueryAsTx{
+				Request:  &types.Request{Header: resp.Request},
+				Response: resp,
+			})
+			ub, err = c.billing(nodes[3])
+			So(err, ShouldBeNil)
+			So(ub.Users, ShouldHaveLength, 1)
+			So(ub.Users[0].User, ShouldEqual, userAddr)
+			So(ub.Users[0].Cost, ShouldEqual, 3)
+		})
+	})
+}
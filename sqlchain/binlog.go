@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+)
+
+/*
+Binlog advising streams the committed write logs of the leader peer between block boundaries:
+
+	1. The leader collects the responded write logs from its local state every BinLogInterval,
+	   starting from the log offset next to the last advised one.
+	2. In eventual consistency mode, the logs are advised to the other peers, which replay them
+	   on their local states. Peers in strong consistency mode have already got the writes from
+	   kayak, thus the logs are not advised to them.
+	3. The logs are always advised to the subscribed observers.
+
+Advising is a best effort: a peer missing some logs will report query conflicts on the following
+ones and just skip them, until it catches up by replaying the next block.
+*/
+
+// nextBinLog returns the write logs to advise since the last call.
+func (c *Chain) nextBinLog() (logs []*types.QueryAsTx) {
+	if logs = c.st.WriteLogs(c.binlogOffset); len(logs) > 0 {
+		c.binlogOffset = logs[len(logs)-1].Response.LogOffset + 1
+	}
+	return
+}
+
+func (c *Chain) observerList() (nodes []proto.NodeID) {
+	c.observerLock.Lock()
+	defer c.observerLock.Unlock()
+	nodes = make([]proto.NodeID, 0, len(c.observers))
+	for k := range c.observers {
+		nodes = append(nodes, k)
+	}
+	return
+}
+
+func (c *Chain) adviseBinLog(ctx context.Context) {
+	var peers = c.rt.getPeers()
+	if peers.Leader != c.rt.getServer() {
+		return
+	}
+	var logs = c.nextBinLog()
+	if len(logs) == 0 {
+		return
+	}
+	var (
+		req = &MuxAdviseBinLogReq{
+			Envelope: proto.Envelope{
+				// TODO(leventeliu): Add fields.
+			},
+			DatabaseID:      c.databaseID,
+			AdviseBinLogReq: AdviseBinLogReq{Logs: logs},
+		}
+		wg     = &sync.WaitGroup{}
+		advise = func(id proto.NodeID, method string) {
+			defer wg.Done()
+			resp := &MuxAdviseBinLogResp{}
+			if err := c.cl.CallNodeWithContext(ctx, id, method, req, resp); err != nil {
+				log.WithFields(log.Fields{
+					"peer":   c.rt.getPeerInfoString(),
+					"target": id,
+					"method": method,
+					"from":   logs[0].Response.LogOffset,
+					"count":  len(logs),
+					"db":     c.databaseID,
+				}).WithError(err).Warning("failed to advise binlog")
+			}
+		}
+	)
+	if c.rt.eventualConsistency {
+		for _, s := range peers.Servers {
+			if s != c.rt.getServer() {
+				wg.Add(1)
+				go advise(s, route.SQLCAdviseBinLog.String())
+			}
+		}
+	}
+	for _, v := range c.observerList() {
+		wg.Add(1)
+		go advise(v, route.OBSAdviseBinLog.String())
+	}
+	wg.Wait()
+}
+
+func (c *Chain) binlogCycle(ctx context.Context) {
+	var ticker = time.NewTicker(c.rt.binlogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.adviseBinLog(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func verifyBinLog(leader proto.NodeID, q *types.QueryAsTx) (err error) {
+	if q.Request == nil || q.Response == nil {
+		return errors.Wrap(ErrInvalidBinLog, "incomplete write log")
+	}
+	if q.Request.Header.QueryType != types.WriteQuery {
+		return errors.Wrapf(ErrInvalidBinLog, "unexpected query type %s", q.Request.Header.QueryType)
+	}
+	if q.Response.NodeID != leader {
+		return errors.Wrapf(ErrInvalidBinLog, "unexpected log producer %s", q.Response.NodeID)
+	}
+	if q.Response.Request.Hash() != q.Request.Header.Hash() {
+		return errors.Wrap(ErrInvalidBinLog, "response doesn't match request")
+	}
+	if err = q.Request.Verify(); err != nil {
+		return
+	}
+	return q.Response.Verify()
+}
+
+// applyBinLog replays the write logs advised by the leader peer on the local state.
+func (c *Chain) applyBinLog(logs []*types.QueryAsTx) (err error) {
+	if !c.rt.eventualConsistency {
+		// Writes are replicated by kayak in strong consistency mode
+		return
+	}
+	var leader = c.rt.getPeers().Leader
+	if leader == c.rt.getServer() {
+		return
+	}
+	for i, v := range logs {
+		if err = verifyBinLog(leader, v); err != nil {
+			err = errors.Wrapf(err, "verify log #%d", i)
+			return
+		}
+		if err = c.st.ReplayWithContext(
+			c.rt.ctx, v.Request, &types.Response{Header: *v.Response},
+		); err != nil {
+			if errors.Cause(err) == x.ErrQueryConflict {
+				// Already replayed or some preceding logs are missing, which will be caught up
+				// by replaying blocks
+				log.WithFields(log.Fields{
+					"peer":       c.rt.getPeerInfoString(),
+					"log_offset": v.Response.LogOffset,
+					"db":         c.databaseID,
+				}).WithError(err).Debug("skip conflicted binlog")
+				err = nil
+				continue
+			}
+			err = errors.Wrapf(err, "replay log #%d", i)
+			return
+		}
+	}
+	return
+}
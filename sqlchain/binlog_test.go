@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBinLog(t *testing.T) {
+	Convey("Given a leader chain and a follower chain", t, func() {
+		cli, err := newRandomNode()
+		So(err, ShouldBeNil)
+		leader, err := newRandomNode()
+		So(err, ShouldBeNil)
+		follower, err := newRandomNode()
+		So(err, ShouldBeNil)
+
+		var (
+			peers = &proto.Peers{PeersHeader: proto.PeersHeader{
+				Leader:  leader.NodeID,
+				Servers: []proto.NodeID{leader.NodeID, follower.NodeID},
+			}}
+			newSt = func(node *nodeProfile) (st *x.State) {
+				var fl = path.Join(testDataDir, t.Name()+string(node.NodeID[:8])+".db")
+				strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+				So(err, ShouldBeNil)
+				st, err = x.NewState(node.NodeID, strg)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					st.Close(false)
+					for _, v := range []string{"", "-shm", "-wal"} {
+						os.Remove(fl + v)
+					}
+				})
+				return
+			}
+			c1 = &Chain{st: newSt(leader), rt: &runtime{
+				ctx: context.Background(), peers: peers, server: leader.NodeID,
+			}}
+			c2 = &Chain{st: newSt(follower), rt: &runtime{
+				ctx: context.Background(), peers: peers, server: follower.NodeID,
+				eventualConsistency: true,
+			}}
+			write = func(pattern string) {
+				var req = &types.Request{
+					Header: types.SignedRequestHeader{RequestHeader: types.RequestHeader{
+						QueryType: types.WriteQuery,
+						NodeID:    cli.NodeID,
+						Timestamp: time.Now().UTC(),
+					}},
+					Payload: types.RequestPayload{Queries: []types.Query{{Pattern: pattern}}},
+				}
+				So(req.Sign(cli.PrivateKey), ShouldBeNil)
+				tracker, resp, err := c1.st.Query(req)
+				So(err, ShouldBeNil)
+				So(resp.Sign(leader.PrivateKey), ShouldBeNil)
+				tracker.UpdateResp(resp)
+			}
+		)
+
+		write(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`)
+		write(`INSERT INTO t1 VALUES (1, 'v1')`)
+		var logs = c1.nextBinLog()
+		So(logs, ShouldHaveLength, 2)
+		So(c1.nextBinLog(), ShouldBeEmpty)
+		write(`INSERT INTO t1 VALUES (2, 'v2')`)
+		var next = c1.nextBinLog()
+		So(next, ShouldHaveLength, 1)
+		So(next[0].Response.LogOffset, ShouldEqual, 2)
+
+		Convey("The follower should replay the logs in eventual consistency mode", func() {
+			err = c2.applyBinLog(logs)
+			So(err, ShouldBeNil)
+			So(c2.st.WriteLogs(0), ShouldHaveLength, 2)
+			// already replayed logs are skipped
+			err = c2.applyBinLog(append(logs, next...))
+			So(err, ShouldBeNil)
+			So(c2.st.WriteLogs(0), ShouldHaveLength, 3)
+		})
+		Convey("The follower should ignore the logs in strong consistency mode", func() {
+			c2.rt.eventualConsistency = false
+			err = c2.applyBinLog(logs)
+			So(err, ShouldBeNil)
+			So(c2.st.WriteLogs(0), ShouldBeEmpty)
+		})
+		Convey("The follower should reject the logs not produced by the leader", func() {
+			c2.rt.peers = &proto.Peers{PeersHeader: proto.PeersHeader{
+				Leader:  follower.NodeID,
+				Servers: peers.Servers,
+			}}
+			c1.rt.peers = &proto.Peers{PeersHeader: proto.PeersHeader{
+				Leader:  cli.NodeID,
+				Servers: peers.Servers,
+			}}
+			err = c2.applyBinLog(logs)
+			So(err, ShouldBeNil)
+			c2.rt.peers = c1.rt.peers
+			err = c2.applyBinLog(logs)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBinLog)
+		})
+		Convey("The follower should reject the tampered logs", func() {
+			logs[0].Request.Payload.Queries[0].Pattern = `DROP TABLE t1`
+			err = c2.applyBinLog(logs)
+			So(err, ShouldNotBeNil)
+			So(c2.st.WriteLogs(0), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// catchUp fetches the blocks after the current head and pushes them to the chain, until the
+// height of the current time is reached. It is done by a miner replacing a drained one before it
+// starts serving the database, so that the database state is rebuilt from the blocks of the
+// other miners. Every block must extend the head and be produced by a peer, and it is replayed
+// into the chain state in the same way as a new block advised by the producer.
+func (c *Chain) catchUp(fetch func(height int32) (*types.Block, error)) (err error) {
+	var (
+		head   = c.rt.getHead()
+		pushed int
+		le     = log.WithFields(log.Fields{
+			"db":   c.databaseID,
+			"from": head.Height,
+		})
+	)
+	le.Info("catching up database from peers")
+	for h := head.Height + 1; h <= c.rt.getHeightFromTime(c.rt.now()); h++ {
+		var b *types.Block
+		if b, err = fetch(h); err != nil {
+			return errors.Wrapf(err, "fetch block at height %d", h)
+		}
+		if b == nil {
+			continue
+		}
+		if head = c.rt.getHead(); !b.ParentHash().IsEqual(&head.Head) {
+			return errors.Wrapf(ErrInvalidBlock,
+				"block %s at height %d doesn't extend head %s",
+				b.BlockHash().String(), h, head.Head.String())
+		}
+		if err = b.Verify(); err != nil {
+			return errors.Wrapf(err, "verify block at height %d", h)
+		}
+		if _, found := c.rt.getPeers().Find(b.Producer()); !found {
+			return errors.Wrapf(ErrUnknownProducer, "block at height %d", h)
+		}
+		if err = c.replayBlock(b); err != nil {
+			return errors.Wrapf(err, "replay block at height %d", h)
+		}
+		if err = c.pushBlock(b); err != nil {
+			return errors.Wrapf(err, "push block at height %d", h)
+		}
+		pushed++
+	}
+	le.WithFields(log.Fields{
+		"to":     c.rt.getHead().Height,
+		"blocks": pushed,
+	}).Info("database caught up")
+	return
+}
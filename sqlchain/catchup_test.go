@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestCatchUp(t *testing.T) {
+	Convey("Given a replacement chain and the blocks of the other miner", t, func() {
+		cli, err := newRandomNode()
+		So(err, ShouldBeNil)
+		miner, err := newRandomNode()
+		So(err, ShouldBeNil)
+		replacement, err := newRandomNode()
+		So(err, ShouldBeNil)
+		stranger, err := newRandomNode()
+		So(err, ShouldBeNil)
+
+		var (
+			prefix = path.Join(testDataDir, t.Name())
+			newSt  = func(node *nodeProfile) (st *x.State) {
+				var fl = path.Join(testDataDir, t.Name()+string(node.NodeID[:8])+".db")
+				strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+				So(err, ShouldBeNil)
+				st, err = x.NewState(node.NodeID, strg)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					st.Close(false)
+					for _, v := range []string{"", "-shm", "-wal"} {
+						os.Remove(fl + v)
+					}
+				})
+				return
+			}
+			src = newSt(miner)
+
+			newReq = func(qt types.QueryType, pattern string) *types.Request {
+				var req = &types.Request{
+					Header: types.SignedRequestHeader{RequestHeader: types.RequestHeader{
+						QueryType: qt,
+						NodeID:    cli.NodeID,
+						Timestamp: time.Now().UTC(),
+					}},
+					Payload: types.RequestPayload{Queries: []types.Query{{Pattern: pattern}}},
+				}
+				So(req.Sign(cli.PrivateKey), ShouldBeNil)
+				return req
+			}
+			write = func(pattern string) *types.QueryAsTx {
+				var req = newReq(types.WriteQuery, pattern)
+				tracker, resp, err := src.Query(req)
+				So(err, ShouldBeNil)
+				So(resp.Sign(miner.PrivateKey), ShouldBeNil)
+				tracker.UpdateResp(resp)
+				return &types.QueryAsTx{Request: req, Response: &resp.Header}
+			}
+			t0     = time.Now().UTC().Add(-10 * time.Second)
+			newBlk = func(
+				producer *nodeProfile, h int32, parent hash.Hash, qs ...*types.QueryAsTx,
+			) *types.Block {
+				var b = &types.Block{
+					SignedHeader: types.SignedHeader{Header: types.Header{
+						Version:    0x01000000,
+						Producer:   producer.NodeID,
+						ParentHash: parent,
+						Timestamp:  t0.Add(time.Duration(h) * time.Second),
+					}},
+					QueryTxs: qs,
+				}
+				So(b.PackAndSignBlock(producer.PrivateKey), ShouldBeNil)
+				return b
+			}
+
+			// no block is produced at height 2
+			b0 = newBlk(miner, 0, hash.Hash{})
+			b1 = newBlk(miner, 1, *b0.BlockHash(),
+				write(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				write(`INSERT INTO t1 VALUES (1, 'v1')`))
+			b3 = newBlk(miner, 3, *b1.BlockHash(), write(`INSERT INTO t1 VALUES (2, 'v2')`))
+
+			blocks = map[int32]*types.Block{0: b0, 1: b1, 3: b3}
+			fetch  = func(h int32) (*types.Block, error) { return blocks[h], nil }
+		)
+
+		bdb, err := leveldb.OpenFile(prefix+"-block-state.ldb", &leveldbConf)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			bdb.Close()
+			os.RemoveAll(prefix + "-block-state.ldb")
+		})
+		var c = &Chain{
+			bdb: bdb,
+			bi:  newBlockIndex(),
+			ai:  newAckIndex(),
+			st:  newSt(replacement),
+			rt: &runtime{
+				ctx:    context.Background(),
+				period: time.Second,
+				server: replacement.NodeID,
+				peers: &proto.Peers{PeersHeader: proto.PeersHeader{
+					Leader:  miner.NodeID,
+					Servers: []proto.NodeID{miner.NodeID, replacement.NodeID},
+				}},
+			},
+		}
+		c.rt.setGenesis(b0)
+		So(c.pushBlock(b0), ShouldBeNil)
+
+		Convey("The chain should catch up the blocks and the database state", func() {
+			So(c.catchUp(fetch), ShouldBeNil)
+			So(c.rt.getHead().Height, ShouldEqual, 3)
+			So(c.rt.getHead().Head, ShouldResemble, *b3.BlockHash())
+			_, resp, err := c.st.Query(newReq(types.ReadQuery, `SELECT v FROM t1`))
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 2)
+		})
+		Convey("The replay should challenge the storage even if the block has no storage proof", func() {
+			var (
+				req = &x.ProofRequest{Seed: *b0.BlockHash(), Prover: miner.NodeID}
+				st  = newSt(stranger)
+			)
+			_, err := st.ReplayBlockWithProof(context.Background(), b1, req)
+			So(err, ShouldBeNil)
+			_, _, proof, err := st.CommitExWithProof(context.Background(), req)
+			So(err, ShouldBeNil)
+			var newProved = func(storageProof hash.Hash) *types.Block {
+				var b = &types.Block{
+					SignedHeader: types.SignedHeader{Header: types.Header{
+						Version:      0x01000000,
+						Producer:     miner.NodeID,
+						ParentHash:   *b0.BlockHash(),
+						Timestamp:    b1.Timestamp(),
+						StateSeq:     proof.Seq,
+						StateRoot:    proof.Root,
+						StorageProof: storageProof,
+					}},
+					QueryTxs: b1.QueryTxs,
+				}
+				So(b.PackAndSignBlock(miner.PrivateKey), ShouldBeNil)
+				return b
+			}
+			So(proof.StorageProof, ShouldNotResemble, hash.Hash{})
+
+			Convey("A missing storage proof should be reported as a proof failure", func() {
+				var b = newProved(hash.Hash{})
+				So(c.replayBlock(b), ShouldBeNil)
+				failures := c.takeProofFailures()
+				So(failures, ShouldHaveLength, 1)
+				So(failures[0].Producer, ShouldEqual, miner.NodeID)
+				So(failures[0].Block, ShouldResemble, *b.BlockHash())
+			})
+			Convey("A valid storage proof should pass the challenge", func() {
+				So(c.replayBlock(newProved(proof.StorageProof)), ShouldBeNil)
+				So(c.takeProofFailures(), ShouldBeEmpty)
+			})
+		})
+		Convey("The snapshot should be served to the database peers only", func() {
+			var (
+				mux   = &MuxService{}
+				fetch = func(node proto.NodeID) (*MuxFetchSnapshotResp, error) {
+					var (
+						req  = &MuxFetchSnapshotReq{DatabaseID: c.databaseID}
+						resp = &MuxFetchSnapshotResp{}
+					)
+					req.Envelope.NodeID = node.ToRawNodeID()
+					return resp, mux.FetchSnapshot(req, resp)
+				}
+			)
+			mux.register(c.databaseID, &ChainRPCService{chain: c})
+			resp, err := fetch(miner.NodeID)
+			So(err, ShouldBeNil)
+			So(resp.Snapshot, ShouldNotBeNil)
+			resp, err = fetch(stranger.NodeID)
+			So(errors.Cause(err), ShouldEqual, ErrNotPeer)
+			So(resp.Snapshot, ShouldBeNil)
+			// the caller cannot be claimed in the request payload
+			var req = &MuxFetchSnapshotReq{
+				DatabaseID:       c.databaseID,
+				FetchSnapshotReq: FetchSnapshotReq{node: miner.NodeID},
+			}
+			err = mux.FetchSnapshot(req, &MuxFetchSnapshotResp{})
+			So(errors.Cause(err), ShouldEqual, ErrNotPeer)
+		})
+		Convey("The catching up should fail if any block is missing", func() {
+			delete(blocks, 1)
+			err = c.catchUp(fetch)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlock)
+			So(c.rt.getHead().Height, ShouldEqual, 0)
+		})
+		Convey("The catching up should fail on the block of an unknown producer", func() {
+			blocks[1] = newBlk(stranger, 1, *b0.BlockHash())
+			err = c.catchUp(fetch)
+			So(errors.Cause(err), ShouldEqual, ErrUnknownProducer)
+			So(c.rt.getHead().Height, ShouldEqual, 0)
+		})
+		Convey("The catching up should fail if the blocks cannot be fetched", func() {
+			err = c.catchUp(func(int32) (*types.Block, error) { return nil, ErrBlockNotFound })
+			So(errors.Cause(err), ShouldEqual, ErrBlockNotFound)
+		})
+	})
+}
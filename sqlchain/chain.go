@@ -23,13 +23,16 @@ import (
 	"fmt"
 	"os"
 	rt "runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
@@ -54,6 +57,8 @@ var (
 	metaBlockIndex    = [4]byte{'B', 'L', 'C', 'K'}
 	metaResponseIndex = [4]byte{'R', 'E', 'S', 'P'}
 	metaAckIndex      = [4]byte{'Q', 'A', 'C', 'K'}
+	metaArchiveIndex  = [4]byte{'A', 'R', 'C', 'H'}
+	metaSettlement    = [4]byte{'S', 'E', 'T', 'L'}
 	leveldbConf       = opt.Options{}
 
 	// Atomic counters for stats
@@ -87,6 +92,8 @@ func heightToKey(h int32) (key []byte) {
 // ['R', 'E', 'Q', 'U', height, hash]
 // block key:
 // ['B', 'L', 'C', 'K', height, hash]
+// archived block key:
+// ['A', 'R', 'C', 'H', height, hash]
 func keyWithSymbolToHeight(k []byte) int32 {
 	if len(k) < 8 {
 		return -1
@@ -117,6 +124,11 @@ type Chain struct {
 	tokenType    types.TokenType
 	gasPrice     uint64
 	updatePeriod uint64
+	// resolveAccount returns the account of a signee key for billing, which is nil for the key
+	// address.
+	resolveAccount func(*asymmetric.PublicKey) (proto.AccountAddress, error)
+	// syncPeers are the peers to catch up the blocks from on start.
+	syncPeers []proto.NodeID
 
 	// observerLock defines the lock of observer update operations.
 	observerLock sync.Mutex
@@ -127,6 +139,31 @@ type Chain struct {
 	// replCh defines the replication trigger channel for replication check.
 	replCh chan struct{}
 
+	// proofFailuresLock defines the lock of pending storage proof failures.
+	proofFailuresLock sync.Mutex
+	// proofFailures defines the storage proof failures to report in the next local block.
+	proofFailures []*types.ProofFailure
+
+	// noAcksLock defines the lock of the following no-ack report fields.
+	noAcksLock sync.Mutex
+	// noAcks defines the no-ack reports to include in the next local block.
+	noAcks []*types.SignedNoAckReportHeader
+	// noAckCounts counts the no-ack reports of each client in the current billing period.
+	noAckCounts map[proto.NodeID]int32
+
+	// binlogOffset is the log offset of the next write log to advise, which is only accessed in
+	// the binlog cycle.
+	binlogOffset uint64
+
+	// archiveLock protects the archive segments from dropping while reading.
+	archiveLock sync.RWMutex
+	// settlementLock protects the following billing settlement fields.
+	settlementLock sync.Mutex
+	// billingTxs are the billing transactions sent to the main chain and not settled yet.
+	billingTxs []*billingTx
+	// settledHeight is the highest block height of which the billing is confirmed.
+	settledHeight int32
+
 	// Cached fileds, may need to renew some of this fields later.
 	//
 	// pk is the private key of the local miner.
@@ -146,7 +183,7 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 	// force rebuilding.
 	var fi os.FileInfo
 	if fi, err = os.Stat(c.ChainFilePrefix + "-block-state.ldb"); err == nil && fi.Mode().IsDir() {
-		return LoadChain(c)
+		return LoadChainWithContext(ctx, c)
 	}
 
 	err = c.Genesis.VerifyAsGenesis()
@@ -220,6 +257,9 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		updatePeriod: c.UpdatePeriod,
 		databaseID:   c.DatabaseID,
 
+		resolveAccount: c.ResolveAccount,
+		syncPeers:      c.SyncPeers,
+
 		// Observer related
 		observers:           make(map[proto.NodeID]int32),
 		observerReplicators: make(map[proto.NodeID]*observerReplicator),
@@ -229,6 +269,20 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 		addr: &addr,
 	}
 
+	if l := c.Genesis.Lineage(); l.IsForked() {
+		if err = chain.seed(l, func(h int32) (*types.Block, error) {
+			return chain.fetchSourceBlock(l.Source, h, c.SourcePeers)
+		}); err != nil {
+			// Remove the chain files, so that the database will be seeded again on next creation
+			chain.bdb.Close()
+			chain.tdb.Close()
+			chain.st.Close(false)
+			os.RemoveAll(bdbFile)
+			os.RemoveAll(tdbFile)
+			return nil, err
+		}
+	}
+
 	if err = chain.pushBlock(c.Genesis); err != nil {
 		return nil, err
 	}
@@ -306,6 +360,9 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		updatePeriod: c.UpdatePeriod,
 		databaseID:   c.DatabaseID,
 
+		resolveAccount: c.ResolveAccount,
+		syncPeers:      c.SyncPeers,
+
 		// Observer related
 		observers:           make(map[proto.NodeID]int32),
 		observerReplicators: make(map[proto.NodeID]*observerReplicator),
@@ -388,12 +445,35 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 		current.initBlockNode(chain.rt.getHeightFromTime(block.Timestamp()), block, parent)
 		chain.bi.addBlock(current)
 		last = current
+
+		if index == 0 {
+			// Rebuild index of the archived blocks, which are all between the genesis block and
+			// the remaining blocks
+			var (
+				archived *blockNode
+				aid      uint64
+			)
+			if archived, aid, err = chain.loadArchivedNodes(); err != nil {
+				return
+			}
+			if archived != nil {
+				last = archived
+			}
+			if aid > id {
+				id = aid
+			}
+		}
 	}
 	if err = blockIter.Error(); err != nil {
 		err = errors.Wrap(err, "load block")
 		return
 	}
 
+	// Restore billing settlement of the archived blocks
+	if err = chain.loadSettlement(); err != nil {
+		return
+	}
+
 	// Set chain state
 	st.node = last
 	chain.rt.setHead(st)
@@ -566,10 +646,14 @@ func (c *Chain) pushAckedQuery(ack *types.SignedAckHeader) (err error) {
 // produceBlock prepares, signs and advises the pending block to the other peers.
 func (c *Chain) produceBlock(now time.Time) (err error) {
 	var (
-		frs []*types.Request
-		qts []*x.QueryTracker
+		frs   []*types.Request
+		qts   []*x.QueryTracker
+		proof *x.StateProof
 	)
-	if frs, qts, err = c.st.CommitEx(); err != nil {
+	if frs, qts, proof, err = c.st.CommitExWithProof(c.rt.ctx, &x.ProofRequest{
+		Seed:   c.rt.getHead().Head,
+		Prover: c.rt.getServer(),
+	}); err != nil {
 		return
 	}
 	var block = &types.Block{
@@ -580,7 +664,12 @@ func (c *Chain) produceBlock(now time.Time) (err error) {
 				GenesisHash: c.rt.genesisHash,
 				ParentHash:  c.rt.getHead().Head,
 				// MerkleRoot: will be set by BPBlock.PackAndSignBlock(PrivateKey)
-				Timestamp: now,
+				StateRoot:     proof.Root,
+				StateSeq:      proof.Seq,
+				StorageProof:  proof.StorageProof,
+				ProofFailures: c.takeProofFailures(),
+				NoAckReports:  c.takeNoAckReports(),
+				Timestamp:     now,
 			},
 		},
 		FailedReqs: frs,
@@ -749,7 +838,7 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 		c.stat()
 		c.pruneBlockCache()
 		c.rt.setNextTurn()
-		c.ai.advance(c.rt.getMinValidHeight())
+		c.reportNoAcks(c.ai.advance(c.rt.getMinValidHeight()))
 		// Info the block processing goroutine that the chain height has grown, so please return
 		// any stashed blocks for further check.
 		c.heights <- c.rt.getHead().Height
@@ -829,6 +918,14 @@ func (c *Chain) sync() (err error) {
 		"db":   c.databaseID,
 	}).Debug("synchronizing chain state")
 
+	if len(c.syncPeers) > 0 {
+		if err = c.catchUp(func(h int32) (*types.Block, error) {
+			return c.fetchSourceBlock(c.databaseID, h, c.syncPeers)
+		}); err != nil {
+			return
+		}
+	}
+
 	for {
 		now := c.rt.now()
 		height := c.rt.getHeightFromTime(now)
@@ -921,30 +1018,12 @@ func (c *Chain) processBlocks(ctx context.Context) {
 						head := c.rt.getHead()
 						currentCount := uint64(head.node.count)
 						if currentCount%c.updatePeriod == 0 {
+							c.resetNoAckCounts()
 							ub, err := c.billing(head.node)
-							if err != nil {
+							if err != nil || ub == nil {
 								log.WithError(err).WithField("db", c.databaseID).Error("billing failed")
-							}
-							// allocate nonce
-							nonceReq := &types.NextAccountNonceReq{}
-							nonceResp := &types.NextAccountNonceResp{}
-							nonceReq.Addr = *c.addr
-							if err = rpc.RequestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
-								// allocate nonce failed
-								log.WithError(err).WithField("db", c.databaseID).Warning("allocate nonce for transaction failed")
-							}
-							ub.Nonce = nonceResp.Nonce
-							if err = ub.Sign(c.pk); err != nil {
-								log.WithError(err).WithField("db", c.databaseID).Warning("sign tx failed")
-							}
-
-							addTxReq := &types.AddTxReq{TTL: 1}
-							addTxResp := &types.AddTxResp{}
-							addTxReq.Tx = ub
-							log.WithField("db", c.databaseID).Debugf("nonce in processBlocks: %d, addr: %s",
-								addTxReq.Tx.GetAccountNonce(), addTxReq.Tx.GetAccountAddress())
-							if err = rpc.RequestBP(route.MCCAddTx.String(), addTxReq, addTxResp); err != nil {
-								log.WithError(err).WithField("db", c.databaseID).Warning("send tx failed")
+							} else {
+								c.sendBilling(ub, head.node.height)
 							}
 						}
 					}
@@ -967,6 +1046,12 @@ func (c *Chain) Start() (err error) {
 	c.rt.goFunc(c.processBlocks)
 	c.rt.goFunc(c.mainCycle)
 	c.rt.goFunc(c.replicationCycle)
+	if c.rt.binlogInterval > 0 {
+		c.rt.goFunc(c.binlogCycle)
+	}
+	if c.rt.archiveTTL > 0 {
+		c.rt.goFunc(c.archiveCycle)
+	}
 	c.rt.startService(c)
 	return
 }
@@ -1021,6 +1106,9 @@ func (c *Chain) FetchBlock(height int32) (b *types.Block, err error) {
 		k := utils.ConcatAll(metaBlockIndex[:], n.indexKey())
 		var v []byte
 		v, err = c.bdb.Get(k, nil)
+		if err == leveldb.ErrNotFound {
+			return c.fetchArchivedBlock(n)
+		}
 		if err != nil {
 			err = errors.Wrapf(err, "fetch block %s", string(k))
 			return
@@ -1038,6 +1126,27 @@ func (c *Chain) FetchBlock(height int32) (b *types.Block, err error) {
 	return
 }
 
+// FetchMerkleProof fetches the signed header of the block at specified height and the inclusion
+// proof of the merkle leaf in the block.
+func (c *Chain) FetchMerkleProof(height int32, leaf *hash.Hash) (
+	header *types.SignedHeader, proof *merkle.Proof, err error,
+) {
+	var b *types.Block
+	if b, err = c.FetchBlock(height); err != nil {
+		return
+	}
+	if b == nil {
+		err = errors.Wrapf(ErrBlockNotFound, "fetch merkle proof at height %d", height)
+		return
+	}
+	if proof, err = b.MerkleProof(leaf); err != nil {
+		err = errors.Wrapf(err, "fetch merkle proof of %s at height %d", leaf.String(), height)
+		return
+	}
+	header = &b.SignedHeader
+	return
+}
+
 // CheckAndPushNewBlock implements ChainRPCServer.CheckAndPushNewBlock.
 func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 	height := c.rt.getHeightFromTime(block.Timestamp())
@@ -1105,7 +1214,7 @@ func (c *Chain) CheckAndPushNewBlock(block *types.Block) (err error) {
 	// }
 
 	// Replicate local state from the new block
-	if err = c.st.ReplayBlockWithContext(c.rt.ctx, block); err != nil {
+	if err = c.replayBlock(block); err != nil {
 		return
 	}
 
@@ -1270,52 +1379,135 @@ func (c *Chain) stat() {
 
 func (c *Chain) billing(node *blockNode) (ub *types.UpdateBilling, err error) {
 	log.WithField("db", c.databaseID).Debugf("begin to billing from count %d", node.count)
+	var header *types.UpdateBillingHeader
+	if header, err = c.collectBilling(node, c.updatePeriod); err != nil {
+		return
+	}
+	ub = types.NewUpdateBilling(header)
+	return
+}
+
+// sendBilling signs ub with the next nonce of the chain account and sends it to the block
+// producers.
+func (c *Chain) sendBilling(ub *types.UpdateBilling, height int32) {
+	var (
+		err       error
+		nonceReq  = &types.NextAccountNonceReq{Addr: *c.addr}
+		nonceResp = &types.NextAccountNonceResp{}
+	)
+	// allocate nonce
+	if err = rpc.RequestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
+		// allocate nonce failed
+		log.WithError(err).WithField("db", c.databaseID).Warning("allocate nonce for transaction failed")
+		return
+	}
+	ub.Nonce = nonceResp.Nonce
+	if err = ub.Sign(c.pk); err != nil {
+		log.WithError(err).WithField("db", c.databaseID).Warning("sign tx failed")
+		return
+	}
+
+	addTxReq := &types.AddTxReq{TTL: 1}
+	addTxResp := &types.AddTxResp{}
+	addTxReq.Tx = ub
+	log.WithField("db", c.databaseID).Debugf("nonce in processBlocks: %d, addr: %s",
+		addTxReq.Tx.GetAccountNonce(), addTxReq.Tx.GetAccountAddress())
+	if err = rpc.RequestBP(route.MCCAddTx.String(), addTxReq, addTxResp); err != nil {
+		log.WithError(err).WithField("db", c.databaseID).Warning("send tx failed")
+	} else if c.rt.dropSettledArchives {
+		c.trackBilling(ub.Hash(), height)
+	}
+}
+
+// BillingPreview returns the pending charges of the blocks not billed yet, which are collected in
+// the same way as the periodic billing. The returned heights bound the blocks of the window, and
+// the header is nil if all the blocks are billed.
+func (c *Chain) BillingPreview() (
+	header *types.UpdateBillingHeader, startHeight, endHeight int32, err error,
+) {
+	var (
+		head = c.rt.getHead().node
+		n    = uint64(head.count) % c.updatePeriod
+	)
+	if n == 0 {
+		return
+	}
+	endHeight = head.height
+	for node, i := head, uint64(0); node != nil && i < n; node, i = node.parent, i+1 {
+		startHeight = node.height
+	}
+	header, err = c.collectBilling(head, n)
+	return
+}
+
+// accountOf returns the account which signee is or was registered to, the queries signed by a key
+// before its rotation are charged to the account of the key.
+func (c *Chain) accountOf(signee *asymmetric.PublicKey) (proto.AccountAddress, error) {
+	if c.resolveAccount != nil {
+		return c.resolveAccount(signee)
+	}
+	return crypto.PubKeyHash(signee)
+}
+
+// collectBilling collects the charges of the n blocks ending at node. The queries of unresolvable
+// signees are skipped rather than failing the whole billing.
+func (c *Chain) collectBilling(
+	node *blockNode, n uint64) (header *types.UpdateBillingHeader, err error,
+) {
 	var (
 		i, j      uint64
 		minerAddr proto.AccountAddress
 		userAddr  proto.AccountAddress
 		usersMap  = make(map[proto.AccountAddress]uint64)
 		minersMap = make(map[proto.AccountAddress]map[proto.AccountAddress]uint64)
+		reports   = make(proofFailureReports)
+		noAcks    = newNoAckReports()
 	)
 
-	for i = 0; i < c.updatePeriod && node != nil; i++ {
+	for i = 0; i < n && node != nil; i++ {
 		var block = node.block
 		// Not cached, recover from storage
 		if block == nil {
 			if block, err = c.FetchBlock(node.height); err != nil {
 				return
 			}
+			if block == nil {
+				err = errors.Wrapf(ErrBlockNotFound, "billing at height %d", node.height)
+				return
+			}
 		}
 		for _, tx := range block.QueryTxs {
-			if minerAddr, err = crypto.PubKeyHash(tx.Response.Signee); err != nil {
-				log.WithError(err).WithField("db", c.databaseID).Warning("billing fail: miner addr")
-				return
+			if minerAddr, err = c.accountOf(tx.Response.Signee); err != nil {
+				log.WithError(err).WithField("db", c.databaseID).Warning("billing skip: miner addr")
+				err = nil
+				continue
 			}
-			if userAddr, err = crypto.PubKeyHash(tx.Request.Header.Signee); err != nil {
-				log.WithError(err).WithField("db", c.databaseID).Warning("billing fail: miner addr")
-				return
+			if userAddr, err = c.accountOf(tx.Request.Header.Signee); err != nil {
+				log.WithError(err).WithField("db", c.databaseID).Warning("billing skip: user addr")
+				err = nil
+				continue
 			}
 
 			if _, ok := minersMap[userAddr]; !ok {
 				minersMap[userAddr] = make(map[proto.AccountAddress]uint64)
 			}
-			if tx.Request.Header.QueryType == types.ReadQuery {
-				minersMap[userAddr][minerAddr] += tx.Response.RowCount
-				usersMap[userAddr] += tx.Response.RowCount
-			} else {
-				minersMap[userAddr][minerAddr] += uint64(tx.Response.AffectedRows)
-				usersMap[userAddr] += uint64(tx.Response.AffectedRows)
-			}
+			// Charge the gas units of the execution cost, the unit price is applied by the
+			// block producers
+			var gas = tx.Response.Cost.Gas()
+			minersMap[userAddr][minerAddr] += gas
+			usersMap[userAddr] += gas
 		}
 
 		for _, req := range block.FailedReqs {
-			if minerAddr, err = crypto.PubKeyHash(block.Signee()); err != nil {
-				log.WithError(err).WithField("db", c.databaseID).Warning("billing fail: miner addr")
-				return
+			if minerAddr, err = c.accountOf(block.Signee()); err != nil {
+				log.WithError(err).WithField("db", c.databaseID).Warning("billing skip: miner addr")
+				err = nil
+				continue
 			}
-			if userAddr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
-				log.WithError(err).WithField("db", c.databaseID).Warning("billing fail: user addr")
-				return
+			if userAddr, err = c.accountOf(req.Header.Signee); err != nil {
+				log.WithError(err).WithField("db", c.databaseID).Warning("billing skip: user addr")
+				err = nil
+				continue
 			}
 			if _, ok := minersMap[userAddr][minerAddr]; !ok {
 				minersMap[userAddr] = make(map[proto.AccountAddress]uint64)
@@ -1324,26 +1516,56 @@ func (c *Chain) billing(node *blockNode) (ub *types.UpdateBilling, err error) {
 			minersMap[userAddr][minerAddr] += uint64(len(req.Payload.Queries))
 			usersMap[userAddr] += uint64(len(req.Payload.Queries))
 		}
+		reports.add(block)
+		noAcks.add(block)
 		node = node.parent
 	}
 
-	ub = types.NewUpdateBilling(&types.UpdateBillingHeader{
-		Users: make([]*types.UserCost, len(usersMap)),
+	// Charge the users once more for the responses they never acknowledged. The penalties are
+	// burned instead of being paid to the reporting miners, as the acks are received by the same
+	// miners, which would otherwise profit from dropping them.
+	var noAckMiners = make(map[proto.AccountAddress]struct{})
+	for userAddr, miners := range noAcks.penalties(c.accountOf) {
+		for minerAddr, cost := range miners {
+			usersMap[userAddr] += cost
+			noAckMiners[minerAddr] = struct{}{}
+		}
+	}
+
+	// Withhold the income of the miners failed in storage proof, users are not charged for it
+	var failedMiners = c.confirmedProofFailures(reports)
+	for _, miner := range failedMiners {
+		for userAddr, miners := range minersMap {
+			usersMap[userAddr] -= miners[miner]
+			delete(miners, miner)
+		}
+	}
+
+	header = &types.UpdateBillingHeader{
+		Users:        make([]*types.UserCost, len(usersMap)),
+		FailedMiners: failedMiners,
+		NoAckMiners:  make([]proto.AccountAddress, 0, len(noAckMiners)),
+	}
+	for k := range noAckMiners {
+		header.NoAckMiners = append(header.NoAckMiners, k)
+	}
+	sort.Slice(header.NoAckMiners, func(i, j int) bool {
+		return bytes.Compare(header.NoAckMiners[i][:], header.NoAckMiners[j][:]) < 0
 	})
 
 	i = 0
 	j = 0
 	for userAddr, cost := range usersMap {
 		log.WithField("db", c.databaseID).Debugf("user %s, cost %d", userAddr.String(), cost)
-		ub.Users[i] = &types.UserCost{
+		header.Users[i] = &types.UserCost{
 			User: userAddr,
 			Cost: cost,
 		}
 		miners := minersMap[userAddr]
-		ub.Users[i].Miners = make([]*types.MinerIncome, len(miners))
+		header.Users[i].Miners = make([]*types.MinerIncome, len(miners))
 
 		for k1, v1 := range miners {
-			ub.Users[i].Miners[j] = &types.MinerIncome{
+			header.Users[i].Miners[j] = &types.MinerIncome{
 				Miner:  k1,
 				Income: v1,
 			}
@@ -1352,6 +1574,6 @@ func (c *Chain) billing(node *blockNode) (ub *types.UpdateBilling, err error) {
 		j = 0
 		i++
 	}
-	ub.Receiver, err = c.databaseID.AccountAddress()
+	header.Receiver, err = c.databaseID.AccountAddress()
 	return
 }
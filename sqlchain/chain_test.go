@@ -274,9 +274,13 @@ func TestMultiChain(t *testing.T) {
 				}
 			}
 
+			p.config.SyncPeers = peers.Servers[:1]
 			if chain, err := NewChain(p.config); err != nil {
 				t.Errorf("error occurred: %v", err)
 			} else {
+				if len(chain.syncPeers) != 1 || chain.syncPeers[0] != peers.Servers[0] {
+					t.Errorf("unexpected sync peers of loaded chain: %v", chain.syncPeers)
+				}
 				t.Logf("Load chain from file %s: head = %s height = %d",
 					p.dbfile, chain.rt.getHead().Head, chain.rt.getHead().Height)
 			}
@@ -19,6 +19,7 @@ package sqlchain
 import (
 	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 )
@@ -37,6 +38,13 @@ type Config struct {
 	Peers      *proto.Peers
 	Server     proto.NodeID
 
+	// SourcePeers sets the peers of the source database to fetch blocks from, if the genesis
+	// block is forked from another database.
+	SourcePeers []proto.NodeID
+	// SyncPeers sets the peers to catch up the database blocks from before the chain starts,
+	// which is set for a miner replacing a drained one.
+	SyncPeers []proto.NodeID
+
 	// Price sets query price in gases.
 	Price           map[types.QueryType]uint64
 	ProducingReward uint64
@@ -47,8 +55,32 @@ type Config struct {
 
 	BlockCacheTTL int32
 
+	// BlockArchiveTTL sets the block periods after which blocks are moved into archive segments,
+	// 0 to disable archiving.
+	BlockArchiveTTL int32
+	// DropSettledArchives enables removing the archive segments once the billing of all their
+	// blocks is confirmed by the main chain.
+	DropSettledArchives bool
+
+	// EventualConsistency enables state digest checking and divergence reconciliation between
+	// peers which execute writes locally.
+	EventualConsistency bool
+
+	// BinLogInterval sets the interval for the leader to advise committed write logs to its peers
+	// and observers between blocks, 0 to disable the binlog advising.
+	BinLogInterval time.Duration
+
+	// NoAckLimit sets the maximum no-ack reports of a client in a billing period, after which the
+	// client queries are rejected, 0 to disable.
+	NoAckLimit int32
+
 	// DBAccount info
 	TokenType    types.TokenType
 	GasPrice     uint64
 	UpdatePeriod uint64
+
+	// ResolveAccount returns the account which a signee key is or was registered to, so that the
+	// queries signed before a key rotation are still billed. The address of the key is used if
+	// not set.
+	ResolveAccount func(signee *asymmetric.PublicKey) (proto.AccountAddress, error)
 }
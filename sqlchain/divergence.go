@@ -0,0 +1,221 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	divergenceQueryConflict = "query conflict"
+	divergenceRootMismatch  = "state root mismatch"
+)
+
+var (
+	metaDivergenceIndex = [4]byte{'D', 'I', 'V', 'G'}
+)
+
+// DivergenceEvent records a state divergence detected on a new block and its reconciliation.
+type DivergenceEvent struct {
+	Height    int32
+	BlockHash hash.Hash
+	Producer  proto.NodeID
+	Reason    string
+	BlockRoot hash.Hash
+	LocalRoot hash.Hash
+	// SnapshotSeq is the state sequence of the producer snapshot restored.
+	SnapshotSeq uint64
+	// DroppedRequests are the hashes of local pending requests discarded by the restoring.
+	DroppedRequests []hash.Hash
+	Reconciled      bool
+	Error           string
+	Timestamp       time.Time
+}
+
+// replayBlock replicates local state from the new block. The state root and the storage proof
+// of the block producer are verified if the local state is comparable with the block. In eventual
+// consistency mode, a diverged state is re-synchronized from the block producer, otherwise the
+// divergence is recorded and the block is rejected.
+func (c *Chain) replayBlock(block *types.Block) (err error) {
+	var (
+		zero   hash.Hash
+		proof  *x.StateProof
+		reason string
+		// the challenge is always derived from the parent block, so that a producer cannot skip
+		// it by leaving the storage proof empty
+		req = &x.ProofRequest{Seed: *block.ParentHash(), Prover: block.Producer()}
+	)
+
+	proof, err = c.st.ReplayBlockWithProof(c.rt.ctx, block, req)
+	switch {
+	case c.rt.eventualConsistency && errors.Cause(err) == x.ErrQueryConflict:
+		return c.reconcile(block, divergenceQueryConflict, zero)
+	case err != nil:
+		return
+	case proof == nil:
+		// local state is not comparable with the block
+		return
+	case !proof.Root.IsEqual(block.StateRoot()):
+		reason = divergenceRootMismatch
+	default:
+		// a missing proof never matches the answer, which is non-zero for a non-zero seed
+		if !proof.StorageProof.IsEqual(block.StorageProof()) {
+			c.reportProofFailure(block)
+		}
+		return
+	}
+
+	if c.rt.eventualConsistency {
+		return c.reconcile(block, reason, proof.Root)
+	}
+	var ev = c.newDivergenceEvent(block, reason, proof.Root)
+	err = errors.Wrapf(ErrStateRootMismatch, "local %s vs block %s at seq %d",
+		proof.Root.String(), block.StateRoot().String(), proof.Seq)
+	c.logDivergence(ev, err)
+	return
+}
+
+func (c *Chain) newDivergenceEvent(
+	block *types.Block, reason string, local hash.Hash) *DivergenceEvent {
+	return &DivergenceEvent{
+		Height:    c.rt.getHeightFromTime(block.Timestamp()),
+		BlockHash: *block.BlockHash(),
+		Producer:  block.Producer(),
+		Reason:    reason,
+		BlockRoot: *block.StateRoot(),
+		LocalRoot: local,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// logDivergence records and logs the divergence event with the reconciling error.
+func (c *Chain) logDivergence(ev *DivergenceEvent, err error) {
+	ev.Reconciled = err == nil
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	le := log.WithFields(log.Fields{
+		"peer":         c.rt.getPeerInfoString(),
+		"height":       ev.Height,
+		"block":        ev.BlockHash.String(),
+		"producer":     ev.Producer,
+		"reason":       ev.Reason,
+		"block_root":   ev.BlockRoot.String(),
+		"local_root":   ev.LocalRoot.String(),
+		"snapshot_seq": ev.SnapshotSeq,
+		"dropped":      len(ev.DroppedRequests),
+		"db":           c.databaseID,
+	}).WithError(err)
+	if ierr := c.recordDivergence(ev); ierr != nil {
+		le.WithField("record_error", ierr).Error("failed to record state divergence")
+		return
+	}
+	le.Error("state divergence detected")
+}
+
+// reconcile restores local state from the snapshot of the block producer.
+func (c *Chain) reconcile(block *types.Block, reason string, local hash.Hash) (err error) {
+	var (
+		ev      = c.newDivergenceEvent(block, reason, local)
+		snap    *x.Snapshot
+		dropped []*types.Request
+	)
+	defer func() { c.logDivergence(ev, err) }()
+
+	if snap, err = c.fetchSnapshot(block.Producer()); err != nil {
+		return
+	}
+	if dropped, err = c.st.Restore(c.rt.ctx, snap); err != nil {
+		return
+	}
+	ev.SnapshotSeq = snap.Seq
+	for _, v := range dropped {
+		ev.DroppedRequests = append(ev.DroppedRequests, v.Header.Hash())
+	}
+	return
+}
+
+// FetchSnapshot dumps the current state snapshot for the requesting node, which must be one of
+// the database peers.
+func (c *Chain) FetchSnapshot(node proto.NodeID) (snap *x.Snapshot, err error) {
+	if _, ok := c.rt.getPeers().Find(node); !ok {
+		err = errors.Wrapf(ErrNotPeer, "fetch snapshot by %s", node)
+		return
+	}
+	return c.st.Snapshot(c.rt.ctx)
+}
+
+func (c *Chain) fetchSnapshot(node proto.NodeID) (snap *x.Snapshot, err error) {
+	var (
+		req = &MuxFetchSnapshotReq{
+			DatabaseID: c.databaseID,
+		}
+		resp = &MuxFetchSnapshotResp{}
+	)
+	if err = c.cl.CallNodeWithContext(
+		c.rt.ctx, node, route.SQLCFetchSnapshot.String(), req, resp,
+	); err != nil {
+		err = errors.Wrapf(err, "fetch snapshot from %s", node)
+		return
+	}
+	if resp.Snapshot == nil {
+		err = errors.Errorf("empty snapshot from %s", node)
+		return
+	}
+	snap = resp.Snapshot
+	return
+}
+
+func (c *Chain) recordDivergence(ev *DivergenceEvent) (err error) {
+	var enc, ierr = utils.EncodeMsgPack(ev)
+	if ierr != nil {
+		err = errors.Wrap(ierr, "encode divergence event")
+		return
+	}
+	key := utils.ConcatAll(metaDivergenceIndex[:], heightToKey(ev.Height), ev.BlockHash[:])
+	if err = c.bdb.Put(key, enc.Bytes(), nil); err != nil {
+		err = errors.Wrapf(err, "put divergence event at height %d", ev.Height)
+	}
+	return
+}
+
+// DivergenceEvents returns all the recorded state divergence events in height order.
+func (c *Chain) DivergenceEvents() (events []*DivergenceEvent, err error) {
+	iter := c.bdb.NewIterator(util.BytesPrefix(metaDivergenceIndex[:]), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var ev = &DivergenceEvent{}
+		if err = utils.DecodeMsgPack(iter.Value(), ev); err != nil {
+			err = errors.Wrapf(err, "decode divergence event at height %d",
+				keyWithSymbolToHeight(iter.Key()))
+			return
+		}
+		events = append(events, ev)
+	}
+	err = iter.Error()
+	return
+}
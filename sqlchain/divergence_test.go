@@ -0,0 +1,59 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestDivergenceEvents(t *testing.T) {
+	Convey("record and list divergence events", t, func() {
+		bdb, err := leveldb.OpenFile(path.Join(testDataDir, t.Name()+"-block-state.ldb"), &leveldbConf)
+		So(err, ShouldBeNil)
+		defer bdb.Close()
+
+		var c = &Chain{bdb: bdb}
+		events, err := c.DivergenceEvents()
+		So(err, ShouldBeNil)
+		So(events, ShouldBeEmpty)
+
+		for _, h := range []int32{7, 3} {
+			err = c.recordDivergence(&DivergenceEvent{
+				Height:          h,
+				BlockHash:       hash.THashH([]byte{byte(h)}),
+				Reason:          divergenceRootMismatch,
+				DroppedRequests: []hash.Hash{hash.THashH([]byte("req"))},
+				Reconciled:      true,
+			})
+			So(err, ShouldBeNil)
+		}
+
+		events, err = c.DivergenceEvents()
+		So(err, ShouldBeNil)
+		So(events, ShouldHaveLength, 2)
+		So(events[0].Height, ShouldEqual, 3)
+		So(events[1].Height, ShouldEqual, 7)
+		So(events[1].Reason, ShouldEqual, divergenceRootMismatch)
+		So(events[1].DroppedRequests, ShouldHaveLength, 1)
+		So(events[1].Reconciled, ShouldBeTrue)
+	})
+}
@@ -35,6 +35,8 @@ var (
 	ErrQueryExpired = errors.New("query has expired")
 	// ErrUnknownProducer indicates that the block has an unknown producer.
 	ErrUnknownProducer = errors.New("unknown block producer")
+	// ErrNotPeer indicates that the caller is not a peer of the database.
+	ErrNotPeer = errors.New("caller is not a peer of the database")
 	// ErrInvalidProducer indicates that the block has an invalid producer.
 	ErrInvalidProducer = errors.New("invalid block producer")
 	// ErrQueryNotFound indicates that a query is not found in the index.
@@ -42,4 +44,19 @@ var (
 	// ErrResponseSeqNotMatch indicates that a response sequence id doesn't match the original one
 	// in the index.
 	ErrResponseSeqNotMatch = errors.New("response sequence id doesn't match")
+	// ErrBlockNotFound indicates that the block at the specified height is not found.
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrStateRootMismatch indicates that the local state root doesn't match the one in block.
+	ErrStateRootMismatch = errors.New("state root doesn't match")
+	// ErrInvalidBinLog indicates that an advised write log is malformed or not produced by the
+	// leader peer.
+	ErrInvalidBinLog = errors.New("invalid binlog")
+	// ErrTooManyNoAcks indicates that the client has too many unacknowledged responses.
+	ErrTooManyNoAcks = errors.New("too many unacknowledged responses")
+	// ErrLineageMismatch indicates that the source blocks fetched for seeding a forked database
+	// don't match the lineage recorded in its genesis block.
+	ErrLineageMismatch = errors.New("source blocks don't match the lineage")
+	// ErrBlockArchived indicates that the block is archived in a dropped archive segment and no
+	// longer available.
+	ErrBlockArchived = errors.New("block archived and dropped")
 )
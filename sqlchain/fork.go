@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// fetchSourceBlock fetches the block at the specified height of the source database from the
+// source peers. It returns a nil block if no block is produced at the height.
+func (c *Chain) fetchSourceBlock(
+	source proto.DatabaseID, height int32, peers []proto.NodeID) (b *types.Block, err error,
+) {
+	var (
+		req = &MuxFetchBlockReq{
+			DatabaseID:    source,
+			FetchBlockReq: FetchBlockReq{Height: height},
+		}
+		resp  *MuxFetchBlockResp
+		found bool
+	)
+	for _, v := range peers {
+		resp = &MuxFetchBlockResp{}
+		if err = c.cl.CallNode(v, route.SQLCFetchBlock.String(), req, resp); err != nil {
+			log.WithFields(log.Fields{
+				"source": source,
+				"height": height,
+				"remote": v,
+			}).WithError(err).Debug("failed to fetch source block from peer")
+			continue
+		}
+		found = true
+		if resp.Block != nil {
+			return resp.Block, nil
+		}
+	}
+	if found {
+		// No block at this height
+		err = nil
+	} else if err == nil {
+		err = errors.Wrapf(ErrBlockNotFound, "no peer of source database %s", source)
+	}
+	return
+}
+
+// seed replays the source database blocks up to the lineage block into the chain state. The
+// blocks are fetched backwards along the parent hashes from the lineage block, so every block
+// replayed is verified against the lineage.
+func (c *Chain) seed(
+	lineage *types.Lineage, fetch func(height int32) (*types.Block, error)) (err error,
+) {
+	var (
+		blocks = make([]*types.Block, 0, lineage.Height+1)
+		expect = lineage.Block
+		le     = log.WithFields(log.Fields{
+			"db":     c.databaseID,
+			"source": lineage.Source,
+			"height": lineage.Height,
+			"block":  lineage.Block.String(),
+		})
+	)
+	le.Info("seeding forked database from source")
+	for h := lineage.Height; h >= 0 && !expect.IsEqual(&hash.Hash{}); h-- {
+		var b *types.Block
+		if b, err = fetch(h); err != nil {
+			return errors.Wrapf(err, "fetch source block at height %d", h)
+		}
+		if b == nil {
+			continue
+		}
+		if !b.BlockHash().IsEqual(&expect) {
+			return errors.Wrapf(ErrLineageMismatch,
+				"block at height %d: expected %s, got %s", h, expect.String(), b.BlockHash().String())
+		}
+		blocks = append(blocks, b)
+		expect = *b.ParentHash()
+	}
+	if !expect.IsEqual(&hash.Hash{}) {
+		return errors.Wrapf(ErrLineageMismatch, "missing block %s", expect.String())
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err = c.st.ReplayBlockWithContext(c.rt.ctx, blocks[i]); err != nil {
+			return errors.Wrapf(err, "replay source block %s", blocks[i].BlockHash().String())
+		}
+	}
+	le.WithField("blocks", len(blocks)).Info("forked database seeded")
+	return
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSeed(t *testing.T) {
+	Convey("Given a source chain with some write queries in blocks", t, func() {
+		cli, err := newRandomNode()
+		So(err, ShouldBeNil)
+		miner, err := newRandomNode()
+		So(err, ShouldBeNil)
+		forked, err := newRandomNode()
+		So(err, ShouldBeNil)
+
+		var (
+			newSt = func(node *nodeProfile) (st *x.State) {
+				var fl = path.Join(testDataDir, t.Name()+string(node.NodeID[:8])+".db")
+				strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+				So(err, ShouldBeNil)
+				st, err = x.NewState(node.NodeID, strg)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					st.Close(false)
+					for _, v := range []string{"", "-shm", "-wal"} {
+						os.Remove(fl + v)
+					}
+				})
+				return
+			}
+			src = newSt(miner)
+			c   = &Chain{st: newSt(forked), rt: &runtime{ctx: context.Background()}}
+
+			newReq = func(qt types.QueryType, pattern string) *types.Request {
+				var req = &types.Request{
+					Header: types.SignedRequestHeader{RequestHeader: types.RequestHeader{
+						QueryType: qt,
+						NodeID:    cli.NodeID,
+						Timestamp: time.Now().UTC(),
+					}},
+					Payload: types.RequestPayload{Queries: []types.Query{{Pattern: pattern}}},
+				}
+				So(req.Sign(cli.PrivateKey), ShouldBeNil)
+				return req
+			}
+			write = func(pattern string) *types.QueryAsTx {
+				var req = newReq(types.WriteQuery, pattern)
+				tracker, resp, err := src.Query(req)
+				So(err, ShouldBeNil)
+				So(resp.Sign(miner.PrivateKey), ShouldBeNil)
+				tracker.UpdateResp(resp)
+				return &types.QueryAsTx{Request: req, Response: &resp.Header}
+			}
+			newBlk = func(parent hash.Hash, qs ...*types.QueryAsTx) *types.Block {
+				var b = &types.Block{
+					SignedHeader: types.SignedHeader{Header: types.Header{
+						Version:    0x01000000,
+						Producer:   miner.NodeID,
+						ParentHash: parent,
+						Timestamp:  time.Now().UTC(),
+					}},
+					QueryTxs: qs,
+				}
+				So(b.PackAndSignBlock(miner.PrivateKey), ShouldBeNil)
+				return b
+			}
+
+			// no block is produced at height 2
+			b0 = newBlk(hash.Hash{})
+			b1 = newBlk(*b0.BlockHash(),
+				write(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				write(`INSERT INTO t1 VALUES (1, 'v1')`))
+			b3 = newBlk(*b1.BlockHash(), write(`INSERT INTO t1 VALUES (2, 'v2')`))
+			b4 = newBlk(*b3.BlockHash(), write(`INSERT INTO t1 VALUES (3, 'v3')`))
+
+			blocks = map[int32]*types.Block{0: b0, 1: b1, 3: b3, 4: b4}
+			fetch  = func(h int32) (*types.Block, error) { return blocks[h], nil }
+		)
+
+		Convey("The forked chain should be seeded to the lineage height", func() {
+			err = c.seed(&types.Lineage{
+				Source: testDatabaseID, Height: 3, Block: *b3.BlockHash(),
+			}, fetch)
+			So(err, ShouldBeNil)
+			_, resp, err := c.st.Query(newReq(types.ReadQuery, `SELECT v FROM t1`))
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 2)
+		})
+		Convey("The seeding should fail if the lineage block doesn't match", func() {
+			err = c.seed(&types.Lineage{
+				Source: testDatabaseID, Height: 4, Block: *b3.BlockHash(),
+			}, fetch)
+			So(errors.Cause(err), ShouldEqual, ErrLineageMismatch)
+		})
+		Convey("The seeding should fail if any source block is missing", func() {
+			delete(blocks, 1)
+			err = c.seed(&types.Lineage{
+				Source: testDatabaseID, Height: 3, Block: *b3.BlockHash(),
+			}, fetch)
+			So(errors.Cause(err), ShouldEqual, ErrLineageMismatch)
+			_, _, err = c.st.Query(newReq(types.ReadQuery, `SELECT v FROM t1`))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The seeding should fail if the source blocks cannot be fetched", func() {
+			err = c.seed(&types.Lineage{
+				Source: testDatabaseID, Height: 3, Block: *b3.BlockHash(),
+			}, func(int32) (*types.Block, error) { return nil, ErrBlockNotFound })
+			So(errors.Cause(err), ShouldEqual, ErrBlockNotFound)
+		})
+	})
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"bytes"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// BlockRecord defines a block entry in the block storage of a sql-chain.
+type BlockRecord struct {
+	Height int32
+	Hash   hash.Hash
+	Block  *types.Block
+	// Err is the decoding or verification error of the block.
+	Err error
+}
+
+// BlockStoreReport defines the verification result of the block storage of a sql-chain.
+type BlockStoreReport struct {
+	Count      int
+	HeadHash   hash.Hash
+	HeadHeight int32
+	// Corrupted defines the heights of blocks failed decoding or verification.
+	Corrupted []int32
+	// Unlinked defines the heights of blocks whose parent is not in the storage.
+	Unlinked []int32
+	// Archived defines the number of blocks moved into archive segments, which are not counted
+	// in Count.
+	Archived int
+}
+
+func openBlockStore(chainFilePrefix string) (bdb *leveldb.DB, err error) {
+	var (
+		bdbFile = chainFilePrefix + "-block-state.ldb"
+		o       = leveldbConf
+	)
+	o.ErrorIfMissing = true
+	if bdb, err = leveldb.OpenFile(bdbFile, &o); err != nil {
+		err = errors.Wrapf(err, "open leveldb %s", bdbFile)
+	}
+	return
+}
+
+// InspectBlockStore walks and verifies the blocks stored with the chain file prefix offline.
+func InspectBlockStore(
+	chainFilePrefix string, fn func(*BlockRecord) error) (report *BlockStoreReport, err error,
+) {
+	var bdb *leveldb.DB
+	if bdb, err = openBlockStore(chainFilePrefix); err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	report = &BlockStoreReport{}
+
+	var stateEnc []byte
+	if stateEnc, err = bdb.Get(metaState[:], nil); err != nil {
+		err = errors.Wrap(err, "read chain state")
+		return
+	}
+	st := &state{}
+	if err = utils.DecodeMsgPack(stateEnc, st); err != nil {
+		err = errors.Wrap(err, "decode chain state")
+		return
+	}
+	report.HeadHash, report.HeadHeight = st.Head, st.Height
+
+	var (
+		known = make(map[hash.Hash]bool)
+		ait   = bdb.NewIterator(util.BytesPrefix(metaArchiveIndex[:]), nil)
+	)
+	for ait.Next() {
+		if k := ait.Key(); len(k) >= len(metaArchiveIndex)+4+hash.HashSize {
+			var h hash.Hash
+			copy(h[:], k[len(metaArchiveIndex)+4:])
+			known[h] = true
+			report.Archived++
+		}
+	}
+	ait.Release()
+	if err = ait.Error(); err != nil {
+		err = errors.Wrap(err, "iterate archive entries")
+		return
+	}
+
+	var it = bdb.NewIterator(util.BytesPrefix(metaBlockIndex[:]), nil)
+	defer it.Release()
+
+	for it.Next() {
+		var (
+			k   = it.Key()
+			rec = &BlockRecord{
+				Height: keyWithSymbolToHeight(k),
+				Block:  &types.Block{},
+			}
+		)
+		if len(k) >= len(metaBlockIndex)+4+hash.HashSize {
+			copy(rec.Hash[:], k[len(metaBlockIndex)+4:])
+		}
+
+		if rec.Err = utils.DecodeMsgPack(it.Value(), rec.Block); rec.Err != nil {
+			rec.Block = nil
+		} else if report.Count == 0 {
+			rec.Err = rec.Block.VerifyAsGenesis()
+		} else {
+			if rec.Err = rec.Block.Verify(); rec.Err == nil && !known[*rec.Block.ParentHash()] {
+				report.Unlinked = append(report.Unlinked, rec.Height)
+			}
+		}
+		if rec.Err == nil && !rec.Block.BlockHash().IsEqual(&rec.Hash) {
+			rec.Err = errors.Wrapf(ErrInvalidBlock, "block hash mismatch with key: %s", rec.Hash)
+		}
+
+		if rec.Err != nil {
+			report.Corrupted = append(report.Corrupted, rec.Height)
+		} else {
+			known[*rec.Block.BlockHash()] = true
+		}
+		report.Count++
+
+		if fn != nil {
+			if err = fn(rec); err != nil {
+				return
+			}
+		}
+	}
+	err = it.Error()
+
+	return
+}
+
+// TruncateBlockStore removes blocks with height greater than or equal to the given height and
+// resets the chain head to the highest remaining block.
+func TruncateBlockStore(chainFilePrefix string, height int32) (removed int, err error) {
+	if height <= 0 {
+		err = errors.Wrap(ErrInvalidBlock, "could not truncate genesis block")
+		return
+	}
+
+	var bdb *leveldb.DB
+	if bdb, err = openBlockStore(chainFilePrefix); err != nil {
+		return
+	}
+	defer bdb.Close()
+
+	var (
+		batch = new(leveldb.Batch)
+		st    = &state{Height: -1}
+		it    = bdb.NewIterator(util.BytesPrefix(metaBlockIndex[:]), nil)
+	)
+	for it.Next() {
+		k := it.Key()
+		if h := keyWithSymbolToHeight(k); h >= height {
+			batch.Delete(append([]byte(nil), k...))
+			removed++
+		} else if len(k) >= len(metaBlockIndex)+4+hash.HashSize {
+			st.Height = h
+			copy(st.Head[:], k[len(metaBlockIndex)+4:])
+		}
+	}
+	it.Release()
+	if err = it.Error(); err != nil {
+		err = errors.Wrap(err, "iterate blocks")
+		return
+	}
+	if st.Height < 0 {
+		err = errors.Wrap(ErrParentNotFound, "no block left after truncation")
+		return
+	}
+
+	var encState *bytes.Buffer
+	if encState, err = utils.EncodeMsgPack(st); err != nil {
+		return
+	}
+	batch.Put(metaState[:], encState.Bytes())
+
+	if err = bdb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		err = errors.Wrap(err, "truncate blocks")
+	}
+
+	return
+}
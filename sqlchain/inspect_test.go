@@ -0,0 +1,109 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestInspectBlockStore(t *testing.T) {
+	Convey("inspect and truncate block storage", t, func() {
+		var (
+			prefix = path.Join(testDataDir, t.Name())
+			bdb    *leveldb.DB
+			err    error
+		)
+		bdb, err = leveldb.OpenFile(prefix+"-block-state.ldb", &leveldbConf)
+		So(err, ShouldBeNil)
+
+		var (
+			b      *types.Block
+			parent hash.Hash
+			st     = &state{}
+		)
+		putBlock := func(h int32, b *types.Block) {
+			enc, err := utils.EncodeMsgPack(b)
+			So(err, ShouldBeNil)
+			err = bdb.Put(utils.ConcatAll(
+				metaBlockIndex[:], heightToKey(h), b.BlockHash()[:]), enc.Bytes(), nil)
+			So(err, ShouldBeNil)
+			st.Head, st.Height = *b.BlockHash(), h
+		}
+
+		for h := int32(0); h < 5; h++ {
+			b, err = createRandomBlock(parent, h == 0)
+			So(err, ShouldBeNil)
+			putBlock(h, b)
+			parent = *b.BlockHash()
+		}
+		// corrupted block at height 5
+		err = bdb.Put(utils.ConcatAll(
+			metaBlockIndex[:], heightToKey(5), parent[:]), []byte("garbage"), nil)
+		So(err, ShouldBeNil)
+		// unlinked block at height 6
+		b, err = createRandomBlock(hash.Hash{}, false)
+		So(err, ShouldBeNil)
+		putBlock(6, b)
+
+		enc, err := utils.EncodeMsgPack(st)
+		So(err, ShouldBeNil)
+		err = bdb.Put(metaState[:], enc.Bytes(), nil)
+		So(err, ShouldBeNil)
+		bdb.Close()
+
+		var (
+			report  *BlockStoreReport
+			heights []int32
+		)
+		report, err = InspectBlockStore(prefix, func(rec *BlockRecord) error {
+			heights = append(heights, rec.Height)
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(heights, ShouldResemble, []int32{0, 1, 2, 3, 4, 5, 6})
+		So(report.Count, ShouldEqual, 7)
+		So(report.HeadHeight, ShouldEqual, 6)
+		So(report.Corrupted, ShouldResemble, []int32{5})
+		So(report.Unlinked, ShouldResemble, []int32{6})
+
+		_, err = TruncateBlockStore(prefix, 0)
+		So(err, ShouldNotBeNil)
+
+		var removed int
+		removed, err = TruncateBlockStore(prefix, 5)
+		So(err, ShouldBeNil)
+		So(removed, ShouldEqual, 2)
+
+		report, err = InspectBlockStore(prefix, nil)
+		So(err, ShouldBeNil)
+		So(report.Count, ShouldEqual, 5)
+		So(report.HeadHeight, ShouldEqual, 4)
+		So(report.HeadHash, ShouldResemble, parent)
+		So(report.Corrupted, ShouldBeEmpty)
+		So(report.Unlinked, ShouldBeEmpty)
+
+		_, err = InspectBlockStore(path.Join(testDataDir, "not_exists"), nil)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -103,6 +103,34 @@ type MuxFetchBlockResp struct {
 	FetchBlockResp
 }
 
+// MuxFetchSnapshotReq defines a request of the FetchSnapshot RPC method.
+type MuxFetchSnapshotReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchSnapshotReq
+}
+
+// MuxFetchSnapshotResp defines a response of the FetchSnapshot RPC method.
+type MuxFetchSnapshotResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchSnapshotResp
+}
+
+// MuxFetchMerkleProofReq defines a request of the FetchMerkleProof RPC method.
+type MuxFetchMerkleProofReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchMerkleProofReq
+}
+
+// MuxFetchMerkleProofResp defines a response of the FetchMerkleProof RPC method.
+type MuxFetchMerkleProofResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchMerkleProofResp
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *MuxService) AdviseNewBlock(req *MuxAdviseNewBlockReq, resp *MuxAdviseNewBlockResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
@@ -148,3 +176,30 @@ func (s *MuxService) FetchBlock(req *MuxFetchBlockReq, resp *MuxFetchBlockResp)
 
 	return ErrUnknownMuxRequest
 }
+
+// FetchSnapshot is the RPC method to fetch the current state snapshot from the target server.
+func (s *MuxService) FetchSnapshot(req *MuxFetchSnapshotReq, resp *MuxFetchSnapshotResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		req.FetchSnapshotReq.node = req.GetNodeID().ToNodeID()
+		return v.(*ChainRPCService).FetchSnapshot(&req.FetchSnapshotReq, &resp.FetchSnapshotResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
+
+// FetchMerkleProof is the RPC method to fetch the merkle inclusion proof of a leaf in a known
+// block from the target server.
+func (s *MuxService) FetchMerkleProof(
+	req *MuxFetchMerkleProofReq, resp *MuxFetchMerkleProofResp) (err error,
+) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).FetchMerkleProof(
+			&req.FetchMerkleProofReq, &resp.FetchMerkleProofResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
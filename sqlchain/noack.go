@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+// No-ack report protocol:
+//
+// 1. A response which is not acknowledged by the client before it expires from the ack index
+//    (see QueryTTL) is signed into a no-ack report by the responding miner, and the report is
+//    recorded in the header of the next block produced by the miner.
+// 2. Reports are aggregated per billing period. A report is confirmed if it is signed by its
+//    block producer for its own response, and the response is not acknowledged in any block of
+//    the period.
+// 3. Each confirmed report charges the client once more for the response cost in the UpdateBilling
+//    transaction. The penalty is not paid to any miner but burned, since the reporting miner is
+//    also the receiver of the missing ack and must not profit from dropping it.
+// 4. Besides, a miner rejects the queries of a client once the client gets NoAckLimit reports
+//    from it in the current billing period.
+
+// reportNoAcks signs the no-ack reports of the expired responses to report in the next local
+// block.
+func (c *Chain) reportNoAcks(resps []*types.SignedResponseHeader) {
+	var (
+		server  = c.rt.getServer()
+		reports = make([]*types.SignedNoAckReportHeader, 0, len(resps))
+	)
+	for _, v := range resps {
+		if v.NodeID != server {
+			continue
+		}
+		var report = &types.SignedNoAckReportHeader{
+			NoAckReportHeader: types.NoAckReportHeader{
+				NodeID:    server,
+				Timestamp: c.rt.now().UTC(),
+				Response:  *v,
+			},
+		}
+		if err := report.Sign(c.pk); err != nil {
+			log.WithFields(log.Fields{
+				"peer":          c.rt.getPeerInfoString(),
+				"response_hash": v.Hash(),
+				"db":            c.databaseID,
+			}).WithError(err).Warning("failed to sign no-ack report")
+			continue
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return
+	}
+
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	if c.noAckCounts == nil {
+		c.noAckCounts = make(map[proto.NodeID]int32)
+	}
+	for _, v := range reports {
+		c.noAckCounts[v.Response.Request.NodeID]++
+	}
+	c.noAcks = append(c.noAcks, reports...)
+}
+
+// takeNoAckReports returns and clears the pending no-ack reports.
+func (c *Chain) takeNoAckReports() (reports []*types.SignedNoAckReportHeader) {
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	reports, c.noAcks = c.noAcks, nil
+	return
+}
+
+// resetNoAckCounts clears the no-ack counts of clients at the beginning of a billing period.
+func (c *Chain) resetNoAckCounts() {
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	c.noAckCounts = nil
+}
+
+// CheckNoAcks returns an error if the client node has reached the no-ack limit in the current
+// billing period.
+func (c *Chain) CheckNoAcks(node proto.NodeID) (err error) {
+	if c.rt.noAckLimit <= 0 {
+		return
+	}
+	c.noAcksLock.Lock()
+	defer c.noAcksLock.Unlock()
+	if cnt := c.noAckCounts[node]; cnt >= c.rt.noAckLimit {
+		err = errors.Wrapf(ErrTooManyNoAcks, "client %s has %d no-ack reports", node, cnt)
+	}
+	return
+}
+
+// noAckReports aggregates the no-ack reports in a billing period.
+type noAckReports struct {
+	acked   map[hash.Hash]struct{}
+	reports map[hash.Hash]*types.SignedNoAckReportHeader
+}
+
+func newNoAckReports() *noAckReports {
+	return &noAckReports{
+		acked:   make(map[hash.Hash]struct{}),
+		reports: make(map[hash.Hash]*types.SignedNoAckReportHeader),
+	}
+}
+
+func (r *noAckReports) add(block *types.Block) {
+	for _, v := range block.Acks {
+		r.acked[v.ResponseHash()] = struct{}{}
+	}
+	for _, v := range block.SignedHeader.NoAckReports {
+		// Only the reports signed by the block producer for its own responses are accepted
+		if v.NodeID != block.Producer() || v.Response.NodeID != v.NodeID ||
+			v.Signee == nil || !v.Signee.IsEqual(block.Signee()) {
+			continue
+		}
+		if err := v.Verify(); err != nil {
+			log.WithField("producer", block.Producer()).WithError(err).Warning(
+				"invalid no-ack report in block")
+			continue
+		}
+		r.reports[v.Response.Hash()] = v
+	}
+}
+
+// penalties returns the no-ack penalty costs: user -> reporting miner -> cost, where the accounts
+// are resolved from the signees by accountOf.
+func (r *noAckReports) penalties(
+	accountOf func(*asymmetric.PublicKey) (proto.AccountAddress, error),
+) (
+	costs map[proto.AccountAddress]map[proto.AccountAddress]uint64,
+) {
+	costs = make(map[proto.AccountAddress]map[proto.AccountAddress]uint64)
+	for k, v := range r.reports {
+		if _, ok := r.acked[k]; ok {
+			continue
+		}
+		user, err := accountOf(v.Response.Request.Signee)
+		if err != nil {
+			continue
+		}
+		miner, err := accountOf(v.Response.Signee)
+		if err != nil {
+			continue
+		}
+		var cost = v.Response.Cost.Gas()
+		if _, ok := costs[user]; !ok {
+			costs[user] = make(map[proto.AccountAddress]uint64)
+		}
+		costs[user][miner] += cost
+	}
+	return
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNoAckReports(t *testing.T) {
+	Convey("Given a chain with some expired responses", t, func() {
+		cli, err := newRandomNode()
+		So(err, ShouldBeNil)
+		miner, err := newRandomNode()
+		So(err, ShouldBeNil)
+		other, err := newRandomNode()
+		So(err, ShouldBeNil)
+
+		var (
+			c = &Chain{
+				ai: newAckIndex(),
+				pk: miner.PrivateKey,
+				rt: &runtime{server: miner.NodeID, noAckLimit: 2},
+			}
+			resps []*types.SignedResponseHeader
+		)
+		for i := 0; i < 3; i++ {
+			resp, err := createRandomQueryResponse(cli, miner)
+			So(err, ShouldBeNil)
+			err = c.ai.addResponse(0, resp)
+			So(err, ShouldBeNil)
+			resps = append(resps, resp)
+		}
+		// a response of another miner is never reported
+		resp, err := createRandomQueryResponse(cli, other)
+		So(err, ShouldBeNil)
+		err = c.ai.addResponse(0, resp)
+		So(err, ShouldBeNil)
+		// an acknowledged response is not expired as unacked
+		ack, err := createRandomQueryAckWithResponse(resps[2], cli)
+		So(err, ShouldBeNil)
+		err = c.ai.register(0, ack)
+		So(err, ShouldBeNil)
+
+		So(c.CheckNoAcks(cli.NodeID), ShouldBeNil)
+		var unacked = c.ai.advance(1)
+		So(unacked, ShouldHaveLength, 3)
+		c.reportNoAcks(unacked)
+		So(errors.Cause(c.CheckNoAcks(cli.NodeID)), ShouldEqual, ErrTooManyNoAcks)
+		So(c.CheckNoAcks(other.NodeID), ShouldBeNil)
+		c.rt.noAckLimit = 0
+		So(c.CheckNoAcks(cli.NodeID), ShouldBeNil)
+		c.rt.noAckLimit = 2
+		c.resetNoAckCounts()
+		So(c.CheckNoAcks(cli.NodeID), ShouldBeNil)
+
+		var reports = c.takeNoAckReports()
+		So(reports, ShouldHaveLength, 2)
+		So(c.takeNoAckReports(), ShouldBeEmpty)
+		for _, v := range reports {
+			So(v.NodeID, ShouldEqual, miner.NodeID)
+			So(v.Verify(), ShouldBeNil)
+		}
+
+		Convey("The reports should be charged in billing if not acknowledged", func() {
+			var block = &types.Block{SignedHeader: types.SignedHeader{Header: types.Header{
+				Producer:     miner.NodeID,
+				NoAckReports: reports,
+			}}}
+			err = block.PackAndSignBlock(miner.PrivateKey)
+			So(err, ShouldBeNil)
+			var acked = &types.Block{Acks: []*types.SignedAckHeader{func() *types.SignedAckHeader {
+				ack, err := createRandomQueryAckWithResponse(&reports[1].Response, cli)
+				So(err, ShouldBeNil)
+				return ack
+			}()}}
+			var na = newNoAckReports()
+			na.add(block)
+			na.add(acked)
+			userAddr, err := crypto.PubKeyHash(cli.PublicKey)
+			So(err, ShouldBeNil)
+			minerAddr, err := crypto.PubKeyHash(miner.PublicKey)
+			So(err, ShouldBeNil)
+			var (
+				penalties = na.penalties(crypto.PubKeyHash)
+				expected  = reports[0].Response.Cost.Gas()
+			)
+			So(penalties, ShouldHaveLength, 1)
+			So(penalties[userAddr][minerAddr], ShouldEqual, expected)
+
+			// the penalties are charged but never paid to the reporting miner
+			c.rt.peers = &proto.Peers{}
+			var node = newBlockNode(1, acked, newBlockNode(0, block, nil))
+			header, err := c.collectBilling(node, 2)
+			So(err, ShouldBeNil)
+			So(header.Users, ShouldHaveLength, 1)
+			So(header.Users[0].User, ShouldEqual, userAddr)
+			So(header.Users[0].Cost, ShouldEqual, penalties[userAddr][minerAddr])
+			So(header.Users[0].Miners, ShouldBeEmpty)
+			So(header.NoAckMiners, ShouldResemble, []proto.AccountAddress{minerAddr})
+		})
+		Convey("The reports should be ignored if not signed by the block producer", func() {
+			var block = &types.Block{SignedHeader: types.SignedHeader{Header: types.Header{
+				Producer:     miner.NodeID,
+				NoAckReports: reports,
+			}}}
+			err = block.PackAndSignBlock(other.PrivateKey)
+			So(err, ShouldBeNil)
+			var na = newNoAckReports()
+			na.add(block)
+			So(na.penalties(crypto.PubKeyHash), ShouldBeEmpty)
+		})
+	})
+}
@@ -17,7 +17,11 @@
 package sqlchain
 
 import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	x "github.com/CovenantSQL/CovenantSQL/xenomint"
 )
 
 // ChainRPCService defines a sql-chain RPC server.
@@ -37,6 +41,8 @@ type AdviseNewBlockResp struct {
 
 // AdviseBinLogReq defines a request of the AdviseBinLog RPC method.
 type AdviseBinLogReq struct {
+	// Logs are the continuous write logs in the log order.
+	Logs []*types.QueryAsTx
 }
 
 // AdviseBinLogResp defines a response of the AdviseBinLog RPC method.
@@ -63,6 +69,31 @@ type FetchBlockResp struct {
 	Block  *types.Block
 }
 
+// FetchSnapshotReq defines a request of the FetchSnapshot RPC method.
+type FetchSnapshotReq struct {
+	// node is the authenticated caller set by the mux service, which is never encoded.
+	node proto.NodeID
+}
+
+// FetchSnapshotResp defines a response of the FetchSnapshot RPC method.
+type FetchSnapshotResp struct {
+	Snapshot *x.Snapshot
+}
+
+// FetchMerkleProofReq defines a request of the FetchMerkleProof RPC method.
+type FetchMerkleProofReq struct {
+	Height int32
+	// Leaf is the hash of a failed request header, a query response header or an ack header.
+	Leaf hash.Hash
+}
+
+// FetchMerkleProofResp defines a response of the FetchMerkleProof RPC method.
+type FetchMerkleProofResp struct {
+	Height int32
+	Header *types.SignedHeader
+	Proof  *merkle.Proof
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) (
 	err error) {
@@ -72,8 +103,7 @@ func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNew
 
 // AdviseBinLog is the RPC method to advise a new binary log to the target server.
 func (s *ChainRPCService) AdviseBinLog(req *AdviseBinLogReq, resp *AdviseBinLogResp) error {
-	// TODO(leventeliu): need implementation.
-	return nil
+	return s.chain.applyBinLog(req.Logs)
 }
 
 // AdviseAckedQuery is the RPC method to advise a new acknowledged query to the target server.
@@ -88,3 +118,20 @@ func (s *ChainRPCService) FetchBlock(req *FetchBlockReq, resp *FetchBlockResp) (
 	resp.Block, err = s.chain.FetchBlock(req.Height)
 	return
 }
+
+// FetchSnapshot is the RPC method to fetch the current state snapshot from the target server,
+// which is only served to the peers of the database.
+func (s *ChainRPCService) FetchSnapshot(req *FetchSnapshotReq, resp *FetchSnapshotResp) (err error) {
+	resp.Snapshot, err = s.chain.FetchSnapshot(req.node)
+	return
+}
+
+// FetchMerkleProof is the RPC method to fetch the merkle inclusion proof of a leaf in a known
+// block from the target server.
+func (s *ChainRPCService) FetchMerkleProof(
+	req *FetchMerkleProofReq, resp *FetchMerkleProofResp) (err error,
+) {
+	resp.Height = req.Height
+	resp.Header, resp.Proof, err = s.chain.FetchMerkleProof(req.Height, &req.Leaf)
+	return
+}
@@ -49,8 +49,20 @@ type runtime struct {
 	queryTTL int32
 	// blockCacheTTL sets the cached block numbers.
 	blockCacheTTL int32
+	// archiveTTL sets the block periods after which blocks are archived, 0 if disabled.
+	archiveTTL int32
+	// archiveDir is the directory of the archive segments.
+	archiveDir string
+	// dropSettledArchives enables removing the archive segments with settled billing.
+	dropSettledArchives bool
 	// muxServer is the multiplexing service of sql-chain PRC.
 	muxService *MuxService
+	// eventualConsistency enables state digest checking of new blocks.
+	eventualConsistency bool
+	// binlogInterval is the write logs advising cycle.
+	binlogInterval time.Duration
+	// noAckLimit is the maximum no-ack reports of a client in a billing period.
+	noAckLimit int32
 
 	// peersMutex protects following peers-relative fields.
 	peersMutex sync.Mutex
@@ -80,6 +92,17 @@ type runtime struct {
 	offset time.Duration
 }
 
+func blockArchiveTTLRequired(c *Config) (ttl int32) {
+	if ttl = c.BlockArchiveTTL; ttl <= 0 {
+		return 0
+	}
+	// Blocks are always archived after they are evicted from cache
+	if cttl := blockCacheTTLRequired(c); ttl < cttl {
+		ttl = cttl
+	}
+	return
+}
+
 func blockCacheTTLRequired(c *Config) (ttl int32) {
 	var billingRequiredTTL = 2 * c.BillingPeriods
 	ttl = c.BlockCacheTTL
@@ -104,6 +127,8 @@ func newRunTime(ctx context.Context, c *Config) (r *runtime) {
 		tick:          c.Tick,
 		queryTTL:      c.QueryTTL,
 		blockCacheTTL: blockCacheTTLRequired(c),
+		archiveTTL:    blockArchiveTTLRequired(c),
+		archiveDir:    archiveDir(c.ChainFilePrefix),
 		muxService:    c.MuxService,
 		peers:         c.Peers,
 		server:        c.Server,
@@ -123,6 +148,11 @@ func newRunTime(ctx context.Context, c *Config) (r *runtime) {
 		nextTurn: 1,
 		head:     &state{},
 		offset:   time.Duration(0),
+
+		eventualConsistency: c.EventualConsistency,
+		binlogInterval:      c.BinLogInterval,
+		noAckLimit:          c.NoAckLimit,
+		dropSettledArchives: c.DropSettledArchives,
 	}
 
 	if c.Genesis != nil {
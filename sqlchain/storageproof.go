@@ -17,99 +17,104 @@
 package sqlchain
 
 import (
-	"errors"
+	"bytes"
+	"sort"
 
-	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
-// Answer is responded by node to confirm other nodes that the node stores data correctly
-type Answer struct {
-	// The block id that the question belongs to
-	PreviousBlockID BlockID
-	// The node id that provides this answer
-	NodeID proto.NodeID
-	// The answer for the question
-	Answer hash.Hash
-}
+// Storage proof protocol:
+//
+// 1. The challenge of each block is derived from its parent block hash, which selects some
+//    random rows of the database (see xenomint.StorageChallenge).
+// 2. The block producer answers the challenge with the hash of the selected rows bound to its
+//    node id, and records the answer along with the state sequence in the block header.
+// 3. Peers replaying the block compute the expected answer from their own replica if the local
+//    state sequence reaches the same one, and report the mismatched answer as a ProofFailure in
+//    their next produced blocks.
+// 4. A failure reported by the majority of the peers within a billing period is confirmed:
+//    the miner income of the period is withheld and the miner is reported in the UpdateBilling
+//    transaction, so that block producer could change its miner status.
 
-// NewAnswer generates an answer for storage proof
-func NewAnswer(previousBlockID BlockID, nodeID proto.NodeID, answer hash.Hash) *Answer {
-	return &Answer{
-		PreviousBlockID: previousBlockID,
-		NodeID:          nodeID,
-		Answer:          answer,
-	}
-}
+// reportProofFailure queues a storage proof failure of block to report in the next local block.
+func (c *Chain) reportProofFailure(block *types.Block) {
+	log.WithFields(log.Fields{
+		"peer":     c.rt.getPeerInfoString(),
+		"block":    block.BlockHash().String(),
+		"producer": block.Producer(),
+		"db":       c.databaseID,
+	}).Warning("storage proof check failed")
 
-// getNextPuzzle generate new puzzle which ask other nodes to get a specified record in database.
-// The index of next SQL (puzzle) is determined by the previous answer and previous block hash
-func getNextPuzzle(answers []Answer, previousBlock StorageProofBlock) (int32, error) {
-	var totalRecordsInSQLChain int32 = 10
-	var sum int32
-	if !CheckValid(answers) {
-		return -1, errors.New("some nodes have not submitted its answer")
-	}
-	for _, answer := range answers {
-		// check if answer is valid
-		if len(answer.Answer) != hash.HashSize {
-			return -1, errors.New("invalid answer format")
+	c.proofFailuresLock.Lock()
+	defer c.proofFailuresLock.Unlock()
+	for _, v := range c.proofFailures {
+		if v.Block.IsEqual(block.BlockHash()) {
+			return
 		}
-		sum += int32(hash.FNVHash32uint(answer.Answer[:]))
-	}
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid block format")
 	}
-	sum += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
-
-	nextPuzzle := sum % totalRecordsInSQLChain
-	return nextPuzzle, nil
+	c.proofFailures = append(c.proofFailures, &types.ProofFailure{
+		Block:    *block.BlockHash(),
+		Producer: block.Producer(),
+	})
 }
 
-// getNExtVerifier returns the id of next verifier.
-// ID is determined by the hash of previous block.
-func getNextVerifier(previousBlock, currentBlock StorageProofBlock) (int32, error) {
-	// check if block is valid
-	if len(previousBlock.ID) <= 0 {
-		return -1, errors.New("invalid previous block")
-	}
-	if len(currentBlock.Nodes) <= 0 {
-		return -1, errors.New("invalid current block")
-	}
-	verifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
-
-	return verifier, nil
+// takeProofFailures returns and clears the pending storage proof failures.
+func (c *Chain) takeProofFailures() (failures []*types.ProofFailure) {
+	c.proofFailuresLock.Lock()
+	defer c.proofFailuresLock.Unlock()
+	failures, c.proofFailures = c.proofFailures, nil
+	return
 }
 
-// selectRecord returns nth record in the table from the database
-func selectRecord(n int32) string {
-	return "hello world"
-}
+// proofFailureReports collects the storage proof failure reporters: failure -> reporters.
+type proofFailureReports map[types.ProofFailure]map[proto.NodeID]struct{}
 
-// CheckValid returns whether answers is valid
-// Checkvalid checks answers as follows:
-// 1. len(answers) == len(nodes) - 1
-// 2. answers[i].nodeID's answer is the same as the hash of verifier
-func CheckValid(answers []Answer) bool {
-	return len(answers) > 0
+func (r proofFailureReports) add(block *types.Block) {
+	for _, v := range block.SignedHeader.ProofFailures {
+		// self-reporting is meaningless
+		if v.Producer == block.Producer() {
+			continue
+		}
+		if _, ok := r[*v]; !ok {
+			r[*v] = make(map[proto.NodeID]struct{})
+		}
+		r[*v][block.Producer()] = struct{}{}
+	}
 }
 
-// GenerateAnswer will select specified record for proving.
-// In order to generate a unique answer which is different with other nodes' answer,
-// we hash(record + nodeID) as the answer
-func GenerateAnswer(answers []Answer, previousBlock StorageProofBlock, node proto.Node) (*Answer, error) {
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		return nil, err
+// confirmedProofFailures returns the miners whose storage proof failures are reported by the
+// majority of the other peers.
+func (c *Chain) confirmedProofFailures(reports proofFailureReports) (miners []proto.AccountAddress) {
+	var (
+		quorum = (len(c.rt.getPeers().Servers)-1)/2 + 1
+		failed = make(map[proto.AccountAddress]struct{})
+	)
+	for failure, reporters := range reports {
+		if len(reporters) < quorum {
+			continue
+		}
+		var node = failure.Producer
+		pub, err := kms.GetPublicKey(node)
+		if err != nil {
+			log.WithField("node", node).WithError(err).Warning("failed to get miner public key")
+			continue
+		}
+		addr, err := crypto.PubKeyHash(pub)
+		if err != nil {
+			log.WithField("node", node).WithError(err).Warning("failed to get miner address")
+			continue
+		}
+		failed[addr] = struct{}{}
 	}
-	record := []byte(selectRecord(sqlIndex))
-	// check if node is valid
-	if len(node.ID) <= 0 {
-		return nil, errors.New("invalid node format")
+	for k := range failed {
+		miners = append(miners, k)
 	}
-	answer := append(record, []byte(node.ID)...)
-
-	answerHash := hash.HashH(answer)
-	return NewAnswer(previousBlock.ID, node.ID, answerHash), nil
+	sort.Slice(miners, func(i, j int) bool {
+		return bytes.Compare(miners[i][:], miners[j][:]) < 0
+	})
+	return
 }
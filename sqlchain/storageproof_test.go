@@ -17,175 +17,59 @@
 package sqlchain
 
 import (
-	"reflect"
-	"strings"
 	"testing"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
 )
 
-var (
-	currentNode   proto.Node
-	voidNode      proto.Node
-	answers       []Answer
-	voidAnswer    []Answer
-	previousBlock StorageProofBlock
-	currentBlock  StorageProofBlock
-	voidBlock     StorageProofBlock
-)
-
-func TestNewAnswer(t *testing.T) {
-	wantedAnswer := Answer{
-		PreviousBlockID: "aaa",
-		NodeID:          "bbb",
-		Answer:          hash.HashH([]byte{1, 2, 3, 4, 5}),
-	}
-	answer := NewAnswer("aaa", "bbb", hash.HashH([]byte{1, 2, 3, 4, 5}))
-
-	if !reflect.DeepEqual(*answer, wantedAnswer) {
-		t.Errorf("the answer is %+v, should be %+v", answer, wantedAnswer)
-	}
-}
-
-func TestGetNextPuzzle(t *testing.T) {
-	var totalRecordsInSQLChain int32 = 10
-	index, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	var wantedIndex int32
-	for _, answer := range answers {
-		wantedIndex += int32(hash.FNVHash32uint(answer.Answer[:]))
-	}
-	wantedIndex += int32(hash.FNVHash32uint([]byte(previousBlock.ID)))
-	wantedIndex %= totalRecordsInSQLChain
-	if index != wantedIndex {
-		t.Errorf("the next sql index is %+v, should be %+v. "+
-			"Answers are %+v, and the previous block is %+v",
-			index, wantedIndex, answers, previousBlock)
-	}
-
-	// void answer
-	index, err = getNextPuzzle(voidAnswer, previousBlock)
-	if err == nil {
-		t.Errorf("index is %d, but should be failed", index)
-	}
-
-	// void block
-	index, err = getNextPuzzle(answers, voidBlock)
-	if err == nil {
-		t.Errorf("index is %d, but should be failed", index)
-	}
-}
-
-func TestGetNextVerifier(t *testing.T) {
-	verifier, err := getNextVerifier(previousBlock, currentBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	wantedVerifier := int32(hash.FNVHash32uint([]byte(previousBlock.ID))) % int32(len(currentBlock.Nodes))
-	if verifier != wantedVerifier {
-		t.Errorf("the next verifier is %d, should be %d", verifier, wantedVerifier)
-	}
-
-	// void previousBlock
-	verifier, err = getNextVerifier(voidBlock, currentBlock)
-	if err == nil {
-		t.Errorf("verifier is %d, but should be failed", verifier)
-	}
-
-	// void currentBlock
-	verifier, err = getNextVerifier(previousBlock, voidBlock)
-	if err == nil {
-		t.Errorf("verifier is %d, but should be failed", verifier)
-	}
-}
-
-func TestSelectRecord(t *testing.T) {
-	if strings.Compare(selectRecord(0), "hello world") != 0 {
-		t.Error("it should be hello world")
-	}
-}
-
-func TestCheckValid(t *testing.T) {
-	if !CheckValid(answers) {
-		t.Error("it should be true")
-	}
-}
-
-func TestGenerateAnswer(t *testing.T) {
-	answer, err := GenerateAnswer(answers, previousBlock, currentNode)
-	if err != nil {
-		t.Error(err)
-	}
-	sqlIndex, err := getNextPuzzle(answers, previousBlock)
-	if err != nil {
-		t.Error(err)
-	}
-	record := []byte(selectRecord(sqlIndex))
-	answerHash := hash.HashH(append(record, []byte(currentNode.ID)...))
-	wantedAnswer := NewAnswer(previousBlock.ID, currentNode.ID, answerHash)
-	if !reflect.DeepEqual(*answer, *wantedAnswer) {
-		t.Errorf("answer is %s, should be %s", *answer, *wantedAnswer)
-	}
-
-	// void answers
-	answer, err = GenerateAnswer(voidAnswer, previousBlock, currentNode)
-	if err == nil {
-		t.Errorf("answer is %+v, should be failed", answer)
-	}
-
-	// void block
-	answer, err = GenerateAnswer(answers, voidBlock, currentNode)
-	if err == nil {
-		t.Errorf("answer is %+v, should be failed", answer)
-	}
-
-	// void node
-	answer, err = GenerateAnswer(answers, previousBlock, voidNode)
-	if err == nil {
-		t.Errorf("answer is %+v, should be failed", answer)
-	}
-
-}
-
-func init() {
-	currentNode = proto.Node{ID: "123456"}
-	currentBlock = StorageProofBlock{
-		ID:    "def",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}},
-	}
-	previousBlock = StorageProofBlock{
-		ID:    "abc",
-		Nodes: []proto.Node{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}},
-	}
-	voidBlock = StorageProofBlock{
-		ID:    "",
-		Nodes: nil,
-	}
-	answers = []Answer{
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{1}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{2}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{3}),
-		},
-		{
-			PreviousBlockID: previousBlock.ID,
-			NodeID:          currentNode.ID,
-			Answer:          hash.HashH([]byte{4}),
-		},
-	}
-	voidAnswer = nil
-	voidNode = proto.Node{}
+func TestProofFailures(t *testing.T) {
+	Convey("Given a chain with some failed blocks", t, func() {
+		var (
+			c      = &Chain{rt: &runtime{}}
+			newBlk = func(producer proto.NodeID, failures ...*types.ProofFailure) *types.Block {
+				return &types.Block{
+					SignedHeader: types.SignedHeader{
+						Header: types.Header{
+							Producer:      producer,
+							ProofFailures: failures,
+						},
+						HSV: verifier.DefaultHashSignVerifierImpl{
+							DataHash: hash.THashH([]byte(producer)),
+						},
+					},
+				}
+			}
+			b1 = newBlk("node1")
+			b2 = newBlk("node2")
+		)
+		Convey("The failures should be reported once and taken", func() {
+			c.reportProofFailure(b1)
+			c.reportProofFailure(b2)
+			c.reportProofFailure(b1)
+			failures := c.takeProofFailures()
+			So(failures, ShouldHaveLength, 2)
+			So(failures[0].Producer, ShouldEqual, "node1")
+			So(failures[0].Block, ShouldResemble, *b1.BlockHash())
+			So(c.takeProofFailures(), ShouldBeEmpty)
+		})
+		Convey("The failure reports should be collected by distinct reporters", func() {
+			var (
+				f1      = &types.ProofFailure{Block: *b1.BlockHash(), Producer: "node1"}
+				f2      = &types.ProofFailure{Block: *b2.BlockHash(), Producer: "node2"}
+				reports = make(proofFailureReports)
+			)
+			reports.add(newBlk("node2", f1))
+			reports.add(newBlk("node2", f1))
+			reports.add(newBlk("node3", f1, f2))
+			// self-reporting is ignored
+			reports.add(newBlk("node1", f1))
+			So(reports, ShouldHaveLength, 2)
+			So(reports[*f1], ShouldHaveLength, 2)
+			So(reports[*f2], ShouldHaveLength, 1)
+		})
+	})
 }
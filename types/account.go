@@ -18,6 +18,7 @@ package types
 
 import (
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -102,6 +103,10 @@ const (
 	Arrears
 	// Arbitration defines the user/miner is in an arbitration.
 	Arbitration
+	// Draining defines the miner is handing off the database to a replacement miner.
+	Draining
+	// Syncing defines the replacement miner is catching up the database from the other miners.
+	Syncing
 	// NumberOfStatus defines the number of status.
 	NumberOfStatus
 )
@@ -153,10 +158,14 @@ type SQLChainProfile struct {
 	Period            uint64
 	GasPrice          uint64
 	LastUpdatedHeight uint32
+	// LastRatedHeight is the height of the last billing which the miners are rated with.
+	LastRatedHeight uint32
 
 	TokenType TokenType
 
 	Owner proto.AccountAddress
+	// PendingOwner is the new owner of a pending ownership transfer, which is not accepted yet.
+	PendingOwner proto.AccountAddress
 	// first miner in the list is leader
 	Miners []*MinerInfo
 
@@ -178,12 +187,24 @@ type ProviderProfile struct {
 	GasPrice      uint64
 	TokenType     TokenType // default Particle
 	NodeID        proto.NodeID
+	Labels        Labels
 }
 
+// RatingUnit is the fixed-point unit of miner ratings, which stands for a rating of 1.
+const RatingUnit uint64 = 1000000
+
 // Account store its balance, and other mate data.
 type Account struct {
 	Address      proto.AccountAddress
 	TokenBalance [SupportTokenNumber]uint64
-	Rating       float64
+	Rating       uint64 // miner rating in [0, RatingUnit]
 	NextNonce    pi.AccountNonce
+	// MultiSig is the registered key set of a multisig account, or nil for a plain account.
+	MultiSig *MultiSigAccount
+	// PublicKey is the registered key of a rotated account, or nil if the account is still bound
+	// to the key of its address.
+	PublicKey *asymmetric.PublicKey
+	// RetiredKeys are the addresses of the keys replaced by later rotations of the account, the
+	// queries signed by these keys before the rotations are still charged to the account.
+	RetiredKeys []proto.AccountAddress
 }
@@ -10,21 +10,50 @@ import (
 func (z *Account) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
-	o = append(o, 0x84, 0x84)
+	// map header, size 7
+	o = append(o, 0x87, 0x87)
+	if z.MultiSig == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.MultiSig.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x87)
+	if z.PublicKey == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.PublicKey.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x87)
 	o = hsp.AppendArrayHeader(o, uint32(SupportTokenNumber))
 	for za0001 := range z.TokenBalance {
 		o = hsp.AppendUint64(o, z.TokenBalance[za0001])
 	}
-	o = append(o, 0x84)
-	o = hsp.AppendFloat64(o, z.Rating)
-	o = append(o, 0x84)
+	o = append(o, 0x87)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.RetiredKeys)))
+	for za0002 := range z.RetiredKeys {
+		if oTemp, err := z.RetiredKeys[za0002].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x87)
+	o = hsp.AppendUint64(o, z.Rating)
+	o = append(o, 0x87)
 	if oTemp, err := z.NextNonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x87)
 	if oTemp, err := z.Address.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -35,7 +64,23 @@ func (z *Account) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Account) Msgsize() (s int) {
-	s = 1 + 13 + hsp.ArrayHeaderSize + (int(SupportTokenNumber) * (hsp.Uint64Size)) + 7 + hsp.Float64Size + 10 + z.NextNonce.Msgsize() + 8 + z.Address.Msgsize()
+	s = 1 + 9
+	if z.MultiSig == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.MultiSig.Msgsize()
+	}
+	s += 10
+	if z.PublicKey == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.PublicKey.Msgsize()
+	}
+	s += 13 + hsp.ArrayHeaderSize + (int(SupportTokenNumber) * (hsp.Uint64Size)) + 12 + hsp.ArrayHeaderSize
+	for za0002 := range z.RetiredKeys {
+		s += z.RetiredKeys[za0002].Msgsize()
+	}
+	s += 7 + hsp.Uint64Size + 10 + z.NextNonce.Msgsize() + 8 + z.Address.Msgsize()
 	return
 }
 
@@ -106,14 +151,20 @@ func (z *MinerInfo) Msgsize() (s int) {
 func (z *ProviderProfile) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 9
-	o = append(o, 0x89, 0x89)
+	// map header, size 10
+	o = append(o, 0x8a, 0x8a)
+	if oTemp, err := z.Labels.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8a)
 	if oTemp, err := z.TokenType.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.TargetUser)))
 	for za0001 := range z.TargetUser {
 		if oTemp, err := z.TargetUser[za0001].MarshalHash(); err != nil {
@@ -122,34 +173,34 @@ func (z *ProviderProfile) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendFloat64(o, z.LoadAvgPerCPU)
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	if oTemp, err := z.Provider.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Deposit)
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.GasPrice)
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Space)
-	o = append(o, 0x89)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Memory)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ProviderProfile) Msgsize() (s int) {
-	s = 1 + 10 + z.TokenType.Msgsize() + 11 + hsp.ArrayHeaderSize
+	s = 1 + 7 + z.Labels.Msgsize() + 10 + z.TokenType.Msgsize() + 11 + hsp.ArrayHeaderSize
 	for za0001 := range z.TargetUser {
 		s += z.TargetUser[za0001].Msgsize()
 	}
@@ -161,20 +212,20 @@ func (z *ProviderProfile) Msgsize() (s int) {
 func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 11
-	o = append(o, 0x8b, 0x8b)
+	// map header, size 13
+	o = append(o, 0x8d, 0x8d)
 	if oTemp, err := z.Meta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	if oTemp, err := z.TokenType.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Miners)))
 	for za0001 := range z.Miners {
 		if z.Miners[za0001] == nil {
@@ -187,7 +238,7 @@ func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Users)))
 	for za0002 := range z.Users {
 		if z.Users[za0002] == nil {
@@ -200,31 +251,39 @@ func (z *SQLChainProfile) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	o = hsp.AppendBytes(o, z.EncodedGenesis)
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	if oTemp, err := z.Owner.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
+	if oTemp, err := z.PendingOwner.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8d)
 	if oTemp, err := z.Address.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	if oTemp, err := z.ID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
+	o = hsp.AppendUint32(o, z.LastRatedHeight)
+	o = append(o, 0x8d)
 	o = hsp.AppendUint32(o, z.LastUpdatedHeight)
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	o = hsp.AppendUint64(o, z.Period)
-	o = append(o, 0x8b)
+	o = append(o, 0x8d)
 	o = hsp.AppendUint64(o, z.GasPrice)
 	return
 }
@@ -247,7 +306,7 @@ func (z *SQLChainProfile) Msgsize() (s int) {
 			s += z.Users[za0002].Msgsize()
 		}
 	}
-	s += 15 + hsp.BytesPrefixSize + len(z.EncodedGenesis) + 6 + z.Owner.Msgsize() + 8 + z.Address.Msgsize() + 3 + z.ID.Msgsize() + 18 + hsp.Uint32Size + 7 + hsp.Uint64Size + 9 + hsp.Uint64Size
+	s += 15 + hsp.BytesPrefixSize + len(z.EncodedGenesis) + 6 + z.Owner.Msgsize() + 13 + z.PendingOwner.Msgsize() + 8 + z.Address.Msgsize() + 3 + z.ID.Msgsize() + 16 + hsp.Uint32Size + 18 + hsp.Uint32Size + 7 + hsp.Uint64Size + 9 + hsp.Uint64Size
 	return
 }
 
@@ -17,6 +17,9 @@
 package types
 
 import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -31,3 +34,46 @@ type AdviseBillingResp struct {
 	proto.Envelope
 	Resp *BillingRequest
 }
+
+// BillingPreviewReq defines a request of the BillingPreview RPC method.
+type BillingPreviewReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// BillingPreviewResp defines a response of the BillingPreview RPC method.
+type BillingPreviewResp struct {
+	proto.Envelope
+	// StartHeight and EndHeight bound the sqlchain blocks of the pending billing window.
+	StartHeight int32
+	EndHeight   int32
+	// Billing is the pending charges in gas units, nil if there is no pending block.
+	Billing *UpdateBillingHeader
+	// GasPrice is the current gas price of the database.
+	GasPrice uint64
+}
+
+// Invoice defines a confirmed billing of a database.
+type Invoice struct {
+	Hash      hash.Hash
+	Height    uint32
+	Timestamp time.Time
+	Billing   UpdateBillingHeader
+}
+
+// QueryInvoicesReq defines a request of the QueryInvoices RPC method.
+type QueryInvoicesReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	// FromHeight and ToHeight bound the main chain blocks to query, ToHeight 0 means no bound.
+	FromHeight uint32
+	ToHeight   uint32
+}
+
+// QueryInvoicesResp defines a response of the QueryInvoices RPC method.
+type QueryInvoicesResp struct {
+	proto.Envelope
+	Invoices []*Invoice
+	// GasPrice is the current gas price of the database, 0 if the database no longer exists.
+	GasPrice uint64
+}
@@ -37,7 +37,39 @@ type Header struct {
 	GenesisHash hash.Hash
 	ParentHash  hash.Hash
 	MerkleRoot  hash.Hash
-	Timestamp   time.Time
+	// StateRoot is the merkle root of the table digests of the database state after the block
+	// queries are applied.
+	StateRoot hash.Hash
+	// StateSeq is the database state sequence which StateRoot and StorageProof are computed at.
+	StateSeq uint64
+	// StorageProof is the producer answer to the storage challenge derived from ParentHash.
+	StorageProof hash.Hash
+	// ProofFailures reports the storage proofs in previous blocks failed the producer checking.
+	ProofFailures []*ProofFailure
+	// NoAckReports reports the responses of the producer which are not acknowledged by clients.
+	NoAckReports []*SignedNoAckReportHeader
+	// Lineage records the source of a forked database in its genesis block.
+	Lineage   Lineage
+	Timestamp time.Time
+}
+
+// Lineage defines the source database and block which a forked database is seeded from.
+type Lineage struct {
+	// Source is the source database, empty if the database is not forked.
+	Source proto.DatabaseID
+	Height int32
+	Block  hash.Hash
+}
+
+// IsForked returns whether the lineage refers to a source database.
+func (l *Lineage) IsForked() bool {
+	return l.Source != ""
+}
+
+// ProofFailure defines a storage proof failure of block producer.
+type ProofFailure struct {
+	Block    hash.Hash
+	Producer proto.NodeID
 }
 
 // SignedHeader is block header along with its producer signature.
@@ -152,6 +184,21 @@ func (b *Block) ParentHash() *hash.Hash {
 	return &b.SignedHeader.ParentHash
 }
 
+// Lineage returns the lineage field of the block header.
+func (b *Block) Lineage() *Lineage {
+	return &b.SignedHeader.Lineage
+}
+
+// StateRoot returns the state root field of the block header.
+func (b *Block) StateRoot() *hash.Hash {
+	return &b.SignedHeader.StateRoot
+}
+
+// StorageProof returns the storage proof field of the block header.
+func (b *Block) StorageProof() *hash.Hash {
+	return &b.SignedHeader.StorageProof
+}
+
 // BlockHash returns the parent hash field of the block header.
 func (b *Block) BlockHash() *hash.Hash {
 	return &b.SignedHeader.HSV.DataHash
@@ -167,8 +214,10 @@ func (b *Block) Signee() *ca.PublicKey {
 	return b.SignedHeader.HSV.Signee
 }
 
-func (b *Block) computeMerkleRoot() hash.Hash {
-	var hs = make([]*hash.Hash, 0, len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks))
+// merkleLeaves returns the merkle leaves of the block: the hashes of the failed requests, the
+// query responses and the acks in order.
+func (b *Block) merkleLeaves() (hs []*hash.Hash) {
+	hs = make([]*hash.Hash, 0, len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks))
 	for i := range b.FailedReqs {
 		h := b.FailedReqs[i].Header.Hash()
 		hs = append(hs, &h)
@@ -181,7 +230,25 @@ func (b *Block) computeMerkleRoot() hash.Hash {
 		h := b.Acks[i].Hash()
 		hs = append(hs, &h)
 	}
-	return *merkle.NewMerkle(hs).GetRoot()
+	return
+}
+
+func (b *Block) computeMerkleRoot() hash.Hash {
+	return *merkle.NewMerkle(b.merkleLeaves()).GetRoot()
+}
+
+// MerkleProof returns the inclusion proof of the merkle leaf in the block, which is the hash of a
+// failed request header, a query response header or an ack header. A query request is included
+// by its response.
+func (b *Block) MerkleProof(leaf *hash.Hash) (proof *merkle.Proof, err error) {
+	var hs = b.merkleLeaves()
+	for i, v := range hs {
+		if v.IsEqual(leaf) {
+			return merkle.NewMerkle(hs).GetProof(uint64(i))
+		}
+	}
+	err = ErrMerkleLeafNotFound
+	return
 }
 
 // Blocks is Block (reference) array.
@@ -131,41 +131,157 @@ func (z Blocks) Msgsize() (s int) {
 func (z *Header) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 6
-	o = append(o, 0x86, 0x86)
+	// map header, size 12
+	o = append(o, 0x8c, 0x8c)
+	if oTemp, err := z.Lineage.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.ProofFailures)))
+	for za0001 := range z.ProofFailures {
+		if z.ProofFailures[za0001] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.ProofFailures[za0001].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
+	o = append(o, 0x8c)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.NoAckReports)))
+	for za0002 := range z.NoAckReports {
+		if z.NoAckReports[za0002] == nil {
+			o = hsp.AppendNil(o)
+		} else {
+			if oTemp, err := z.NoAckReports[za0002].MarshalHash(); err != nil {
+				return nil, err
+			} else {
+				o = hsp.AppendBytes(o, oTemp)
+			}
+		}
+	}
+	o = append(o, 0x8c)
 	if oTemp, err := z.GenesisHash.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x8c)
 	if oTemp, err := z.ParentHash.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x8c)
 	if oTemp, err := z.MerkleRoot.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x8c)
+	if oTemp, err := z.StateRoot.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
+	if oTemp, err := z.StorageProof.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8c)
 	o = hsp.AppendInt32(o, z.Version)
-	o = append(o, 0x86)
+	o = append(o, 0x8c)
 	if oTemp, err := z.Producer.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x86)
+	o = append(o, 0x8c)
 	o = hsp.AppendTime(o, z.Timestamp)
+	o = append(o, 0x8c)
+	o = hsp.AppendUint64(o, z.StateSeq)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Header) Msgsize() (s int) {
-	s = 1 + 12 + z.GenesisHash.Msgsize() + 11 + z.ParentHash.Msgsize() + 11 + z.MerkleRoot.Msgsize() + 8 + hsp.Int32Size + 9 + z.Producer.Msgsize() + 10 + hsp.TimeSize
+	s = 1 + 8 + z.Lineage.Msgsize() + 14 + hsp.ArrayHeaderSize
+	for za0001 := range z.ProofFailures {
+		if z.ProofFailures[za0001] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.ProofFailures[za0001].Msgsize()
+		}
+	}
+	s += 13 + hsp.ArrayHeaderSize
+	for za0002 := range z.NoAckReports {
+		if z.NoAckReports[za0002] == nil {
+			s += hsp.NilSize
+		} else {
+			s += z.NoAckReports[za0002].Msgsize()
+		}
+	}
+	s += 12 + z.GenesisHash.Msgsize() + 11 + z.ParentHash.Msgsize() + 11 + z.MerkleRoot.Msgsize() + 10 + z.StateRoot.Msgsize() + 13 + z.StorageProof.Msgsize() + 8 + hsp.Int32Size + 9 + z.Producer.Msgsize() + 10 + hsp.TimeSize + 9 + hsp.Uint64Size
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *Lineage) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if oTemp, err := z.Block.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x83)
+	o = hsp.AppendInt32(o, z.Height)
+	o = append(o, 0x83)
+	if oTemp, err := z.Source.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Lineage) Msgsize() (s int) {
+	s = 1 + 6 + z.Block.Msgsize() + 7 + hsp.Int32Size + 7 + z.Source.Msgsize()
+	return
+}
+
+// MarshalHash marshals for hash
+func (z *ProofFailure) MarshalHash() (o []byte, err error) {
+	var b []byte
+	o = hsp.Require(b, z.Msgsize())
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if oTemp, err := z.Block.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x82)
+	if oTemp, err := z.Producer.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ProofFailure) Msgsize() (s int) {
+	s = 1 + 6 + z.Block.Msgsize() + 9 + z.Producer.Msgsize()
 	return
 }
 
@@ -25,6 +25,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
@@ -448,3 +449,28 @@ func Test(t *testing.T) {
 		}
 	})
 }
+
+func TestBlockMerkleProof(t *testing.T) {
+	Convey("Given a block with some acks", t, func() {
+		block, err := createRandomBlock(genesisHash, false)
+		So(err, ShouldBeNil)
+		for i := 0; i < 5; i++ {
+			block.Acks = append(block.Acks, &SignedAckHeader{
+				DefaultHashSignVerifierImpl: verifier.DefaultHashSignVerifierImpl{
+					DataHash: hash.Hash{byte(i + 1)},
+				},
+			})
+		}
+		block.SignedHeader.MerkleRoot = block.computeMerkleRoot()
+		Convey("The ack inclusion should be proved", func() {
+			for _, v := range block.Acks {
+				var leaf = v.Hash()
+				proof, err := block.MerkleProof(&leaf)
+				So(err, ShouldBeNil)
+				So(merkle.VerifyProof(&leaf, &block.SignedHeader.MerkleRoot, proof), ShouldBeTrue)
+			}
+			_, err = block.MerkleProof(&hash.Hash{0xff})
+			So(err, ShouldEqual, ErrMerkleLeafNotFound)
+		})
+	})
+}
@@ -29,12 +29,16 @@ import (
 //go:generate hsp
 
 // BPHeader defines the main chain block header.
+//
+// SnapshotRoot commits the state root of the main chain state after applying this block, and
+// is only set on blocks at the snapshot interval.
 type BPHeader struct {
-	Version    int32
-	Producer   proto.AccountAddress
-	MerkleRoot hash.Hash
-	ParentHash hash.Hash
-	Timestamp  time.Time
+	Version      int32
+	Producer     proto.AccountAddress
+	MerkleRoot   hash.Hash
+	ParentHash   hash.Hash
+	SnapshotRoot hash.Hash
+	Timestamp    time.Time
 }
 
 // BPSignedHeader defines the main chain header with the signature.
@@ -73,6 +77,18 @@ func (b *BPBlock) GetTxHashes() []*hash.Hash {
 	return hs
 }
 
+// TxProof returns the inclusion proof of the transaction in the block.
+func (b *BPBlock) TxProof(tx *hash.Hash) (proof *merkle.Proof, err error) {
+	var hs = b.GetTxHashes()
+	for i, v := range hs {
+		if v.IsEqual(tx) {
+			return merkle.NewMerkle(hs).GetProof(uint64(i))
+		}
+	}
+	err = ErrMerkleLeafNotFound
+	return
+}
+
 // PackAndSignBlock computes block's hash and sign it.
 func (b *BPBlock) PackAndSignBlock(signer *asymmetric.PrivateKey) error {
 	hs := b.GetTxHashes()
@@ -22,6 +22,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 )
 
@@ -135,3 +137,23 @@ func TestBlock_PackAndSignBlock(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestBlock_TxProof(t *testing.T) {
+	block, err := generateRandomBlock(genesisHash, false)
+	if err != nil {
+		t.Fatalf("failed to generate block: %v", err)
+	}
+	for _, tx := range block.Transactions {
+		h := tx.Hash()
+		proof, err := block.TxProof(&h)
+		if err != nil {
+			t.Fatalf("failed to get tx proof: %v", err)
+		}
+		if !merkle.VerifyProof(&h, &block.SignedHeader.MerkleRoot, proof) {
+			t.Fatalf("failed to verify tx proof of %s", h.String())
+		}
+	}
+	if _, err = block.TxProof(&hash.Hash{}); err != ErrMerkleLeafNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// BPSnapshotHeader defines the header of a main chain state snapshot.
+type BPSnapshotHeader struct {
+	Count     uint32
+	Height    uint32
+	BlockHash hash.Hash
+	StateRoot hash.Hash
+}
+
+// BPSnapshot defines a signed snapshot of the irreversible main chain state, which is the state
+// right after applying the block with the same hash.
+type BPSnapshot struct {
+	BPSnapshotHeader
+	verifier.DefaultHashSignVerifierImpl
+	Block     *BPBlock
+	Accounts  []*Account
+	Databases []*SQLChainProfile
+	Providers []*ProviderProfile
+}
+
+// Sign computes the state root of the snapshot and signs its header.
+func (s *BPSnapshot) Sign(signer *asymmetric.PrivateKey) (err error) {
+	if s.StateRoot, err = ComputeStateRoot(s.Accounts, s.Databases, s.Providers); err != nil {
+		return
+	}
+	return s.DefaultHashSignVerifierImpl.Sign(&s.BPSnapshotHeader, signer)
+}
+
+// Verify checks the snapshot header signature, the enclosed block and the state root, which
+// must match the snapshot commitment in the block header.
+func (s *BPSnapshot) Verify() (err error) {
+	if err = s.DefaultHashSignVerifierImpl.Verify(&s.BPSnapshotHeader); err != nil {
+		return
+	}
+	if s.Block == nil {
+		return errors.Wrap(ErrHashVerification, "missing snapshot block")
+	}
+	if err = s.Block.Verify(); err != nil {
+		return
+	}
+	if !s.BlockHash.IsEqual(s.Block.BlockHash()) {
+		return errors.Wrap(ErrHashVerification, "snapshot block hash not match")
+	}
+	if !s.StateRoot.IsEqual(&s.Block.SignedHeader.SnapshotRoot) {
+		return errors.Wrap(ErrStateRootVerification, "snapshot root not committed in block")
+	}
+	var root hash.Hash
+	if root, err = ComputeStateRoot(s.Accounts, s.Databases, s.Providers); err != nil {
+		return
+	}
+	if !root.IsEqual(&s.StateRoot) {
+		return errors.WithStack(ErrStateRootVerification)
+	}
+	return
+}
+
+// ComputeStateRoot returns the merkle root of the given main chain state objects. The result is
+// independent of the object order. The encoded genesis block of a sqlchain profile is signed
+// locally by each block producer, so only its header without the producer part is committed.
+func ComputeStateRoot(
+	accounts []*Account, databases []*SQLChainProfile, providers []*ProviderProfile,
+) (
+	root hash.Hash, err error,
+) {
+	var (
+		roots = make([]*hash.Hash, 3)
+		hs    []*hash.Hash
+	)
+	// Accounts
+	hs = make([]*hash.Hash, 0, len(accounts))
+	for _, v := range accounts {
+		var h hash.Hash
+		if h, err = hashObject(v); err != nil {
+			return
+		}
+		hs = append(hs, &h)
+	}
+	roots[0] = sortedMerkleRoot(hs)
+	// SQLChain profiles
+	hs = make([]*hash.Hash, 0, len(databases))
+	for _, v := range databases {
+		var (
+			h   hash.Hash
+			cpy = *v
+		)
+		if cpy.EncodedGenesis, err = genesisDigest(v.EncodedGenesis); err != nil {
+			return
+		}
+		if h, err = hashObject(&cpy); err != nil {
+			return
+		}
+		hs = append(hs, &h)
+	}
+	roots[1] = sortedMerkleRoot(hs)
+	// Providers
+	hs = make([]*hash.Hash, 0, len(providers))
+	for _, v := range providers {
+		var (
+			h   hash.Hash
+			cpy = *v
+		)
+		// Use the canonical node id form produced by the msgpack codec, so that the root of a
+		// decoded snapshot stays the same.
+		if nh, ierr := hash.NewHashFromStr(string(cpy.NodeID)); ierr == nil {
+			cpy.NodeID = proto.NodeID(nh.String())
+		}
+		if h, err = hashObject(&cpy); err != nil {
+			return
+		}
+		hs = append(hs, &h)
+	}
+	roots[2] = sortedMerkleRoot(hs)
+
+	root = *merkle.NewMerkle(roots).GetRoot()
+	return
+}
+
+// genesisDigest returns the hash of the encoded sqlchain genesis block with its producer and
+// signature cleared.
+func genesisDigest(enc []byte) (digest []byte, err error) {
+	if len(enc) == 0 {
+		return
+	}
+	var (
+		genesis = &Block{}
+		h       hash.Hash
+	)
+	if err = utils.DecodeMsgPack(enc, genesis); err != nil {
+		err = errors.Wrap(err, "failed to decode sqlchain genesis")
+		return
+	}
+	genesis.SignedHeader.Producer = ""
+	if h, err = hashObject(&genesis.SignedHeader.Header); err != nil {
+		return
+	}
+	digest = h[:]
+	return
+}
+
+func hashObject(mh verifier.MarshalHasher) (h hash.Hash, err error) {
+	var enc []byte
+	if enc, err = mh.MarshalHash(); err != nil {
+		return
+	}
+	h = hash.THashH(enc)
+	return
+}
+
+func sortedMerkleRoot(hs []*hash.Hash) *hash.Hash {
+	sort.Slice(hs, func(i, j int) bool {
+		return bytes.Compare(hs[i][:], hs[j][:]) < 0
+	})
+	return merkle.NewMerkle(hs).GetRoot()
+}
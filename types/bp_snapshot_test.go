@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBPSnapshot(t *testing.T) {
+	Convey("test bp snapshot", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(priv.PubKey())
+		So(err, ShouldBeNil)
+		priv2, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			node1 = (&proto.RawNodeID{Hash: hash.Hash{0x1}}).ToNodeID()
+			node2 = (&proto.RawNodeID{Hash: hash.Hash{0x2}}).ToNodeID()
+		)
+
+		// Encode a sqlchain genesis block signed by the given producer
+		encodeGenesis := func(
+			producer proto.NodeID, signer *asymmetric.PrivateKey, lineage Lineage,
+		) []byte {
+			gb := &Block{
+				SignedHeader: SignedHeader{
+					Header: Header{
+						Version:   0x01000000,
+						Producer:  producer,
+						Lineage:   lineage,
+						Timestamp: time.Unix(1000, 0).UTC(),
+					},
+				},
+			}
+			So(gb.PackAndSignBlock(signer), ShouldBeNil)
+			enc, err := utils.EncodeMsgPack(gb)
+			So(err, ShouldBeNil)
+			return enc.Bytes()
+		}
+
+		var (
+			accounts = []*Account{
+				{Address: addr, TokenBalance: [SupportTokenNumber]uint64{10, 10}},
+				{Address: proto.AccountAddress{0x1}, NextNonce: 3},
+			}
+			databases = []*SQLChainProfile{
+				{ID: "db1", Owner: addr, EncodedGenesis: encodeGenesis(node1, priv, Lineage{})},
+			}
+			providers = []*ProviderProfile{
+				{Provider: addr, Deposit: 10},
+			}
+		)
+
+		root, err := ComputeStateRoot(accounts, databases, providers)
+		So(err, ShouldBeNil)
+		reordered, err := ComputeStateRoot([]*Account{accounts[1], accounts[0]}, []*SQLChainProfile{
+			{ID: "db1", Owner: addr, EncodedGenesis: encodeGenesis(node2, priv2, Lineage{})},
+		}, providers)
+		So(err, ShouldBeNil)
+		So(reordered, ShouldResemble, root)
+		forked, err := ComputeStateRoot(accounts, []*SQLChainProfile{
+			{ID: "db1", Owner: addr, EncodedGenesis: encodeGenesis(
+				node1, priv, Lineage{Source: "db0", Height: 1})},
+		}, providers)
+		So(err, ShouldBeNil)
+		So(forked, ShouldNotResemble, root)
+		_, err = ComputeStateRoot(accounts, []*SQLChainProfile{
+			{ID: "db1", Owner: addr, EncodedGenesis: []byte{0x1}},
+		}, providers)
+		So(err, ShouldNotBeNil)
+		changed, err := ComputeStateRoot(accounts[:1], databases, providers)
+		So(err, ShouldBeNil)
+		So(changed, ShouldNotResemble, root)
+
+		block := &BPBlock{
+			SignedHeader: BPSignedHeader{
+				BPHeader: BPHeader{
+					Producer:     addr,
+					SnapshotRoot: root,
+					Timestamp:    time.Now().UTC(),
+				},
+			},
+		}
+		err = block.PackAndSignBlock(priv)
+		So(err, ShouldBeNil)
+
+		snapshot := &BPSnapshot{
+			BPSnapshotHeader: BPSnapshotHeader{
+				Count:     4,
+				Height:    5,
+				BlockHash: block.SignedHeader.BlockHash,
+			},
+			Block:     block,
+			Accounts:  accounts,
+			Databases: databases,
+			Providers: providers,
+		}
+		err = snapshot.Sign(priv)
+		So(err, ShouldBeNil)
+		So(snapshot.StateRoot, ShouldResemble, root)
+		err = snapshot.Verify()
+		So(err, ShouldBeNil)
+
+		enc, err := utils.EncodeMsgPack(snapshot)
+		So(err, ShouldBeNil)
+		var dec = &BPSnapshot{}
+		err = utils.DecodeMsgPack(enc.Bytes(), dec)
+		So(err, ShouldBeNil)
+		err = dec.Verify()
+		So(err, ShouldBeNil)
+
+		// Tamper with the state objects
+		dec.Accounts[0].TokenBalance[Particle] = 100
+		err = dec.Verify()
+		So(errors.Cause(err), ShouldEqual, ErrStateRootVerification)
+
+		// Snapshot of a block without commitment
+		block.SignedHeader.SnapshotRoot = root
+		block.SignedHeader.SnapshotRoot[0]++
+		err = block.PackAndSignBlock(priv)
+		So(err, ShouldBeNil)
+		snapshot.BlockHash = block.SignedHeader.BlockHash
+		err = snapshot.Sign(priv)
+		So(err, ShouldBeNil)
+		err = snapshot.Verify()
+		So(errors.Cause(err), ShouldEqual, ErrStateRootVerification)
+
+		// Snapshot of another block
+		snapshot.BlockHash[0]++
+		err = snapshot.Sign(priv)
+		So(err, ShouldBeNil)
+		err = snapshot.Verify()
+		So(errors.Cause(err), ShouldEqual, ErrHashVerification)
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -72,6 +73,34 @@ type FetchLastIrreversibleBlockResp struct {
 	Height    uint32
 	Block     *BPBlock
 	SQLChains []*SQLChainProfile
+	// Accounts are the rotated accounts of the SQLChain users and miners, which bind keys other
+	// than the ones of their addresses or keep the retired keys of previous rotations.
+	Accounts []*Account
+}
+
+// FetchSnapshotReq defines a request of the FetchSnapshot RPC method.
+type FetchSnapshotReq struct {
+	proto.Envelope
+	Count uint32 // 0 for the latest snapshot
+}
+
+// FetchSnapshotResp defines a response of the FetchSnapshot RPC method.
+type FetchSnapshotResp struct {
+	proto.Envelope
+	Snapshot *BPSnapshot
+}
+
+// FetchHeadersReq defines a request of the FetchHeaders RPC method.
+type FetchHeadersReq struct {
+	proto.Envelope
+	From uint32
+	To   uint32
+}
+
+// FetchHeadersResp defines a response of the FetchHeaders RPC method.
+type FetchHeadersResp struct {
+	proto.Envelope
+	Headers []*BPSignedHeader
 }
 
 // FetchBlockByCountReq define a request of the FetchBlockByCount RPC method.
@@ -185,3 +214,18 @@ type QueryTxStateResp struct {
 	Hash  hash.Hash
 	State pi.TransactionState
 }
+
+// QueryTxProofReq defines a request of the QueryTxProof RPC method.
+type QueryTxProofReq struct {
+	proto.Envelope
+	Hash hash.Hash
+}
+
+// QueryTxProofResp defines a response of the QueryTxProof RPC method.
+type QueryTxProofResp struct {
+	proto.Envelope
+	Hash   hash.Hash
+	Height uint32
+	Header *BPSignedHeader
+	Proof  *merkle.Proof
+}
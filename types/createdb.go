@@ -34,6 +34,7 @@ type CreateDatabaseHeader struct {
 	AdvancePayment uint64
 	TokenType      TokenType
 	Nonce          pi.AccountNonce
+	pi.TransactionFeeMixin
 }
 
 // GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
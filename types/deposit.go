@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// DepositToDatabaseHeader defines the database deposit transaction header.
+type DepositToDatabaseHeader struct {
+	TargetSQLChain proto.AccountAddress
+	Amount         uint64
+	TokenType      TokenType
+	Nonce          pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *DepositToDatabaseHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// DepositToDatabase defines the database deposit transaction, which tops up the advance payment
+// of the sender in the target database.
+type DepositToDatabase struct {
+	DepositToDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDepositToDatabase returns new instance.
+func NewDepositToDatabase(header *DepositToDatabaseHeader) *DepositToDatabase {
+	return &DepositToDatabase{
+		DepositToDatabaseHeader: *header,
+		TransactionTypeMixin:    *pi.NewTransactionTypeMixin(pi.TransactionTypeDepositToDatabase),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (dd *DepositToDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return dd.DefaultHashSignVerifierImpl.Sign(&dd.DepositToDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (dd *DepositToDatabase) Verify() error {
+	return dd.DefaultHashSignVerifierImpl.Verify(&dd.DepositToDatabaseHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (dd *DepositToDatabase) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(dd.Signee)
+	return addr
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeDepositToDatabase, (*DepositToDatabase)(nil))
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// DisputeHeader defines the Dispute transaction header.
+type DisputeHeader struct {
+	Receiver proto.AccountAddress
+	// Response is the disputed response signed by the accused miner, which also carries the
+	// original request signed by the user.
+	Response SignedResponseHeader
+	// Witnesses are the responses of the same request from the other miners of the database,
+	// which must be executed against the same database state, i.e. the same LogOffset, as the
+	// disputed response.
+	Witnesses []*SignedResponseHeader
+	Nonce     pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// Dispute defines the Dispute transaction, which is submitted by a database user to accuse a
+// miner of returning a wrong query result.
+type Dispute struct {
+	DisputeHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDispute returns new instance.
+func NewDispute(header *DisputeHeader) *Dispute {
+	return &Dispute{
+		DisputeHeader:        *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeDispute),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (d *Dispute) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(d.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (d *Dispute) GetAccountNonce() pi.AccountNonce {
+	return d.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (d *Dispute) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return d.DefaultHashSignVerifierImpl.Sign(&d.DisputeHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify, the evidences are verified as well.
+func (d *Dispute) Verify() (err error) {
+	if err = d.DefaultHashSignVerifierImpl.Verify(&d.DisputeHeader); err != nil {
+		return
+	}
+	if err = d.Response.Verify(); err != nil {
+		return errors.Wrap(err, "verify disputed response")
+	}
+	var reqHash = d.Response.Request.Hash()
+	for i, v := range d.Witnesses {
+		if v == nil {
+			return errors.Wrapf(ErrInvalidDispute, "nil witness #%d", i)
+		}
+		if v.Request.Hash() != reqHash {
+			return errors.Wrapf(ErrInvalidDispute, "witness #%d doesn't match request", i)
+		}
+		// Responses of different states may legally disagree, e.g. a read replayed after a write
+		if v.LogOffset != d.Response.LogOffset {
+			return errors.Wrapf(ErrInvalidDispute,
+				"witness #%d is executed at offset %d, expected %d",
+				i, v.LogOffset, d.Response.LogOffset)
+		}
+		if err = v.Verify(); err != nil {
+			return errors.Wrapf(err, "verify witness #%d", i)
+		}
+	}
+	return
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeDispute, (*Dispute)(nil))
+}
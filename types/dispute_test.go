@@ -0,0 +1,83 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDispute(t *testing.T) {
+	Convey("Given a dispute with witnesses", t, func() {
+		userKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		minerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			req     = SignedRequestHeader{RequestHeader: RequestHeader{QueryType: ReadQuery}}
+			respond = func(payload string) (resp *SignedResponseHeader) {
+				resp = &SignedResponseHeader{ResponseHeader: ResponseHeader{
+					Request:     req,
+					LogOffset:   10,
+					PayloadHash: hash.THashH([]byte(payload)),
+				}}
+				So(resp.Sign(minerKey), ShouldBeNil)
+				return
+			}
+		)
+		So(req.Sign(userKey), ShouldBeNil)
+		var d = NewDispute(&DisputeHeader{
+			Response:  *respond("wrong"),
+			Witnesses: []*SignedResponseHeader{respond("right")},
+			Nonce:     1,
+		})
+		So(d.GetTransactionType(), ShouldEqual, pi.TransactionTypeDispute)
+		So(d.GetAccountNonce(), ShouldEqual, 1)
+		So(d.Sign(userKey), ShouldBeNil)
+		So(d.Verify(), ShouldBeNil)
+
+		Convey("The witness for another request should be rejected", func() {
+			var other = req
+			other.SeqNo++
+			So(other.Sign(userKey), ShouldBeNil)
+			var w = &SignedResponseHeader{ResponseHeader: ResponseHeader{Request: other}}
+			So(w.Sign(minerKey), ShouldBeNil)
+			d.Witnesses = append(d.Witnesses, w)
+			So(d.Sign(userKey), ShouldBeNil)
+			So(errors.Cause(d.Verify()), ShouldEqual, ErrInvalidDispute)
+		})
+		Convey("The witness executed against another state should be rejected", func() {
+			// The same read replayed after a write of the user
+			var w = respond("right")
+			w.LogOffset++
+			So(w.Sign(minerKey), ShouldBeNil)
+			d.Witnesses = append(d.Witnesses, w)
+			So(d.Sign(userKey), ShouldBeNil)
+			So(errors.Cause(d.Verify()), ShouldEqual, ErrInvalidDispute)
+		})
+		Convey("The tampered response should be rejected", func() {
+			d.Response.PayloadHash = hash.THashH([]byte("right"))
+			So(d.Sign(userKey), ShouldBeNil)
+			So(d.Verify(), ShouldNotBeNil)
+		})
+	})
+}
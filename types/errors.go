@@ -32,4 +32,20 @@ var (
 	ErrBillingNotMatch = errors.New("billing request doesn't match")
 	// ErrHashVerification indicates a failed hash verification.
 	ErrHashVerification = errors.New("hash verification failed")
+	// ErrMerkleLeafNotFound indicates that the merkle leaf is not found in the block.
+	ErrMerkleLeafNotFound = errors.New("merkle leaf not found")
+	// ErrInvalidDispute indicates that the dispute evidences are invalid.
+	ErrInvalidDispute = errors.New("invalid dispute")
+	// ErrInvalidMultiSigAccount indicates that the key set or threshold of a multisig account is
+	// invalid.
+	ErrInvalidMultiSigAccount = errors.New("invalid multisig account")
+	// ErrUnknownMultiSigKey indicates that the signee is not a key of the multisig account.
+	ErrUnknownMultiSigKey = errors.New("unknown multisig account key")
+	// ErrMultiSigThreshold indicates that the multisig transaction has not enough signatures.
+	ErrMultiSigThreshold = errors.New("multisig threshold not reached")
+	// ErrUnsupportedMultiSigTx indicates that the transaction type can not be wrapped by a multisig
+	// transaction.
+	ErrUnsupportedMultiSigTx = errors.New("unsupported multisig wrapped transaction")
+	// ErrStateRootVerification indicates a failed state root verification of a snapshot.
+	ErrStateRootVerification = errors.New("state root verification failed")
 )
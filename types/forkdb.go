@@ -0,0 +1,70 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// ForkDatabaseHeader defines the database fork transaction header.
+type ForkDatabaseHeader struct {
+	CreateDatabaseHeader
+	// Lineage is the source database and block which the new database is forked from.
+	Lineage Lineage
+}
+
+// ForkDatabase defines the database fork transaction, which creates a new database seeded from
+// the source database state at the lineage block.
+type ForkDatabase struct {
+	ForkDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewForkDatabase returns new instance.
+func NewForkDatabase(header *ForkDatabaseHeader) *ForkDatabase {
+	return &ForkDatabase{
+		ForkDatabaseHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeForkDatabase),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (fd *ForkDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return fd.DefaultHashSignVerifierImpl.Sign(&fd.ForkDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (fd *ForkDatabase) Verify() error {
+	return fd.DefaultHashSignVerifierImpl.Verify(&fd.ForkDatabaseHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (fd *ForkDatabase) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(fd.Signee)
+	return addr
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeForkDatabase, (*ForkDatabase)(nil))
+}
@@ -39,6 +39,8 @@ type ResourceMeta struct {
 	EncryptionKey          string                 // encryption key for database instance
 	UseEventualConsistency bool                   // use eventual consistency replication if enabled
 	ConsistencyLevel       float64                // customized strong consistency level
+	MinRating              uint64                 // min rating in [0, RatingUnit] of the matched miners
+	Placement              PlacementConstraints   // label constraints on the matched miners
 }
 
 // ServiceInstance defines single instance to be initialized.
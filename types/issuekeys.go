@@ -37,6 +37,7 @@ type IssueKeysHeader struct {
 	TargetSQLChain proto.AccountAddress
 	MinerKeys      []MinerKey
 	Nonce          interfaces.AccountNonce
+	interfaces.TransactionFeeMixin
 }
 
 // GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
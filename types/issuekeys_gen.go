@@ -42,8 +42,8 @@ func (z *IssueKeys) Msgsize() (s int) {
 func (z *IssueKeysHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 3
-	o = append(o, 0x83, 0x83)
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.MinerKeys)))
 	for za0001 := range z.MinerKeys {
 		// map header, size 2
@@ -56,18 +56,24 @@ func (z *IssueKeysHeader) MarshalHash() (o []byte, err error) {
 		o = append(o, 0x82)
 		o = hsp.AppendString(o, z.MinerKeys[za0001].EncryptionKey)
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	if oTemp, err := z.TargetSQLChain.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
+	o = append(o, 0x84)
+	if oTemp, err := z.TransactionFeeMixin.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
 	return
 }
 
@@ -77,7 +83,7 @@ func (z *IssueKeysHeader) Msgsize() (s int) {
 	for za0001 := range z.MinerKeys {
 		s += 1 + 6 + z.MinerKeys[za0001].Miner.Msgsize() + 14 + hsp.StringPrefixSize + len(z.MinerKeys[za0001].EncryptionKey)
 	}
-	s += 6 + z.Nonce.Msgsize() + 15 + z.TargetSQLChain.Msgsize()
+	s += 6 + z.Nonce.Msgsize() + 15 + z.TargetSQLChain.Msgsize() + 20 + z.TransactionFeeMixin.Msgsize()
 	return
 }
 
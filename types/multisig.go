@@ -0,0 +1,383 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"sort"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+const (
+	// MaxMultiSigKeys defines the max number of keys in a multisig account.
+	MaxMultiSigKeys = 16
+)
+
+// MultiSigAccount defines the key set and the signature threshold of a M-of-N multisig account.
+type MultiSigAccount struct {
+	Threshold uint32
+	Keys      []*asymmetric.PublicKey
+}
+
+// NewMultiSigAccount returns a new multisig account requiring threshold signatures of the keys.
+// The keys are sorted, so the account address doesn't depend on the order they are given in.
+func NewMultiSigAccount(threshold uint32, keys []*asymmetric.PublicKey) (
+	account *MultiSigAccount, err error,
+) {
+	var sorted = make([]*asymmetric.PublicKey, 0, len(keys))
+	for _, v := range keys {
+		if v == nil {
+			err = errors.Wrap(ErrInvalidMultiSigAccount, "nil key")
+			return
+		}
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Serialize(), sorted[j].Serialize()) < 0
+	})
+	var ma = &MultiSigAccount{
+		Threshold: threshold,
+		Keys:      sorted,
+	}
+	if err = ma.Validate(); err != nil {
+		return
+	}
+	account = ma
+	return
+}
+
+// Validate checks that the threshold is within [1, len(Keys)] and the keys are distinct and
+// sorted.
+func (m *MultiSigAccount) Validate() (err error) {
+	if len(m.Keys) > MaxMultiSigKeys {
+		return errors.Wrapf(ErrInvalidMultiSigAccount, "%d keys exceed the limit %d",
+			len(m.Keys), MaxMultiSigKeys)
+	}
+	if m.Threshold == 0 || int(m.Threshold) > len(m.Keys) {
+		return errors.Wrapf(ErrInvalidMultiSigAccount, "threshold %d of %d keys",
+			m.Threshold, len(m.Keys))
+	}
+	var prev []byte
+	for _, v := range m.Keys {
+		if v == nil {
+			return errors.Wrap(ErrInvalidMultiSigAccount, "nil key")
+		}
+		var cur = v.Serialize()
+		if prev != nil && bytes.Compare(prev, cur) >= 0 {
+			return errors.Wrap(ErrInvalidMultiSigAccount, "keys are not distinct or not sorted")
+		}
+		prev = cur
+	}
+	return
+}
+
+// Address returns the account address of the multisig account, which is the hash of its key set
+// and threshold.
+func (m *MultiSigAccount) Address() (addr proto.AccountAddress, err error) {
+	var enc []byte
+	if enc, err = m.MarshalHash(); err != nil {
+		return
+	}
+	addr = proto.AccountAddress(hash.THashH(enc))
+	return
+}
+
+// DeepCopy implements deepcopy.Interface. The keys are immutable and shared with the copy.
+func (m *MultiSigAccount) DeepCopy() interface{} {
+	if m == nil {
+		return m
+	}
+	var keys = make([]*asymmetric.PublicKey, len(m.Keys))
+	copy(keys, m.Keys)
+	return &MultiSigAccount{
+		Threshold: m.Threshold,
+		Keys:      keys,
+	}
+}
+
+func (m *MultiSigAccount) hasKey(key *asymmetric.PublicKey) bool {
+	for _, v := range m.Keys {
+		if v.IsEqual(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateMultiSigAccountHeader defines the multisig account creation transaction header.
+type CreateMultiSigAccountHeader struct {
+	Account MultiSigAccount
+	Nonce   pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// CreateMultiSigAccount defines the multisig account creation transaction, which registers the
+// key set and threshold of a multisig account. It can be sent by any account.
+type CreateMultiSigAccount struct {
+	CreateMultiSigAccountHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewCreateMultiSigAccount returns new instance.
+func NewCreateMultiSigAccount(header *CreateMultiSigAccountHeader) *CreateMultiSigAccount {
+	return &CreateMultiSigAccount{
+		CreateMultiSigAccountHeader: *header,
+		TransactionTypeMixin:        *pi.NewTransactionTypeMixin(pi.TransactionTypeCreateMultiSigAccount),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (cm *CreateMultiSigAccount) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return cm.DefaultHashSignVerifierImpl.Sign(&cm.CreateMultiSigAccountHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (cm *CreateMultiSigAccount) Verify() error {
+	return cm.DefaultHashSignVerifierImpl.Verify(&cm.CreateMultiSigAccountHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (cm *CreateMultiSigAccount) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(cm.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (cm *CreateMultiSigAccount) GetAccountNonce() pi.AccountNonce {
+	return cm.Nonce
+}
+
+// MultiSigHeader defines the multisig transaction header.
+type MultiSigHeader struct {
+	Account MultiSigAccount
+	// Tx is the wrapped transaction, which leaves its own signature fields empty.
+	Tx pi.Transaction
+}
+
+// MultiSig defines the transaction wrapper of a multisig account. The wrapped transaction is
+// applied on behalf of the account once Threshold keys of the account have signed the header.
+// The partial signatures can be collected offline by passing the transaction around.
+type MultiSig struct {
+	MultiSigHeader
+	pi.TransactionTypeMixin
+	DataHash   hash.Hash
+	Signees    []*asymmetric.PublicKey
+	Signatures []*asymmetric.Signature
+}
+
+// NewMultiSig returns a new multisig transaction wrapping tx.
+func NewMultiSig(account *MultiSigAccount, tx pi.Transaction) *MultiSig {
+	return &MultiSig{
+		MultiSigHeader: MultiSigHeader{
+			Account: *account,
+			Tx:      tx,
+		},
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeMultiSig),
+	}
+}
+
+// Unwrap returns the wrapped transaction.
+func (m *MultiSig) Unwrap() (tx pi.Transaction) {
+	tx = m.Tx
+	for {
+		if w, ok := tx.(*pi.TransactionWrapper); ok {
+			tx = w.Unwrap()
+		} else {
+			return
+		}
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (m *MultiSig) GetAccountAddress() proto.AccountAddress {
+	addr, _ := m.Account.Address()
+	return addr
+}
+
+// GetFee implements interfaces/ContainsTransactionFee.GetFee, the fee of the wrapped transaction
+// is paid by the multisig account.
+func (m *MultiSig) GetFee() uint64 {
+	if tx := m.Unwrap(); tx != nil {
+		return pi.GetTransactionFee(tx)
+	}
+	return 0
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (m *MultiSig) GetAccountNonce() pi.AccountNonce {
+	if tx := m.Unwrap(); tx != nil {
+		return tx.GetAccountNonce()
+	}
+	return 0
+}
+
+// Hash implements interfaces/Transaction.Hash.
+func (m *MultiSig) Hash() hash.Hash {
+	return m.DataHash
+}
+
+func (m *MultiSig) headerHash() (h hash.Hash, err error) {
+	var enc []byte
+	if enc, err = m.MultiSigHeader.MarshalHash(); err != nil {
+		return
+	}
+	h = hash.THashH(enc)
+	return
+}
+
+// setHeaderHash sets the header hash, the signatures of a former header are dropped.
+func (m *MultiSig) setHeaderHash(h hash.Hash) {
+	if !m.DataHash.IsEqual(&h) {
+		m.DataHash = h
+		m.Signees = nil
+		m.Signatures = nil
+	}
+}
+
+func (m *MultiSig) addSignature(signee *asymmetric.PublicKey, signature *asymmetric.Signature) {
+	for i, v := range m.Signees {
+		if v.IsEqual(signee) {
+			m.Signatures[i] = signature
+			return
+		}
+	}
+	m.Signees = append(m.Signees, signee)
+	m.Signatures = append(m.Signatures, signature)
+}
+
+// Sign implements interfaces/Transaction.Sign. It adds a partial signature of signer, which must
+// be one of the account keys. Existing signatures are dropped if the header has been changed
+// since they were made.
+func (m *MultiSig) Sign(signer *asymmetric.PrivateKey) (err error) {
+	var (
+		signee    = signer.PubKey()
+		h         hash.Hash
+		signature *asymmetric.Signature
+	)
+	if !m.Account.hasKey(signee) {
+		return errors.WithStack(ErrUnknownMultiSigKey)
+	}
+	if h, err = m.headerHash(); err != nil {
+		return
+	}
+	if signature, err = signer.Sign(h[:]); err != nil {
+		return
+	}
+	m.setHeaderHash(h)
+	m.addSignature(signee, signature)
+	return
+}
+
+// Merge collects the partial signatures from another copy of the same multisig transaction.
+// Like Sign, existing signatures are dropped if the header has been changed since they were made.
+func (m *MultiSig) Merge(other *MultiSig) (err error) {
+	var h hash.Hash
+	if h, err = m.headerHash(); err != nil {
+		return
+	}
+	if !other.DataHash.IsEqual(&h) {
+		return errors.WithStack(verifier.ErrHashValueNotMatch)
+	}
+	if len(other.Signees) != len(other.Signatures) {
+		return errors.WithStack(ErrSignVerification)
+	}
+	for i, v := range other.Signees {
+		if v == nil || !m.Account.hasKey(v) {
+			return errors.WithStack(ErrUnknownMultiSigKey)
+		}
+		if other.Signatures[i] == nil || !other.Signatures[i].Verify(h[:], v) {
+			return errors.WithStack(verifier.ErrSignatureNotMatch)
+		}
+	}
+	m.setHeaderHash(h)
+	for i, v := range other.Signees {
+		m.addSignature(v, other.Signatures[i])
+	}
+	return
+}
+
+// isMultiSigSupported reports whether tx can be wrapped by a multisig transaction, i.e., it is
+// authorized by its sender account only.
+func isMultiSigSupported(tx pi.Transaction) bool {
+	switch tx.(type) {
+	case *Transfer, *CreateDatabase, *ForkDatabase, *DepositToDatabase, *WithdrawFromDatabase,
+		*TransferDatabaseOwnership, *UpdatePermission, *IssueKeys:
+		return true
+	default:
+		return false
+	}
+}
+
+// Verify implements interfaces/Transaction.Verify. It requires valid signatures of at least
+// Threshold distinct keys of the account, and a wrapped transaction of the supported types.
+func (m *MultiSig) Verify() (err error) {
+	if err = m.Account.Validate(); err != nil {
+		return
+	}
+	var inner = m.Unwrap()
+	if inner == nil {
+		return errors.Wrap(ErrInvalidMultiSigAccount, "no wrapped transaction")
+	}
+	if !isMultiSigSupported(inner) {
+		return errors.Wrapf(ErrUnsupportedMultiSigTx, "transaction type %s",
+			inner.GetTransactionType())
+	}
+	var h hash.Hash
+	if h, err = m.headerHash(); err != nil {
+		return
+	}
+	if !m.DataHash.IsEqual(&h) {
+		return errors.WithStack(verifier.ErrHashValueNotMatch)
+	}
+	if len(m.Signees) != len(m.Signatures) {
+		return errors.WithStack(ErrSignVerification)
+	}
+	var signed = make(map[proto.AccountAddress]struct{})
+	for i, v := range m.Signees {
+		if v == nil || !m.Account.hasKey(v) {
+			return errors.WithStack(ErrUnknownMultiSigKey)
+		}
+		if m.Signatures[i] == nil || !m.Signatures[i].Verify(h[:], v) {
+			return errors.WithStack(verifier.ErrSignatureNotMatch)
+		}
+		var addr proto.AccountAddress
+		if addr, err = crypto.PubKeyHash(v); err != nil {
+			return
+		}
+		signed[addr] = struct{}{}
+	}
+	if len(signed) < int(m.Account.Threshold) {
+		return errors.Wrapf(ErrMultiSigThreshold, "%d of %d signatures",
+			len(signed), m.Account.Threshold)
+	}
+	return
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeCreateMultiSigAccount, (*CreateMultiSigAccount)(nil))
+	pi.RegisterTransaction(pi.TransactionTypeMultiSig, (*MultiSig)(nil))
+}
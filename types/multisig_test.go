@@ -0,0 +1,130 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTxMultiSig(t *testing.T) {
+	Convey("test tx multisig", t, func() {
+		var (
+			privs = make([]*asymmetric.PrivateKey, 3)
+			keys  = make([]*asymmetric.PublicKey, 3)
+			err   error
+		)
+		for i := range privs {
+			privs[i], keys[i], err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+		}
+
+		_, err = NewMultiSigAccount(0, keys)
+		So(errors.Cause(err), ShouldEqual, ErrInvalidMultiSigAccount)
+		_, err = NewMultiSigAccount(4, keys)
+		So(errors.Cause(err), ShouldEqual, ErrInvalidMultiSigAccount)
+		_, err = NewMultiSigAccount(1, []*asymmetric.PublicKey{keys[0], keys[0]})
+		So(errors.Cause(err), ShouldEqual, ErrInvalidMultiSigAccount)
+
+		account, err := NewMultiSigAccount(2, keys)
+		So(err, ShouldBeNil)
+		reversed, err := NewMultiSigAccount(2, []*asymmetric.PublicKey{keys[2], keys[1], keys[0]})
+		So(err, ShouldBeNil)
+		addr, err := account.Address()
+		So(err, ShouldBeNil)
+		raddr, err := reversed.Address()
+		So(err, ShouldBeNil)
+		So(raddr, ShouldEqual, addr)
+
+		create := NewCreateMultiSigAccount(&CreateMultiSigAccountHeader{
+			Account: *account,
+			Nonce:   1,
+		})
+		So(create.Sign(privs[0]), ShouldBeNil)
+		So(create.Verify(), ShouldBeNil)
+		sender, err := crypto.PubKeyHash(keys[0])
+		So(err, ShouldBeNil)
+		So(create.GetAccountAddress(), ShouldEqual, sender)
+
+		tx := NewMultiSig(account, NewTransfer(&TransferHeader{
+			Sender:    addr,
+			Receiver:  sender,
+			Amount:    1,
+			TokenType: Particle,
+			Nonce:     2,
+		}))
+		So(tx.GetAccountAddress(), ShouldEqual, addr)
+		So(tx.GetAccountNonce(), ShouldEqual, 2)
+
+		outsider, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(errors.Cause(tx.Sign(outsider)), ShouldEqual, ErrUnknownMultiSigKey)
+
+		// collect the partial signatures offline through an encoded copy
+		So(tx.Sign(privs[0]), ShouldBeNil)
+		So(errors.Cause(tx.Verify()), ShouldEqual, ErrMultiSigThreshold)
+		enc, err := utils.EncodeMsgPack(tx)
+		So(err, ShouldBeNil)
+		var cpy = &MultiSig{}
+		err = utils.DecodeMsgPack(enc.Bytes(), cpy)
+		So(err, ShouldBeNil)
+		So(cpy.Hash(), ShouldEqual, tx.Hash())
+		So(cpy.Sign(privs[2]), ShouldBeNil)
+		// signing again with the same key doesn't count twice
+		So(cpy.Sign(privs[2]), ShouldBeNil)
+		So(len(cpy.Signees), ShouldEqual, 2)
+		So(tx.Merge(cpy), ShouldBeNil)
+		So(tx.Verify(), ShouldBeNil)
+		So(cpy.Verify(), ShouldBeNil)
+
+		// wrapped in a transaction wrapper
+		enc, err = utils.EncodeMsgPack(pi.WrapTransaction(tx))
+		So(err, ShouldBeNil)
+		var wrapper = &pi.TransactionWrapper{}
+		err = utils.DecodeMsgPack(enc.Bytes(), wrapper)
+		So(err, ShouldBeNil)
+		So(wrapper.Unwrap().Verify(), ShouldBeNil)
+		So(wrapper.Unwrap().GetAccountNonce(), ShouldEqual, 2)
+
+		tx.Unwrap().(*Transfer).Amount = 2
+		So(errors.Cause(tx.Verify()), ShouldEqual, verifier.ErrHashValueNotMatch)
+		So(errors.Cause(tx.Merge(cpy)), ShouldEqual, verifier.ErrHashValueNotMatch)
+		// signing a changed header drops the stale signatures
+		So(tx.Sign(privs[1]), ShouldBeNil)
+		So(len(tx.Signees), ShouldEqual, 1)
+		So(errors.Cause(tx.Verify()), ShouldEqual, ErrMultiSigThreshold)
+
+		// only the transactions authorized by the sender account can be wrapped
+		for _, inner := range []pi.Transaction{
+			NewCreateMultiSigAccount(&CreateMultiSigAccountHeader{Account: *account, Nonce: 3}),
+			NewRotateAccountKey(&RotateAccountKeyHeader{Account: addr, NewKey: keys[1], Nonce: 3}),
+			NewMultiSig(account, NewTransfer(&TransferHeader{Sender: addr, Nonce: 3})),
+		} {
+			var unsupported = NewMultiSig(account, inner)
+			So(unsupported.Sign(privs[0]), ShouldBeNil)
+			So(unsupported.Sign(privs[1]), ShouldBeNil)
+			So(errors.Cause(unsupported.Verify()), ShouldEqual, ErrUnsupportedMultiSigTx)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate hsp
+
+// Well-known label keys advertised by providers.
+const (
+	LabelRegion        = "region"
+	LabelDatacenter    = "datacenter"
+	LabelOperator      = "operator"
+	LabelHardwareClass = "hardware"
+)
+
+// Label defines a key-value attribute of a provider, such as its region or operator.
+type Label struct {
+	Key   string
+	Value string
+}
+
+// ParseLabel parses a label in the "key=value" form.
+func ParseLabel(s string) (l Label, err error) {
+	var kv = strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		err = errors.Errorf("invalid label: %s", s)
+		return
+	}
+	l = Label{Key: kv[0], Value: kv[1]}
+	return
+}
+
+// String implements fmt.Stringer.String.
+func (l Label) String() string {
+	return l.Key + "=" + l.Value
+}
+
+// Labels defines the label set of a provider.
+type Labels []Label
+
+// Get returns the value of the label key.
+func (ls Labels) Get(key string) (value string, ok bool) {
+	for _, l := range ls {
+		if l.Key == key {
+			return l.Value, true
+		}
+	}
+	return
+}
+
+// Has returns whether the label set contains the label.
+func (ls Labels) Has(label Label) bool {
+	var value, ok = ls.Get(label.Key)
+	return ok && value == label.Value
+}
+
+// PlacementConstraints defines the constraints on the labels of the miners of a database.
+type PlacementConstraints struct {
+	MatchLabels Labels // labels every miner must have
+	AvoidLabels Labels // labels no miner may have, e.g. datacenter=X
+	SpreadKey   string // label key across whose values the miners spread, e.g. operator
+	Spread      uint16 // min distinct SpreadKey values among the miners
+}
+
+// Match returns whether a provider with the labels satisfies the per-miner constraints.
+func (c *PlacementConstraints) Match(labels Labels) bool {
+	for _, l := range c.MatchLabels {
+		if !labels.Has(l) {
+			return false
+		}
+	}
+	for _, l := range c.AvoidLabels {
+		if labels.Has(l) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlacementConstraints(t *testing.T) {
+	Convey("Given some provider labels", t, func() {
+		var labels Labels
+		for _, v := range []string{"region=us-east", "datacenter=dc1", "operator=acme"} {
+			l, err := ParseLabel(v)
+			So(err, ShouldBeNil)
+			So(l.String(), ShouldEqual, v)
+			labels = append(labels, l)
+		}
+		for _, v := range []string{"", "region", "=us-east"} {
+			_, err := ParseLabel(v)
+			So(err, ShouldNotBeNil)
+		}
+		v, ok := labels.Get(LabelOperator)
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "acme")
+		_, ok = labels.Get(LabelHardwareClass)
+		So(ok, ShouldBeFalse)
+
+		Convey("The empty constraints should match any labels", func() {
+			var c = &PlacementConstraints{}
+			So(c.Match(labels), ShouldBeTrue)
+			So(c.Match(nil), ShouldBeTrue)
+		})
+		Convey("The labels should match the required labels", func() {
+			var c = &PlacementConstraints{
+				MatchLabels: Labels{{Key: LabelRegion, Value: "us-east"}},
+			}
+			So(c.Match(labels), ShouldBeTrue)
+			So(c.Match(nil), ShouldBeFalse)
+			c.MatchLabels = append(c.MatchLabels, Label{Key: LabelHardwareClass, Value: "ssd"})
+			So(c.Match(labels), ShouldBeFalse)
+		})
+		Convey("The labels should not match the avoided labels", func() {
+			var c = &PlacementConstraints{
+				AvoidLabels: Labels{{Key: LabelDatacenter, Value: "dc2"}},
+			}
+			So(c.Match(labels), ShouldBeTrue)
+			c.AvoidLabels = append(c.AvoidLabels, Label{Key: LabelDatacenter, Value: "dc1"})
+			So(c.Match(labels), ShouldBeFalse)
+		})
+	})
+}
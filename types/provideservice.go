@@ -37,7 +37,9 @@ type ProvideServiceHeader struct {
 	GasPrice      uint64
 	TokenType     TokenType
 	NodeID        proto.NodeID
+	Labels        Labels // advertised labels, e.g. region, datacenter or operator
 	Nonce         interfaces.AccountNonce
+	interfaces.TransactionFeeMixin
 }
 
 // GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
@@ -42,14 +42,20 @@ func (z *ProvideService) Msgsize() (s int) {
 func (z *ProvideServiceHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 8
-	o = append(o, 0x88, 0x88)
+	// map header, size 10
+	o = append(o, 0x8a, 0x8a)
+	if oTemp, err := z.Labels.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
+	o = append(o, 0x8a)
 	if oTemp, err := z.TokenType.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.TargetUser)))
 	for za0001 := range z.TargetUser {
 		if oTemp, err := z.TargetUser[za0001].MarshalHash(); err != nil {
@@ -58,35 +64,41 @@ func (z *ProvideServiceHeader) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	o = hsp.AppendFloat64(o, z.LoadAvgPerCPU)
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	if oTemp, err := z.NodeID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.GasPrice)
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Space)
-	o = append(o, 0x88)
+	o = append(o, 0x8a)
 	o = hsp.AppendUint64(o, z.Memory)
+	o = append(o, 0x8a)
+	if oTemp, err := z.TransactionFeeMixin.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ProvideServiceHeader) Msgsize() (s int) {
-	s = 1 + 10 + z.TokenType.Msgsize() + 11 + hsp.ArrayHeaderSize
+	s = 1 + 7 + z.Labels.Msgsize() + 10 + z.TokenType.Msgsize() + 11 + hsp.ArrayHeaderSize
 	for za0001 := range z.TargetUser {
 		s += z.TargetUser[za0001].Msgsize()
 	}
-	s += 14 + hsp.Float64Size + 6 + z.Nonce.Msgsize() + 7 + z.NodeID.Msgsize() + 9 + hsp.Uint64Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size
+	s += 14 + hsp.Float64Size + 6 + z.Nonce.Msgsize() + 7 + z.NodeID.Msgsize() + 9 + hsp.Uint64Size + 6 + hsp.Uint64Size + 7 + hsp.Uint64Size + 20 + z.TransactionFeeMixin.Msgsize()
 	return
 }
@@ -40,6 +40,18 @@ const (
 	NumberOfQueryType
 )
 
+// ReadConsistency enumerates available consistency level of read queries.
+type ReadConsistency int32
+
+const (
+	// ReadConsistencyAny serves read query from local state of the node directly.
+	ReadConsistencyAny ReadConsistency = iota
+	// ReadConsistencyStrong serves read query after local state catches up with leader commits.
+	ReadConsistencyStrong
+	// ReadConsistencyBoundedStaleness serves read query with state no staler than MaxStaleness.
+	ReadConsistencyBoundedStaleness
+)
+
 // NamedArg defines the named argument structure for database.
 type NamedArg struct {
 	Name  string
@@ -67,6 +79,8 @@ type RequestHeader struct {
 	Timestamp    time.Time        `json:"t"`  // time in UTC zone
 	BatchCount   uint64           `json:"bc"` // query count in this request
 	QueriesHash  hash.Hash        `json:"qh"` // hash of query payload
+	Consistency  ReadConsistency  `json:"rc"` // consistency level of read query
+	MaxStaleness int64            `json:"ms"` // max staleness in milliseconds for bounded staleness read
 }
 
 // QueryKey defines an unique query key of a request.
@@ -107,6 +121,20 @@ func (t QueryType) String() string {
 	}
 }
 
+// String implements fmt.Stringer for logging purpose.
+func (c ReadConsistency) String() string {
+	switch c {
+	case ReadConsistencyAny:
+		return "any"
+	case ReadConsistencyStrong:
+		return "strong"
+	case ReadConsistencyBoundedStaleness:
+		return "bounded_staleness"
+	default:
+		return "unknown"
+	}
+}
+
 // Verify checks hash and signature in request header.
 func (sh *SignedRequestHeader) Verify() (err error) {
 	return sh.DefaultHashSignVerifierImpl.Verify(&sh.RequestHeader)
@@ -40,6 +40,36 @@ type ResponsePayload struct {
 	Rows      []ResponseRow `json:"r"`
 }
 
+const (
+	// StepsPerGas is the count of sqlite virtual machine steps charged as one gas unit.
+	StepsPerGas = 1000
+	// BytesPerGas is the count of query and result bytes charged as one gas unit.
+	BytesPerGas = 1024
+)
+
+// QueryCost defines the execution cost of a query request recorded by the miner.
+type QueryCost struct {
+	Steps       uint64 `json:"s"` // sqlite virtual machine steps
+	InputBytes  uint64 `json:"i"` // bytes of query patterns and arguments
+	ResultBytes uint64 `json:"r"` // bytes of result rows
+}
+
+// Add accumulates the cost of c2 to c.
+func (c *QueryCost) Add(c2 *QueryCost) {
+	c.Steps += c2.Steps
+	c.InputBytes += c2.InputBytes
+	c.ResultBytes += c2.ResultBytes
+}
+
+// Gas returns the billing units of the cost, each response costs at least one gas unit.
+func (c *QueryCost) Gas() uint64 {
+	var gas = c.Steps/StepsPerGas + (c.InputBytes+c.ResultBytes)/BytesPerGas
+	if gas == 0 {
+		gas = 1
+	}
+	return gas
+}
+
 // ResponseHeader defines a query response header.
 type ResponseHeader struct {
 	Request      SignedRequestHeader `json:"r"`
@@ -50,6 +80,7 @@ type ResponseHeader struct {
 	LastInsertID int64               `json:"l"`  // insert insert id
 	AffectedRows int64               `json:"a"`  // affected rows
 	PayloadHash  hash.Hash           `json:"dh"` // hash of query response payload
+	Cost         QueryCost           `json:"g"`  // execution cost of the request
 }
 
 // SignedResponseHeader defines a signed query response header.
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// RotateAccountKeyHeader defines the account key rotation transaction header.
+type RotateAccountKeyHeader struct {
+	Account proto.AccountAddress
+	// NewKey is the key to bind to the account, rotating back to the key of the account address
+	// clears the binding.
+	NewKey *asymmetric.PublicKey
+	Nonce  pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *RotateAccountKeyHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// RotateAccountKey defines the account key rotation transaction, which is signed by the current
+// key of the account.
+type RotateAccountKey struct {
+	RotateAccountKeyHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewRotateAccountKey returns new instance.
+func NewRotateAccountKey(header *RotateAccountKeyHeader) *RotateAccountKey {
+	return &RotateAccountKey{
+		RotateAccountKeyHeader: *header,
+		TransactionTypeMixin:   *pi.NewTransactionTypeMixin(pi.TransactionTypeRotateAccountKey),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (rk *RotateAccountKey) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return rk.DefaultHashSignVerifierImpl.Sign(&rk.RotateAccountKeyHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (rk *RotateAccountKey) Verify() error {
+	return rk.DefaultHashSignVerifierImpl.Verify(&rk.RotateAccountKeyHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (rk *RotateAccountKey) GetAccountAddress() proto.AccountAddress {
+	return rk.Account
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeRotateAccountKey, (*RotateAccountKey)(nil))
+}
@@ -31,6 +31,7 @@ type TransferHeader struct {
 	Nonce            pi.AccountNonce
 	Amount           uint64
 	TokenType        TokenType
+	pi.TransactionFeeMixin
 }
 
 // Transfer defines the transfer transaction.
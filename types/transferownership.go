@@ -0,0 +1,78 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// TransferDatabaseOwnershipHeader defines the database ownership transfer transaction header.
+type TransferDatabaseOwnershipHeader struct {
+	TargetSQLChain proto.AccountAddress
+	NewOwner       proto.AccountAddress
+	// RequireAcceptance keeps the transfer pending until the new owner accepts it, by sending the
+	// same transaction with itself as the new owner.
+	RequireAcceptance bool
+	Nonce             pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *TransferDatabaseOwnershipHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// TransferDatabaseOwnership defines the database ownership transfer transaction.
+type TransferDatabaseOwnership struct {
+	TransferDatabaseOwnershipHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewTransferDatabaseOwnership returns new instance.
+func NewTransferDatabaseOwnership(header *TransferDatabaseOwnershipHeader) *TransferDatabaseOwnership {
+	return &TransferDatabaseOwnership{
+		TransferDatabaseOwnershipHeader: *header,
+		TransactionTypeMixin:            *pi.NewTransactionTypeMixin(pi.TransactionTypeTransferDatabaseOwnership),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (to *TransferDatabaseOwnership) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return to.DefaultHashSignVerifierImpl.Sign(&to.TransferDatabaseOwnershipHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (to *TransferDatabaseOwnership) Verify() error {
+	return to.DefaultHashSignVerifierImpl.Verify(&to.TransferDatabaseOwnershipHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (to *TransferDatabaseOwnership) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(to.Signee)
+	return addr
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeTransferDatabaseOwnership, (*TransferDatabaseOwnership)(nil))
+}
@@ -44,6 +44,11 @@ type UpdateBillingHeader struct {
 	Receiver proto.AccountAddress
 	Nonce    pi.AccountNonce
 	Users    []*UserCost
+	// FailedMiners are the miners failed storage proof checking in the billing period.
+	FailedMiners []proto.AccountAddress
+	// NoAckMiners are the miners with unacknowledged responses reported in the billing period.
+	NoAckMiners []proto.AccountAddress
+	pi.TransactionFeeMixin
 }
 
 // UpdateBilling defines the UpdateBilling transaction.
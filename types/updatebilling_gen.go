@@ -64,8 +64,8 @@ func (z *UpdateBilling) Msgsize() (s int) {
 func (z *UpdateBillingHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 3
-	o = append(o, 0x83, 0x83)
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
 	o = hsp.AppendArrayHeader(o, uint32(len(z.Users)))
 	for za0001 := range z.Users {
 		if z.Users[za0001] == nil {
@@ -78,18 +78,42 @@ func (z *UpdateBillingHeader) MarshalHash() (o []byte, err error) {
 			}
 		}
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x86)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.FailedMiners)))
+	for za0002 := range z.FailedMiners {
+		if oTemp, err := z.FailedMiners[za0002].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x86)
+	o = hsp.AppendArrayHeader(o, uint32(len(z.NoAckMiners)))
+	for za0003 := range z.NoAckMiners {
+		if oTemp, err := z.NoAckMiners[za0003].MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x86)
 	if oTemp, err := z.Nonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x86)
 	if oTemp, err := z.Receiver.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
+	o = append(o, 0x86)
+	if oTemp, err := z.TransactionFeeMixin.MarshalHash(); err != nil {
+		return nil, err
+	} else {
+		o = hsp.AppendBytes(o, oTemp)
+	}
 	return
 }
 
@@ -103,7 +127,15 @@ func (z *UpdateBillingHeader) Msgsize() (s int) {
 			s += z.Users[za0001].Msgsize()
 		}
 	}
-	s += 6 + z.Nonce.Msgsize() + 9 + z.Receiver.Msgsize()
+	s += 13 + hsp.ArrayHeaderSize
+	for za0002 := range z.FailedMiners {
+		s += z.FailedMiners[za0002].Msgsize()
+	}
+	s += 12 + hsp.ArrayHeaderSize
+	for za0003 := range z.NoAckMiners {
+		s += z.NoAckMiners[za0003].Msgsize()
+	}
+	s += 6 + z.Nonce.Msgsize() + 9 + z.Receiver.Msgsize() + 20 + z.TransactionFeeMixin.Msgsize()
 	return
 }
 
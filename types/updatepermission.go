@@ -32,6 +32,7 @@ type UpdatePermissionHeader struct {
 	TargetUser     proto.AccountAddress
 	Permission     UserPermission
 	Nonce          interfaces.AccountNonce
+	interfaces.TransactionFeeMixin
 }
 
 // GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
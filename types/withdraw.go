@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// WithdrawFromDatabaseHeader defines the database withdrawal transaction header.
+type WithdrawFromDatabaseHeader struct {
+	TargetSQLChain proto.AccountAddress
+	Amount         uint64
+	TokenType      TokenType
+	Nonce          pi.AccountNonce
+	pi.TransactionFeeMixin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *WithdrawFromDatabaseHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// WithdrawFromDatabase defines the database withdrawal transaction, which withdraws the unused
+// advance payment of a database user, or the deposit of a database miner.
+type WithdrawFromDatabase struct {
+	WithdrawFromDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewWithdrawFromDatabase returns new instance.
+func NewWithdrawFromDatabase(header *WithdrawFromDatabaseHeader) *WithdrawFromDatabase {
+	return &WithdrawFromDatabase{
+		WithdrawFromDatabaseHeader: *header,
+		TransactionTypeMixin:       *pi.NewTransactionTypeMixin(pi.TransactionTypeWithdrawFromDatabase),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (wd *WithdrawFromDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return wd.DefaultHashSignVerifierImpl.Sign(&wd.WithdrawFromDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (wd *WithdrawFromDatabase) Verify() error {
+	return wd.DefaultHashSignVerifierImpl.Verify(&wd.WithdrawFromDatabaseHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (wd *WithdrawFromDatabase) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(wd.Signee)
+	return addr
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeWithdrawFromDatabase, (*WithdrawFromDatabase)(nil))
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// WithdrawServiceHeader defines the miner service withdrawal transaction header.
+type WithdrawServiceHeader struct {
+	// Drain also hands off the databases served by the miner to replacement miners, the miner
+	// deposits of the databases are released after the replicas have migrated.
+	Drain bool
+	Nonce interfaces.AccountNonce
+	interfaces.TransactionFeeMixin
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *WithdrawServiceHeader) GetAccountNonce() interfaces.AccountNonce {
+	return h.Nonce
+}
+
+// WithdrawService defines the miner service withdrawal transaction, which removes the miner from
+// the provider list.
+type WithdrawService struct {
+	WithdrawServiceHeader
+	interfaces.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewWithdrawService returns new instance.
+func NewWithdrawService(h *WithdrawServiceHeader) *WithdrawService {
+	return &WithdrawService{
+		WithdrawServiceHeader: *h,
+		TransactionTypeMixin:  *interfaces.NewTransactionTypeMixin(interfaces.TransactionTypeWithdrawService),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (ws *WithdrawService) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return ws.DefaultHashSignVerifierImpl.Sign(&ws.WithdrawServiceHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (ws *WithdrawService) Verify() error {
+	return ws.DefaultHashSignVerifierImpl.Verify(&ws.WithdrawServiceHeader)
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (ws *WithdrawService) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(ws.Signee)
+	return addr
+}
+
+func init() {
+	interfaces.RegisterTransaction(interfaces.TransactionTypeWithdrawService, (*WithdrawService)(nil))
+}
@@ -25,11 +25,14 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	"github.com/CovenantSQL/CovenantSQL/chainbus"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
 )
 
 // BusService defines the man chain bus service type.
@@ -49,6 +52,14 @@ type BusService struct {
 	blockCount       uint32
 	sqlChainProfiles map[proto.DatabaseID]*types.SQLChainProfile
 	sqlChainState    map[proto.DatabaseID](map[proto.AccountAddress]*types.PermStat)
+	// rotatedKeys maps the rotated accounts to their registered keys, and keyAccounts maps the
+	// addresses of the registered keys back to the accounts.
+	rotatedKeys map[proto.AccountAddress]*asymmetric.PublicKey
+	keyAccounts map[proto.AccountAddress]proto.AccountAddress
+	// retiredKeys maps the addresses of the keys replaced by a later rotation to their accounts,
+	// as recorded by the block producers. The queries signed by these keys before the rotation
+	// are still charged to the accounts.
+	retiredKeys map[proto.AccountAddress]proto.AccountAddress
 }
 
 // NewBusService creates a new chain bus instance.
@@ -66,8 +77,8 @@ func NewBusService(
 		localAddress:  addr,
 	}
 	// State initialization: fetch last block and update fields `blockCount` and `sqlChainProfiles`
-	var _, profiles, count = bs.requestLastBlock()
-	bs.updateState(count, profiles)
+	var _, profiles, accounts, count = bs.requestLastBlock()
+	bs.updateState(count, profiles, accounts)
 	return bs
 }
 
@@ -82,13 +93,33 @@ func (bs *BusService) GetCurrentDBMapping() (dbMap map[proto.DatabaseID]*types.S
 	return
 }
 
-func (bs *BusService) updateState(count uint32, profiles []*types.SQLChainProfile) {
+func (bs *BusService) updateState(
+	count uint32, profiles []*types.SQLChainProfile, accounts []*types.Account,
+) {
 	bs.lock.Lock()
 	defer bs.lock.Unlock()
 	var (
 		rebuilt       = make(map[proto.DatabaseID]*types.SQLChainProfile)
 		sqlchainState = make(map[proto.DatabaseID](map[proto.AccountAddress]*types.PermStat))
+		rotatedKeys   = make(map[proto.AccountAddress]*asymmetric.PublicKey)
+		keyAccounts   = make(map[proto.AccountAddress]proto.AccountAddress)
+		retiredKeys   = make(map[proto.AccountAddress]proto.AccountAddress)
 	)
+	for _, v := range accounts {
+		for _, key := range v.RetiredKeys {
+			retiredKeys[key] = v.Address
+		}
+		if v.PublicKey == nil {
+			continue
+		}
+		var key, err = crypto.PubKeyHash(v.PublicKey)
+		if err != nil {
+			log.WithError(err).WithField("account", v.Address).Warning("invalid account key")
+			continue
+		}
+		rotatedKeys[v.Address] = v.PublicKey
+		keyAccounts[key] = v.Address
+	}
 	for _, v := range profiles {
 		rebuilt[v.ID] = v
 		sqlchainState[v.ID] = make(map[proto.AccountAddress]*types.PermStat)
@@ -102,6 +133,9 @@ func (bs *BusService) updateState(count uint32, profiles []*types.SQLChainProfil
 	atomic.StoreUint32(&bs.blockCount, count)
 	bs.sqlChainProfiles = rebuilt
 	bs.sqlChainState = sqlchainState
+	bs.rotatedKeys = rotatedKeys
+	bs.keyAccounts = keyAccounts
+	bs.retiredKeys = retiredKeys
 }
 
 func (bs *BusService) subscribeBlock(ctx context.Context) {
@@ -117,7 +151,7 @@ func (bs *BusService) subscribeBlock(ctx context.Context) {
 			// fetch block from remote block producer
 			c := atomic.LoadUint32(&bs.blockCount)
 			log.Debugf("fetch block in count: %d", c)
-			b, profiles, newCount := bs.requestLastBlock()
+			b, profiles, accounts, newCount := bs.requestLastBlock()
 			if b == nil {
 				continue
 			}
@@ -133,7 +167,7 @@ func (bs *BusService) subscribeBlock(ctx context.Context) {
 			}).Debug("success fetch block")
 
 			// Write sqlchain profile state first (bound to the last irreversible block)
-			bs.updateState(newCount, profiles)
+			bs.updateState(newCount, profiles, accounts)
 
 			// Fetch any intermediate irreversible blocks and extract txs
 			for i := c + 1; i < newCount; i++ {
@@ -171,7 +205,7 @@ func (bs *BusService) fetchBlockByCount(count uint32) (block *types.BPBlock, err
 }
 
 func (bs *BusService) requestLastBlock() (
-	block *types.BPBlock, profiles []*types.SQLChainProfile, count uint32,
+	block *types.BPBlock, profiles []*types.SQLChainProfile, accounts []*types.Account, count uint32,
 ) {
 	req := &types.FetchLastIrreversibleBlockReq{
 		Address: bs.localAddress,
@@ -185,6 +219,7 @@ func (bs *BusService) requestLastBlock() (
 
 	block = resp.Block
 	profiles = resp.SQLChains
+	accounts = resp.Accounts
 	count = resp.Count
 	return
 }
@@ -210,6 +245,55 @@ func (bs *BusService) RequestPermStat(
 	return
 }
 
+// ResolveAccount returns the account which signee is currently registered to. The key of a
+// rotated account address and the retired keys are rejected.
+func (bs *BusService) ResolveAccount(signee *asymmetric.PublicKey) (addr proto.AccountAddress, err error) {
+	var key proto.AccountAddress
+	if key, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	bs.lock.RLock()
+	defer bs.lock.RUnlock()
+	if account, ok := bs.keyAccounts[key]; ok {
+		addr = account
+		return
+	}
+	if _, ok := bs.rotatedKeys[key]; ok {
+		err = errors.Wrapf(ErrPermissionDeny, "address key %s of the account is rotated", key)
+		return
+	}
+	if account, ok := bs.retiredKeys[key]; ok {
+		err = errors.Wrapf(ErrPermissionDeny, "key %s of account %s is rotated", key, account)
+		return
+	}
+	addr = key
+	return
+}
+
+// ResolveBillingAccount returns the account which signee is or was registered to. Unlike
+// ResolveAccount, the original and the retired keys of a rotated account are still resolved to
+// the account, so the queries accepted before the rotation are charged to it.
+func (bs *BusService) ResolveBillingAccount(
+	signee *asymmetric.PublicKey) (addr proto.AccountAddress, err error,
+) {
+	var key proto.AccountAddress
+	if key, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	bs.lock.RLock()
+	defer bs.lock.RUnlock()
+	if account, ok := bs.keyAccounts[key]; ok {
+		addr = account
+		return
+	}
+	if account, ok := bs.retiredKeys[key]; ok {
+		addr = account
+		return
+	}
+	addr = key
+	return
+}
+
 func (bs *BusService) requestBP(method string, request interface{}, response interface{}) (err error) {
 	var bpNodeID proto.NodeID
 	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
@@ -37,9 +37,88 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+func TestBusServiceResolveAccount(t *testing.T) {
+	Convey("Given a BusService with a rotated account", t, func() {
+		var (
+			bs                 = &BusService{}
+			oldPriv, newPriv   *asymmetric.PrivateKey
+			otherPriv          *asymmetric.PrivateKey
+			addr, other, addr2 proto.AccountAddress
+			err                error
+		)
+		oldPriv, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		newPriv, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherPriv, _, err = asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err = crypto.PubKeyHash(oldPriv.PubKey())
+		So(err, ShouldBeNil)
+		other, err = crypto.PubKeyHash(otherPriv.PubKey())
+		So(err, ShouldBeNil)
+		bs.updateState(1, nil, []*types.Account{
+			{Address: addr, PublicKey: newPriv.PubKey()},
+		})
+
+		Convey("The registered key should be resolved to the account", func() {
+			addr2, err = bs.ResolveAccount(newPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+		})
+		Convey("The rotated key should be rejected", func() {
+			_, err = bs.ResolveAccount(oldPriv.PubKey())
+			So(errors.Cause(err), ShouldEqual, ErrPermissionDeny)
+		})
+		Convey("The key of a plain account should be resolved to its address", func() {
+			addr2, err = bs.ResolveAccount(otherPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, other)
+		})
+		Convey("The rotated keys should still be resolved to the account for billing", func() {
+			addr2, err = bs.ResolveBillingAccount(oldPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+			addr2, err = bs.ResolveBillingAccount(newPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+
+			// Rotate again, the retired key should be loaded from the account
+			var newKey proto.AccountAddress
+			newKey, err = crypto.PubKeyHash(newPriv.PubKey())
+			So(err, ShouldBeNil)
+			bs.updateState(2, nil, []*types.Account{{
+				Address:     addr,
+				PublicKey:   otherPriv.PubKey(),
+				RetiredKeys: []proto.AccountAddress{newKey},
+			}})
+			_, err = bs.ResolveAccount(newPriv.PubKey())
+			So(errors.Cause(err), ShouldEqual, ErrPermissionDeny)
+			addr2, err = bs.ResolveBillingAccount(newPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+			addr2, err = bs.ResolveBillingAccount(otherPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+
+			// A fresh service should load the same retired keys
+			var fresh = &BusService{}
+			fresh.updateState(2, nil, []*types.Account{{
+				Address:     addr,
+				PublicKey:   otherPriv.PubKey(),
+				RetiredKeys: []proto.AccountAddress{newKey},
+			}})
+			addr2, err = fresh.ResolveBillingAccount(newPriv.PubKey())
+			So(err, ShouldBeNil)
+			So(addr2, ShouldEqual, addr)
+		})
+	})
+}
+
 func TestNewBusService(t *testing.T) {
 	Convey("Create a BusService with mock bp", t, func() {
 		var (
@@ -46,6 +46,9 @@ const (
 	// KayakWalFileName defines log pool name of database instance.
 	KayakWalFileName = "kayak.ldb"
 
+	// KayakFileWalDirName defines segmented file log pool directory name of database instance.
+	KayakFileWalDirName = "kayak.wal"
+
 	// SQLChainFileName defines sqlchain storage file name.
 	SQLChainFileName = "chain.db"
 
@@ -64,15 +67,24 @@ const (
 	// CommitTimeout defines the commit timeout config.
 	CommitTimeout = time.Minute
 
+	// ReadIndexTimeout defines the max time waiting for local state to catch up with leader.
+	ReadIndexTimeout = 10 * time.Second
+
 	// SlowQuerySampleSize defines the maximum slow query log size (default: 1KB).
 	SlowQuerySampleSize = 1 << 10
 )
 
+// closableWal defines the kayak wal with resource recycle support.
+type closableWal interface {
+	kt.Wal
+	Close()
+}
+
 // Database defines a single database instance in worker runtime.
 type Database struct {
 	cfg            *DBConfig
 	dbID           proto.DatabaseID
-	kayakWal       *kl.LevelDBWal
+	kayakWal       closableWal
 	kayakRuntime   *kayak.Runtime
 	kayakConfig    *kt.RuntimeConfig
 	connSeqs       sync.Map
@@ -151,14 +163,23 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 		Peers:           peers,
 
 		// currently sqlchain package only use Server.ID as node id
-		MuxService: cfg.ChainMux,
-		Server:     db.nodeID,
+		MuxService:  cfg.ChainMux,
+		Server:      db.nodeID,
+		SourcePeers: cfg.SourcePeers,
+		SyncPeers:   cfg.SyncPeers,
 
 		Period:   conf.GConf.SQLChainPeriod,
 		Tick:     conf.GConf.SQLChainTick,
 		QueryTTL: conf.GConf.SQLChainTTL,
 
 		UpdatePeriod: cfg.UpdateBlockCount,
+
+		EventualConsistency: cfg.UseEventualConsistency,
+		BinLogInterval:      conf.GConf.SQLChainBinLogInterval,
+		NoAckLimit:          conf.GConf.SQLChainNoAckLimit,
+		BlockArchiveTTL:     cfg.BlockArchiveTTL,
+		DropSettledArchives: cfg.DropSettledArchives,
+		ResolveAccount:      cfg.ResolveAccount,
 	}
 	if db.chain, err = sqlchain.NewChain(chainCfg); err != nil {
 		return
@@ -167,24 +188,25 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 	}
 
 	// init kayak config
-	kayakWalPath := filepath.Join(cfg.DataDir, KayakWalFileName)
-	if db.kayakWal, err = kl.NewLevelDBWal(kayakWalPath); err != nil {
+	if db.kayakWal, err = openKayakWal(cfg); err != nil {
 		err = errors.Wrap(err, "init kayak log pool failed")
 		return
 	}
 
 	db.kayakConfig = &kt.RuntimeConfig{
-		Handler:          db,
-		PrepareThreshold: PrepareThreshold,
-		CommitThreshold:  CommitThreshold,
-		PrepareTimeout:   PrepareTimeout,
-		CommitTimeout:    CommitTimeout,
-		Peers:            peers,
-		Wal:              db.kayakWal,
-		NodeID:           db.nodeID,
-		InstanceID:       string(db.dbID),
-		ServiceName:      DBKayakRPCName,
-		MethodName:       DBKayakMethodName,
+		Handler:             db,
+		PrepareThreshold:    PrepareThreshold,
+		CommitThreshold:     CommitThreshold,
+		PrepareTimeout:      PrepareTimeout,
+		CommitTimeout:       CommitTimeout,
+		Peers:               peers,
+		Wal:                 db.kayakWal,
+		WalRetention:        cfg.WalRetention,
+		NodeID:              db.nodeID,
+		InstanceID:          string(db.dbID),
+		ServiceName:         DBKayakRPCName,
+		MethodName:          DBKayakMethodName,
+		ReadIndexMethodName: DBKayakReadIndexMethodName,
 	}
 
 	// create kayak runtime
@@ -204,6 +226,41 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 	return
 }
 
+func openKayakWal(cfg *DBConfig) (w closableWal, err error) {
+	ldbPath := filepath.Join(cfg.DataDir, KayakWalFileName)
+	if cfg.FileWal == nil {
+		var ldbWal *kl.LevelDBWal
+		if ldbWal, err = kl.NewLevelDBWal(ldbPath); err != nil {
+			return
+		}
+		w = ldbWal
+		return
+	}
+
+	walDir := filepath.Join(cfg.DataDir, KayakFileWalDirName)
+	if _, err = os.Stat(walDir); os.IsNotExist(err) {
+		if _, err = os.Stat(ldbPath); err == nil {
+			// convert existing leveldb wal on first use of file wal
+			var count uint64
+			if count, err = kl.MigrateLevelDBWal(ldbPath, walDir, cfg.FileWal); err != nil {
+				_ = os.RemoveAll(walDir)
+				return
+			}
+			log.WithFields(log.Fields{
+				"db":    cfg.DatabaseID,
+				"count": count,
+			}).Info("migrated leveldb wal to file wal")
+		}
+	}
+
+	var fileWal *kl.FileWal
+	if fileWal, err = kl.NewFileWal(walDir, cfg.FileWal); err != nil {
+		return
+	}
+	w = fileWal
+	return
+}
+
 // UpdatePeers defines peers update query interface.
 func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
 	if err = db.kayakRuntime.UpdatePeers(peers); err != nil {
@@ -240,8 +297,16 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 		}
 	}()
 
+	if err = db.chain.CheckNoAcks(request.Header.NodeID); err != nil {
+		return
+	}
+
 	switch request.Header.QueryType {
 	case types.ReadQuery:
+		if err = db.waitReadIndex(request); err != nil {
+			err = errors.Wrap(err, "failed to wait for read index")
+			return
+		}
 		if tracker, response, err = db.chain.Query(request); err != nil {
 			err = errors.Wrap(err, "failed to query read query")
 			return
@@ -278,6 +343,33 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 	return
 }
 
+func (db *Database) waitReadIndex(request *types.Request) (err error) {
+	var maxStaleness time.Duration
+
+	switch request.Header.Consistency {
+	case types.ReadConsistencyAny:
+		return
+	case types.ReadConsistencyStrong:
+	case types.ReadConsistencyBoundedStaleness:
+		if request.Header.MaxStaleness < 0 {
+			return errors.Wrap(ErrInvalidRequest, "negative max staleness")
+		}
+		maxStaleness = time.Duration(request.Header.MaxStaleness) * time.Millisecond
+	default:
+		return errors.Wrap(ErrInvalidRequest, "invalid read consistency")
+	}
+
+	if db.cfg.UseEventualConsistency {
+		// writes are not replicated by kayak, local state is the only state
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.GetContext(), ReadIndexTimeout)
+	defer cancel()
+	_, err = db.kayakRuntime.ReadIndex(ctx, maxStaleness)
+	return
+}
+
 func (db *Database) logSlow(request *types.Request, isFinished bool, tmStart time.Time) {
 	if request == nil {
 		return
@@ -323,6 +415,18 @@ func (db *Database) Ack(ack *types.Ack) (err error) {
 	return db.saveAck(&ack.Header)
 }
 
+// DivergenceEvents returns the state divergence events recorded in eventual consistency mode.
+func (db *Database) DivergenceEvents() (events []*sqlchain.DivergenceEvent, err error) {
+	return db.chain.DivergenceEvents()
+}
+
+// BillingPreview returns the pending charges of the blocks not billed yet.
+func (db *Database) BillingPreview() (
+	header *types.UpdateBillingHeader, startHeight, endHeight int32, err error,
+) {
+	return db.chain.BillingPreview()
+}
+
 // Shutdown stop database handles and stop service the database.
 func (db *Database) Shutdown() (err error) {
 	if db.kayakRuntime != nil {
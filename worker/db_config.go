@@ -19,6 +19,8 @@ package worker
 import (
 	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 )
@@ -36,4 +38,12 @@ type DBConfig struct {
 	UseEventualConsistency bool
 	ConsistencyLevel       float64
 	SlowQueryTime          time.Duration
+	FileWal                *kl.FileWalConfig
+	WalRetention           uint64
+	BlockArchiveTTL        int32
+	DropSettledArchives    bool
+	SourcePeers            []proto.NodeID
+	SyncPeers              []proto.NodeID
+	// ResolveAccount returns the account which a signee key is or was registered to.
+	ResolveAccount func(signee *asymmetric.PublicKey) (proto.AccountAddress, error)
 }
@@ -60,6 +60,8 @@ type DBMS struct {
 	busService *BusService
 	address    proto.AccountAddress
 	privKey    *asymmetric.PrivateKey
+	// draining holds the databases with draining miners, whose peers are updated on release.
+	draining sync.Map
 }
 
 // NewDBMS returns new database management instance.
@@ -181,6 +183,18 @@ func (dbms *DBMS) Init() (err error) {
 		err = errors.Wrap(err, "init chain bus failed")
 		return
 	}
+	if err = dbms.busService.Subscribe("/ForkDatabase/", dbms.forkDatabase); err != nil {
+		err = errors.Wrap(err, "init chain bus failed")
+		return
+	}
+	if err = dbms.busService.Subscribe("/WithdrawService/", dbms.withdrawService); err != nil {
+		err = errors.Wrap(err, "init chain bus failed")
+		return
+	}
+	if err = dbms.busService.Subscribe("/UpdateBilling/", dbms.updateBilling); err != nil {
+		err = errors.Wrap(err, "init chain bus failed")
+		return
+	}
 	dbms.busService.Start()
 
 	return
@@ -193,7 +207,22 @@ func (dbms *DBMS) createDatabase(tx interfaces.Transaction, count uint32) {
 			tx.GetTransactionType().String())
 		return
 	}
+	dbms.createDatabaseFromHeader(&cd.CreateDatabaseHeader)
+}
+
+func (dbms *DBMS) forkDatabase(tx interfaces.Transaction, count uint32) {
+	fd, ok := tx.(*types.ForkDatabase)
+	if !ok {
+		log.WithError(ErrInvalidTransactionType).Warningf("invalid tx type in forkDatabase: %s",
+			tx.GetTransactionType().String())
+		return
+	}
+	// The lineage is recorded in the genesis block from the profile, the new database is seeded
+	// while creating the sqlchain
+	dbms.createDatabaseFromHeader(&fd.CreateDatabaseHeader)
+}
 
+func (dbms *DBMS) createDatabaseFromHeader(cd *types.CreateDatabaseHeader) {
 	var (
 		dbID          = proto.FromAccountAndNonce(cd.Owner, uint32(cd.Nonce))
 		isTargetMiner = false
@@ -233,6 +262,126 @@ func (dbms *DBMS) createDatabase(tx interfaces.Transaction, count uint32) {
 	}
 }
 
+// withdrawService handles the miner drain: the replacement miner creates the database, and the
+// other serving miners update the peers of the database.
+func (dbms *DBMS) withdrawService(tx interfaces.Transaction, count uint32) {
+	ws, ok := tx.(*types.WithdrawService)
+	if !ok {
+		log.WithError(ErrInvalidTransactionType).Warningf("invalid tx type in withdrawService: %s",
+			tx.GetTransactionType().String())
+		return
+	}
+	if !ws.Drain {
+		return
+	}
+	var withdrawn = ws.GetAccountAddress()
+	for _, p := range dbms.busService.GetCurrentDBMapping() {
+		var draining, serving bool
+		for _, mi := range p.Miners {
+			if mi.Address == withdrawn && mi.Status == types.Draining {
+				draining = true
+			}
+			if mi.Address == dbms.address && mi.Status != types.Draining {
+				serving = true
+			}
+		}
+		if !draining {
+			continue
+		}
+		dbms.draining.Store(p.ID, struct{}{})
+		if serving {
+			dbms.syncDatabase(p)
+		}
+	}
+}
+
+// updateBilling handles the release of the draining miners: the released miner drops the
+// database, and the other miners update the peers of the database.
+func (dbms *DBMS) updateBilling(tx interfaces.Transaction, count uint32) {
+	ub, ok := tx.(*types.UpdateBilling)
+	if !ok {
+		log.WithError(ErrInvalidTransactionType).Warningf("invalid tx type in updateBilling: %s",
+			tx.GetTransactionType().String())
+		return
+	}
+	var dbID = ub.Receiver.DatabaseID()
+	if _, ok := dbms.draining.Load(dbID); !ok {
+		return
+	}
+	if p, ok := dbms.busService.RequestSQLProfile(dbID); ok {
+		for _, mi := range p.Miners {
+			if mi.Status == types.Draining {
+				// Retry creating the replacement database if it failed to catch up
+				if _, exists := dbms.getMeta(dbID); !exists {
+					dbms.syncDatabase(p)
+				}
+				return
+			}
+		}
+		dbms.draining.Delete(dbID)
+		dbms.syncDatabase(p)
+		return
+	}
+	// The profile is only listed for the miners of the database
+	dbms.draining.Delete(dbID)
+	log.WithField("databaseid", dbID).Info("miner released from database, drop it")
+	if err := dbms.Drop(dbID); err != nil {
+		log.WithError(err).Error("drop database error")
+	}
+}
+
+// syncDatabase creates the database of the profile, or updates its peers if it already exists.
+func (dbms *DBMS) syncDatabase(p *types.SQLChainProfile) {
+	var si, err = dbms.buildSQLChainServiceInstance(p)
+	if err != nil {
+		log.WithError(err).Warn("failed to build sqlchain service instance from profile")
+		return
+	}
+	if _, exists := dbms.getMeta(p.ID); exists {
+		err = dbms.Update(si)
+	} else {
+		err = dbms.Create(si, true)
+	}
+	if err != nil {
+		log.WithError(err).WithField("databaseid", p.ID).Error("sync database error")
+	}
+}
+
+// getSourcePeers returns the miners of the source database which a forked database is seeded from.
+func (dbms *DBMS) getSourcePeers(source proto.DatabaseID) (peers []proto.NodeID, err error) {
+	p, ok := dbms.busService.RequestSQLProfile(source)
+	if !ok {
+		err = errors.Wrapf(ErrNotExists, "source database %s profile not found", source)
+		return
+	}
+	peers = make([]proto.NodeID, len(p.Miners))
+	for i, mi := range p.Miners {
+		peers[i] = mi.NodeID
+	}
+	return
+}
+
+// getSyncPeers returns the miners to catch up the database from, if the local miner is a syncing
+// replacement of a drained miner.
+func (dbms *DBMS) getSyncPeers(dbID proto.DatabaseID) (peers []proto.NodeID) {
+	p, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return
+	}
+	var syncing bool
+	for _, mi := range p.Miners {
+		if mi.Address == dbms.address {
+			syncing = mi.Status == types.Syncing
+		} else if mi.Status != types.Syncing {
+			peers = append(peers, mi.NodeID)
+		}
+	}
+	if !syncing {
+		return nil
+	}
+	return
+}
+
 func (dbms *DBMS) buildSQLChainServiceInstance(
 	profile *types.SQLChainProfile) (instance *types.ServiceInstance, err error,
 ) {
@@ -391,7 +540,19 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		UseEventualConsistency: instance.ResourceMeta.UseEventualConsistency,
 		ConsistencyLevel:       instance.ResourceMeta.ConsistencyLevel,
 		SlowQueryTime:          DefaultSlowQueryTime,
+		FileWal:                dbms.cfg.FileWal,
+		WalRetention:           dbms.cfg.WalRetention,
+		BlockArchiveTTL:        dbms.cfg.BlockArchiveTTL,
+		DropSettledArchives:    dbms.cfg.DropSettledArchives,
+		ResolveAccount:         dbms.busService.ResolveBillingAccount,
+	}
+
+	if l := instance.GenesisBlock.Lineage(); l.IsForked() {
+		if dbCfg.SourcePeers, err = dbms.getSourcePeers(l.Source); err != nil {
+			return
+		}
 	}
+	dbCfg.SyncPeers = dbms.getSyncPeers(instance.DatabaseID)
 
 	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
 		return
@@ -440,7 +601,7 @@ func (dbms *DBMS) Query(req *types.Request) (res *types.Response, err error) {
 	var exists bool
 
 	// check permission
-	addr, err := crypto.PubKeyHash(req.Header.Signee)
+	addr, err := dbms.busService.ResolveAccount(req.Header.Signee)
 	if err != nil {
 		return
 	}
@@ -464,7 +625,7 @@ func (dbms *DBMS) Ack(ack *types.Ack) (err error) {
 	var exists bool
 
 	// check permission
-	addr, err := crypto.PubKeyHash(ack.Header.Signee)
+	addr, err := dbms.busService.ResolveAccount(ack.Header.Signee)
 	if err != nil {
 		return
 	}
@@ -550,7 +711,7 @@ func (dbms *DBMS) addTxSubscription(dbID proto.DatabaseID, nodeID proto.NodeID,
 		}).WithError(err).Warning("get pubkey failed in addTxSubscription")
 		return
 	}
-	addr, err := crypto.PubKeyHash(pubkey)
+	addr, err := dbms.busService.ResolveAccount(pubkey)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"databaseID": dbID,
@@ -609,6 +770,63 @@ func (dbms *DBMS) cancelTxSubscription(dbID proto.DatabaseID, nodeID proto.NodeI
 	return
 }
 
+func (dbms *DBMS) checkAdmin(dbID proto.DatabaseID, nodeID proto.NodeID) (err error) {
+	var (
+		pubkey *asymmetric.PublicKey
+		addr   proto.AccountAddress
+	)
+	if pubkey, err = kms.GetPublicKey(nodeID); err != nil {
+		return
+	}
+	if addr, err = dbms.busService.ResolveAccount(pubkey); err != nil {
+		return
+	}
+	if permStat, ok := dbms.busService.RequestPermStat(dbID, addr); !ok {
+		err = errors.Wrap(ErrPermissionDeny, "database not exists")
+		return
+	} else if !permStat.Permission.CheckAdmin() {
+		err = errors.Wrapf(ErrPermissionDeny, "not admin, permission: %d", permStat.Permission)
+		return
+	}
+	return
+}
+
+func (dbms *DBMS) queryDivergence(
+	dbID proto.DatabaseID, nodeID proto.NodeID) (events []*sqlchain.DivergenceEvent, err error,
+) {
+	// only database admin is allowed to query divergence events
+	if err = dbms.checkAdmin(dbID, nodeID); err != nil {
+		return
+	}
+
+	db, exists := dbms.getMeta(dbID)
+	if !exists {
+		err = ErrNotExists
+		return
+	}
+	return db.DivergenceEvents()
+}
+
+func (dbms *DBMS) billingPreview(
+	dbID proto.DatabaseID, nodeID proto.NodeID, resp *types.BillingPreviewResp) (err error,
+) {
+	// only database admin is allowed to preview the charges of all users
+	if err = dbms.checkAdmin(dbID, nodeID); err != nil {
+		return
+	}
+
+	db, exists := dbms.getMeta(dbID)
+	if !exists {
+		err = ErrNotExists
+		return
+	}
+	if profile, ok := dbms.busService.RequestSQLProfile(dbID); ok {
+		resp.GasPrice = profile.GasPrice
+	}
+	resp.Billing, resp.StartHeight, resp.EndHeight, err = db.BillingPreview()
+	return
+}
+
 // Shutdown defines dbms shutdown logic.
 func (dbms *DBMS) Shutdown() (err error) {
 	dbms.dbMap.Range(func(_, rawDB interface{}) bool {
@@ -19,6 +19,7 @@ package worker
 import (
 	"time"
 
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 )
 
@@ -32,4 +33,13 @@ type DBMSConfig struct {
 	RootDir       string
 	Server        *rpc.Server
 	MaxReqTimeGap time.Duration
+	// FileWal enables segmented file wal for databases, leveldb wal is used if nil.
+	FileWal *kl.FileWalConfig
+	// WalRetention sets the count of latest logs kept on file wal truncation, 0 to keep all logs.
+	WalRetention uint64
+	// BlockArchiveTTL sets the block periods after which sqlchain blocks are archived, 0 to
+	// disable archiving.
+	BlockArchiveTTL int32
+	// DropSettledArchives removes the archived blocks once their billing is confirmed.
+	DropSettledArchives bool
 }
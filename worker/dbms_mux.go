@@ -29,6 +29,8 @@ import (
 const (
 	// DBKayakMethodName defines the database kayak rpc method name.
 	DBKayakMethodName = "Call"
+	// DBKayakReadIndexMethodName defines the database kayak read index rpc method name.
+	DBKayakReadIndexMethodName = "ReadIndex"
 )
 
 // DBKayakMuxService defines a mux service for sqlchain kayak.
@@ -67,3 +69,15 @@ func (s *DBKayakMuxService) Call(req *kt.RPCRequest, _ *interface{}) (err error)
 
 	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
 }
+
+// ReadIndex handles kayak read index request from followers.
+func (s *DBKayakMuxService) ReadIndex(req *kt.ReadIndexRequest, resp *kt.ReadIndexResponse) (err error) {
+	id := proto.DatabaseID(req.Instance)
+
+	if v, ok := s.serviceMap.Load(id); ok {
+		resp.Index, err = v.(*kayak.Runtime).LeaderReadIndex()
+		return
+	}
+
+	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
+}
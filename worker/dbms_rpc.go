@@ -22,6 +22,7 @@ import (
 	//"runtime/trace"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/sqlchain"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
@@ -55,6 +56,18 @@ type CancelSubscriptionResp struct {
 	proto.Envelope
 }
 
+// QueryDivergenceReq defines a request of QueryDivergence RPC method.
+type QueryDivergenceReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// QueryDivergenceResp defines a response of QueryDivergence RPC method.
+type QueryDivergenceResp struct {
+	proto.Envelope
+	Events []*sqlchain.DivergenceEvent
+}
+
 // DBMSRPCService is the rpc endpoint of database management.
 type DBMSRPCService struct {
 	dbms *DBMS
@@ -168,3 +181,16 @@ func (rpc *DBMSRPCService) CancelSubscription(req *CancelSubscriptionReq, _ *Can
 	err = rpc.dbms.cancelTxSubscription(req.DatabaseID, nodeID)
 	return
 }
+
+// QueryDivergence is the RPC method for database admin to query the state divergence events.
+func (rpc *DBMSRPCService) QueryDivergence(req *QueryDivergenceReq, resp *QueryDivergenceResp) (err error) {
+	resp.Events, err = rpc.dbms.queryDivergence(req.DatabaseID, req.GetNodeID().ToNodeID())
+	return
+}
+
+// BillingPreview is the RPC method for database admin to preview the pending charges.
+func (rpc *DBMSRPCService) BillingPreview(
+	req *types.BillingPreviewReq, resp *types.BillingPreviewResp) (err error,
+) {
+	return rpc.dbms.billingPreview(req.DatabaseID, req.GetNodeID().ToNodeID(), resp)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/pkg/errors"
+)
+
+const vmStepsQuery = "SELECT " + xs.VMStepsFunc + "()"
+
+// vmSteps returns the virtual machine steps executed by the connection behind qer. It returns 0 if
+// the underlying storage doesn't count the steps.
+//
+// The counter is read with a background context: a canceled query context should not change the
+// recorded cost, which is verified by the other peers.
+func vmSteps(qer sqlQuerier) (steps uint64) {
+	var rows, err = qer.QueryContext(context.Background(), vmStepsQuery)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var v int64
+		if err = rows.Scan(&v); err == nil && v > 0 {
+			steps = uint64(v)
+		}
+	}
+	return
+}
+
+func valueSize(v interface{}) uint64 {
+	switch x := v.(type) {
+	case nil:
+		return 1
+	case string:
+		return uint64(len(x))
+	case []byte:
+		return uint64(len(x))
+	default:
+		return 8
+	}
+}
+
+// inputSize returns the bytes of the query pattern and arguments.
+func inputSize(q *types.Query) (size uint64) {
+	size = uint64(len(q.Pattern))
+	for _, v := range q.Args {
+		size += uint64(len(v.Name)) + valueSize(v.Value)
+	}
+	return
+}
+
+// resultSize returns the bytes of the result rows.
+func resultSize(data [][]interface{}) (size uint64) {
+	for _, row := range data {
+		for _, v := range row {
+			size += valueSize(v)
+		}
+	}
+	return
+}
+
+// verifyCost checks the cost recorded in the response header against the replayed one.
+//
+// Only the input and result bytes are verified. The virtual machine steps depend on the sqlite
+// build and its query planner, which may differ between peers, so the recorded steps signed by
+// the producer are trusted and a difference is only logged.
+func verifyCost(resp *types.ResponseHeader, replayed *types.QueryCost) (err error) {
+	if resp.Cost.InputBytes != replayed.InputBytes || resp.Cost.ResultBytes != replayed.ResultBytes {
+		err = errors.Wrapf(ErrCostMismatch,
+			"recorded %+v vs replayed %+v at log offset %d", resp.Cost, *replayed, resp.LogOffset)
+		return
+	}
+	if resp.Cost.Steps != replayed.Steps {
+		log.WithFields(log.Fields{
+			"offset":   resp.LogOffset,
+			"recorded": resp.Cost.Steps,
+			"replayed": replayed.Steps,
+		}).Debug("replayed vm steps differ from the recorded")
+	}
+	return
+}
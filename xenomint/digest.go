@@ -0,0 +1,471 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// value tags of the canonical row encoding
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagText
+	tagBlob
+	tagTime
+	tagBool
+)
+
+// TableDigest is the order-independent digest of a single table.
+type TableDigest struct {
+	Name     string
+	RowCount uint64
+	// RowSum is the sum of all row hashes modulo 2^256.
+	RowSum hash.Hash
+}
+
+// Hash returns the summary hash of the table digest.
+func (d *TableDigest) Hash() hash.Hash {
+	var buf = new(bytes.Buffer)
+	writeDigestBytes(buf, []byte(d.Name))
+	_ = binary.Write(buf, binary.BigEndian, d.RowCount)
+	buf.Write(d.RowSum[:])
+	return hash.THashH(buf.Bytes())
+}
+
+// Snapshot is a full dump of the user tables of a State, used to reconcile a diverged state.
+type Snapshot struct {
+	// Seq is the state sequence the snapshot is taken at.
+	Seq    uint64
+	Tables []*SnapshotTable
+	// Objects are the create statements of indexes, views and triggers.
+	Objects []string
+}
+
+// SnapshotTable is the schema and data of a single table in snapshot.
+type SnapshotTable struct {
+	Name    string
+	SQL     string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func writeDigestBytes(buf *bytes.Buffer, b []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint64(len(b)))
+	buf.Write(b)
+}
+
+// writeDigestValue writes the canonical encoding of a column value to buf.
+func writeDigestValue(buf *bytes.Buffer, v interface{}) (err error) {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(tagNull)
+	case int64:
+		buf.WriteByte(tagInt)
+		_ = binary.Write(buf, binary.BigEndian, x)
+	case float64:
+		buf.WriteByte(tagFloat)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(x))
+	case string:
+		buf.WriteByte(tagText)
+		writeDigestBytes(buf, []byte(x))
+	case []byte:
+		buf.WriteByte(tagBlob)
+		writeDigestBytes(buf, x)
+	case time.Time:
+		buf.WriteByte(tagTime)
+		_ = binary.Write(buf, binary.BigEndian, x.UnixNano())
+	case bool:
+		buf.WriteByte(tagBool)
+		if x {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	default:
+		err = errors.Errorf("unsupported column value type %T", v)
+	}
+	return
+}
+
+// addHash adds h to sum as 256-bit big-endian integers, overflow is dropped.
+func addHash(sum *hash.Hash, h *hash.Hash) {
+	var carry uint16
+	for i := hash.HashSize - 1; i >= 0; i-- {
+		carry += uint16(sum[i]) + uint16(h[i])
+		sum[i] = byte(carry)
+		carry >>= 8
+	}
+}
+
+// subHash subtracts h from sum as 256-bit big-endian integers, borrow is dropped.
+func subHash(sum *hash.Hash, h *hash.Hash) {
+	var borrow int16
+	for i := hash.HashSize - 1; i >= 0; i-- {
+		var d = int16(sum[i]) - int16(h[i]) - borrow
+		borrow = 0
+		if d < 0 {
+			d += 256
+			borrow = 1
+		}
+		sum[i] = byte(d)
+	}
+}
+
+// rowHash returns the hash of the canonical encoding of row, buf is used as scratch.
+func rowHash(buf *bytes.Buffer, row []interface{}) (h hash.Hash, err error) {
+	buf.Reset()
+	for _, v := range row {
+		if err = writeDigestValue(buf, v); err != nil {
+			return
+		}
+	}
+	h = hash.THashH(buf.Bytes())
+	return
+}
+
+type sqlQuerierExecer interface {
+	sqlQuerier
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func listTables(ctx context.Context, qer sqlQuerier) (names, stmts []string, err error) {
+	var rows *sql.Rows
+	if rows, err = qer.QueryContext(ctx, `SELECT name, sql FROM sqlite_master
+WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, stmt string
+		if err = rows.Scan(&name, &stmt); err != nil {
+			return
+		}
+		names = append(names, name)
+		stmts = append(stmts, stmt)
+	}
+	err = rows.Err()
+	return
+}
+
+// scanTable calls fn on each row of the table.
+func scanTable(
+	ctx context.Context, qer sqlQuerier, name string, fn func(row []interface{}) error,
+) (
+	columns []string, err error,
+) {
+	return scanQuery(ctx, qer, fn, "SELECT * FROM "+quoteIdentifier(name))
+}
+
+// scanQuery calls fn on each row of the query result.
+func scanQuery(
+	ctx context.Context, qer sqlQuerier, fn func(row []interface{}) error,
+	query string, args ...interface{},
+) (
+	columns []string, err error,
+) {
+	var rows *sql.Rows
+	if rows, err = qer.QueryContext(ctx, query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			row  = make([]interface{}, len(columns))
+			dest = make([]interface{}, len(columns))
+		)
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		if err = fn(row); err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+func computeTableDigest(
+	ctx context.Context, qer sqlQuerier, name string) (d *TableDigest, err error,
+) {
+	d = &TableDigest{Name: name}
+	var buf = new(bytes.Buffer)
+	if _, err = scanTable(ctx, qer, name, func(row []interface{}) (err error) {
+		var h hash.Hash
+		if h, err = rowHash(buf, row); err != nil {
+			return
+		}
+		addHash(&d.RowSum, &h)
+		d.RowCount++
+		return
+	}); err != nil {
+		err = errors.Wrapf(err, "digest table %s", name)
+	}
+	return
+}
+
+// digest computes the state root from the uncommitted transaction without the table digest
+// cache, which must be called with the state lock held.
+func (s *State) digest(ctx context.Context) (h hash.Hash, tables []*TableDigest, err error) {
+	var names, stmts []string
+	if names, stmts, err = listTables(ctx, s.unc); err != nil {
+		err = errors.Wrap(err, "list tables")
+		return
+	}
+	var leaves = make([]*hash.Hash, len(names))
+	tables = make([]*TableDigest, len(names))
+	for i, name := range names {
+		if tables[i], err = computeTableDigest(ctx, s.unc, name); err != nil {
+			return
+		}
+		// schema difference is a divergence too
+		leaves[i] = stateRootLeaf(tables[i], stmts[i])
+	}
+	h = *merkle.NewMerkle(leaves).GetRoot()
+	return
+}
+
+// Digest fully recomputes the state root of the current state and returns it with the digests
+// of each user table.
+func (s *State) Digest(ctx context.Context) (h hash.Hash, tables []*TableDigest, err error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.digest(ctx)
+}
+
+// ProofRequest defines the storage challenge to answer along with state commit or block replay.
+type ProofRequest struct {
+	// Seed is the storage challenge seed, storage proof is not computed with a zero seed.
+	Seed hash.Hash
+	// Prover is the node which the storage proof answer is bound to.
+	Prover proto.NodeID
+}
+
+// StateProof defines the state evidences computed at a specified state sequence.
+type StateProof struct {
+	Seq          uint64
+	Root         hash.Hash
+	StorageProof hash.Hash
+}
+
+// prove computes the state evidences, which must be called with the state lock held.
+func (s *State) prove(ctx context.Context, req *ProofRequest) (proof *StateProof, err error) {
+	var (
+		zero hash.Hash
+		p    = &StateProof{Seq: s.getSeq()}
+	)
+	if p.Root, err = s.stateRoot(ctx); err != nil {
+		return
+	}
+	if !req.Seed.IsEqual(&zero) {
+		if p.StorageProof, err = s.storageProof(ctx, req.Seed, req.Prover); err != nil {
+			return
+		}
+	}
+	proof = p
+	return
+}
+
+// CommitExWithProof commits the current transaction and returns all the pooled queries along
+// with the state evidences after commit.
+func (s *State) CommitExWithProof(
+	ctx context.Context, req *ProofRequest,
+) (
+	failed []*types.Request, queries []*QueryTracker, proof *StateProof, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	s.tryCommit()
+	if proof, err = s.prove(ctx, req); err != nil {
+		return
+	}
+	failed = s.pool.failedList()
+	queries = s.pool.queries
+	s.pool = newPool()
+	return
+}
+
+// ReplayBlockWithProof replays the queries from block and returns the state evidences after
+// replaying. The evidences are comparable with the block producer's only if the local state
+// sequence reaches the block state sequence exactly, otherwise a nil proof is returned.
+func (s *State) ReplayBlockWithProof(
+	ctx context.Context, block *types.Block, req *ProofRequest) (proof *StateProof, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	if err = s.replayBlock(ctx, block); err != nil {
+		return
+	}
+	if s.getSeq() != block.SignedHeader.StateSeq {
+		return
+	}
+	return s.prove(ctx, req)
+}
+
+// Snapshot dumps all the user tables of the current state.
+func (s *State) Snapshot(ctx context.Context) (snap *Snapshot, err error) {
+	s.Lock()
+	defer s.Unlock()
+	var names, stmts []string
+	if names, stmts, err = listTables(ctx, s.unc); err != nil {
+		err = errors.Wrap(err, "list tables")
+		return
+	}
+	snap = &Snapshot{
+		Seq:    s.getSeq(),
+		Tables: make([]*SnapshotTable, len(names)),
+	}
+	for i, name := range names {
+		var t = &SnapshotTable{Name: name, SQL: stmts[i]}
+		if t.Columns, err = scanTable(ctx, s.unc, name, func(row []interface{}) error {
+			t.Rows = append(t.Rows, row)
+			return nil
+		}); err != nil {
+			err = errors.Wrapf(err, "dump table %s", name)
+			return
+		}
+		snap.Tables[i] = t
+	}
+	var rows *sql.Rows
+	if rows, err = s.unc.QueryContext(ctx, `SELECT sql FROM sqlite_master
+WHERE type IN ('index', 'view', 'trigger') AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%'`,
+	); err != nil {
+		err = errors.Wrap(err, "list schema objects")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stmt string
+		if err = rows.Scan(&stmt); err != nil {
+			return
+		}
+		snap.Objects = append(snap.Objects, stmt)
+	}
+	err = rows.Err()
+	return
+}
+
+func restoreSnapshot(ctx context.Context, tx sqlQuerierExecer, snap *Snapshot) (err error) {
+	// drop all the existing user objects, indexes are dropped along with tables
+	var (
+		rows  *sql.Rows
+		drops []string
+	)
+	if rows, err = tx.QueryContext(ctx, `SELECT type, name FROM sqlite_master
+WHERE type IN ('view', 'trigger', 'table') AND name NOT LIKE 'sqlite_%'`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var typ, name string
+		if err = rows.Scan(&typ, &name); err != nil {
+			rows.Close()
+			return
+		}
+		drops = append(drops, fmt.Sprintf(
+			"DROP %s IF EXISTS %s", strings.ToUpper(typ), quoteIdentifier(name)))
+	}
+	rows.Close()
+	for _, v := range drops {
+		if _, err = tx.ExecContext(ctx, v); err != nil {
+			return
+		}
+	}
+	for _, t := range snap.Tables {
+		if _, err = tx.ExecContext(ctx, t.SQL); err != nil {
+			return
+		}
+		if len(t.Columns) == 0 {
+			continue
+		}
+		var (
+			cols   = make([]string, len(t.Columns))
+			params = make([]string, len(t.Columns))
+			stmt   string
+		)
+		for i, c := range t.Columns {
+			cols[i] = quoteIdentifier(c)
+			params[i] = "?"
+		}
+		stmt = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdentifier(t.Name),
+			strings.Join(cols, ", "), strings.Join(params, ", "))
+		for _, r := range t.Rows {
+			if _, err = tx.ExecContext(ctx, stmt, r...); err != nil {
+				return
+			}
+		}
+	}
+	for _, v := range snap.Objects {
+		if _, err = tx.ExecContext(ctx, v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Restore replaces all the user tables with the snapshot and resets the state sequence to the
+// snapshot's. The pending local queries are dropped and returned.
+func (s *State) Restore(ctx context.Context, snap *Snapshot) (dropped []*types.Request, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if err = restoreSnapshot(ctx, s.unc, snap); err != nil {
+		// uncommitted changes are discarded along with the partial restoring
+		var ierr error
+		if ierr = s.uncRollback(); ierr != nil {
+			log.WithError(ierr).Fatal("failed to rollback")
+		}
+		if s.unc, ierr = s.strg.Writer().Begin(); ierr != nil {
+			log.WithError(ierr).Fatal("failed to begin")
+		}
+		err = errors.Wrap(err, "restore snapshot")
+		return
+	}
+	s.setSeq(snap.Seq)
+	s.tryCommit()
+	s.rootCache.markAll()
+	for _, v := range s.pool.queries {
+		dropped = append(dropped, v.Req)
+	}
+	s.pool = newPool()
+	atomic.StoreUint64(&s.snapshotSeq, snap.Seq)
+	return
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateDigest(t *testing.T) {
+	Convey("Given two chain state objects", t, func() {
+		var (
+			ctx    = context.Background()
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			newSt  = func(name string) (st *State) {
+				fl := path.Join(testingDataDir, fmt.Sprint(t.Name(), name))
+				strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+				So(err, ShouldBeNil)
+				st, err = NewState(nodeID, strg)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					err = st.Close(true)
+					So(err, ShouldBeNil)
+					for _, v := range []string{"", "-shm", "-wal"} {
+						err = os.Remove(fl + v)
+						So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+					}
+				})
+				return
+			}
+			write = func(st *State, qs ...types.Query) {
+				ref, resp, err := st.Query(buildRequest(types.WriteQuery, qs))
+				So(err, ShouldBeNil)
+				ref.UpdateResp(resp)
+			}
+			st1 = newSt("x1")
+			st2 = newSt("x2")
+		)
+		const schema = `CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`
+
+		Convey("The digest should not depend on the row insertion order", func() {
+			write(st1, buildQuery(schema),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 1, "v1"),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 2, "v2"))
+			write(st2, buildQuery(schema),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 2, "v2"),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 1, "v1"))
+			d1, tables, err := st1.Digest(ctx)
+			So(err, ShouldBeNil)
+			So(tables, ShouldHaveLength, 1)
+			So(tables[0].Name, ShouldEqual, "t1")
+			So(tables[0].RowCount, ShouldEqual, 2)
+			d2, _, err := st2.Digest(ctx)
+			So(err, ShouldBeNil)
+			So(d1, ShouldResemble, d2)
+
+			write(st2, buildQuery(`UPDATE t1 SET v = ? WHERE k = ?`, "vx", 1))
+			d2, _, err = st2.Digest(ctx)
+			So(err, ShouldBeNil)
+			So(d1, ShouldNotResemble, d2)
+		})
+		Convey("The replayed state digest should be comparable with the producer's", func() {
+			write(st1, buildQuery(schema))
+			write(st1, buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 1, "v1"))
+			_, qts, p1, err := st1.CommitExWithProof(ctx, &ProofRequest{})
+			So(err, ShouldBeNil)
+			So(p1.Seq, ShouldEqual, 2)
+			var block = &types.Block{
+				SignedHeader: types.SignedHeader{Header: types.Header{
+					StateRoot: p1.Root,
+					StateSeq:  p1.Seq,
+				}},
+				QueryTxs: make([]*types.QueryAsTx, len(qts)),
+			}
+			for i, v := range qts {
+				block.QueryTxs[i] = &types.QueryAsTx{Request: v.Req, Response: &v.Resp.Header}
+			}
+			p2, err := st2.ReplayBlockWithProof(ctx, block, &ProofRequest{})
+			So(err, ShouldBeNil)
+			So(p2, ShouldNotBeNil)
+			So(p2.Root, ShouldResemble, *block.StateRoot())
+		})
+		Convey("The diverged state should be restored from snapshot", func() {
+			write(st1, buildQuery(schema),
+				buildQuery(`CREATE INDEX idx_v ON t1 (v)`),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 1, "v1"),
+				buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 2, nil))
+			write(st2, buildQuery(`CREATE TABLE t2 (k INT)`))
+			write(st2, buildQuery(`INSERT INTO t2 VALUES (?)`, 1))
+
+			snap, err := st1.Snapshot(ctx)
+			So(err, ShouldBeNil)
+			So(snap.Seq, ShouldEqual, 4)
+			So(snap.Tables, ShouldHaveLength, 1)
+			So(snap.Tables[0].Rows, ShouldHaveLength, 2)
+			So(snap.Objects, ShouldHaveLength, 1)
+
+			dropped, err := st2.Restore(ctx, snap)
+			So(err, ShouldBeNil)
+			So(dropped, ShouldHaveLength, 2)
+			So(st2.getSeq(), ShouldEqual, 4)
+
+			var d1, d2 hash.Hash
+			d1, _, err = st1.Digest(ctx)
+			So(err, ShouldBeNil)
+			d2, _, err = st2.Digest(ctx)
+			So(err, ShouldBeNil)
+			So(d2, ShouldResemble, d1)
+
+			// queries included in snapshot are skipped on replaying
+			_, qts, err := st1.CommitEx()
+			So(err, ShouldBeNil)
+			write(st1, buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 3, "v3"))
+			_, nqts, p1, err := st1.CommitExWithProof(ctx, &ProofRequest{})
+			So(err, ShouldBeNil)
+			var block = &types.Block{
+				SignedHeader: types.SignedHeader{Header: types.Header{
+					StateRoot: p1.Root,
+					StateSeq:  p1.Seq,
+				}},
+			}
+			for _, v := range append(qts, nqts...) {
+				block.QueryTxs = append(block.QueryTxs,
+					&types.QueryAsTx{Request: v.Req, Response: &v.Resp.Header})
+			}
+			p2, err := st2.ReplayBlockWithProof(ctx, block, &ProofRequest{})
+			So(err, ShouldBeNil)
+			So(p2, ShouldNotBeNil)
+			So(p2.Root, ShouldResemble, p1.Root)
+		})
+	})
+}
+
+func TestStorageProof(t *testing.T) {
+	Convey("Given two chain state objects with the same data", t, func() {
+		var (
+			ctx    = context.Background()
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			other  = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+			seed   = hash.THashH([]byte("seed"))
+			newSt  = func(name string) (st *State) {
+				fl := path.Join(testingDataDir, fmt.Sprint(t.Name(), name))
+				strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+				So(err, ShouldBeNil)
+				st, err = NewState(nodeID, strg)
+				So(err, ShouldBeNil)
+				Reset(func() {
+					err = st.Close(true)
+					So(err, ShouldBeNil)
+					for _, v := range []string{"", "-shm", "-wal"} {
+						err = os.Remove(fl + v)
+						So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+					}
+				})
+				return
+			}
+			write = func(st *State, qs ...types.Query) {
+				ref, resp, err := st.Query(buildRequest(types.WriteQuery, qs))
+				So(err, ShouldBeNil)
+				ref.UpdateResp(resp)
+			}
+			st1 = newSt("x1")
+			st2 = newSt("x2")
+		)
+		for _, st := range []*State{st1, st2} {
+			write(st, buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`))
+			for i := 0; i < 10; i++ {
+				write(st, buildQuery(`INSERT INTO t1 VALUES (?, ?)`, i, fmt.Sprint("v", i)))
+			}
+		}
+		Convey("The storage proofs should be equal", func() {
+			a1, seq1, err := st1.StorageProof(ctx, seed, nodeID)
+			So(err, ShouldBeNil)
+			a2, seq2, err := st2.StorageProof(ctx, seed, nodeID)
+			So(err, ShouldBeNil)
+			So(seq1, ShouldEqual, seq2)
+			So(a1, ShouldResemble, a2)
+
+			Convey("The storage proof should be bound to the prover", func() {
+				a2, _, err = st2.StorageProof(ctx, seed, other)
+				So(err, ShouldBeNil)
+				So(a1, ShouldNotResemble, a2)
+			})
+			Convey("The storage proof should differ on different data", func() {
+				write(st2, buildQuery(`UPDATE t1 SET v = ?`, "vx"))
+				a2, _, err = st2.StorageProof(ctx, seed, nodeID)
+				So(err, ShouldBeNil)
+				So(a1, ShouldNotResemble, a2)
+			})
+		})
+		Convey("The storage challenge should be deterministic", func() {
+			var (
+				tables = []string{"t1", "t2"}
+				counts = []int64{10, 0}
+				s1     = StorageChallenge(seed, tables, counts)
+				s2     = StorageChallenge(seed, tables, counts)
+			)
+			So(s1, ShouldHaveLength, StorageProofSamples)
+			So(s1, ShouldResemble, s2)
+			for _, v := range s1 {
+				if v.Table == "t2" {
+					So(v.Offset, ShouldEqual, -1)
+				} else {
+					So(v.Offset, ShouldBeBetweenOrEqual, 0, 9)
+				}
+			}
+			So(StorageChallenge(seed, nil, nil), ShouldBeEmpty)
+		})
+		Convey("The sampled rows should not depend on the query plan", func() {
+			// the scanning order without ORDER BY is undefined, reverse it on st2
+			_, err := st2.unc.Exec(`PRAGMA reverse_unordered_selects = 1`)
+			So(err, ShouldBeNil)
+			for _, st := range []*State{st1, st2} {
+				write(st, buildQuery(`CREATE TABLE t2 (k TEXT, v INT, PRIMARY KEY(k)) WITHOUT ROWID`))
+			}
+			for i := 0; i < 10; i++ {
+				write(st1, buildQuery(`INSERT INTO t2 VALUES (?, ?)`, fmt.Sprint("k", i), i))
+				write(st2, buildQuery(`INSERT INTO t2 VALUES (?, ?)`, fmt.Sprint("k", 9-i), 9-i))
+			}
+			for i := 0; i < 16; i++ {
+				var s = hash.THashH([]byte(fmt.Sprint("seed", i)))
+				a1, _, err := st1.StorageProof(ctx, s, nodeID)
+				So(err, ShouldBeNil)
+				a2, _, err := st2.StorageProof(ctx, s, nodeID)
+				So(err, ShouldBeNil)
+				So(a1, ShouldResemble, a2)
+			}
+			So(st1.rootCache.schema.orders, ShouldResemble, []string{"rowid", `"k"`})
+		})
+	})
+}
@@ -27,6 +27,8 @@ var (
 	ErrInvalidRequest = errors.New("invalid request")
 	// ErrQueryConflict indicates the there is a conflict on query replay.
 	ErrQueryConflict = errors.New("query conflict")
+	// ErrCostMismatch indicates the recorded query cost mismatches the replayed one.
+	ErrCostMismatch = errors.New("query cost mismatch")
 	// ErrMuxServiceNotFound indicates that the multiplexing service endpoint is not found.
 	ErrMuxServiceNotFound = errors.New("mux service not found")
 	// ErrStatefulQueryParts indicates query contains stateful query parts.
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChangesFunc is the name of the sql function which returns the rows changed by the current
+// connection since the last call as a blob, see DecodeChanges. The changes are collected by the
+// sqlite update hook, and are not reported for the WITHOUT ROWID tables, the rows deleted by the
+// truncate optimization or by REPLACE conflict resolution.
+const ChangesFunc = "cql_take_changes"
+
+// MaxTrackedChanges is the maximum count of changed rows kept by a connection, the further changes
+// are dropped and the overflow is reported to the next ChangesFunc call.
+const MaxTrackedChanges = 1 << 16
+
+// rowChanges records the changed rows of a connection, which is only accessed by the goroutine
+// using the connection.
+type rowChanges struct {
+	count    int
+	overflow bool
+	// rows maps the lower-cased table name to the rowids of the changed rows.
+	rows map[string]map[int64]struct{}
+}
+
+func newRowChanges() *rowChanges {
+	return &rowChanges{rows: make(map[string]map[int64]struct{})}
+}
+
+func (c *rowChanges) update(op int, db, table string, rowid int64) {
+	if db != "main" || c.overflow {
+		return
+	}
+	var key = strings.ToLower(table)
+	var ids, ok = c.rows[key]
+	if !ok {
+		ids = make(map[int64]struct{})
+		c.rows[key] = ids
+	}
+	if _, ok = ids[rowid]; ok {
+		return
+	}
+	if c.count >= MaxTrackedChanges {
+		c.overflow = true
+		c.rows = make(map[string]map[int64]struct{})
+		return
+	}
+	ids[rowid] = struct{}{}
+	c.count++
+}
+
+// take encodes and resets the changes: an overflow flag byte followed by the tables, each of which
+// is encoded as the name length, the name, the rowid count and the rowids in varints.
+func (c *rowChanges) take() (b []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	b = make([]byte, 1, 1+len(c.rows)*16+c.count*binary.MaxVarintLen64)
+	if c.overflow {
+		b[0] = 1
+	}
+	for k, ids := range c.rows {
+		b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(k)))]...)
+		b = append(b, k...)
+		b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(ids)))]...)
+		for id := range ids {
+			b = append(b, buf[:binary.PutVarint(buf[:], id)]...)
+		}
+	}
+	c.count = 0
+	c.overflow = false
+	c.rows = make(map[string]map[int64]struct{})
+	return
+}
+
+// DecodeChanges decodes the result of ChangesFunc to the rowids of the changed rows by lower-cased
+// table name. If overflow is true, some changes were dropped and the returned ones are incomplete.
+func DecodeChanges(b []byte) (changes map[string][]int64, overflow bool, err error) {
+	if len(b) == 0 {
+		err = errors.New("missing overflow flag")
+		return
+	}
+	overflow = b[0] != 0
+	b = b[1:]
+	changes = make(map[string][]int64)
+	var next = func() (v uint64) {
+		var n int
+		if v, n = binary.Uvarint(b); n <= 0 {
+			err = errors.New("malformed changes")
+			return
+		}
+		b = b[n:]
+		return
+	}
+	for len(b) > 0 {
+		var l = next()
+		if err != nil {
+			return
+		}
+		if uint64(len(b)) < l {
+			err = errors.New("malformed changes")
+			return
+		}
+		var (
+			name  = string(b[:l])
+			count uint64
+		)
+		b = b[l:]
+		if count = next(); err != nil {
+			return
+		}
+		var ids = make([]int64, 0, count)
+		for i := uint64(0); i < count; i++ {
+			var id, n = binary.Varint(b)
+			if n <= 0 {
+				err = errors.New("malformed changes")
+				return
+			}
+			b = b[n:]
+			ids = append(ids, id)
+		}
+		changes[name] = ids
+	}
+	return
+}
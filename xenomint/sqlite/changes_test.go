@@ -0,0 +1,98 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRowChanges(t *testing.T) {
+	Convey("Given a sqlite storage implementation", t, func() {
+		var fl = path.Join(testingDataDir, t.Name())
+		st, err := NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		tx, err := st.Writer().Begin()
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = tx.Rollback()
+			So(err, ShouldBeNil)
+			err = st.Close()
+			So(err, ShouldBeNil)
+			for _, v := range []string{"", "-shm", "-wal"} {
+				err = os.Remove(fl + v)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		var take = func() (changes map[string][]int64, overflow bool) {
+			var b []byte
+			err := tx.QueryRow("SELECT " + ChangesFunc + "()").Scan(&b)
+			So(err, ShouldBeNil)
+			changes, overflow, err = DecodeChanges(b)
+			So(err, ShouldBeNil)
+			for _, v := range changes {
+				sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+			}
+			return
+		}
+
+		Convey("The changed rows should be taken by rowid", func() {
+			_, err = tx.Exec(`CREATE TABLE T1 (k INTEGER PRIMARY KEY, v TEXT)`)
+			So(err, ShouldBeNil)
+			changes, overflow := take()
+			So(overflow, ShouldBeFalse)
+			So(changes, ShouldBeEmpty)
+			_, err = tx.Exec(`INSERT INTO t1 VALUES (1, 'a'), (2, 'b'), (3, 'c')`)
+			So(err, ShouldBeNil)
+			_, err = tx.Exec(`UPDATE t1 SET v = 'x' WHERE k = 1`)
+			So(err, ShouldBeNil)
+			_, err = tx.Exec(`DELETE FROM t1 WHERE k = 3`)
+			So(err, ShouldBeNil)
+			changes, overflow = take()
+			So(overflow, ShouldBeFalse)
+			So(changes, ShouldResemble, map[string][]int64{"t1": {1, 2, 3}})
+			changes, _ = take()
+			So(changes, ShouldBeEmpty)
+		})
+		Convey("The overflow should be reported", func() {
+			_, err = tx.Exec(`CREATE TABLE t1 (k INTEGER PRIMARY KEY)`)
+			So(err, ShouldBeNil)
+			_, err = tx.Exec(`WITH RECURSIVE s(k) AS (SELECT 1 UNION ALL SELECT k + 1 FROM s
+WHERE k < ?) INSERT INTO t1 SELECT k FROM s`, MaxTrackedChanges+1)
+			So(err, ShouldBeNil)
+			changes, overflow := take()
+			So(overflow, ShouldBeTrue)
+			So(changes, ShouldBeEmpty)
+			_, err = tx.Exec(`DELETE FROM t1 WHERE k = 1`)
+			So(err, ShouldBeNil)
+			changes, overflow = take()
+			So(overflow, ShouldBeFalse)
+			So(changes, ShouldResemble, map[string][]int64{"t1": {1}})
+		})
+		Convey("The malformed changes should be rejected", func() {
+			_, _, err = DecodeChanges(nil)
+			So(err, ShouldNotBeNil)
+			_, _, err = DecodeChanges([]byte{0, 5, 't'})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
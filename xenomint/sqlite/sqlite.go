@@ -53,6 +53,11 @@ func init() {
 			if err = c.RegisterFunc("sleep", sleepFunc, true); err != nil {
 				return
 			}
+			var changes = newRowChanges()
+			c.RegisterUpdateHook(changes.update)
+			if err = c.RegisterFunc(ChangesFunc, changes.take, false); err != nil {
+				return
+			}
 			return
 		},
 	})
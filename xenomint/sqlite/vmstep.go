@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+/*
+#include <stdlib.h>
+
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_context sqlite3_context;
+typedef struct sqlite3_value sqlite3_value;
+
+extern int sqlite3_auto_extension(void (*entry)(void));
+extern void sqlite3_progress_handler(sqlite3 *db, int n, int (*cb)(void *), void *arg);
+extern int sqlite3_create_function_v2(sqlite3 *db, const char *name, int nArg, int eTextRep,
+	void *app, void (*fn)(sqlite3_context *, int, sqlite3_value **),
+	void (*step)(sqlite3_context *, int, sqlite3_value **), void (*final)(sqlite3_context *),
+	void (*destroy)(void *));
+extern void *sqlite3_user_data(sqlite3_context *ctx);
+extern void sqlite3_result_int64(sqlite3_context *ctx, long long v);
+
+#define CQL_SQLITE_UTF8 1
+
+// The progress handler is called back every VM_STEP_GRANULARITY steps to keep the overhead low,
+// and the counter is scaled by it. The steps of a statement below the granularity are not counted.
+#define VM_STEP_GRANULARITY 100
+#define VM_STEPS_FUNC "cql_vm_steps"
+
+static int vmStepCallback(void *arg) {
+	++*(unsigned long long *)arg;
+	return 0;
+}
+
+static void vmStepsFunc(sqlite3_context *ctx, int argc, sqlite3_value **argv) {
+	unsigned long long *counter = sqlite3_user_data(ctx);
+	sqlite3_result_int64(ctx, (long long)(*counter * VM_STEP_GRANULARITY));
+}
+
+// installVMStepCounter is the auto extension entry point called on each new connection. The
+// counter is owned by the sql function and freed by sqlite when the connection is closed.
+static int installVMStepCounter(sqlite3 *db, char **errMsg, const void *api) {
+	unsigned long long *counter = calloc(1, sizeof(unsigned long long));
+	if (counter == NULL) {
+		return 7; // SQLITE_NOMEM
+	}
+	// the destructor is also invoked by sqlite if the function fails to be created
+	int rc = sqlite3_create_function_v2(db, VM_STEPS_FUNC, 0, CQL_SQLITE_UTF8, counter,
+		vmStepsFunc, NULL, NULL, free);
+	if (rc != 0) {
+		return rc;
+	}
+	sqlite3_progress_handler(db, VM_STEP_GRANULARITY, vmStepCallback, counter);
+	return 0;
+}
+
+static int registerVMStepCounter() {
+	return sqlite3_auto_extension((void (*)(void))installVMStepCounter);
+}
+*/
+import "C"
+
+import (
+	"github.com/pkg/errors"
+)
+
+// VMStepsFunc is the name of the sql function which returns the count of virtual machine steps
+// executed by the current connection. The difference of two calls around a statement on the same
+// connection is the execution cost of that statement. It is installed on every sqlite connection
+// as an auto extension, see VM_STEPS_FUNC.
+const VMStepsFunc = "cql_vm_steps"
+
+func init() {
+	if rc := C.registerVMStepCounter(); rc != 0 {
+		panic(errors.Errorf("failed to register vm step counter: %d", int(rc)))
+	}
+}
@@ -44,6 +44,10 @@ type State struct {
 	lastCommitPoint uint64
 	current         uint64 // current is the current lastSeq of the current transaction
 	hasSchemaChange uint32 // indicates schema change happens in this uncommitted transaction
+	snapshotSeq     uint64 // queries before snapshotSeq are included in the restored snapshot
+
+	// rootCache caches the table digests to compute the state root incrementally.
+	rootCache *stateRootCache
 }
 
 // NewState returns a new State bound to strg.
@@ -53,6 +57,8 @@ func NewState(nodeID proto.NodeID, strg xi.Storage) (s *State, err error) {
 		strg:   strg,
 		pool:   newPool(),
 		maxTx:  100,
+
+		rootCache: newStateRootCache(),
 	}
 	if t.unc, err = t.strg.Writer().Begin(); err != nil {
 		return
@@ -224,6 +230,7 @@ func (s *State) readTx(
 		cnames, ctypes []string
 		data           [][]interface{}
 		querier        sqlQuerier
+		cost           types.QueryCost
 	)
 	if atomic.LoadUint32(&s.hasSchemaChange) == 1 {
 		// lock transaction
@@ -251,12 +258,16 @@ func (s *State) readTx(
 	}()
 
 	for i, v := range req.Payload.Queries {
+		var steps = vmSteps(querier)
 		if cnames, ctypes, data, ierr = readSingle(ctx, querier, &v); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
 			return
 		}
+		cost.Steps += vmSteps(querier) - steps
+		cost.InputBytes += inputSize(&v)
+		cost.ResultBytes += resultSize(data)
 	}
 	// Build query response
 	ref = &QueryTracker{Req: req}
@@ -268,6 +279,7 @@ func (s *State) readTx(
 				Timestamp: s.getLocalTime(),
 				RowCount:  uint64(len(data)),
 				LogOffset: id,
+				Cost:      cost,
 			},
 		},
 		Payload: types.ResponsePayload{
@@ -280,7 +292,7 @@ func (s *State) readTx(
 }
 
 func (s *State) writeSingle(
-	ctx context.Context, q *types.Query) (res sql.Result, err error,
+	ctx context.Context, q *types.Query) (res sql.Result, cost types.QueryCost, err error,
 ) {
 	var (
 		containsDDL bool
@@ -306,7 +318,14 @@ func (s *State) writeSingle(
 		return
 	}
 	//parsed = time.Since(start)
-	if res, err = s.unc.Exec(pattern, args...); err == nil {
+	var steps = vmSteps(s.unc)
+	res, err = s.unc.Exec(pattern, args...)
+	cost.Steps = vmSteps(s.unc) - steps
+	cost.InputBytes = inputSize(q)
+	// mark even if failed, statements before the failed one may take effect
+	s.rootCache.markWritten(q.Pattern, containsDDL)
+	s.rootCache.trackChanges(s.unc)
+	if err == nil {
 		if containsDDL {
 			atomic.StoreUint32(&s.hasSchemaChange, 1)
 		}
@@ -325,6 +344,7 @@ func (s *State) write(
 		totalAffectedRows int64
 		curAffectedRows   int64
 		lastInsertID      int64
+		totalCost         types.QueryCost
 		start             = time.Now()
 
 		lockAcquired, writeDone, enqueued, lockReleased, respBuilt time.Duration
@@ -373,8 +393,11 @@ func (s *State) write(
 			defer s.unc.Exec(`ROLLBACK TO "?"`, lastSeq)
 		}
 		for i, v := range req.Payload.Queries {
-			var res sql.Result
-			if res, ierr = s.writeSingle(ctx, &v); ierr != nil {
+			var (
+				res  sql.Result
+				cost types.QueryCost
+			)
+			if res, cost, ierr = s.writeSingle(ctx, &v); ierr != nil {
 				err = errors.Wrapf(ierr, "execute at #%d failed", i)
 				// TODO(leventeliu): request may actually be partial successed without
 				// rolling back.
@@ -385,6 +408,7 @@ func (s *State) write(
 			curAffectedRows, _ = res.RowsAffected()
 			lastInsertID, _ = res.LastInsertId()
 			totalAffectedRows += curAffectedRows
+			totalCost.Add(&cost)
 		}
 		if qcnt > 1 {
 			// Release savepoint
@@ -417,6 +441,7 @@ func (s *State) write(
 				LogOffset:    lastSeq,
 				AffectedRows: totalAffectedRows,
 				LastInsertID: lastInsertID,
+				Cost:         totalCost,
 			},
 		},
 	}
@@ -429,6 +454,7 @@ func (s *State) replay(ctx context.Context, req *types.Request, resp *types.Resp
 		ierr    error
 		lastSeq uint64
 		query   = &QueryTracker{Req: req, Resp: resp}
+		cost    types.QueryCost
 	)
 	s.Lock()
 	defer s.Unlock()
@@ -441,10 +467,15 @@ func (s *State) replay(ctx context.Context, req *types.Request, resp *types.Resp
 		return
 	}
 	for i, v := range req.Payload.Queries {
-		if _, ierr = s.writeSingle(ctx, &v); ierr != nil {
+		var qcost types.QueryCost
+		if _, qcost, ierr = s.writeSingle(ctx, &v); ierr != nil {
 			err = errors.Wrapf(ierr, "execute at #%d failed", i)
 			return
 		}
+		cost.Add(&qcost)
+	}
+	if err = verifyCost(&resp.Header.ResponseHeader, &cost); err != nil {
+		return
 	}
 	// Try to commit if the ongoing tx is too large or schema is changed
 	if s.getSeq()-s.getLastCommitPoint() > s.maxTx ||
@@ -464,16 +495,24 @@ func (s *State) ReplayBlock(block *types.Block) (err error) {
 // ReplayBlockWithContext replays the queries from block with context. It also checks and
 // skips some preceding pooled queries.
 func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.replayBlock(ctx, block)
+}
+
+func (s *State) replayBlock(ctx context.Context, block *types.Block) (err error) {
 	var (
 		ierr   error
 		lastsp uint64 // Last lastSeq
 	)
-	s.Lock()
-	defer s.Unlock()
 	for i, q := range block.QueryTxs {
 		if q.Request.Header.QueryType == types.ReadQuery {
 			continue
 		}
+		// Skip query already included in the restored snapshot
+		if q.Response.ResponseHeader.LogOffset < atomic.LoadUint64(&s.snapshotSeq) {
+			continue
+		}
 		var query = &QueryTracker{Req: q.Request, Resp: &types.Response{Header: *q.Response}}
 		lastsp = s.getSeq()
 		if q.Response.ResponseHeader.LogOffset > lastsp {
@@ -489,15 +528,22 @@ func (s *State) ReplayBlockWithContext(ctx context.Context, block *types.Block)
 			continue
 		}
 		// Replay query
+		var cost types.QueryCost
 		for j, v := range q.Request.Payload.Queries {
 			if q.Request.Header.QueryType != types.WriteQuery {
 				err = errors.Wrapf(ErrInvalidRequest, "replay block at %d:%d", i, j)
 				return
 			}
-			if _, ierr = s.writeSingle(ctx, &v); ierr != nil {
+			var qcost types.QueryCost
+			if _, qcost, ierr = s.writeSingle(ctx, &v); ierr != nil {
 				err = errors.Wrapf(ierr, "execute at %d:%d failed", i, j)
 				return
 			}
+			cost.Add(&qcost)
+		}
+		if err = verifyCost(&q.Response.ResponseHeader, &cost); err != nil {
+			err = errors.Wrapf(err, "replay block at %d", i)
+			return
 		}
 		s.pool.enqueue(lastsp, query)
 	}
@@ -625,6 +671,7 @@ func (s *State) uncRollback() (err error) {
 	if err = s.unc.Rollback(); err != nil {
 		return
 	}
+	s.rootCache.markAll()
 	// reset schema change flag
 	atomic.StoreUint32(&s.hasSchemaChange, 0)
 	return
@@ -682,6 +729,27 @@ func (s *State) ReplayWithContext(
 	return
 }
 
+// WriteLogs returns the pooled write logs with log offsets not less than offset in the log order.
+// It stops at the first query which is not responded yet, so that the returned logs are always
+// continuous.
+func (s *State) WriteLogs(offset uint64) (logs []*types.QueryAsTx) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, v := range s.pool.queries {
+		v.RLock()
+		var req, resp = v.Req, v.Resp
+		v.RUnlock()
+		if resp == nil {
+			break
+		}
+		if resp.Header.LogOffset < offset {
+			continue
+		}
+		logs = append(logs, &types.QueryAsTx{Request: req, Response: &resp.Header})
+	}
+	return
+}
+
 // Stat prints the statistic message of the State object.
 func (s *State) Stat(id proto.DatabaseID) {
 	var (
@@ -363,6 +363,71 @@ INSERT INTO t1 (k, v) VALUES (?, ?)`, concat(values[2:4])...),
 					So(resp1.Payload, ShouldResemble, resp2.Payload)
 				}
 			})
+			Convey("The query cost should be recorded and verified while replaying", func() {
+				var wreq = buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[0]...),
+				})
+				_, resp, err = st1.Query(wreq)
+				So(err, ShouldBeNil)
+				So(resp.Header.Cost.InputBytes, ShouldBeGreaterThan, 0)
+				So(resp.Header.Cost.ResultBytes, ShouldEqual, 0)
+				// the steps may differ with the sqlite build, the recorded ones are trusted
+				var tampered = *resp
+				tampered.Header.Cost.Steps++
+				err = st2.Replay(wreq, &tampered)
+				So(err, ShouldBeNil)
+				wreq = buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[1]...),
+				})
+				_, resp, err = st1.Query(wreq)
+				So(err, ShouldBeNil)
+				tampered = *resp
+				tampered.Header.Cost.InputBytes++
+				err = st2.Replay(wreq, &tampered)
+				So(errors.Cause(err), ShouldEqual, ErrCostMismatch)
+
+				_, resp, err = st1.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT v FROM t1 WHERE k=?`, values[0][0]),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Cost.ResultBytes, ShouldEqual, len(values[0][1].([]byte)))
+
+				// the steps are counted in a coarse granularity
+				_, resp, err = st1.Query(buildRequest(types.ReadQuery, []types.Query{
+					buildQuery(`SELECT COUNT(*) FROM t1 a, t1 b, sqlite_master c, sqlite_master d,
+sqlite_master e, sqlite_master f`),
+				}))
+				So(err, ShouldBeNil)
+				So(resp.Header.Cost.Steps, ShouldBeGreaterThan, 0)
+			})
+			Convey("The write logs should be continuous and replayable in another instance", func() {
+				_, _, err = st1.CommitEx()
+				So(err, ShouldBeNil)
+				So(st1.WriteLogs(0), ShouldBeEmpty)
+				var qts = make([]*QueryTracker, len(values))
+				for i := range values {
+					qts[i], resp, err = st1.Query(buildRequest(types.WriteQuery, []types.Query{
+						buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, values[i]...),
+					}))
+					So(err, ShouldBeNil)
+					if i != 2 {
+						qts[i].UpdateResp(resp)
+					}
+				}
+				// Logs after a pending query are held back
+				var logs = st1.WriteLogs(0)
+				So(logs, ShouldHaveLength, 2)
+				So(logs[0].Response.LogOffset, ShouldEqual, 1)
+				So(logs[1].Response.LogOffset, ShouldEqual, 2)
+				So(st1.WriteLogs(2), ShouldHaveLength, 1)
+				for _, v := range logs {
+					err = st2.Replay(v.Request, &types.Response{Header: *v.Response})
+					So(err, ShouldBeNil)
+				}
+				// Replaying an applied log reports conflict
+				err = st2.Replay(logs[0].Request, &types.Response{Header: *logs[0].Response})
+				So(errors.Cause(err), ShouldEqual, ErrQueryConflict)
+			})
 			Convey("When queries are committed to blocks on state instance #1", func() {
 				var (
 					qt   *QueryTracker
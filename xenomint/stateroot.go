@@ -0,0 +1,545 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/merkle"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	"github.com/CovenantSQL/sqlparser"
+	"github.com/pkg/errors"
+)
+
+const changesQuery = "SELECT " + xs.ChangesFunc + "()"
+
+// stateRootCache caches the table digests to compute the state root incrementally.
+//
+// The row hashes of a table are kept by rowid if the row changes of the table are tracked by the
+// storage, see xs.ChangesFunc, and only the changed rows are read to update the table digest. The
+// other written tables are rescanned, as well as the tables written by a statement which bypasses
+// the row change tracking.
+type stateRootCache struct {
+	// tables maps the lower-cased table name to its digest.
+	tables map[string]*TableDigest
+	// rows maps the lower-cased table name to its row hashes by rowid, for the tracked tables.
+	rows map[string]map[int64]hash.Hash
+	// dirty records the lower-cased names of the written tables.
+	dirty map[string]struct{}
+	// rescan records the lower-cased names of the tables to be rescanned though tracked.
+	rescan map[string]struct{}
+	// changed records the rowids of the changed rows by lower-cased table name.
+	changed map[string]map[int64]struct{}
+	// updated records the lower-cased names of the updated columns by lower-cased table name.
+	updated map[string]map[string]struct{}
+	// all indicates that all the tables should be rescanned.
+	all bool
+	// schema caches the tables of the state, which is reloaded on next computing if nil.
+	schema *stateSchema
+}
+
+// stateSchema defines the tables of the state, which only changes on DDL.
+type stateSchema struct {
+	names, stmts []string
+	// orders are the ORDER BY clauses which scan the tables in a deterministic order: by rowid, or
+	// by primary key for the WITHOUT ROWID tables.
+	orders []string
+	// tracked indicates whether the row changes of the tables are tracked by rowid, which is false
+	// for the WITHOUT ROWID tables, the tables with a column named rowid, or with any REPLACE
+	// conflict clause.
+	tracked []bool
+	// aliases are the lower-cased names of the INTEGER PRIMARY KEY columns, which are the aliases
+	// of the rowid, or empty if none.
+	aliases []string
+	// cascading records the lower-cased names of the tables on which a write may change other
+	// tables, i.e., the tables with triggers or referenced by foreign keys.
+	cascading map[string]struct{}
+	// triggered records the lower-cased names of the tables with triggers, of which the writes
+	// may bypass the row change tracking.
+	triggered map[string]struct{}
+	// referencing records the lower-cased names of the tables with foreign keys, which may be
+	// changed by the foreign key actions, including the rowid changes not tracked.
+	referencing map[string]struct{}
+}
+
+func newStateRootCache() *stateRootCache {
+	return &stateRootCache{
+		tables:  make(map[string]*TableDigest),
+		rows:    make(map[string]map[int64]hash.Hash),
+		dirty:   make(map[string]struct{}),
+		rescan:  make(map[string]struct{}),
+		changed: make(map[string]map[int64]struct{}),
+		updated: make(map[string]map[string]struct{}),
+		all:     true,
+	}
+}
+
+// markAll marks all the tables, and also invalidates the cached schema as a DDL may be executed.
+func (c *stateRootCache) markAll() {
+	c.all = true
+	c.schema = nil
+}
+
+func (c *stateRootCache) mark(table string) {
+	c.dirty[strings.ToLower(table)] = struct{}{}
+}
+
+// markRescan marks the table written by a statement which bypasses the row change tracking.
+func (c *stateRootCache) markRescan(table string) {
+	c.mark(table)
+	c.rescan[strings.ToLower(table)] = struct{}{}
+}
+
+// markTableExprs marks the tables in exprs and returns their names, ok is false if any table can
+// not be resolved.
+func (c *stateRootCache) markTableExprs(
+	exprs sqlparser.TableExprs, rescan bool) (names []string, ok bool,
+) {
+	for _, v := range exprs {
+		var ate *sqlparser.AliasedTableExpr
+		if ate, ok = v.(*sqlparser.AliasedTableExpr); !ok {
+			return
+		}
+		var tn sqlparser.TableName
+		if tn, ok = ate.Expr.(sqlparser.TableName); !ok {
+			return
+		}
+		if rescan {
+			c.markRescan(tn.Name.String())
+		} else {
+			c.mark(tn.Name.String())
+		}
+		names = append(names, tn.Name.String())
+	}
+	ok = true
+	return
+}
+
+// markUpdated records the updated columns of the tables.
+func (c *stateRootCache) markUpdated(tables []string, exprs sqlparser.UpdateExprs) {
+	for _, t := range tables {
+		var key = strings.ToLower(t)
+		var cols, ok = c.updated[key]
+		if !ok {
+			cols = make(map[string]struct{})
+			c.updated[key] = cols
+		}
+		for _, v := range exprs {
+			cols[v.Name.Name.Lowered()] = struct{}{}
+		}
+	}
+}
+
+// updatesRowid reports whether the rowid of the table may be updated, in which case the old rowid
+// is not reported by the row change tracking.
+func (c *stateRootCache) updatesRowid(key, alias string) bool {
+	for k := range c.updated[key] {
+		switch k {
+		case "rowid", "oid", "_rowid_", alias:
+			return true
+		}
+	}
+	return false
+}
+
+// markWritten marks the tables written by the query pattern. Any statement not understood
+// results in marking all the tables.
+func (c *stateRootCache) markWritten(pattern string, containsDDL bool) {
+	if containsDDL {
+		c.markAll()
+		return
+	}
+	var _, statements, err = sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(pattern))
+	if err != nil {
+		c.markAll()
+		return
+	}
+	for _, v := range statements {
+		switch stmt := v.(type) {
+		case *sqlparser.Select, *sqlparser.Union, *sqlparser.Show:
+		case *sqlparser.Insert:
+			// the rows deleted by REPLACE conflict resolution are not tracked
+			if stmt.Action == sqlparser.ReplaceStr {
+				c.markRescan(stmt.Table.Name.String())
+			} else {
+				c.mark(stmt.Table.Name.String())
+			}
+		case *sqlparser.Update:
+			var tables, ok = c.markTableExprs(stmt.TableExprs, false)
+			if !ok {
+				c.markAll()
+			}
+			c.markUpdated(tables, stmt.Exprs)
+		case *sqlparser.Delete:
+			// the rows deleted by the truncate optimization are not tracked
+			var rescan = stmt.Where == nil
+			for _, t := range stmt.Targets {
+				if rescan {
+					c.markRescan(t.Name.String())
+				} else {
+					c.mark(t.Name.String())
+				}
+			}
+			if _, ok := c.markTableExprs(stmt.TableExprs, rescan); !ok {
+				c.markAll()
+			}
+		default:
+			c.markAll()
+		}
+	}
+}
+
+// stateRootLeaf returns the merkle leaf of a table, which binds the table digest to its schema.
+func stateRootLeaf(d *TableDigest, stmt string) *hash.Hash {
+	var (
+		buf = new(bytes.Buffer)
+		th  = d.Hash()
+	)
+	buf.Write(th[:])
+	writeDigestBytes(buf, []byte(stmt))
+	var h = hash.THashH(buf.Bytes())
+	return &h
+}
+
+// loadStateSchema loads the tables and finds out the cascading tables of the state.
+func loadStateSchema(ctx context.Context, tx *sql.Tx) (schema *stateSchema, err error) {
+	schema = &stateSchema{
+		cascading:   make(map[string]struct{}),
+		triggered:   make(map[string]struct{}),
+		referencing: make(map[string]struct{}),
+	}
+	if schema.names, schema.stmts, err = listTables(ctx, tx); err != nil {
+		err = errors.Wrap(err, "list tables")
+		return
+	}
+	var triggers []string
+	if triggers, err = queryStrings(
+		ctx, tx, `SELECT tbl_name FROM sqlite_master WHERE type = 'trigger'`,
+	); err != nil {
+		err = errors.Wrap(err, "list triggers")
+		return
+	}
+	for _, v := range triggers {
+		schema.cascading[strings.ToLower(v)] = struct{}{}
+		schema.triggered[strings.ToLower(v)] = struct{}{}
+	}
+	schema.orders = make([]string, len(schema.names))
+	schema.tracked = make([]bool, len(schema.names))
+	schema.aliases = make([]string, len(schema.names))
+	for i, name := range schema.names {
+		if schema.orders[i], err = tableOrder(ctx, tx, name); err != nil {
+			err = errors.Wrapf(err, "resolve scanning order of table %s", name)
+			return
+		}
+		var columns []string
+		if columns, err = queryStrings(
+			ctx, tx, `SELECT lower(name) FROM pragma_table_info(?) WHERE lower(name) = 'rowid'`, name,
+		); err != nil {
+			err = errors.Wrapf(err, "list columns of table %s", name)
+			return
+		}
+		schema.tracked[i] = schema.orders[i] == "rowid" && len(columns) == 0 &&
+			!strings.Contains(strings.ToUpper(schema.stmts[i]), "REPLACE")
+		var pks []string
+		if pks, err = queryStrings(ctx, tx, `SELECT lower(name) || ' ' || upper(type)
+FROM pragma_table_info(?) WHERE pk > 0`, name); err != nil {
+			err = errors.Wrapf(err, "list primary key of table %s", name)
+			return
+		}
+		if len(pks) == 1 && strings.HasSuffix(pks[0], " INTEGER") {
+			schema.aliases[i] = strings.TrimSuffix(pks[0], " INTEGER")
+		}
+		var parents []string
+		if parents, err = queryStrings(
+			ctx, tx, `SELECT "table" FROM pragma_foreign_key_list(?)`, name,
+		); err != nil {
+			err = errors.Wrapf(err, "list foreign keys of table %s", name)
+			return
+		}
+		if len(parents) > 0 {
+			schema.referencing[strings.ToLower(name)] = struct{}{}
+		}
+		for _, v := range parents {
+			schema.cascading[strings.ToLower(v)] = struct{}{}
+		}
+	}
+	return
+}
+
+// tableOrder returns the ORDER BY clause of the table rowid, or of the primary key if the table
+// is a WITHOUT ROWID one.
+func tableOrder(ctx context.Context, tx *sql.Tx, name string) (order string, err error) {
+	var rows *sql.Rows
+	if rows, err = tx.QueryContext(
+		ctx, "SELECT rowid FROM "+quoteIdentifier(name)+" LIMIT 0",
+	); err == nil {
+		rows.Close()
+		order = "rowid"
+		return
+	}
+	var pks []string
+	if pks, err = queryStrings(
+		ctx, tx, `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, name,
+	); err != nil {
+		return
+	}
+	if len(pks) == 0 {
+		err = errors.New("neither rowid nor primary key found")
+		return
+	}
+	for i, v := range pks {
+		pks[i] = quoteIdentifier(v)
+	}
+	order = strings.Join(pks, ", ")
+	return
+}
+
+// queryStrings returns the first column of the query result as strings.
+func queryStrings(
+	ctx context.Context, tx *sql.Tx, query string, args ...interface{},
+) (
+	values []string, err error,
+) {
+	var rows *sql.Rows
+	if rows, err = tx.QueryContext(ctx, query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	err = rows.Err()
+	return
+}
+
+// hasCascadingWrites reports whether any of the dirty tables is one of the given cascading
+// tables, of which a write may change other tables than the written one.
+func (c *stateRootCache) hasCascadingWrites(cascading map[string]struct{}) bool {
+	for k := range c.dirty {
+		if _, ok := cascading[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// trackChanges collects the rows changed since the last call from the connection behind qer. The
+// written tables are rescanned if the storage doesn't track the row changes.
+//
+// The changes are read with a background context, as a canceled query context should not result
+// in rescanning the written tables.
+func (c *stateRootCache) trackChanges(qer sqlQuerier) {
+	var (
+		b        []byte
+		changes  map[string][]int64
+		overflow bool
+		err      error
+	)
+	if err = func() (err error) {
+		var rows *sql.Rows
+		if rows, err = qer.QueryContext(context.Background(), changesQuery); err != nil {
+			return
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err = rows.Err(); err == nil {
+				err = sql.ErrNoRows
+			}
+			return
+		}
+		return rows.Scan(&b)
+	}(); err == nil {
+		changes, overflow, err = xs.DecodeChanges(b)
+	}
+	if err != nil {
+		for k := range c.dirty {
+			c.rescan[k] = struct{}{}
+		}
+		return
+	}
+	if overflow {
+		c.markAll()
+		return
+	}
+	for k, ids := range changes {
+		var m, ok = c.changed[k]
+		if !ok {
+			m = make(map[int64]struct{}, len(ids))
+			c.changed[k] = m
+		}
+		for _, id := range ids {
+			m[id] = struct{}{}
+		}
+	}
+}
+
+// computeTableRows scans the table and returns its digest along with the row hashes by rowid.
+func computeTableRows(
+	ctx context.Context, qer sqlQuerier, name string,
+) (
+	d *TableDigest, hashes map[int64]hash.Hash, err error,
+) {
+	d = &TableDigest{Name: name}
+	hashes = make(map[int64]hash.Hash)
+	var buf = new(bytes.Buffer)
+	if _, err = scanQuery(ctx, qer, func(row []interface{}) (err error) {
+		var id, ok = row[0].(int64)
+		if !ok {
+			return errors.Errorf("unexpected rowid type %T", row[0])
+		}
+		var h hash.Hash
+		if h, err = rowHash(buf, row[1:]); err != nil {
+			return
+		}
+		addHash(&d.RowSum, &h)
+		d.RowCount++
+		hashes[id] = h
+		return
+	}, "SELECT rowid, * FROM "+quoteIdentifier(name)); err != nil {
+		err = errors.Wrapf(err, "digest table %s", name)
+	}
+	return
+}
+
+// updateTableRows updates the table digest and the row hashes with the changed rows, of which
+// the previous hashes are subtracted and the current ones are added. The rows are read by rowid,
+// so the cost scales with the count of the changed rows.
+func updateTableRows(
+	ctx context.Context, qer sqlQuerier, prev *TableDigest,
+	hashes map[int64]hash.Hash, changed map[int64]struct{},
+) (
+	d *TableDigest, err error,
+) {
+	var (
+		next  = *prev
+		buf   = new(bytes.Buffer)
+		query = "SELECT * FROM " + quoteIdentifier(prev.Name) + " WHERE rowid = ?"
+	)
+	for id := range changed {
+		if h, ok := hashes[id]; ok {
+			subHash(&next.RowSum, &h)
+			next.RowCount--
+			delete(hashes, id)
+		}
+		if _, err = scanQuery(ctx, qer, func(row []interface{}) (err error) {
+			var h hash.Hash
+			if h, err = rowHash(buf, row); err != nil {
+				return
+			}
+			addHash(&next.RowSum, &h)
+			next.RowCount++
+			hashes[id] = h
+			return
+		}, query, id); err != nil {
+			err = errors.Wrapf(err, "update digest of table %s", prev.Name)
+			return
+		}
+	}
+	d = &next
+	return
+}
+
+// stateRoot computes the state root from the uncommitted transaction incrementally, which must
+// be called with the state lock held. The digest of a tracked table is updated from its changed
+// rows, and the other tables are only rescanned if written.
+func (s *State) stateRoot(ctx context.Context) (root hash.Hash, err error) {
+	var c = s.rootCache
+	defer func() {
+		if err != nil {
+			// the cached row hashes may be partially updated
+			c.markAll()
+		}
+	}()
+	if c.schema == nil {
+		if c.schema, err = loadStateSchema(ctx, s.unc); err != nil {
+			return
+		}
+	}
+	var (
+		names   = c.schema.names
+		stmts   = c.schema.stmts
+		all     = c.all || c.hasCascadingWrites(c.schema.triggered)
+		cascade = c.hasCascadingWrites(c.schema.cascading)
+	)
+
+	var (
+		tables = make(map[string]*TableDigest, len(names))
+		rows   = make(map[string]map[int64]hash.Hash, len(names))
+		leaves = make([]*hash.Hash, len(names))
+	)
+	for i, name := range names {
+		var (
+			key        = strings.ToLower(name)
+			tracked    = c.schema.tracked[i]
+			d, ok      = c.tables[key]
+			hashes, rk = c.rows[key]
+			_, dirty   = c.dirty[key]
+			_, rescan  = c.rescan[key]
+			_, child   = c.schema.referencing[key]
+		)
+		switch {
+		case all || !ok || rescan || (cascade && child) ||
+			(tracked && (!rk || c.updatesRowid(key, c.schema.aliases[i]))):
+			if tracked {
+				d, hashes, err = computeTableRows(ctx, s.unc, name)
+			} else {
+				d, err = computeTableDigest(ctx, s.unc, name)
+			}
+		case tracked:
+			if changed := c.changed[key]; len(changed) > 0 {
+				d, err = updateTableRows(ctx, s.unc, d, hashes, changed)
+			}
+		case dirty:
+			d, err = computeTableDigest(ctx, s.unc, name)
+		}
+		if err != nil {
+			return
+		}
+		tables[key] = d
+		if tracked {
+			rows[key] = hashes
+		}
+		leaves[i] = stateRootLeaf(d, stmts[i])
+	}
+	c.tables = tables
+	c.rows = rows
+	c.dirty = make(map[string]struct{})
+	c.rescan = make(map[string]struct{})
+	c.changed = make(map[string]map[int64]struct{})
+	c.updated = make(map[string]map[string]struct{})
+	c.all = false
+	root = *merkle.NewMerkle(leaves).GetRoot()
+	return
+}
+
+// StateRoot returns the state root of the current state and the state sequence it is computed
+// at.
+func (s *State) StateRoot(ctx context.Context) (root hash.Hash, seq uint64, err error) {
+	s.Lock()
+	defer s.Unlock()
+	seq = s.getSeq()
+	root, err = s.stateRoot(ctx)
+	return
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateRootCache(t *testing.T) {
+	Convey("Given a state root cache", t, func() {
+		var c = newStateRootCache()
+		So(c.all, ShouldBeTrue)
+		c.all = false
+
+		Convey("The written tables should be marked", func() {
+			c.markWritten(`INSERT INTO T1 VALUES (1); UPDATE t2 SET v = 1; DELETE FROM t3`, false)
+			So(c.all, ShouldBeFalse)
+			So(c.dirty, ShouldContainKey, "t1")
+			So(c.dirty, ShouldContainKey, "t2")
+			So(c.dirty, ShouldContainKey, "t3")
+			c.markWritten(`SELECT * FROM t4`, false)
+			So(c.all, ShouldBeFalse)
+			So(c.dirty, ShouldNotContainKey, "t4")
+		})
+		Convey("All tables should be marked on schema change or unknown statements", func() {
+			c.schema = &stateSchema{}
+			c.markWritten(`CREATE TABLE t1 (k INT)`, true)
+			So(c.all, ShouldBeTrue)
+			So(c.schema, ShouldBeNil)
+			c.all = false
+			c.markWritten(`THIS IS NOT SQL`, false)
+			So(c.all, ShouldBeTrue)
+		})
+	})
+}
+
+func TestStateRoot(t *testing.T) {
+	Convey("Given a chain state object", t, func() {
+		var (
+			ctx    = context.Background()
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			fl     = path.Join(testingDataDir, t.Name())
+			st     *State
+			write  = func(qs ...types.Query) {
+				ref, resp, err := st.Query(buildRequest(types.WriteQuery, qs))
+				So(err, ShouldBeNil)
+				ref.UpdateResp(resp)
+			}
+			check = func() (root hash.Hash) {
+				root, _, err := st.StateRoot(ctx)
+				So(err, ShouldBeNil)
+				full, _, err := st.Digest(ctx)
+				So(err, ShouldBeNil)
+				So(root, ShouldResemble, full)
+				return
+			}
+		)
+		strg, err := xs.NewSqlite(fmt.Sprint("file:", fl, "?_foreign_keys=1"))
+		So(err, ShouldBeNil)
+		st, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			for _, v := range []string{"", "-shm", "-wal"} {
+				err = os.Remove(fl + v)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+
+		Convey("The incremental state root should match the fully recomputed one", func() {
+			r0 := check()
+			write(buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+				buildQuery(`CREATE TABLE t2 (k INT)`))
+			r1 := check()
+			So(r1, ShouldNotResemble, r0)
+			write(buildQuery(`INSERT INTO t1 VALUES (?, ?)`, 1, "v1"))
+			r2 := check()
+			So(r2, ShouldNotResemble, r1)
+			write(buildQuery(`INSERT INTO t2 VALUES (?)`, 1))
+			r3 := check()
+			So(r3, ShouldNotResemble, r2)
+			_, _, err = st.CommitEx()
+			So(err, ShouldBeNil)
+			write(buildQuery(`UPDATE t1 SET v = ? WHERE k = ?`, "vx", 1))
+			So(check(), ShouldNotResemble, r3)
+			write(buildQuery(`UPDATE t1 SET v = ? WHERE k = ?`, "v1", 1))
+			So(check(), ShouldResemble, r3)
+			write(buildQuery(`DELETE FROM t2`))
+			So(check(), ShouldResemble, r2)
+		})
+		Convey("The state root should be updated from the changed rows", func() {
+			write(buildQuery(`CREATE TABLE t1 (k INTEGER PRIMARY KEY, v TEXT, u INT UNIQUE)`),
+				buildQuery(`CREATE TABLE t2 (k TEXT, v INT, PRIMARY KEY(k)) WITHOUT ROWID`),
+				buildQuery(`CREATE TABLE t3 (rowid TEXT, v INT)`),
+				buildQuery(`CREATE TABLE t4 (k INT UNIQUE ON CONFLICT REPLACE, v INT)`))
+			for i := 0; i < 10; i++ {
+				write(buildQuery(`INSERT INTO t1 VALUES (?, ?, ?)`, i, fmt.Sprint("v", i), i),
+					buildQuery(`INSERT INTO t2 VALUES (?, ?)`, fmt.Sprint("k", i), i),
+					buildQuery(`INSERT INTO t3 VALUES (?, ?)`, fmt.Sprint("r", i), i),
+					buildQuery(`INSERT INTO t4 VALUES (?, ?)`, i, i))
+			}
+			r0 := check()
+			So(st.rootCache.schema.tracked, ShouldResemble, []bool{true, false, false, false})
+			So(st.rootCache.rows, ShouldContainKey, "t1")
+			So(st.rootCache.rows["t1"], ShouldHaveLength, 10)
+
+			write(buildQuery(`UPDATE t1 SET v = ? WHERE k = ?`, "vx", 1))
+			So(st.rootCache.changed["t1"], ShouldHaveLength, 1)
+			So(st.rootCache.rescan, ShouldBeEmpty)
+			check()
+			// the rowid changes
+			write(buildQuery(`UPDATE t1 SET k = ? WHERE k = ?`, 100, 2))
+			check()
+			write(buildQuery(`INSERT OR REPLACE INTO t1 VALUES (?, ?, ?)`, 200, "v3", 3))
+			So(st.rootCache.rescan, ShouldContainKey, "t1")
+			check()
+			write(buildQuery(`DELETE FROM t1 WHERE k > ?`, 7))
+			check()
+			for _, v := range []string{"t2", "t3", "t4"} {
+				write(buildQuery(fmt.Sprintf(`UPDATE %s SET v = v + 1`, v)))
+				check()
+			}
+			write(buildQuery(`INSERT INTO t4 VALUES (?, ?)`, 1, 100))
+			check()
+			write(buildQuery(`DELETE FROM t1`))
+			So(st.rootCache.rescan, ShouldContainKey, "t1")
+			check()
+			So(st.rootCache.rows["t1"], ShouldBeEmpty)
+			So(check(), ShouldNotResemble, r0)
+		})
+		Convey("The state root should track cascading writes", func() {
+			write(buildQuery(`CREATE TABLE t1 (k INT, PRIMARY KEY(k))`),
+				buildQuery(`CREATE TABLE t2 (k INT REFERENCES t1(k) ON DELETE CASCADE)`))
+			write(buildQuery(`INSERT INTO t1 VALUES (?)`, 1),
+				buildQuery(`INSERT INTO t2 VALUES (?)`, 1))
+			check()
+			So(st.rootCache.all, ShouldBeFalse)
+			schema := st.rootCache.schema
+			So(schema.cascading, ShouldContainKey, "t1")
+			So(schema.cascading, ShouldNotContainKey, "t2")
+			write(buildQuery(`DELETE FROM t1`))
+			check()
+
+			// the schema is cached until next DDL
+			write(buildQuery(`INSERT INTO t1 VALUES (?)`, 2),
+				buildQuery(`INSERT INTO t2 VALUES (?)`, 2))
+			check()
+			So(st.rootCache.schema, ShouldEqual, schema)
+			// the rowid of t4 is changed by the foreign key action
+			write(buildQuery(`CREATE TABLE t4 (k INTEGER PRIMARY KEY REFERENCES t1(k)
+ON UPDATE CASCADE)`))
+			write(buildQuery(`INSERT INTO t1 VALUES (?)`, 4),
+				buildQuery(`INSERT INTO t4 VALUES (?)`, 4))
+			check()
+			schema = st.rootCache.schema
+			So(schema.referencing, ShouldContainKey, "t4")
+			write(buildQuery(`UPDATE t1 SET k = ? WHERE k = ?`, 5, 4))
+			check()
+			So(st.rootCache.rows["t4"], ShouldContainKey, int64(5))
+			So(st.rootCache.rows["t4"], ShouldNotContainKey, int64(4))
+			// triggers are not supported by the query parser, create it directly
+			write(buildQuery(`CREATE TABLE t3 (k INT)`))
+			check()
+			trigger := `CREATE TRIGGER t3_insert AFTER INSERT ON t3 BEGIN
+INSERT INTO t2 VALUES (NEW.k); END`
+			_, err = st.unc.Exec(trigger)
+			So(err, ShouldBeNil)
+			st.rootCache.markWritten(trigger, true)
+			check()
+			So(st.rootCache.schema, ShouldNotEqual, schema)
+			So(st.rootCache.schema.cascading, ShouldContainKey, "t3")
+			write(buildQuery(`INSERT INTO t1 VALUES (?)`, 3),
+				buildQuery(`INSERT INTO t3 VALUES (?)`, 3))
+			check()
+		})
+	})
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
+)
+
+// StorageProofSamples is the number of rows sampled by a storage challenge.
+//
+// Rows instead of sqlite pages are sampled, because the page layout of replicas may differ
+// while the row contents are the same. The rows are sampled in rowid order, or in primary key
+// order for the WITHOUT ROWID tables, which does not depend on the query plan.
+const StorageProofSamples = 4
+
+// StorageSample is a row selected by storage challenge.
+type StorageSample struct {
+	Table string
+	// Offset is the row offset in rowid or primary key order, -1 for an empty table.
+	Offset int64
+}
+
+// StorageChallenge returns the rows selected by the challenge seed from the tables.
+func StorageChallenge(seed hash.Hash, tables []string, counts []int64) (samples []StorageSample) {
+	if len(tables) == 0 {
+		return
+	}
+	samples = make([]StorageSample, StorageProofSamples)
+	for i := range samples {
+		var (
+			h = hash.THashH(append(seed[:], byte(i)))
+			t = binary.BigEndian.Uint64(h[:8]) % uint64(len(tables))
+		)
+		samples[i].Table = tables[t]
+		samples[i].Offset = -1
+		if counts[t] > 0 {
+			samples[i].Offset = int64(binary.BigEndian.Uint64(h[8:16]) % uint64(counts[t]))
+		}
+	}
+	return
+}
+
+func readRowAt(
+	ctx context.Context, tx *sql.Tx, table, order string, offset int64) (row []interface{}, err error,
+) {
+	var (
+		rows *sql.Rows
+		cols []string
+	)
+	if rows, err = tx.QueryContext(ctx, "SELECT * FROM "+quoteIdentifier(table)+
+		" ORDER BY "+order+" LIMIT 1 OFFSET ?", offset,
+	); err != nil {
+		return
+	}
+	defer rows.Close()
+	if cols, err = rows.Columns(); err != nil {
+		return
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = errors.Errorf("row %d not found", offset)
+		}
+		return
+	}
+	var dest = make([]interface{}, len(cols))
+	row = make([]interface{}, len(cols))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	err = rows.Scan(dest...)
+	return
+}
+
+// storageProof answers the storage challenge with the sampled rows bound to the prover node id,
+// which must be called with the state lock held.
+//
+// The row counts are taken from the table digests of the state root cache, which is brought up to
+// date first, so that the tables are not counted on each block.
+func (s *State) storageProof(
+	ctx context.Context, seed hash.Hash, prover proto.NodeID) (answer hash.Hash, err error,
+) {
+	if _, err = s.stateRoot(ctx); err != nil {
+		return
+	}
+	var (
+		c      = s.rootCache
+		tables = c.schema.names
+		counts = make([]int64, len(tables))
+		orders = make(map[string]string, len(tables))
+	)
+	for i, v := range tables {
+		counts[i] = int64(c.tables[strings.ToLower(v)].RowCount)
+		orders[v] = c.schema.orders[i]
+	}
+
+	var buf = new(bytes.Buffer)
+	writeDigestBytes(buf, []byte(prover))
+	buf.Write(seed[:])
+	for _, v := range StorageChallenge(seed, tables, counts) {
+		writeDigestBytes(buf, []byte(v.Table))
+		if v.Offset < 0 {
+			continue
+		}
+		var row []interface{}
+		if row, err = readRowAt(ctx, s.unc, v.Table, orders[v.Table], v.Offset); err != nil {
+			err = errors.Wrapf(err, "read table %s", v.Table)
+			return
+		}
+		for _, c := range row {
+			if err = writeDigestValue(buf, c); err != nil {
+				return
+			}
+		}
+	}
+	answer = hash.THashH(buf.Bytes())
+	return
+}
+
+// StorageProof answers the storage challenge on the current state for the prover node.
+func (s *State) StorageProof(
+	ctx context.Context, seed hash.Hash, prover proto.NodeID) (answer hash.Hash, seq uint64, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	seq = s.getSeq()
+	answer, err = s.storageProof(ctx, seed, prover)
+	return
+}